@@ -3,11 +3,13 @@ package main
 import (
 	"log"
 	"net/http"
-	"os"
 
+	"example.com/myapp/internal/auth"
 	"example.com/myapp/internal/config"
 	"example.com/myapp/internal/database"
+	"example.com/myapp/internal/email"
 	"example.com/myapp/internal/handlers"
+	"example.com/myapp/internal/storage"
 	"example.com/myapp/internal/template"
 )
 
@@ -24,64 +26,137 @@ func main() {
 
 	tpl := template.Load("web/templates")
 
-	h := handlers.New(db, tpl, cfg)
+	// Uploaded files live on local disk (UPLOAD_DIR) or in an S3 bucket
+	store, err := storage.Open(cfg)
+	if err != nil {
+		log.Fatal("Failed to open upload storage:", err)
+	}
+
+	mailer := email.NewMailer(email.Config{
+		Host:     cfg.SMTPHost,
+		Port:     email.ParsePort(cfg.SMTPPort),
+		Username: cfg.SMTPUsername,
+		Password: cfg.SMTPPassword,
+		From:     cfg.SMTPFrom,
+	})
+
+	h := handlers.New(db, tpl, cfg, store, mailer)
+	h.PruneSnapshots()
 
 	mux := http.NewServeMux()
 	// public
 	mux.HandleFunc("/signup", h.Signup)
 	mux.HandleFunc("/login", h.Login)
-
-	// 1. Determine where uploaded files live
-	// Default to local folder for development
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "./web/static/uploads"
-	}
-	// Ensure the directory exists
-	os.MkdirAll(uploadDir, 0755)
+	mux.HandleFunc("/password/forgot", h.ForgotPassword)
+	mux.HandleFunc("/password/reset", h.ResetPassword)
+	mux.HandleFunc("/verify", h.VerifyEmail)
 
 	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("./web/static"))))
+	// The default upload directory is inside web/static; uploads only go out
+	// through /uploads/, which sets safe headers
+	mux.Handle("/static/uploads/", http.NotFoundHandler())
 
-	mux.Handle("/uploads/", http.StripPrefix("/uploads/", http.FileServer(http.Dir(uploadDir))))
+	mux.HandleFunc("/uploads/", h.ServeUpload)
 
 	// protected
 	mux.HandleFunc("/", h.RequireLogin(h.Home))
 	mux.HandleFunc("/logout", h.RequireLogin(h.Logout))
+	mux.HandleFunc("/logout/all", h.RequireLogin(h.LogoutAll))
 
 	mux.HandleFunc("/lesson", h.RequireLogin(h.StudentLessonList))
 
 	mux.HandleFunc("/application", h.RequireLogin(h.StudentApplication))
 
+	mux.HandleFunc("/cancel", h.RequireLogin(h.StudentCancel))
 
-	protectAdmin := func(next http.HandlerFunc) http.HandlerFunc {
-		return h.RequireLogin(h.RequireAdmin(next))
+	mux.HandleFunc("/verify/resend", h.RequireLogin(h.ResendVerification))
+
+
+	// staff routes: each one names the permission it needs (see auth.rolePermissions)
+	staff := func(perm auth.Permission, next http.HandlerFunc) http.HandlerFunc {
+		return h.RequireLogin(h.RequirePermission(perm, next))
 	}
 
 
-	mux.HandleFunc("/admin", protectAdmin(h.AdminPage))
+	mux.HandleFunc("/admin", staff(auth.PermAdminHome, h.AdminPage))
+
+	mux.HandleFunc("/admin/config", staff(auth.PermManageSettings, h.AdminConfig))
+
+	mux.HandleFunc("/admin/days", staff(auth.PermManageSettings, h.AdminEventDays))
 
-	mux.HandleFunc("/admin/config", protectAdmin(h.AdminConfig))
+	mux.HandleFunc("/admin/days/add", staff(auth.PermManageSettings, h.AdminAddEventDay))
 
-	mux.HandleFunc("/admin/classes/new", protectAdmin(h.AdminCreateClass))
+	mux.HandleFunc("/admin/days/edit", staff(auth.PermManageSettings, h.AdminEditEventDay))
+
+	mux.HandleFunc("/admin/days/delete", staff(auth.PermManageSettings, h.AdminDeleteEventDay))
+
+	mux.HandleFunc("/admin/classes/new", staff(auth.PermManageClasses, h.AdminCreateClass))
 
 	// 1. View Detail Page
-	mux.HandleFunc("/admin/classes/detail", protectAdmin(h.AdminClassDetail))
+	mux.HandleFunc("/admin/classes/detail", staff(auth.PermViewClasses, h.AdminClassDetail))
 
 	// 2. Action: Add Session
 
-	mux.HandleFunc("/admin/sessions/add", protectAdmin(h.AdminAddSession))
+	mux.HandleFunc("/admin/sessions/add", staff(auth.PermManageClasses, h.AdminAddSession))
+
+	mux.HandleFunc("/admin/classes/edit", staff(auth.PermManageClasses, h.AdminEditClass))
+
+	mux.HandleFunc("/admin/classes/delete", staff(auth.PermManageClasses, h.AdminDeleteClass))
+
+	mux.HandleFunc("/admin/sessions/edit", staff(auth.PermManageClasses, h.AdminEditSession))
+
+	mux.HandleFunc("/admin/sessions/delete", staff(auth.PermManageClasses, h.AdminDeleteSession))
+
+	mux.HandleFunc("/admin/classes", staff(auth.PermViewClasses, h.AdminClassList))
+
+	mux.HandleFunc("/admin/data", staff(auth.PermViewParticipants, h.AdminDataPage))
+
+	mux.HandleFunc("/admin/data/download", staff(auth.PermViewParticipants, h.AdminDownloadCSV))
+
+	mux.HandleFunc("/admin/data/download/classes", staff(auth.PermViewParticipants, h.AdminDownloadClasses))
+
+	mux.HandleFunc("/admin/reset", staff(auth.PermResetSystem, h.AdminResetPage))
+
+	mux.HandleFunc("/admin/reset/execute", staff(auth.PermResetSystem, h.AdminResetExecute))
+
+	mux.HandleFunc("/admin/backups", staff(auth.PermResetSystem, h.AdminBackups))
+
+	mux.HandleFunc("/admin/backups/create", staff(auth.PermResetSystem, h.AdminCreateBackup))
+
+	mux.HandleFunc("/admin/backups/download", staff(auth.PermResetSystem, h.AdminDownloadBackup))
+
+	mux.HandleFunc("/admin/backups/restore", staff(auth.PermResetSystem, h.AdminRestoreBackup))
+
+	mux.HandleFunc("/admin/editions", staff(auth.PermManageSettings, h.AdminEditions))
+
+	mux.HandleFunc("/admin/editions/rollover", staff(auth.PermManageSettings, h.AdminRolloverEdition))
+
+	mux.HandleFunc("/admin/editions/anonymize", staff(auth.PermManageSettings, h.AdminAnonymizeEdition))
+
+	mux.HandleFunc("/admin/editions/retention", staff(auth.PermManageSettings, h.AdminRetention))
+
+	mux.HandleFunc("/admin/users", staff(auth.PermManageUsers, h.AdminUserList))
+
+	mux.HandleFunc("/admin/users/verify", staff(auth.PermManageUsers, h.AdminVerifyUser))
+
+	mux.HandleFunc("/admin/users/sessions/revoke", staff(auth.PermManageUsers, h.AdminRevokeSessions))
+
+	mux.HandleFunc("/admin/users/unlock", staff(auth.PermManageUsers, h.AdminUnlockUser))
+
+	mux.HandleFunc("/admin/users/role", staff(auth.PermAssignRoles, h.AdminAssignRole))
 
-	mux.HandleFunc("/admin/classes", protectAdmin(h.AdminClassList))
+	mux.HandleFunc("/admin/audit", staff(auth.PermViewAudit, h.AdminAuditLog))
 
-	mux.HandleFunc("/admin/data", protectAdmin(h.AdminDataPage))
+	mux.HandleFunc("/admin/audit/download", staff(auth.PermViewAudit, h.AdminAuditDownload))
 
-	mux.HandleFunc("/admin/data/download", protectAdmin(h.AdminDownloadCSV))
+	// instructor portal
+	mux.HandleFunc("/instructor", staff(auth.PermInstructorPortal, h.InstructorHome))
 
-	mux.HandleFunc("/admin/data/download/classes", protectAdmin(h.AdminDownloadClasses))
+	mux.HandleFunc("/instructor/roster", staff(auth.PermInstructorPortal, h.InstructorRoster))
 
-	mux.HandleFunc("/admin/reset", protectAdmin(h.AdminResetPage))
+	mux.HandleFunc("/instructor/roster/download", staff(auth.PermInstructorPortal, h.InstructorRosterDownload))
 
-	mux.HandleFunc("/admin/reset/execute", protectAdmin(h.AdminResetExecute))
+	mux.HandleFunc("/instructor/classes/edit", staff(auth.PermInstructorPortal, h.InstructorEditClass))
 
 
 	addr := cfg.ListenAddr
@@ -90,7 +165,7 @@ func main() {
 	}
 
 	log.Printf("listening on %s", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if err := http.ListenAndServe(addr, h.CSRF(mux)); err != nil {
 		log.Fatalf("server: %v", err)
 	}
 }
@@ -6,10 +6,38 @@ CREATE TABLE IF NOT EXISTS users (
     email VARCHAR(255) NOT NULL UNIQUE,
     -- MATCHING YOUR GO CODE HERE:
     password_hash VARCHAR(255) NOT NULL, 
-    is_admin BOOLEAN DEFAULT FALSE,
+    -- super_admin, class_manager, reception, viewer, instructor or student (see auth.Role)
+    role VARCHAR(20) NOT NULL DEFAULT 'student'
+        CHECK (role IN ('super_admin', 'class_manager', 'reception', 'viewer', 'instructor', 'student')),
+    email_verified_at TIMESTAMPTZ, -- NULL until the signup link is clicked
+    anonymized_at TIMESTAMPTZ, -- set when the retention period ran out (see event_editions)
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
 
+-- Upgrades. CREATE TABLE IF NOT EXISTS leaves an existing table as it is, so
+-- columns added since the first release are also added here; rerunning this
+-- file on an older database (psql -f init.sql) brings it up to date.
+DO $$
+BEGIN
+    -- is_admin became role: former admins keep every permission
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'is_admin') THEN
+        ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'student'
+            CHECK (role IN ('super_admin', 'class_manager', 'reception', 'viewer', 'instructor', 'student'));
+        UPDATE users SET role = 'super_admin' WHERE is_admin;
+        ALTER TABLE users DROP COLUMN is_admin;
+    END IF;
+    -- Accounts from before email verification aren't asked to verify
+    IF NOT EXISTS (SELECT 1 FROM information_schema.columns
+                   WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'email_verified_at') THEN
+        ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+        UPDATE users SET email_verified_at = COALESCE(created_at, NOW());
+    END IF;
+END $$;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role VARCHAR(20) NOT NULL DEFAULT 'student'
+    CHECK (role IN ('super_admin', 'class_manager', 'reception', 'viewer', 'instructor', 'student'));
+ALTER TABLE users ADD COLUMN IF NOT EXISTS anonymized_at TIMESTAMPTZ;
+
 CREATE TABLE IF NOT EXISTS user_profiles (
     id SERIAL PRIMARY KEY,
     user_id INT NOT NULL UNIQUE,
@@ -17,39 +45,149 @@ CREATE TABLE IF NOT EXISTS user_profiles (
     guardian_name VARCHAR(100) NOT NULL,
     school_name VARCHAR(100) NOT NULL,
     grade VARCHAR(10) NOT NULL,
+    student_kana VARCHAR(100) NOT NULL DEFAULT '', -- furigana of student_name
+    phone VARCHAR(20) NOT NULL DEFAULT '',
+    guardian_count SMALLINT NOT NULL DEFAULT 0 CHECK (guardian_count BETWEEN 0 AND 2), -- accompanying guardians
+    accessibility_needs TEXT NOT NULL DEFAULT '',
     created_at TIMESTAMPTZ DEFAULT NOW(),
     CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
 );
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS student_kana VARCHAR(100) NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS phone VARCHAR(20) NOT NULL DEFAULT '';
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS guardian_count SMALLINT NOT NULL DEFAULT 0
+    CHECK (guardian_count BETWEEN 0 AND 2);
+ALTER TABLE user_profiles ADD COLUMN IF NOT EXISTS accessibility_needs TEXT NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE, -- sha256 of the emailed token
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_reset_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS email_verification_tokens (
+    token_id SERIAL PRIMARY KEY,
+    user_id INT NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE, -- sha256 of the emailed token
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ DEFAULT NOW(),
+    CONSTRAINT fk_verification_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Logins (the cookie holds a random ID; only its hash is stored)
+CREATE TABLE IF NOT EXISTS user_sessions (
+    session_hash CHAR(64) PRIMARY KEY,
+    user_id INT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    expires_at TIMESTAMPTZ NOT NULL, -- slides with activity up to a fixed maximum
+    CONSTRAINT fk_session_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+CREATE INDEX IF NOT EXISTS idx_user_sessions_user ON user_sessions(user_id);
+
+-- Every login attempt, kept for throttling and auditing (never updated)
+CREATE TABLE IF NOT EXISTS login_attempts (
+    attempt_id BIGSERIAL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL, -- as typed (lowercased), even if no such account exists
+    ip VARCHAR(45) NOT NULL,
+    outcome VARCHAR(10) NOT NULL CHECK (outcome IN ('success', 'failure', 'unlock')),
+    attempted_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_email ON login_attempts(email, attempted_at);
+CREATE INDEX IF NOT EXISTS idx_login_attempts_ip ON login_attempts(ip, attempted_at);
 
 -- 2. System Settings
 CREATE TABLE IF NOT EXISTS system_settings (
     setting_key VARCHAR(50) PRIMARY KEY,
     setting_value TEXT
 );
--- Default event dates (You can change these later in Admin Config)
 INSERT INTO system_settings (setting_key, setting_value) VALUES 
-('event_date_1', '2025-08-01'),
-('event_date_2', '2025-08-02')
+('cancel_deadline_hours', '24'),
+('enrollment_rules', '{"max_per_day": 2, "max_total": 3, "forbid_overlap": true}'),
+('retention_days', '365')
 ON CONFLICT DO NOTHING;
 
+-- Event editions: one row per yearly event. Exactly one is active; the
+-- others are archived (read-only, still reportable) and may be anonymized.
+CREATE TABLE IF NOT EXISTS event_editions (
+    edition_id SERIAL PRIMARY KEY,
+    name VARCHAR(100) NOT NULL UNIQUE, -- e.g. "2025年度"
+    status VARCHAR(10) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'archived')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    archived_at TIMESTAMPTZ,
+    anonymized_at TIMESTAMPTZ -- student PII of this edition was scrubbed
+);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_event_editions_one_active ON event_editions(status) WHERE status = 'active';
+
+-- Event days of an edition, as many as needed (e.g. three open-campus days plus an online day)
+CREATE TABLE IF NOT EXISTS event_days (
+    day_id SERIAL PRIMARY KEY,
+    edition_id INT NOT NULL REFERENCES event_editions(edition_id) ON DELETE CASCADE,
+    label VARCHAR(50) NOT NULL, -- e.g. "1日目", "オンライン"
+    event_date DATE NOT NULL,
+    UNIQUE (edition_id, label)
+);
+CREATE INDEX IF NOT EXISTS idx_event_days_edition ON event_days(edition_id, event_date);
+
+-- First edition with two days (set the real days later in Admin > 開催日).
+-- Older databases kept the two dates in event_date_1 and event_date_2.
+INSERT INTO event_editions (name)
+SELECT EXTRACT(YEAR FROM CURRENT_DATE)::text || '年度'
+WHERE NOT EXISTS (SELECT 1 FROM event_editions);
+INSERT INTO event_days (edition_id, label, event_date)
+SELECT e.edition_id, d.label,
+       COALESCE((SELECT setting_value::date FROM system_settings WHERE setting_key = 'event_date_' || (d.offset_days + 1)),
+                CURRENT_DATE + d.offset_days)
+FROM event_editions e, (VALUES ('1日目', 0), ('2日目', 1)) AS d(label, offset_days)
+WHERE e.status = 'active' AND NOT EXISTS (SELECT 1 FROM event_days);
+
 
 -- 3. Classes & Instructors
 CREATE TABLE IF NOT EXISTS classes (
     class_id SERIAL PRIMARY KEY,
     class_name TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '', -- Markdown
+    category VARCHAR(50) NOT NULL DEFAULT '', -- department tag, e.g. "理科", "情報"
+    target_grades TEXT[] NOT NULL DEFAULT '{}', -- user_profiles.grade values; empty means every grade
+    prerequisites TEXT NOT NULL DEFAULT '',
+    image_url TEXT NOT NULL DEFAULT '', -- stored image name (see upload.SaveImage)
     syllabus_pdf_url TEXT,
+    syllabus_thumb TEXT,   -- PNG of the PDF's first page (same hash, .png)
+    syllabus_excerpt TEXT, -- the PDF's opening text, shown on the lesson list
     room_number VARCHAR(50),
     room_name TEXT,
     registration_start_at TIMESTAMPTZ NOT NULL,
     registration_end_at TIMESTAMPTZ NOT NULL,
+    edition_id INT NOT NULL REFERENCES event_editions(edition_id),
     created_at TIMESTAMPTZ DEFAULT NOW()
 );
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS category VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS target_grades TEXT[] NOT NULL DEFAULT '{}';
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS prerequisites TEXT NOT NULL DEFAULT '';
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS image_url TEXT NOT NULL DEFAULT '';
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS syllabus_thumb TEXT;
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS syllabus_excerpt TEXT;
+-- Classes from before editions belong to the active one
+ALTER TABLE classes ADD COLUMN IF NOT EXISTS edition_id INT REFERENCES event_editions(edition_id);
+UPDATE classes SET edition_id = (SELECT edition_id FROM event_editions WHERE status = 'active')
+WHERE edition_id IS NULL;
+ALTER TABLE classes ALTER COLUMN edition_id SET NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_classes_edition ON classes(edition_id);
 
 CREATE TABLE IF NOT EXISTS instructors (
     instructor_id SERIAL PRIMARY KEY,
     name TEXT NOT NULL UNIQUE
 );
 
+-- Instructor accounts only see the classes of the instructor they're linked to
+ALTER TABLE users ADD COLUMN IF NOT EXISTS instructor_id INT
+    REFERENCES instructors(instructor_id) ON DELETE SET NULL;
+
 CREATE TABLE IF NOT EXISTS class_instructors (
     class_id INT NOT NULL,
     instructor_id INT NOT NULL,
@@ -63,13 +201,35 @@ CREATE TABLE IF NOT EXISTS class_instructors (
 CREATE TABLE IF NOT EXISTS class_sessions (
     session_id SERIAL PRIMARY KEY,
     class_id INT NOT NULL,
-    day_sequence INT NOT NULL, -- 1 or 2
+    day_id INT NOT NULL REFERENCES event_days(day_id), -- a day can't be deleted while it has sessions
     start_at TIMESTAMPTZ NOT NULL,
     end_at TIMESTAMPTZ NOT NULL,
     capacity INT NOT NULL,
     current_enrolled_count INT DEFAULT 0,
+    -- Last line of defence against overbooking (EnrollUser also locks the row)
+    CONSTRAINT chk_session_capacity CHECK (current_enrolled_count <= capacity),
+    CONSTRAINT chk_session_count_non_negative CHECK (current_enrolled_count >= 0),
     CONSTRAINT fk_session_class FOREIGN KEY (class_id) REFERENCES classes(class_id) ON DELETE CASCADE
 );
+DO $$
+BEGIN
+    -- day_sequence (1 or 2) became a reference to the seeded 1日目/2日目
+    IF EXISTS (SELECT 1 FROM information_schema.columns
+               WHERE table_schema = current_schema() AND table_name = 'class_sessions' AND column_name = 'day_sequence') THEN
+        ALTER TABLE class_sessions ADD COLUMN IF NOT EXISTS day_id INT REFERENCES event_days(day_id);
+        UPDATE class_sessions cs SET day_id = d.day_id
+        FROM event_days d JOIN event_editions e ON e.edition_id = d.edition_id AND e.status = 'active'
+        WHERE d.label = cs.day_sequence || '日目';
+        ALTER TABLE class_sessions ALTER COLUMN day_id SET NOT NULL;
+        ALTER TABLE class_sessions DROP COLUMN day_sequence;
+    END IF;
+    IF NOT EXISTS (SELECT 1 FROM pg_constraint
+                   WHERE conrelid = 'class_sessions'::regclass AND conname = 'chk_session_capacity') THEN
+        ALTER TABLE class_sessions
+            ADD CONSTRAINT chk_session_capacity CHECK (current_enrolled_count <= capacity),
+            ADD CONSTRAINT chk_session_count_non_negative CHECK (current_enrolled_count >= 0);
+    END IF;
+END $$;
 
 
 -- 5. Enrollments
@@ -78,10 +238,40 @@ CREATE TABLE IF NOT EXISTS session_enrollments (
     session_id INT NOT NULL,
     user_profile_id INT NOT NULL,
     registered_at TIMESTAMPTZ DEFAULT NOW(),
-    status VARCHAR(20) DEFAULT 'confirmed',
+    status VARCHAR(20) DEFAULT 'confirmed', -- 'confirmed' or 'waitlisted'
     
     UNIQUE(session_id, user_profile_id),
 
     CONSTRAINT fk_enrollment_session FOREIGN KEY (session_id) REFERENCES class_sessions(session_id) ON DELETE CASCADE,
     CONSTRAINT fk_enrollment_profile FOREIGN KEY (user_profile_id) REFERENCES user_profiles(id) ON DELETE CASCADE
 );
+
+
+-- 6. Audit log (append-only; written by internal/audit)
+CREATE TABLE IF NOT EXISTS audit_logs (
+    audit_id BIGSERIAL PRIMARY KEY,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    actor_id INT, -- no foreign key: entries must outlive deleted accounts; the address is looked up in users
+    action VARCHAR(50) NOT NULL,
+    target_type VARCHAR(30) NOT NULL DEFAULT '',
+    target_id VARCHAR(50) NOT NULL DEFAULT '',
+    before_data JSONB,
+    after_data JSONB,
+    ip VARCHAR(45) NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_occurred ON audit_logs(occurred_at);
+CREATE INDEX IF NOT EXISTS idx_audit_logs_target ON audit_logs(target_type, target_id);
+
+CREATE OR REPLACE FUNCTION audit_logs_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_logs is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_logs_no_change ON audit_logs;
+CREATE TRIGGER audit_logs_no_change BEFORE UPDATE OR DELETE ON audit_logs
+    FOR EACH ROW EXECUTE FUNCTION audit_logs_append_only();
+
+DROP TRIGGER IF EXISTS audit_logs_no_truncate ON audit_logs;
+CREATE TRIGGER audit_logs_no_truncate BEFORE TRUNCATE ON audit_logs
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_logs_append_only();
@@ -0,0 +1,192 @@
+// Package audit records who did what to which record. The audit_logs table
+// is append-only: a trigger rejects UPDATE, DELETE and TRUNCATE.
+//
+// Because entries can never be scrubbed, they hold no personal data: the
+// actor is stored by user ID only and List looks the address up in users,
+// so anonymizing an account (models.AnonymizeEdition) also anonymizes how
+// its entries are shown. What an entry keeps for good is the user ID, the
+// action, the target type and ID, the before/after data (record fields and
+// user IDs, never names or addresses) and the client IP.
+package audit
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Actions written by the handlers
+const (
+	ActionClassCreate      = "class.create"
+	ActionClassUpdate      = "class.update"
+	ActionClassDelete      = "class.delete"
+	ActionSessionCreate    = "session.create"
+	ActionSessionUpdate    = "session.update"
+	ActionSessionDelete    = "session.delete"
+	ActionEventDayCreate   = "event_day.create"
+	ActionEventDayUpdate   = "event_day.update"
+	ActionEventDayDelete   = "event_day.delete"
+	ActionSettingsSave     = "settings.update"
+	ActionSystemReset      = "system.reset"
+	ActionSystemBackup     = "system.backup"
+	ActionSystemRestore    = "system.restore"
+	ActionEditionRollover  = "edition.rollover"
+	ActionEditionAnonymize = "edition.anonymize"
+	ActionDataExport       = "data.export"
+
+	ActionUserVerify  = "user.verify"
+	ActionUserUnlock  = "user.unlock"
+	ActionUserLogout  = "user.revoke_sessions"
+	ActionUserRole    = "user.role"
+	ActionDescription = "class.description"
+
+	ActionEnroll          = "enrollment.create"
+	ActionCancel          = "enrollment.cancel"
+	ActionWaitlistJoin    = "waitlist.join"
+	ActionWaitlistPromote = "waitlist.promote"
+)
+
+// Actions lists every action, for the filter on the audit page
+var Actions = []string{
+	ActionClassCreate, ActionClassUpdate, ActionClassDelete, ActionDescription,
+	ActionSessionCreate, ActionSessionUpdate, ActionSessionDelete,
+	ActionEventDayCreate, ActionEventDayUpdate, ActionEventDayDelete,
+	ActionSettingsSave, ActionSystemReset, ActionSystemBackup, ActionSystemRestore, ActionDataExport,
+	ActionEditionRollover, ActionEditionAnonymize,
+	ActionUserVerify, ActionUserUnlock, ActionUserLogout, ActionUserRole,
+	ActionEnroll, ActionCancel, ActionWaitlistJoin, ActionWaitlistPromote,
+}
+
+// Entry is one audited action. Before and After are marshalled to JSON;
+// leave them nil when there is nothing to show.
+type Entry struct {
+	ActorID    int // 0 for the system itself (e.g. waitlist promotion)
+	Action     string
+	TargetType string // "class", "session", "user", "settings", ...
+	TargetID   string // a record ID; never an email address or name
+	Before     any
+	After      any
+	IP         string
+}
+
+// Execer is satisfied by *sql.DB and *sql.Tx, so an entry can be written
+// in the same transaction as the change it describes
+type Execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// Record appends an entry to the audit log
+func Record(db Execer, e Entry) error {
+	before, err := marshal(e.Before)
+	if err != nil {
+		return err
+	}
+	after, err := marshal(e.After)
+	if err != nil {
+		return err
+	}
+	var actor any
+	if e.ActorID > 0 {
+		actor = e.ActorID
+	}
+	_, err = db.Exec(`
+		INSERT INTO audit_logs (actor_id, action, target_type, target_id, before_data, after_data, ip)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+	`, actor, e.Action, e.TargetType, e.TargetID, before, after, e.IP)
+	return err
+}
+
+func marshal(v any) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// LogEntry is a stored audit record
+type LogEntry struct {
+	ID         int64
+	OccurredAt time.Time
+	ActorID    int
+	ActorEmail string // the account's current address; "" if it was deleted
+	Action     string
+	TargetType string
+	TargetID   string
+	Before     string // JSON, "" if none
+	After      string
+	IP         string
+}
+
+// Filter narrows List; zero fields don't filter
+type Filter struct {
+	Actor      string // substring of the actor's current email
+	Action     string
+	TargetType string
+	TargetID   string
+	From       time.Time // inclusive
+	To         time.Time // exclusive
+	Limit      int
+}
+
+// List returns matching entries, newest first
+func List(db *sql.DB, f Filter) ([]LogEntry, error) {
+	query := `
+		SELECT a.audit_id, a.occurred_at, COALESCE(a.actor_id, 0), COALESCE(u.email, ''), a.action,
+		       a.target_type, a.target_id, COALESCE(a.before_data::text, ''), COALESCE(a.after_data::text, ''), a.ip
+		FROM audit_logs a
+		LEFT JOIN users u ON u.id = a.actor_id
+		WHERE 1=1
+	`
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	if f.Actor != "" {
+		add("u.email ILIKE '%%' || $%d || '%%'", f.Actor)
+	}
+	if f.Action != "" {
+		add("a.action = $%d", f.Action)
+	}
+	if f.TargetType != "" {
+		add("a.target_type = $%d", f.TargetType)
+	}
+	if f.TargetID != "" {
+		add("a.target_id = $%d", f.TargetID)
+	}
+	if !f.From.IsZero() {
+		add("a.occurred_at >= $%d", f.From)
+	}
+	if !f.To.IsZero() {
+		add("a.occurred_at < $%d", f.To)
+	}
+	query += " ORDER BY a.occurred_at DESC, a.audit_id DESC"
+	if f.Limit > 0 {
+		args = append(args, f.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []LogEntry
+	for rows.Next() {
+		var e LogEntry
+		if err := rows.Scan(
+			&e.ID, &e.OccurredAt, &e.ActorID, &e.ActorEmail, &e.Action,
+			&e.TargetType, &e.TargetID, &e.Before, &e.After, &e.IP,
+		); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"testing"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+func TestListShowsCurrentAddress(t *testing.T) {
+	db := dbtest.Open(t)
+	var uid int
+	if err := db.QueryRow("INSERT INTO users (email, password_hash) VALUES ('family@example.com', 'x') RETURNING id").Scan(&uid); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range []Entry{
+		{ActorID: uid, Action: ActionEnroll, TargetType: "session", TargetID: "1", After: map[string]int{"user_id": uid}},
+		{Action: ActionWaitlistPromote, TargetType: "session", TargetID: "1"},
+	} {
+		if err := Record(db, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := List(db, Filter{Actor: "family@"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ActorID != uid || entries[0].ActorEmail != "family@example.com" {
+		t.Fatalf("entries = %+v", entries)
+	}
+
+	// Anonymizing the account changes what the log shows; nothing in
+	// audit_logs held the address
+	if _, err := db.Exec("UPDATE users SET email = 'anonymized-' || id || '@invalid' WHERE id = $1", uid); err != nil {
+		t.Fatal(err)
+	}
+	if entries, _ := List(db, Filter{Actor: "family@"}); len(entries) != 0 {
+		t.Errorf("old address still matches: %+v", entries)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_logs WHERE row_to_json(audit_logs)::text LIKE '%family@%'").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d audit rows hold the address", n)
+	}
+
+	// A deleted account leaves its ID
+	if _, err := db.Exec("DELETE FROM users WHERE id = $1", uid); err != nil {
+		t.Fatal(err)
+	}
+	entries, err = List(db, Filter{Action: ActionEnroll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].ActorID != uid || entries[0].ActorEmail != "" {
+		t.Fatalf("after delete: %+v", entries)
+	}
+}
+
+func TestAppendOnly(t *testing.T) {
+	db := dbtest.Open(t)
+	if err := Record(db, Entry{Action: ActionSystemBackup}); err != nil {
+		t.Fatal(err)
+	}
+	for _, q := range []string{
+		"UPDATE audit_logs SET ip = '127.0.0.1'",
+		"DELETE FROM audit_logs",
+		"TRUNCATE audit_logs",
+	} {
+		if _, err := db.Exec(q); err == nil {
+			t.Errorf("%s succeeded", q)
+		}
+	}
+}
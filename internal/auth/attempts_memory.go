@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryAttemptStore keeps login attempts in process memory, for tests
+type MemoryAttemptStore struct {
+	mu       sync.Mutex
+	attempts []Attempt
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{}
+}
+
+func (s *MemoryAttemptStore) Record(a Attempt) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attempts = append(s.attempts, a)
+	return nil
+}
+
+func (s *MemoryAttemptStore) AccountFailures(email string, since time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// failures before the latest success or unlock don't count
+	for _, a := range s.attempts {
+		if a.Email == email && a.Outcome != OutcomeFailure && a.At.After(since) {
+			since = a.At
+		}
+	}
+	return s.countFailures(since, func(a Attempt) bool { return a.Email == email })
+}
+
+func (s *MemoryAttemptStore) IPFailures(ip string, since time.Time) (int, time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.countFailures(since, func(a Attempt) bool { return a.IP == ip })
+}
+
+func (s *MemoryAttemptStore) FailingAccounts(since time.Time) ([]string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seen := make(map[string]bool)
+	var emails []string
+	for _, a := range s.attempts {
+		if a.Outcome == OutcomeFailure && a.At.After(since) && !seen[a.Email] {
+			seen[a.Email] = true
+			emails = append(emails, a.Email)
+		}
+	}
+	return emails, nil
+}
+
+// countFailures must be called with s.mu held
+func (s *MemoryAttemptStore) countFailures(since time.Time, match func(Attempt) bool) (int, time.Time, error) {
+	var n int
+	var last time.Time
+	for _, a := range s.attempts {
+		if a.Outcome == OutcomeFailure && a.At.After(since) && match(a) {
+			n++
+			if a.At.After(last) {
+				last = a.At
+			}
+		}
+	}
+	return n, last, nil
+}
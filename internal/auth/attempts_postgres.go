@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostgresAttemptStore records attempts in the login_attempts table.
+// Rows are never updated or deleted, so the table doubles as an audit trail.
+type PostgresAttemptStore struct {
+	db *sql.DB
+}
+
+func NewPostgresAttemptStore(db *sql.DB) *PostgresAttemptStore {
+	return &PostgresAttemptStore{db: db}
+}
+
+func (s *PostgresAttemptStore) Record(a Attempt) error {
+	_, err := s.db.Exec(`
+		INSERT INTO login_attempts (email, ip, outcome, attempted_at)
+		VALUES ($1, $2, $3, $4)
+	`, a.Email, a.IP, a.Outcome, a.At)
+	return err
+}
+
+func (s *PostgresAttemptStore) AccountFailures(email string, since time.Time) (int, time.Time, error) {
+	return s.countFailures(`
+		SELECT COUNT(*), MAX(attempted_at) FROM login_attempts
+		WHERE email = $1 AND outcome = 'failure' AND attempted_at > $2
+		  AND attempted_at > COALESCE((
+		      SELECT MAX(attempted_at) FROM login_attempts
+		      WHERE email = $1 AND outcome IN ('success', 'unlock')
+		  ), '-infinity')
+	`, email, since)
+}
+
+func (s *PostgresAttemptStore) IPFailures(ip string, since time.Time) (int, time.Time, error) {
+	return s.countFailures(`
+		SELECT COUNT(*), MAX(attempted_at) FROM login_attempts
+		WHERE ip = $1 AND outcome = 'failure' AND attempted_at > $2
+	`, ip, since)
+}
+
+func (s *PostgresAttemptStore) FailingAccounts(since time.Time) ([]string, error) {
+	rows, err := s.db.Query(`
+		SELECT DISTINCT email FROM login_attempts
+		WHERE outcome = 'failure' AND attempted_at > $1
+	`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var emails []string
+	for rows.Next() {
+		var e string
+		if err := rows.Scan(&e); err != nil {
+			return nil, err
+		}
+		emails = append(emails, e)
+	}
+	return emails, rows.Err()
+}
+
+func (s *PostgresAttemptStore) countFailures(query string, key string, since time.Time) (int, time.Time, error) {
+	var n int
+	var last sql.NullTime
+	if err := s.db.QueryRow(query, key, since).Scan(&n, &last); err != nil {
+		return 0, time.Time{}, err
+	}
+	return n, last.Time, nil
+}
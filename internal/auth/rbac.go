@@ -0,0 +1,97 @@
+package auth
+
+// Role is stored in users.role
+type Role string
+
+const (
+	RoleSuperAdmin   Role = "super_admin"   // everything, including reset and role assignment
+	RoleClassManager Role = "class_manager" // creates and edits classes and sessions
+	RoleReception    Role = "reception"     // helps families: participant lists, account support
+	RoleViewer       Role = "viewer"        // read-only access to classes and participants
+	RoleInstructor   Role = "instructor"    // read-only, limited to their own classes
+	RoleStudent      Role = "student"       // a family account; no staff access
+)
+
+// Permission names one kind of staff action; routes require one each
+type Permission string
+
+const (
+	PermAdminHome        Permission = "admin_home"
+	PermViewClasses      Permission = "view_classes"
+	PermManageClasses    Permission = "manage_classes"
+	PermViewParticipants Permission = "view_participants"
+	PermManageUsers      Permission = "manage_users"
+	PermAssignRoles      Permission = "assign_roles"
+	PermManageSettings   Permission = "manage_settings"
+	PermResetSystem      Permission = "reset_system"
+	PermViewAudit        Permission = "view_audit"
+	PermInstructorPortal Permission = "instructor_portal" // an instructor's own classes and rosters
+)
+
+// adminPermissions are everything in the admin area. The instructor portal
+// isn't included: it only makes sense for an account linked to an instructor.
+var adminPermissions = []Permission{
+	PermAdminHome, PermViewClasses, PermManageClasses, PermViewParticipants,
+	PermManageUsers, PermAssignRoles, PermManageSettings, PermResetSystem,
+	PermViewAudit,
+}
+
+// rolePermissions is the permission matrix
+var rolePermissions = map[Role][]Permission{
+	RoleSuperAdmin:   adminPermissions,
+	RoleClassManager: {PermAdminHome, PermViewClasses, PermManageClasses, PermViewParticipants},
+	RoleReception:    {PermAdminHome, PermViewClasses, PermViewParticipants, PermManageUsers},
+	RoleViewer:       {PermAdminHome, PermViewClasses, PermViewParticipants},
+	RoleInstructor:   {PermAdminHome, PermViewClasses, PermViewParticipants, PermInstructorPortal},
+}
+
+var roleLabels = map[Role]string{
+	RoleSuperAdmin:   "システム管理者",
+	RoleClassManager: "授業管理者",
+	RoleReception:    "受付担当",
+	RoleViewer:       "閲覧のみ",
+	RoleInstructor:   "担当教職員",
+	RoleStudent:      "生徒・保護者",
+}
+
+// Roles lists every role in the order shown on the role assignment screen
+func Roles() []Role {
+	return []Role{RoleSuperAdmin, RoleClassManager, RoleReception, RoleViewer, RoleInstructor, RoleStudent}
+}
+
+// ParseRole validates a role name from a form or the database
+func ParseRole(s string) (Role, bool) {
+	r := Role(s)
+	_, ok := roleLabels[r]
+	return r, ok
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+// IsStaff reports whether the role may enter the admin area at all
+func (r Role) IsStaff() bool {
+	return r.Can(PermAdminHome)
+}
+
+func (r Role) Label() string {
+	if l, ok := roleLabels[r]; ok {
+		return l
+	}
+	return string(r)
+}
+
+// Permissions returns the role's permissions keyed by name, for templates
+func (r Role) Permissions() map[string]bool {
+	m := make(map[string]bool)
+	for _, p := range rolePermissions[r] {
+		m[string(p)] = true
+	}
+	return m
+}
@@ -0,0 +1,75 @@
+package auth
+
+import "testing"
+
+// allPermissions is every permission, so the matrix below must state each
+// role's answer for each of them
+var allPermissions = []Permission{
+	PermAdminHome, PermViewClasses, PermManageClasses, PermViewParticipants,
+	PermManageUsers, PermAssignRoles, PermManageSettings, PermResetSystem,
+	PermViewAudit, PermInstructorPortal,
+}
+
+func TestRolePermissionMatrix(t *testing.T) {
+	const (
+		Y = true
+		n = false
+	)
+	// Columns follow allPermissions
+	matrix := map[Role][]bool{
+		//                home view mgCl part users roles sett reset audit portal
+		RoleSuperAdmin:   {Y, Y, Y, Y, Y, Y, Y, Y, Y, n},
+		RoleClassManager: {Y, Y, Y, Y, n, n, n, n, n, n},
+		RoleReception:    {Y, Y, n, Y, Y, n, n, n, n, n},
+		RoleViewer:       {Y, Y, n, Y, n, n, n, n, n, n},
+		RoleInstructor:   {Y, Y, n, Y, n, n, n, n, n, Y},
+		RoleStudent:      {n, n, n, n, n, n, n, n, n, n},
+		Role("admin"):    {n, n, n, n, n, n, n, n, n, n}, // unknown names get nothing
+		Role(""):         {n, n, n, n, n, n, n, n, n, n},
+	}
+	for role, want := range matrix {
+		for i, p := range allPermissions {
+			if got := role.Can(p); got != want[i] {
+				t.Errorf("%q.Can(%s) = %v, want %v", role, p, got, want[i])
+			}
+		}
+		if got := role.IsStaff(); got != want[0] {
+			t.Errorf("%q.IsStaff() = %v, want %v", role, got, want[0])
+		}
+	}
+
+	// Every assignable role is in the matrix
+	for _, r := range Roles() {
+		if _, ok := matrix[r]; !ok {
+			t.Errorf("role %q missing from the test matrix", r)
+		}
+	}
+}
+
+func TestPermissionsMatchesCan(t *testing.T) {
+	for _, r := range Roles() {
+		m := r.Permissions()
+		for _, p := range allPermissions {
+			if m[string(p)] != r.Can(p) {
+				t.Errorf("%s: Permissions()[%s] = %v, Can = %v", r, p, m[string(p)], r.Can(p))
+			}
+		}
+	}
+}
+
+func TestParseRole(t *testing.T) {
+	for _, r := range Roles() {
+		if got, ok := ParseRole(string(r)); !ok || got != r {
+			t.Errorf("ParseRole(%q) = %q, %v", r, got, ok)
+		}
+		if r.Label() == string(r) {
+			t.Errorf("%q has no label", r)
+		}
+	}
+	// is_admin became super_admin; there is no plain "admin" role
+	for _, s := range []string{"admin", "", "Super_Admin", "super_admin "} {
+		if _, ok := ParseRole(s); ok {
+			t.Errorf("ParseRole(%q) accepted", s)
+		}
+	}
+}
@@ -1,8 +1,13 @@
-
 package auth
 
-import "github.com/gorilla/securecookie"
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/securecookie"
+)
 
+// Session signs small cookies that don't need server-side state (the CSRF token)
 type Session struct {
 	Secure *securecookie.SecureCookie
 	Key    string
@@ -17,3 +22,129 @@ func NewSecureCookie(hashKey, blockKey string) *Session {
 	return &Session{Secure: sc, Key: "session"}
 }
 
+const (
+	DefaultIdleTimeout = 2 * time.Hour
+	DefaultMaxLifetime = 24 * time.Hour
+	renewInterval      = time.Minute // don't write to the store on every request
+)
+
+// SessionManager issues login cookies holding an opaque random ID and
+// resolves them through a Store. Logging out deletes the stored record,
+// so a copied cookie stops working immediately.
+type SessionManager struct {
+	Store       Store
+	CookieName  string
+	IdleTimeout time.Duration // logged out after this long without a request
+	MaxLifetime time.Duration // logged out this long after login regardless of activity
+	Now         func() time.Time
+}
+
+func NewSessionManager(store Store) *SessionManager {
+	return &SessionManager{
+		Store:       store,
+		CookieName:  "session",
+		IdleTimeout: DefaultIdleTimeout,
+		MaxLifetime: DefaultMaxLifetime,
+		Now:         time.Now,
+	}
+}
+
+// Start records a new login and sets its cookie
+func (m *SessionManager) Start(w http.ResponseWriter, userID int, email string) error {
+	now := m.Now()
+	_ = m.Store.Purge(now) // housekeeping; a failure here shouldn't block the login
+
+	token, hash, err := NewToken()
+	if err != nil {
+		return err
+	}
+	rec := SessionRecord{
+		UserID:    userID,
+		Email:     email,
+		CreatedAt: now,
+		ExpiresAt: m.nextExpiry(now, now),
+	}
+	if err := m.Store.Create(hash, rec); err != nil {
+		return err
+	}
+	m.setCookie(w, token, rec.ExpiresAt)
+	return nil
+}
+
+// Load resolves the request's cookie to a live session, sliding its
+// expiry forward. ok is false if there's no cookie or it's been revoked or expired.
+func (m *SessionManager) Load(w http.ResponseWriter, r *http.Request) (rec SessionRecord, ok bool) {
+	c, err := r.Cookie(m.CookieName)
+	if err != nil || c.Value == "" {
+		return SessionRecord{}, false
+	}
+	hash := HashToken(c.Value)
+
+	rec, err = m.Store.Get(hash)
+	if err != nil {
+		return SessionRecord{}, false
+	}
+
+	now := m.Now()
+	if !now.Before(rec.ExpiresAt) {
+		_ = m.Store.Delete(hash)
+		m.clearCookie(w)
+		return SessionRecord{}, false
+	}
+
+	next := m.nextExpiry(now, rec.CreatedAt)
+	if next.Sub(rec.ExpiresAt) >= renewInterval {
+		if err := m.Store.Touch(hash, next); err == nil {
+			rec.ExpiresAt = next
+			m.setCookie(w, c.Value, next)
+		}
+	}
+	return rec, true
+}
+
+// End revokes the request's session and clears the cookie
+func (m *SessionManager) End(w http.ResponseWriter, r *http.Request) error {
+	m.clearCookie(w)
+	c, err := r.Cookie(m.CookieName)
+	if err != nil || c.Value == "" {
+		return nil
+	}
+	return m.Store.Delete(HashToken(c.Value))
+}
+
+// EndAll revokes every session of a user, on all devices
+func (m *SessionManager) EndAll(userID int) error {
+	return m.Store.DeleteUser(userID)
+}
+
+// nextExpiry is the idle deadline counted from now, capped by the absolute lifetime
+func (m *SessionManager) nextExpiry(now, createdAt time.Time) time.Time {
+	exp := now.Add(m.IdleTimeout)
+	if limit := createdAt.Add(m.MaxLifetime); exp.After(limit) {
+		exp = limit
+	}
+	return exp
+}
+
+func (m *SessionManager) setCookie(w http.ResponseWriter, value string, expires time.Time) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    value,
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+		Expires:  expires,
+		// Secure: true, // enable in production with HTTPS
+	})
+}
+
+func (m *SessionManager) clearCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     m.CookieName,
+		Value:    "",
+		Path:     "/",
+		HttpOnly: true,
+		Expires:  time.Unix(0, 0),
+		MaxAge:   -1,
+	})
+}
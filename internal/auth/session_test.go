@@ -0,0 +1,194 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newTestSessions() (*SessionManager, *MemoryStore, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC)}
+	store := NewMemoryStore()
+	m := NewSessionManager(store)
+	m.Now = clock.Now
+	return m, store, clock
+}
+
+// login starts a session and returns its cookie
+func login(t *testing.T, m *SessionManager, userID int) *http.Cookie {
+	t.Helper()
+	w := httptest.NewRecorder()
+	if err := m.Start(w, userID, "family@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value == "" {
+		t.Fatalf("Start set cookies %v", cookies)
+	}
+	return cookies[0]
+}
+
+// load makes a request carrying c and returns the session and the
+// recorder holding any cookie Load set
+func load(m *SessionManager, c *http.Cookie) (SessionRecord, bool, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+	w := httptest.NewRecorder()
+	rec, ok := m.Load(w, r)
+	return rec, ok, w
+}
+
+func TestSessionExpiry(t *testing.T) {
+	const idle, life = DefaultIdleTimeout, DefaultMaxLifetime
+	// Each step waits, then makes a request; all but the last must succeed
+	tests := []struct {
+		name  string
+		steps []time.Duration
+		ok    bool
+	}{
+		{"right after login", []time.Duration{0}, true},
+		{"just before the idle timeout", []time.Duration{idle - time.Second}, true},
+		{"at the idle timeout", []time.Duration{idle}, false},
+		{"activity slides the timeout", []time.Duration{idle - time.Minute, idle - time.Minute}, true},
+		{"idle after activity", []time.Duration{idle - time.Minute, idle}, false},
+		{"active just before the lifetime ends", repeat(idle-time.Minute, int(life/(idle-time.Minute))), true},
+		{"active past the lifetime", repeat(idle-time.Minute, int(life/(idle-time.Minute))+1), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, _, clock := newTestSessions()
+			c := login(t, m, 1)
+			start := clock.now
+			for i, d := range tt.steps {
+				clock.Advance(d)
+				rec, ok, _ := load(m, c)
+				if i < len(tt.steps)-1 && !ok {
+					t.Fatalf("step %d (%v after login): logged out", i, clock.now.Sub(start))
+				}
+				if i == len(tt.steps)-1 && ok != tt.ok {
+					t.Fatalf("%v after login: ok = %v, want %v", clock.now.Sub(start), ok, tt.ok)
+				}
+				if ok && (rec.UserID != 1 || rec.ExpiresAt.After(start.Add(life))) {
+					t.Fatalf("record %+v", rec)
+				}
+			}
+		})
+	}
+}
+
+func repeat(d time.Duration, n int) []time.Duration {
+	out := make([]time.Duration, n)
+	for i := range out {
+		out[i] = d
+	}
+	return out
+}
+
+func TestSessionRenewal(t *testing.T) {
+	m, store, clock := newTestSessions()
+	c := login(t, m, 1)
+	hash := HashToken(c.Value)
+	first, _ := store.Get(hash)
+
+	// Within renewInterval the store isn't written and no cookie is sent
+	clock.Advance(renewInterval - time.Second)
+	_, ok, w := load(m, c)
+	if rec, _ := store.Get(hash); !ok || !rec.ExpiresAt.Equal(first.ExpiresAt) || len(w.Result().Cookies()) != 0 {
+		t.Fatalf("renewed too early: ok %v, expiry %v, cookies %v", ok, rec.ExpiresAt, w.Result().Cookies())
+	}
+
+	// After it both the store and the cookie move forward
+	clock.Advance(time.Second)
+	_, ok, w = load(m, c)
+	want := clock.now.Add(m.IdleTimeout)
+	if rec, _ := store.Get(hash); !ok || !rec.ExpiresAt.Equal(want) {
+		t.Fatalf("not renewed: ok %v, expiry %v, want %v", ok, rec.ExpiresAt, want)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != c.Value || !cookies[0].Expires.Equal(want.Truncate(time.Second)) {
+		t.Errorf("renewed cookie %v", cookies)
+	}
+}
+
+func TestSessionExpiredIsDeleted(t *testing.T) {
+	m, store, clock := newTestSessions()
+	c := login(t, m, 1)
+	clock.Advance(m.IdleTimeout)
+	_, ok, w := load(m, c)
+	if ok {
+		t.Fatal("expired session loaded")
+	}
+	if _, err := store.Get(HashToken(c.Value)); err != ErrSessionNotFound {
+		t.Errorf("expired record kept: %v", err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookie not cleared: %v", cookies)
+	}
+}
+
+func TestSessionEnd(t *testing.T) {
+	m, _, _ := newTestSessions()
+	phone, laptop := login(t, m, 1), login(t, m, 1)
+	other := login(t, m, 2)
+
+	// Logging out on one device leaves the others
+	r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+	r.AddCookie(phone)
+	w := httptest.NewRecorder()
+	if err := m.End(w, r); err != nil {
+		t.Fatal(err)
+	}
+	if cookies := w.Result().Cookies(); len(cookies) != 1 || cookies[0].MaxAge >= 0 {
+		t.Errorf("cookie not cleared: %v", cookies)
+	}
+	if _, ok, _ := load(m, phone); ok {
+		t.Error("ended session still loads")
+	}
+	if _, ok, _ := load(m, laptop); !ok {
+		t.Error("other device logged out by End")
+	}
+
+	// EndAll logs out every device of one user only
+	if err := m.EndAll(1); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := load(m, laptop); ok {
+		t.Error("session survived EndAll")
+	}
+	if _, ok, _ := load(m, other); !ok {
+		t.Error("EndAll logged out another user")
+	}
+
+	// End without a cookie is harmless
+	if err := m.End(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/logout", nil)); err != nil {
+		t.Errorf("End without a cookie: %v", err)
+	}
+}
+
+func TestSessionUnknownCookie(t *testing.T) {
+	m, _, _ := newTestSessions()
+	login(t, m, 1)
+	for _, v := range []string{"", "forged", HashToken("forged")} {
+		if _, ok, _ := load(m, &http.Cookie{Name: m.CookieName, Value: v}); ok {
+			t.Errorf("cookie %q accepted", v)
+		}
+	}
+}
+
+func TestSessionPurge(t *testing.T) {
+	m, store, clock := newTestSessions()
+	old := login(t, m, 1)
+	clock.Advance(m.IdleTimeout - time.Minute)
+	recent := login(t, m, 2)
+
+	// Each login purges what has expired by then
+	clock.Advance(time.Minute)
+	login(t, m, 3)
+	if _, err := store.Get(HashToken(old.Value)); err != ErrSessionNotFound {
+		t.Errorf("expired session not purged: %v", err)
+	}
+	if _, err := store.Get(HashToken(recent.Value)); err != nil {
+		t.Errorf("live session purged: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// SessionRecord is what the server remembers about one login
+type SessionRecord struct {
+	UserID    int
+	Email     string
+	CreatedAt time.Time
+	ExpiresAt time.Time // slides forward with activity, capped by the manager's MaxLifetime
+}
+
+// Store persists logins keyed by the hash of the opaque cookie value.
+// Implementations never see the cookie value itself.
+type Store interface {
+	Create(idHash string, rec SessionRecord) error
+	Get(idHash string) (SessionRecord, error) // ErrSessionNotFound if unknown
+	Touch(idHash string, expiresAt time.Time) error
+	Delete(idHash string) error
+	DeleteUser(userID int) error // revokes every login of one user
+	Purge(now time.Time) error   // drops expired records
+}
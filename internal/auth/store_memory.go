@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps sessions in process memory. Logins don't survive a
+// restart, so it's meant for tests and local experiments.
+type MemoryStore struct {
+	mu       sync.Mutex
+	sessions map[string]SessionRecord
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{sessions: make(map[string]SessionRecord)}
+}
+
+func (s *MemoryStore) Create(idHash string, rec SessionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sessions[idHash] = rec
+	return nil
+}
+
+func (s *MemoryStore) Get(idHash string) (SessionRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.sessions[idHash]
+	if !ok {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	return rec, nil
+}
+
+func (s *MemoryStore) Touch(idHash string, expiresAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.sessions[idHash]
+	if !ok {
+		return ErrSessionNotFound
+	}
+	rec.ExpiresAt = expiresAt
+	s.sessions[idHash] = rec
+	return nil
+}
+
+func (s *MemoryStore) Delete(idHash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sessions, idHash)
+	return nil
+}
+
+func (s *MemoryStore) DeleteUser(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.sessions {
+		if rec.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) Purge(now time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, rec := range s.sessions {
+		if !now.Before(rec.ExpiresAt) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package auth
+
+import (
+	"database/sql"
+	"time"
+)
+
+// PostgresStore keeps sessions in the user_sessions table, so logins
+// survive restarts and can be revoked from any instance
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func NewPostgresStore(db *sql.DB) *PostgresStore {
+	return &PostgresStore{db: db}
+}
+
+func (s *PostgresStore) Create(idHash string, rec SessionRecord) error {
+	_, err := s.db.Exec(`
+		INSERT INTO user_sessions (session_hash, user_id, created_at, expires_at)
+		VALUES ($1, $2, $3, $4)
+	`, idHash, rec.UserID, rec.CreatedAt, rec.ExpiresAt)
+	return err
+}
+
+// Get reads the email from users rather than the session, so an address
+// change shows up without logging in again
+func (s *PostgresStore) Get(idHash string) (SessionRecord, error) {
+	var rec SessionRecord
+	err := s.db.QueryRow(`
+		SELECT s.user_id, u.email, s.created_at, s.expires_at
+		FROM user_sessions s
+		JOIN users u ON u.id = s.user_id
+		WHERE s.session_hash = $1
+	`, idHash).Scan(&rec.UserID, &rec.Email, &rec.CreatedAt, &rec.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return SessionRecord{}, ErrSessionNotFound
+	}
+	return rec, err
+}
+
+func (s *PostgresStore) Touch(idHash string, expiresAt time.Time) error {
+	_, err := s.db.Exec(`
+		UPDATE user_sessions SET expires_at = $2, last_seen_at = NOW()
+		WHERE session_hash = $1
+	`, idHash, expiresAt)
+	return err
+}
+
+func (s *PostgresStore) Delete(idHash string) error {
+	_, err := s.db.Exec("DELETE FROM user_sessions WHERE session_hash = $1", idHash)
+	return err
+}
+
+func (s *PostgresStore) DeleteUser(userID int) error {
+	_, err := s.db.Exec("DELETE FROM user_sessions WHERE user_id = $1", userID)
+	return err
+}
+
+func (s *PostgresStore) Purge(now time.Time) error {
+	_, err := s.db.Exec("DELETE FROM user_sessions WHERE expires_at <= $1", now)
+	return err
+}
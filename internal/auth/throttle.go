@@ -0,0 +1,153 @@
+package auth
+
+import (
+	"strings"
+	"time"
+)
+
+// Outcomes recorded in the login_attempts table
+const (
+	OutcomeSuccess = "success"
+	OutcomeFailure = "failure"
+	OutcomeUnlock  = "unlock" // an admin (or a password reset) cleared the failures
+)
+
+// Attempt is one login attempt, kept for auditing
+type Attempt struct {
+	Email   string
+	IP      string
+	Outcome string
+	At      time.Time
+}
+
+// AttemptStore records login attempts and answers the throttler's questions
+type AttemptStore interface {
+	Record(a Attempt) error
+	// AccountFailures counts an account's failures after since that came
+	// after its latest success or unlock, and returns when the last one was
+	AccountFailures(email string, since time.Time) (n int, last time.Time, err error)
+	// IPFailures counts failures from one client address after since
+	IPFailures(ip string, since time.Time) (n int, last time.Time, err error)
+	// FailingAccounts lists accounts with any failure after since
+	FailingAccounts(since time.Time) ([]string, error)
+}
+
+// Decision tells Login whether to check the password at all
+type Decision struct {
+	Allowed    bool
+	Locked     bool          // account or address is locked out, not just slowed down
+	RetryAfter time.Duration // how long until the next attempt will be considered
+}
+
+// Throttler slows down and then locks out repeated failed logins, per
+// account (guessing one family's password) and per client address
+// (trying many accounts from one machine)
+type Throttler struct {
+	Store AttemptStore
+	Now   func() time.Time
+
+	Window        time.Duration // failures older than this are forgotten
+	DelayAfter    int           // failures before delays start
+	BaseDelay     time.Duration // first delay, doubled for each further failure
+	MaxFailures   int           // failures that lock the account
+	Lockout       time.Duration // how long a locked account stays locked
+	IPMaxFailures int           // failures from one address that block it
+}
+
+func NewThrottler(store AttemptStore) *Throttler {
+	return &Throttler{
+		Store:         store,
+		Now:           time.Now,
+		Window:        30 * time.Minute,
+		DelayAfter:    3,
+		BaseDelay:     2 * time.Second,
+		MaxFailures:   5,
+		Lockout:       15 * time.Minute,
+		IPMaxFailures: 20,
+	}
+}
+
+// Check decides whether an attempt for email from ip may proceed
+func (t *Throttler) Check(email, ip string) (Decision, error) {
+	now := t.Now()
+	since := now.Add(-t.Window)
+
+	n, last, err := t.Store.IPFailures(ip, since)
+	if err != nil {
+		return Decision{}, err
+	}
+	if n >= t.IPMaxFailures {
+		if until := last.Add(t.Lockout); now.Before(until) {
+			return Decision{Locked: true, RetryAfter: until.Sub(now)}, nil
+		}
+	}
+
+	n, last, err = t.Store.AccountFailures(normalizeEmail(email), since)
+	if err != nil {
+		return Decision{}, err
+	}
+	if until, locked := t.waitUntil(n, last); now.Before(until) {
+		return Decision{Locked: locked, RetryAfter: until.Sub(now)}, nil
+	}
+	return Decision{Allowed: true}, nil
+}
+
+// waitUntil is when the next attempt is allowed after n recent failures
+func (t *Throttler) waitUntil(n int, last time.Time) (until time.Time, locked bool) {
+	switch {
+	case n >= t.MaxFailures:
+		return last.Add(t.Lockout), true
+	case n >= t.DelayAfter:
+		return last.Add(t.BaseDelay << (n - t.DelayAfter)), false
+	}
+	return time.Time{}, false
+}
+
+func (t *Throttler) RecordFailure(email, ip string) error {
+	return t.record(email, ip, OutcomeFailure)
+}
+
+func (t *Throttler) RecordSuccess(email, ip string) error {
+	return t.record(email, ip, OutcomeSuccess)
+}
+
+// Unlock clears an account's failures; ip is whoever unlocked it
+func (t *Throttler) Unlock(email, ip string) error {
+	return t.record(email, ip, OutcomeUnlock)
+}
+
+// LockedAccounts returns the accounts currently locked out and until when
+func (t *Throttler) LockedAccounts() (map[string]time.Time, error) {
+	now := t.Now()
+	since := now.Add(-t.Window)
+
+	emails, err := t.Store.FailingAccounts(since)
+	if err != nil {
+		return nil, err
+	}
+	locked := make(map[string]time.Time)
+	for _, email := range emails {
+		n, last, err := t.Store.AccountFailures(email, since)
+		if err != nil {
+			return nil, err
+		}
+		if until, isLock := t.waitUntil(n, last); isLock && now.Before(until) {
+			locked[email] = until
+		}
+	}
+	return locked, nil
+}
+
+func (t *Throttler) record(email, ip, outcome string) error {
+	return t.Store.Record(Attempt{
+		Email:   normalizeEmail(email),
+		IP:      ip,
+		Outcome: outcome,
+		At:      t.Now(),
+	})
+}
+
+// normalizeEmail makes "Foo@Example.com " and "foo@example.com" share a counter
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
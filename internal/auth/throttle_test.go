@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+// fakeClock is a settable Throttler.Now
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func newTestThrottler() (*Throttler, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 8, 1, 9, 0, 0, 0, time.UTC)}
+	t := NewThrottler(NewMemoryAttemptStore())
+	t.Now = clock.Now
+	return t, clock
+}
+
+// fail records n failures one second apart
+func fail(t *testing.T, th *Throttler, clock *fakeClock, email, ip string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		clock.Advance(time.Second)
+		if err := th.RecordFailure(email, ip); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func check(t *testing.T, th *Throttler, email, ip string) Decision {
+	t.Helper()
+	d, err := th.Check(email, ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d
+}
+
+func TestThrottlerDelaysThenLocks(t *testing.T) {
+	th, clock := newTestThrottler()
+	const email, ip = "family@example.com", "192.0.2.1"
+
+	fail(t, th, clock, email, ip, th.DelayAfter-1)
+	if d := check(t, th, email, ip); !d.Allowed {
+		t.Fatalf("below DelayAfter: %+v", d)
+	}
+
+	// Delays double with each failure
+	fail(t, th, clock, email, ip, 1)
+	if d := check(t, th, email, ip); d.Allowed || d.Locked || d.RetryAfter != th.BaseDelay {
+		t.Fatalf("at DelayAfter: %+v, want a %v delay", d, th.BaseDelay)
+	}
+	fail(t, th, clock, email, ip, 1)
+	if d := check(t, th, email, ip); d.Allowed || d.Locked || d.RetryAfter != 2*th.BaseDelay {
+		t.Fatalf("one more: %+v, want a %v delay", d, 2*th.BaseDelay)
+	}
+
+	// MaxFailures locks the account, also when written differently
+	fail(t, th, clock, email, ip, th.MaxFailures-th.DelayAfter-1)
+	d := check(t, th, " Family@Example.com", ip)
+	if d.Allowed || !d.Locked || d.RetryAfter != th.Lockout {
+		t.Fatalf("at MaxFailures: %+v, want locked for %v", d, th.Lockout)
+	}
+	locked, err := th.LockedAccounts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := locked[email]; !ok || len(locked) != 1 {
+		t.Errorf("LockedAccounts = %v", locked)
+	}
+
+	// Other accounts from the same address are unaffected
+	if d := check(t, th, "other@example.com", ip); !d.Allowed {
+		t.Errorf("other account: %+v", d)
+	}
+
+	// Still locked one second before the lockout ends, open after it
+	clock.Advance(th.Lockout - time.Second)
+	if d := check(t, th, email, ip); !d.Locked || d.RetryAfter != time.Second {
+		t.Fatalf("just before the end: %+v", d)
+	}
+	clock.Advance(time.Second)
+	if d := check(t, th, email, ip); !d.Allowed {
+		t.Fatalf("after the lockout: %+v", d)
+	}
+	if locked, _ := th.LockedAccounts(); len(locked) != 0 {
+		t.Errorf("LockedAccounts after the lockout = %v", locked)
+	}
+}
+
+func TestThrottlerForgetsOldFailures(t *testing.T) {
+	th, clock := newTestThrottler()
+	const email, ip = "family@example.com", "192.0.2.1"
+
+	fail(t, th, clock, email, ip, th.MaxFailures-1)
+	clock.Advance(th.Window)
+	// The earlier failures are out of the window, so this one alone counts
+	fail(t, th, clock, email, ip, 1)
+	if d := check(t, th, email, ip); !d.Allowed {
+		t.Fatalf("old failures still count: %+v", d)
+	}
+}
+
+func TestThrottlerSuccessResetsCounter(t *testing.T) {
+	th, clock := newTestThrottler()
+	const email, ip = "family@example.com", "192.0.2.1"
+
+	fail(t, th, clock, email, ip, th.MaxFailures-1)
+	clock.Advance(time.Minute) // wait out the delay
+	if d := check(t, th, email, ip); !d.Allowed {
+		t.Fatalf("after the delay: %+v", d)
+	}
+	clock.Advance(time.Second)
+	if err := th.RecordSuccess(email, ip); err != nil {
+		t.Fatal(err)
+	}
+
+	// Without the reset this failure would lock the account
+	fail(t, th, clock, email, ip, 1)
+	if d := check(t, th, email, ip); !d.Allowed {
+		t.Fatalf("failures before the success still count: %+v", d)
+	}
+	fail(t, th, clock, email, ip, th.MaxFailures-1)
+	if d := check(t, th, email, ip); !d.Locked {
+		t.Fatalf("new failures should lock again: %+v", d)
+	}
+}
+
+func TestThrottlerUnlock(t *testing.T) {
+	th, clock := newTestThrottler()
+	const email, ip = "family@example.com", "192.0.2.1"
+
+	fail(t, th, clock, email, ip, th.MaxFailures)
+	if d := check(t, th, email, ip); !d.Locked {
+		t.Fatalf("not locked: %+v", d)
+	}
+	clock.Advance(time.Second)
+	if err := th.Unlock(email, "198.51.100.7"); err != nil {
+		t.Fatal(err)
+	}
+	if d := check(t, th, email, ip); !d.Allowed {
+		t.Fatalf("after unlock: %+v", d)
+	}
+}
+
+func TestThrottlerBlocksAddress(t *testing.T) {
+	th, clock := newTestThrottler()
+	const ip = "192.0.2.1"
+
+	// One failure each on many accounts: no account reaches a delay
+	for i := 0; i < th.IPMaxFailures; i++ {
+		fail(t, th, clock, string(rune('a'+i))+"@example.com", ip, 1)
+	}
+	d := check(t, th, "new@example.com", ip)
+	if d.Allowed || !d.Locked {
+		t.Fatalf("address not blocked: %+v", d)
+	}
+	if d := check(t, th, "new@example.com", "198.51.100.7"); !d.Allowed {
+		t.Errorf("other address blocked: %+v", d)
+	}
+
+	clock.Advance(th.Lockout)
+	if d := check(t, th, "new@example.com", ip); !d.Allowed {
+		t.Errorf("address still blocked after the lockout: %+v", d)
+	}
+}
@@ -0,0 +1,344 @@
+// Package backup writes and restores snapshots of the whole event: every
+// table as JSON plus the uploaded files, bundled in one zip.
+//
+// Layout of a snapshot:
+//
+//	manifest.json         format version, creation time, row counts
+//	tables/<table>.json   one JSON array of rows per table
+//	uploads/<file>        the uploaded files (see package storage)
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"path"
+	"strings"
+	"time"
+
+	"example.com/myapp/internal/storage"
+	"example.com/myapp/internal/upload"
+)
+
+// FormatVersion is written to every manifest. Restore refuses other versions.
+const FormatVersion = 1
+
+// Limits on what Restore reads out of a snapshot. The sizes in a zip's
+// headers are the uploader's word; a small crafted file can expand to
+// far more than the disk or memory holds.
+const (
+	maxRestoreSize    = 2 << 30 // 2GB uncompressed, all entries together
+	maxRestoreEntries = 20000
+)
+
+var (
+	ErrNotEmpty          = errors.New("the database already holds event data")
+	ErrUnsupportedFormat = errors.New("unsupported snapshot format")
+)
+
+// table is one table in the snapshot. Tables are listed parents first, so
+// restoring in this order satisfies the foreign keys.
+type table struct {
+	Name   string
+	Key    string // ordering column, and the serial column whose sequence is reset
+	Serial bool
+}
+
+// tables excludes data that must not outlive a restore: logins, throttling
+// counters and unused email tokens
+var tables = []table{
+	{"event_editions", "edition_id", true},
+	{"event_days", "day_id", true},
+	{"system_settings", "setting_key", false},
+	{"instructors", "instructor_id", true},
+	{"users", "id", true},
+	{"user_profiles", "id", true},
+	{"classes", "class_id", true},
+	{"class_instructors", "class_id", false},
+	{"class_sessions", "session_id", true},
+	{"session_enrollments", "enrollment_id", true},
+	{"audit_logs", "audit_id", true},
+}
+
+// eventTables must be empty before a restore. Settings, the seeded edition
+// and staff accounts may exist; they are replaced by the snapshot.
+var eventTables = []string{"classes", "class_sessions", "session_enrollments", "user_profiles"}
+
+// Manifest describes a snapshot
+type Manifest struct {
+	FormatVersion int            `json:"format_version"`
+	CreatedAt     time.Time      `json:"created_at"`
+	Rows          map[string]int `json:"rows"`
+	Files         int            `json:"files"`
+}
+
+// Write streams a snapshot of the database and of the uploaded files to w. The
+// tables are read in one repeatable-read transaction, so they're consistent
+// with each other even while the site is in use.
+func Write(db *sql.DB, store storage.Storage, w io.Writer) (Manifest, error) {
+	m := Manifest{FormatVersion: FormatVersion, CreatedAt: time.Now(), Rows: map[string]int{}}
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return m, err
+	}
+	defer tx.Rollback()
+
+	zw := zip.NewWriter(w)
+	for _, t := range tables {
+		rows, err := readTable(tx, t)
+		if err != nil {
+			return m, fmt.Errorf("read %s: %w", t.Name, err)
+		}
+		m.Rows[t.Name] = len(rows)
+		if err := writeJSON(zw, "tables/"+t.Name+".json", rows); err != nil {
+			return m, err
+		}
+	}
+
+	if m.Files, err = writeUploads(zw, store); err != nil {
+		return m, err
+	}
+	if err := writeJSON(zw, "manifest.json", m); err != nil {
+		return m, err
+	}
+	return m, zw.Close()
+}
+
+// readTable returns every row of a table as raw JSON objects
+func readTable(tx *sql.Tx, t table) ([]json.RawMessage, error) {
+	rows, err := tx.Query(fmt.Sprintf("SELECT row_to_json(t)::text FROM %s t ORDER BY t.%s", t.Name, t.Key))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	list := []json.RawMessage{}
+	for rows.Next() {
+		var s string
+		if err := rows.Scan(&s); err != nil {
+			return nil, err
+		}
+		list = append(list, json.RawMessage(s))
+	}
+	return list, rows.Err()
+}
+
+func writeJSON(zw *zip.Writer, name string, v any) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", " ")
+	return enc.Encode(v)
+}
+
+// writeUploads adds the uploaded files to the zip
+func writeUploads(zw *zip.Writer, store storage.Storage) (int, error) {
+	files, err := store.List()
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, f := range files {
+		src, _, err := store.Get(f.Name)
+		if err == storage.ErrNotFound {
+			continue // deleted since it was listed
+		}
+		if err != nil {
+			return count, err
+		}
+		dst, err := zw.Create("uploads/" + f.Name)
+		if err == nil {
+			_, err = io.Copy(dst, src)
+		}
+		src.Close()
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Restore loads a snapshot into a database without event data (for example
+// right after a reset) and puts the uploaded files back into store.
+// Everything in the database is replaced in one transaction, including
+// staff accounts, so current logins end and staff sign in with the
+// passwords they had when the snapshot was taken. Audit log entries that
+// already exist are kept as they are.
+func Restore(db *sql.DB, store storage.Storage, r io.ReaderAt, size int64) (Manifest, error) {
+	var m Manifest
+
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return m, ErrUnsupportedFormat
+	}
+	if len(zr.File) > maxRestoreEntries {
+		return m, fmt.Errorf("%w: more than %d files", ErrUnsupportedFormat, maxRestoreEntries)
+	}
+	b := &budget{left: maxRestoreSize}
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	if err := readJSON(b, files["manifest.json"], &m); err != nil {
+		return m, ErrUnsupportedFormat
+	}
+	if m.FormatVersion != FormatVersion {
+		return m, fmt.Errorf("%w: version %d", ErrUnsupportedFormat, m.FormatVersion)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return m, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	for _, name := range eventTables {
+		var exists bool
+		if err := tx.QueryRow(fmt.Sprintf("SELECT EXISTS (SELECT 1 FROM %s)", name)).Scan(&exists); err != nil {
+			return m, err
+		}
+		if exists {
+			return m, ErrNotEmpty
+		}
+	}
+
+	// Replace what a fresh install seeds (children first; audit_logs is append-only)
+	for i := len(tables) - 1; i >= 0; i-- {
+		if tables[i].Name == "audit_logs" {
+			continue
+		}
+		if _, err := tx.Exec("DELETE FROM " + tables[i].Name); err != nil {
+			return m, fmt.Errorf("clear %s: %w", tables[i].Name, err)
+		}
+	}
+
+	for _, t := range tables {
+		var rows []json.RawMessage
+		if err := readJSON(b, files["tables/"+t.Name+".json"], &rows); err != nil {
+			return m, fmt.Errorf("%w: %s: %v", ErrUnsupportedFormat, t.Name, err)
+		}
+		if err := insertRows(tx, t, rows); err != nil {
+			return m, fmt.Errorf("restore %s: %w", t.Name, err)
+		}
+	}
+
+	// Files go back before the commit: a failed copy leaves the database untouched
+	if err := restoreUploads(zr.File, store, b); err != nil {
+		return m, err
+	}
+	return m, tx.Commit()
+}
+
+// insertRows inserts JSON rows with json_populate_record, so column types
+// come from the table itself. The serial sequence then continues after the
+// largest restored ID.
+func insertRows(tx *sql.Tx, t table, rows []json.RawMessage) error {
+	conflict := ""
+	if t.Name == "audit_logs" {
+		conflict = " ON CONFLICT (audit_id) DO NOTHING"
+	}
+	query := fmt.Sprintf("INSERT INTO %s SELECT * FROM json_populate_record(NULL::%s, $1::json)%s", t.Name, t.Name, conflict)
+	for _, row := range rows {
+		if _, err := tx.Exec(query, string(row)); err != nil {
+			return err
+		}
+	}
+
+	if t.Serial {
+		_, err := tx.Exec(fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence('%s', '%s'), COALESCE(MAX(%s), 1), MAX(%s) IS NOT NULL) FROM %s",
+			t.Name, t.Key, t.Key, t.Key, t.Name))
+		return err
+	}
+	return nil
+}
+
+// budget is what is left of maxRestoreSize while a snapshot is read
+type budget struct {
+	left int64
+}
+
+// read returns the uncompressed content of f, which may be at most limit
+// bytes and must fit in what is left of the budget
+func (b *budget) read(f *zip.File, limit int64) ([]byte, error) {
+	limit = min(limit, b.left)
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	// One byte past the limit tells a too-large entry from one of exactly limit
+	data, err := io.ReadAll(io.LimitReader(rc, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%w: %s is too large", ErrUnsupportedFormat, f.Name)
+	}
+	b.left -= int64(len(data))
+	return data, nil
+}
+
+func readJSON(b *budget, f *zip.File, v any) error {
+	if f == nil {
+		return errors.New("missing file")
+	}
+	data, err := b.read(f, b.left)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// restoreUploads puts the uploads/ entries into store. Names with a
+// directory part are rejected so a crafted zip can't write elsewhere.
+// Content gets the checks of a normal upload; a file that fails them,
+// such as one stored before uploads were checked, is left out (it could
+// not be served anyway).
+func restoreUploads(files []*zip.File, store storage.Storage, b *budget) error {
+	for _, f := range files {
+		name, ok := strings.CutPrefix(f.Name, "uploads/")
+		if !ok || name == "" {
+			continue
+		}
+		if !storage.ValidName(name) {
+			return fmt.Errorf("%w: bad file name %q", ErrUnsupportedFormat, f.Name)
+		}
+
+		// No upload is larger than a syllabus. The header's size is only
+		// trusted to skip a file; read stops at the limit regardless.
+		if f.UncompressedSize64 > upload.MaxPDFSize {
+			log.Printf("Skipped %s from the snapshot: %v", name, upload.ErrTooLarge)
+			continue
+		}
+		data, err := b.read(f, upload.MaxPDFSize)
+		if err != nil {
+			return err
+		}
+		if err := upload.CheckStored(name, data); err != nil {
+			log.Printf("Skipped %s from the snapshot: %v", name, err)
+			continue
+		}
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		if err := store.Put(name, bytes.NewReader(data), contentType); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,267 @@
+package backup
+
+import (
+	"archive/zip"
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"example.com/myapp/internal/database/dbtest"
+	"example.com/myapp/internal/storage"
+)
+
+// seed adds one of everything a snapshot carries
+func seed(t *testing.T, db *sql.DB) {
+	t.Helper()
+	stmts := []string{
+		`INSERT INTO users (email, password_hash, role, email_verified_at)
+		 VALUES ('staff@example.com', '$2a$10$staffhash', 'super_admin', NOW()),
+		        ('family@example.com', '$2a$10$familyhash', 'student', NOW())`,
+		`INSERT INTO user_profiles (user_id, student_name, guardian_name, school_name, grade, student_kana, phone)
+		 SELECT id, '高専 太郎', '高専 花子', '第一中学校', '2', 'こうせん たろう', '090-1234-5678'
+		 FROM users WHERE email = 'family@example.com'`,
+		`INSERT INTO instructors (name) VALUES ('担当 一郎')`,
+		`INSERT INTO classes (class_name, description, category, target_grades, prerequisites, image_url,
+		                      syllabus_pdf_url, room_number, room_name,
+		                      registration_start_at, registration_end_at, edition_id)
+		 SELECT 'ロボット入門', '**楽しい**授業', '情報', '{1,2}', '筆記用具', '', 'a.pdf', '1-101', '第1演習室',
+		        '2030-01-01 09:00:00.123456+09', '2030-02-01 17:00+09', edition_id
+		 FROM event_editions WHERE status = 'active'`,
+		`INSERT INTO class_instructors (class_id, instructor_id) SELECT class_id, instructor_id FROM classes, instructors`,
+		`INSERT INTO class_sessions (class_id, day_id, start_at, end_at, capacity, current_enrolled_count)
+		 SELECT class_id, (SELECT MIN(day_id) FROM event_days), '2030-03-01 10:00+09', '2030-03-01 11:00+09', 20, 1
+		 FROM classes`,
+		`INSERT INTO session_enrollments (session_id, user_profile_id, status)
+		 SELECT session_id, p.id, 'confirmed' FROM class_sessions, user_profiles p`,
+		`INSERT INTO audit_logs (actor_id, action, target_type, target_id, after_data)
+		 VALUES (1, 'class.create', 'class', '1', '{"class_name": "ロボット入門"}')`,
+	}
+	for _, s := range stmts {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("seed: %v\n%s", err, s)
+		}
+	}
+}
+
+// dump reads every snapshot table the way Write does
+func dump(t *testing.T, db *sql.DB) map[string][]string {
+	t.Helper()
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	out := map[string][]string{}
+	for _, tb := range tables {
+		rows, err := readTable(tx, tb)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, r := range rows {
+			out[tb.Name] = append(out[tb.Name], string(r))
+		}
+	}
+	return out
+}
+
+// reset empties the event data the way the admin reset does
+func reset(t *testing.T, db *sql.DB, store storage.Storage) {
+	t.Helper()
+	for _, s := range []string{
+		"DELETE FROM session_enrollments",
+		"DELETE FROM class_sessions",
+		"DELETE FROM class_instructors",
+		"DELETE FROM classes",
+		"DELETE FROM event_editions WHERE status <> 'active'",
+		"DELETE FROM instructors",
+		"DELETE FROM user_profiles WHERE user_id IN (SELECT id FROM users WHERE role = 'student')",
+		"DELETE FROM users WHERE role = 'student'",
+		"DELETE FROM system_settings",
+	} {
+		if _, err := db.Exec(s); err != nil {
+			t.Fatalf("reset: %v", err)
+		}
+	}
+	files, _ := store.List()
+	for _, f := range files {
+		store.Delete(f.Name)
+	}
+}
+
+func TestSnapshotResetRestore(t *testing.T) {
+	db := dbtest.Open(t)
+	store := storage.NewMemory()
+	seed(t, db)
+	const pdf = "%PDF-1.4 syllabus"
+	if err := store.Put("a.pdf", strings.NewReader(pdf), "application/pdf"); err != nil {
+		t.Fatal(err)
+	}
+	before := dump(t, db)
+
+	var buf bytes.Buffer
+	m, err := Write(db, store, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Rows["classes"] != 1 || m.Rows["session_enrollments"] != 1 || m.Files != 1 {
+		t.Fatalf("manifest = %+v", m)
+	}
+
+	reset(t, db, store)
+	if got := dump(t, db); reflect.DeepEqual(got, before) {
+		t.Fatal("reset changed nothing")
+	}
+
+	if _, err := Restore(db, store, bytes.NewReader(buf.Bytes()), int64(buf.Len())); err != nil {
+		t.Fatal(err)
+	}
+	after := dump(t, db)
+	for _, tb := range tables {
+		if !reflect.DeepEqual(after[tb.Name], before[tb.Name]) {
+			t.Errorf("%s differs after restore:\n got  %v\n want %v", tb.Name, after[tb.Name], before[tb.Name])
+		}
+	}
+	rc, _, err := store.Get("a.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != pdf {
+		t.Errorf("restored file = %q", data)
+	}
+
+	// New rows get fresh IDs after the restored ones
+	var id int
+	if err := db.QueryRow("INSERT INTO instructors (name) VALUES ('新任') RETURNING instructor_id").Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	if id <= 1 {
+		t.Errorf("sequence not moved past restored rows: id %d", id)
+	}
+
+	// A second restore would overwrite event data
+	if _, err := Restore(db, store, bytes.NewReader(buf.Bytes()), int64(buf.Len())); !errors.Is(err, ErrNotEmpty) {
+		t.Errorf("restore over data: err = %v, want ErrNotEmpty", err)
+	}
+}
+
+func TestRestoreRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		zip  func(t *testing.T) []byte
+	}{
+		{"not a zip", func(t *testing.T) []byte { return []byte("PK? no") }},
+		{"no manifest", func(t *testing.T) []byte { return zipOf(t, map[string]string{"tables/users.json": "[]"}) }},
+		{"other version", func(t *testing.T) []byte {
+			return zipOf(t, map[string]string{"manifest.json": `{"format_version": 99}`})
+		}},
+		{"too many files", func(t *testing.T) []byte {
+			files := map[string]string{"manifest.json": `{"format_version": 1}`}
+			for i := range maxRestoreEntries {
+				files[fmt.Sprintf("uploads/%d.pdf", i)] = ""
+			}
+			return zipOf(t, files)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := tt.zip(t)
+			// Rejected before the database is touched
+			_, err := Restore(nil, storage.NewMemory(), bytes.NewReader(data), int64(len(data)))
+			if !errors.Is(err, ErrUnsupportedFormat) {
+				t.Fatalf("err = %v, want ErrUnsupportedFormat", err)
+			}
+		})
+	}
+}
+
+func TestRestoreUploadsRejectsPaths(t *testing.T) {
+	data := zipOf(t, map[string]string{"uploads/../../etc/passwd": "x"})
+	zr := mustZip(t, data)
+	if err := restoreUploads(zr.File, storage.NewMemory(), &budget{left: maxRestoreSize}); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Fatalf("err = %v, want ErrUnsupportedFormat", err)
+	}
+}
+
+func TestRestoreUploadsChecksContent(t *testing.T) {
+	hash := strings.Repeat("0f", 32)
+	var img bytes.Buffer
+	png.Encode(&img, image.NewGray(image.Rect(0, 0, 2, 2)))
+	files := map[string]string{
+		"uploads/" + hash + ".pdf":                     "%PDF-1.4 syllabus",
+		"uploads/syllabus_legacy.pdf":                  "%PDF-1.4 legacy",
+		"uploads/" + hash + ".png":                     img.String(),
+		"uploads/legacy_page.pdf":                      "<html><script>alert(1)</script></html>",
+		"uploads/" + strings.Repeat("1e", 32) + ".png": "%PDF-1.4 not an image",
+		"uploads/" + strings.Repeat("2d", 32) + ".jpg": img.String(), // a PNG under a JPEG name
+		"uploads/notes.txt":                            "hello",
+	}
+	store := storage.NewMemory()
+	if err := restoreUploads(mustZip(t, zipOf(t, files)).File, store, &budget{left: maxRestoreSize}); err != nil {
+		t.Fatal(err)
+	}
+	list, _ := store.List()
+	var names []string
+	for _, f := range list {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if want := []string{hash + ".pdf", hash + ".png", "syllabus_legacy.pdf"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("restored %q, want %q", names, want)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	zr := mustZip(t, zipOf(t, map[string]string{"a": strings.Repeat("x", 6), "b": strings.Repeat("y", 6)}))
+	entry := map[string]*zip.File{}
+	for _, f := range zr.File {
+		entry[f.Name] = f
+	}
+
+	b := &budget{left: 10}
+	if _, err := b.read(entry["a"], 5); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("entry over its own limit: err = %v", err)
+	}
+	if data, err := b.read(entry["a"], 10); err != nil || string(data) != "xxxxxx" || b.left != 4 {
+		t.Fatalf("read = %q, %v; %d left", data, err, b.left)
+	}
+	// Each entry is small, but together they are over the total
+	if _, err := b.read(entry["b"], 10); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("entry over the total: err = %v", err)
+	}
+}
+
+func zipOf(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, body := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func mustZip(t *testing.T, data []byte) *zip.Reader {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return zr
+}
@@ -2,7 +2,10 @@ package config
 
 import (
 	"fmt"
+	"log"
 	"os"
+	"strconv"
+	"strings"
 )
 
 type Config struct {
@@ -10,6 +13,20 @@ type Config struct {
 	CookieHash  string
 	CookieBlock string
 	ListenAddr  string
+	BaseURL     string // public URL used in emailed links, e.g. https://example.com
+	BackupDir   string // where snapshots are written before a reset
+	// BackupRetentionDays: snapshots older than this are deleted (0 keeps all)
+	BackupRetentionDays int
+	// Upload Storage ("local", "s3" or "memory")
+	Storage     string
+	UploadDir   string // local: directory of the uploaded files
+	S3Endpoint  string
+	S3Region    string
+	S3Bucket    string
+	S3Prefix    string
+	S3AccessKey string
+	S3SecretKey string
+	S3PublicURL string // optional: public URL of the bucket, files are redirected there
 	// SMTP Configuration
 	SMTPHost     string
 	SMTPPort     string
@@ -21,10 +38,23 @@ type Config struct {
 func Load() Config {
 	return Config{
 		// Centralized Logic: Try DATABASE_URL first, otherwise build it manually
-		DB_DSN:      getDatabaseDSN(),
-		CookieHash:  getEnv("COOKIE_HASH_KEY", ""),
-		CookieBlock: getEnv("COOKIE_BLOCK_KEY", ""),
-		ListenAddr:  getEnv("LISTEN_ADDR", ":8080"),
+		DB_DSN:              getDatabaseDSN(),
+		CookieHash:          getEnv("COOKIE_HASH_KEY", ""),
+		CookieBlock:         getEnv("COOKIE_BLOCK_KEY", ""),
+		ListenAddr:          getEnv("LISTEN_ADDR", ":8080"),
+		BaseURL:             strings.TrimRight(getEnv("BASE_URL", "http://localhost:8080"), "/"),
+		BackupDir:           getEnv("BACKUP_DIR", "./backups"),
+		BackupRetentionDays: getEnvInt("BACKUP_RETENTION_DAYS", 30),
+		// Upload Storage
+		Storage:     getEnv("STORAGE_BACKEND", "local"),
+		UploadDir:   getEnv("UPLOAD_DIR", "./web/static/uploads"),
+		S3Endpoint:  getEnv("S3_ENDPOINT", ""),
+		S3Region:    getEnv("S3_REGION", ""),
+		S3Bucket:    getEnv("S3_BUCKET", ""),
+		S3Prefix:    getEnv("S3_PREFIX", ""),
+		S3AccessKey: getEnv("S3_ACCESS_KEY_ID", ""),
+		S3SecretKey: getEnv("S3_SECRET_ACCESS_KEY", ""),
+		S3PublicURL: getEnv("S3_PUBLIC_URL", ""),
 		// SMTP Configuration
 		SMTPHost:     getEnv("SMTP_HOST", ""),
 		SMTPPort:     getEnv("SMTP_PORT", "587"),
@@ -58,3 +88,16 @@ func getEnv(k, def string) string {
 	}
 	return def
 }
+
+func getEnvInt(k string, def int) int {
+	v := os.Getenv(k)
+	if v == "" {
+		return def
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		log.Printf("config: %s=%q is not a number, using %d", k, v, def)
+		return def
+	}
+	return n
+}
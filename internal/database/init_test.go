@@ -0,0 +1,92 @@
+package database
+
+import (
+	"testing"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+// TestInitSQLUpgradesFirstRelease loads the schema of the first release
+// (testdata/init_v1.sql) with some data, then runs the current init.sql
+// over it, twice, as an upgrade would
+func TestInitSQLUpgradesFirstRelease(t *testing.T) {
+	db := dbtest.OpenEmpty(t)
+	dbtest.ExecFile(t, db, "testdata/init_v1.sql")
+	for _, q := range []string{
+		`INSERT INTO users (email, password_hash, is_admin) VALUES ('admin@example.com', 'x', TRUE), ('family@example.com', 'x', FALSE)`,
+		`INSERT INTO user_profiles (user_id, student_name, guardian_name, school_name, grade)
+		 SELECT id, '生徒', '保護者', '中学校', '2' FROM users WHERE NOT is_admin`,
+		`INSERT INTO classes (class_name, registration_start_at, registration_end_at) VALUES ('授業', NOW(), NOW() + INTERVAL '1 day')`,
+		`INSERT INTO class_sessions (class_id, day_sequence, start_at, end_at, capacity, current_enrolled_count)
+		 SELECT class_id, 2, '2025-08-02 10:00+09', '2025-08-02 11:00+09', 10, 1 FROM classes`,
+		`INSERT INTO session_enrollments (session_id, user_profile_id) SELECT session_id, p.id FROM class_sessions, user_profiles p`,
+	} {
+		if _, err := db.Exec(q); err != nil {
+			t.Fatalf("%v\n%s", err, q)
+		}
+	}
+
+	dbtest.ExecFile(t, db, dbtest.InitSQL())
+	dbtest.ExecFile(t, db, dbtest.InitSQL())
+
+	roles := map[string]string{}
+	rows, err := db.Query("SELECT email, role, email_verified_at IS NOT NULL FROM users")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+		var addr, role string
+		var verified bool
+		if err := rows.Scan(&addr, &role, &verified); err != nil {
+			t.Fatal(err)
+		}
+		roles[addr] = role
+		if !verified {
+			t.Errorf("%s has to verify its address again", addr)
+		}
+	}
+	rows.Close()
+	if roles["admin@example.com"] != "super_admin" || roles["family@example.com"] != "student" {
+		t.Errorf("roles = %v", roles)
+	}
+	var adminColumn bool
+	db.QueryRow(`SELECT EXISTS (SELECT 1 FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = 'users' AND column_name = 'is_admin')`).Scan(&adminColumn)
+	if adminColumn {
+		t.Error("is_admin was not dropped")
+	}
+
+	// The session moved to the seeded second day, dated from the old setting
+	var label, date string
+	var active bool
+	err = db.QueryRow(`
+		SELECT d.label, d.event_date::text, e.status = 'active'
+		FROM class_sessions cs
+		JOIN classes c ON c.class_id = cs.class_id
+		JOIN event_editions e ON e.edition_id = c.edition_id
+		JOIN event_days d ON d.day_id = cs.day_id AND d.edition_id = e.edition_id
+	`).Scan(&label, &date, &active)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if label != "2日目" || date != "2025-08-02" || !active {
+		t.Errorf("session day = %s %s (active edition %v)", label, date, active)
+	}
+
+	// New columns have their defaults, and the capacity check is in place
+	var kana, category string
+	var grades []byte
+	err = db.QueryRow("SELECT student_kana FROM user_profiles").Scan(&kana)
+	if err == nil {
+		err = db.QueryRow("SELECT category, target_grades::text FROM classes").Scan(&category, &grades)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kana != "" || category != "" || string(grades) != "{}" {
+		t.Errorf("defaults: kana %q, category %q, grades %s", kana, category, grades)
+	}
+	if _, err := db.Exec("UPDATE class_sessions SET current_enrolled_count = capacity + 1"); err == nil {
+		t.Error("chk_session_capacity was not added")
+	}
+}
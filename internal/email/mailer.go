@@ -17,6 +17,12 @@ type Config struct {
 	From     string
 }
 
+// Sender sends one HTML email. Mailer is the SMTP implementation; tests
+// pass a fake that records the messages.
+type Sender interface {
+	Send(to, subject, htmlBody string) error
+}
+
 // Mailer handles email sending
 type Mailer struct {
 	config Config
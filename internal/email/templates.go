@@ -2,6 +2,8 @@ package email
 
 import (
 	"fmt"
+	"html"
+	"strings"
 	"time"
 )
 
@@ -66,7 +68,7 @@ func GenerateEnrollmentConfirmation(data EnrollmentData) string {
         <ul style="margin: 10px 0 0 0; padding-left: 20px; color: #856404;">
             <li>当日は開始時刻の10分前までにお越しください</li>
             <li>保護者の方もご一緒にご参加いただけます</li>
-            <li>キャンセルされる場合は、お早めにご連絡ください</li>
+            <li>キャンセルされる場合は、お早めにマイページから手続きしてください</li>
         </ul>
     </div>
 
@@ -94,3 +96,378 @@ func GenerateEnrollmentConfirmation(data EnrollmentData) string {
 func GetEnrollmentSubject() string {
 	return "【模擬授業】申込完了のお知らせ"
 }
+
+// GenerateCancellationConfirmation creates the HTML body for cancellation confirmation
+func GenerateCancellationConfirmation(data EnrollmentData) string {
+	startDate := data.StartAt.Format("2006年01月02日")
+	startTime := data.StartAt.Format("15:04")
+	endTime := data.EndAt.Format("15:04")
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>授業申込キャンセル</title>
+</head>
+<body style="font-family: 'メイリオ', Meiryo, 'ヒラギノ角ゴ Pro', 'Hiragino Kaku Gothic Pro', sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin-bottom: 20px;">
+        <h1 style="color: #0066cc; margin-top: 0;">申込キャンセルのお知らせ</h1>
+        <p><strong>%s</strong> 様</p>
+        <p>以下の模擬授業の申込をキャンセルしました。</p>
+    </div>
+
+    <div style="background-color: #ffffff; border: 1px solid #dee2e6; border-radius: 8px; padding: 20px; margin-bottom: 20px;">
+        <h2 style="color: #0066cc; border-bottom: 2px solid #0066cc; padding-bottom: 10px;">キャンセル内容</h2>
+
+        <table style="width: 100%%; border-collapse: collapse;">
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold; width: 30%%;">授業名</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold;">日時</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s %s 〜 %s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; font-weight: bold;">教室</td>
+                <td style="padding: 12px 0;">%s %s</td>
+            </tr>
+        </table>
+    </div>
+
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 15px; text-align: center; font-size: 0.9em; color: #6c757d;">
+        <p style="margin: 0;">このメールは送信専用です。ご返信いただいても対応できませんのでご了承ください。</p>
+        <p style="margin: 5px 0 0 0;">お心当たりのない場合は学校までご連絡ください。</p>
+    </div>
+</body>
+</html>
+`,
+		data.StudentName,
+		data.ClassName,
+		startDate,
+		startTime,
+		endTime,
+		data.RoomNumber,
+		data.RoomName,
+	)
+
+	return html
+}
+
+// GetCancellationSubject returns the subject line for cancellation confirmation
+func GetCancellationSubject() string {
+	return "【模擬授業】申込キャンセルのお知らせ"
+}
+
+// GenerateWaitlistPromotion creates the HTML body sent when a waitlisted student gets a seat
+func GenerateWaitlistPromotion(data EnrollmentData) string {
+	startDate := data.StartAt.Format("2006年01月02日")
+	startTime := data.StartAt.Format("15:04")
+	endTime := data.EndAt.Format("15:04")
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>キャンセル待ち繰り上げ</title>
+</head>
+<body style="font-family: 'メイリオ', Meiryo, 'ヒラギノ角ゴ Pro', 'Hiragino Kaku Gothic Pro', sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin-bottom: 20px;">
+        <h1 style="color: #0066cc; margin-top: 0;">キャンセル待ち繰り上げのお知らせ</h1>
+        <p><strong>%s</strong> 様</p>
+        <p>キャンセル待ちをしていた模擬授業に空きが出たため、申込が確定しました。</p>
+    </div>
+
+    <div style="background-color: #ffffff; border: 1px solid #dee2e6; border-radius: 8px; padding: 20px; margin-bottom: 20px;">
+        <h2 style="color: #0066cc; border-bottom: 2px solid #0066cc; padding-bottom: 10px;">申込内容</h2>
+
+        <table style="width: 100%%; border-collapse: collapse;">
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold; width: 30%%;">授業名</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold;">日時</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s %s 〜 %s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold;">教室</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s %s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; font-weight: bold;">担当教員</td>
+                <td style="padding: 12px 0;">%s</td>
+            </tr>
+        </table>
+    </div>
+
+    <div style="background-color: #fff3cd; border: 1px solid #ffc107; border-radius: 8px; padding: 15px; margin-bottom: 20px;">
+        <p style="margin: 0; color: #856404;"><strong>⚠️ 注意事項</strong></p>
+        <ul style="margin: 10px 0 0 0; padding-left: 20px; color: #856404;">
+            <li>参加できない場合は、マイページから早めにキャンセルしてください</li>
+            <li>当日は開始時刻の10分前までにお越しください</li>
+        </ul>
+    </div>
+
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 15px; text-align: center; font-size: 0.9em; color: #6c757d;">
+        <p style="margin: 0;">このメールは送信専用です。ご返信いただいても対応できませんのでご了承ください。</p>
+        <p style="margin: 5px 0 0 0;">お問い合わせは学校までご連絡ください。</p>
+    </div>
+</body>
+</html>
+`,
+		data.StudentName,
+		data.ClassName,
+		startDate,
+		startTime,
+		endTime,
+		data.RoomNumber,
+		data.RoomName,
+		data.TeacherName,
+	)
+
+	return html
+}
+
+// GetWaitlistPromotionSubject returns the subject line for waitlist promotion
+func GetWaitlistPromotionSubject() string {
+	return "【模擬授業】キャンセル待ち繰り上げのお知らせ"
+}
+
+// ChangeNoticeData contains information for the class change notice
+type ChangeNoticeData struct {
+	EnrollmentData          // the session as it is now
+	Changes        []string // human-readable lines, e.g. "教室: 1-101 → 2-201"
+}
+
+// GenerateClassChangeNotice creates the HTML body sent when an admin changes the time or room of a class
+func GenerateClassChangeNotice(data ChangeNoticeData) string {
+	startDate := data.StartAt.Format("2006年01月02日")
+	startTime := data.StartAt.Format("15:04")
+	endTime := data.EndAt.Format("15:04")
+
+	var changes strings.Builder
+	for _, c := range data.Changes {
+		changes.WriteString("<li>" + html.EscapeString(c) + "</li>")
+	}
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>授業内容変更</title>
+</head>
+<body style="font-family: 'メイリオ', Meiryo, 'ヒラギノ角ゴ Pro', 'Hiragino Kaku Gothic Pro', sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin-bottom: 20px;">
+        <h1 style="color: #0066cc; margin-top: 0;">授業内容変更のお知らせ</h1>
+        <p><strong>%s</strong> 様</p>
+        <p>お申込みいただいている模擬授業の内容が変更されました。</p>
+    </div>
+
+    <div style="background-color: #fff3cd; border: 1px solid #ffc107; border-radius: 8px; padding: 15px; margin-bottom: 20px;">
+        <p style="margin: 0; color: #856404;"><strong>変更点</strong></p>
+        <ul style="margin: 10px 0 0 0; padding-left: 20px; color: #856404;">%s</ul>
+    </div>
+
+    <div style="background-color: #ffffff; border: 1px solid #dee2e6; border-radius: 8px; padding: 20px; margin-bottom: 20px;">
+        <h2 style="color: #0066cc; border-bottom: 2px solid #0066cc; padding-bottom: 10px;">変更後の内容</h2>
+
+        <table style="width: 100%%; border-collapse: collapse;">
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold; width: 30%%;">授業名</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold;">日時</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s %s 〜 %s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; font-weight: bold;">教室</td>
+                <td style="padding: 12px 0;">%s %s</td>
+            </tr>
+        </table>
+    </div>
+
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 15px; text-align: center; font-size: 0.9em; color: #6c757d;">
+        <p style="margin: 0;">変更後の日時で参加できない場合は、マイページからキャンセルしてください。</p>
+        <p style="margin: 5px 0 0 0;">お問い合わせは学校までご連絡ください。</p>
+    </div>
+</body>
+</html>
+`,
+		data.StudentName,
+		changes.String(),
+		data.ClassName,
+		startDate,
+		startTime,
+		endTime,
+		data.RoomNumber,
+		data.RoomName,
+	)
+
+	return body
+}
+
+// GetClassChangeSubject returns the subject line for the class change notice
+func GetClassChangeSubject() string {
+	return "【模擬授業】授業内容変更のお知らせ"
+}
+
+// GenerateClassCancelledNotice creates the HTML body sent when an admin deletes a class or session
+func GenerateClassCancelledNotice(data EnrollmentData) string {
+	startDate := data.StartAt.Format("2006年01月02日")
+	startTime := data.StartAt.Format("15:04")
+	endTime := data.EndAt.Format("15:04")
+
+	html := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>授業中止</title>
+</head>
+<body style="font-family: 'メイリオ', Meiryo, 'ヒラギノ角ゴ Pro', 'Hiragino Kaku Gothic Pro', sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin-bottom: 20px;">
+        <h1 style="color: #0066cc; margin-top: 0;">授業中止のお知らせ</h1>
+        <p><strong>%s</strong> 様</p>
+        <p>誠に申し訳ございませんが、お申込みいただいていた以下の模擬授業は中止となりました。申込は取り消されています。</p>
+    </div>
+
+    <div style="background-color: #ffffff; border: 1px solid #dee2e6; border-radius: 8px; padding: 20px; margin-bottom: 20px;">
+        <table style="width: 100%%; border-collapse: collapse;">
+            <tr>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6; font-weight: bold; width: 30%%;">授業名</td>
+                <td style="padding: 12px 0; border-bottom: 1px solid #dee2e6;">%s</td>
+            </tr>
+            <tr>
+                <td style="padding: 12px 0; font-weight: bold;">日時</td>
+                <td style="padding: 12px 0;">%s %s 〜 %s</td>
+            </tr>
+        </table>
+    </div>
+
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 15px; text-align: center; font-size: 0.9em; color: #6c757d;">
+        <p style="margin: 0;">他の授業へのお申込みは開講情報一覧から行えます。</p>
+        <p style="margin: 5px 0 0 0;">お問い合わせは学校までご連絡ください。</p>
+    </div>
+</body>
+</html>
+`,
+		data.StudentName,
+		data.ClassName,
+		startDate,
+		startTime,
+		endTime,
+	)
+
+	return html
+}
+
+// GetClassCancelledSubject returns the subject line for the class cancelled notice
+func GetClassCancelledSubject() string {
+	return "【模擬授業】授業中止のお知らせ"
+}
+
+// GeneratePasswordReset creates the HTML body of the password reset email
+func GeneratePasswordReset(link string, validFor time.Duration) string {
+	link = html.EscapeString(link)
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>パスワード再設定</title>
+</head>
+<body style="font-family: 'メイリオ', Meiryo, 'ヒラギノ角ゴ Pro', 'Hiragino Kaku Gothic Pro', sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin-bottom: 20px;">
+        <h1 style="color: #0066cc; margin-top: 0;">パスワード再設定のご案内</h1>
+        <p>パスワード再設定のリクエストを受け付けました。以下のボタンから新しいパスワードを設定してください。</p>
+        <p style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: #ffffff; padding: 12px 30px; border-radius: 4px; text-decoration: none; font-weight: bold;">パスワードを再設定する</a>
+        </p>
+        <p style="font-size: 0.9em; word-break: break-all;">ボタンが押せない場合は次のURLをブラウザに貼り付けてください:<br>%s</p>
+    </div>
+
+    <div style="background-color: #fff3cd; border: 1px solid #ffc107; border-radius: 8px; padding: 15px; margin-bottom: 20px;">
+        <ul style="margin: 0; padding-left: 20px; color: #856404;">
+            <li>このリンクの有効期限は%d分です</li>
+            <li>リンクは一度だけ使用できます</li>
+            <li>お心当たりのない場合は、このメールを破棄してください。パスワードは変更されません</li>
+        </ul>
+    </div>
+
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 15px; text-align: center; font-size: 0.9em; color: #6c757d;">
+        <p style="margin: 0;">このメールは送信専用です。ご返信いただいても対応できませんのでご了承ください。</p>
+    </div>
+</body>
+</html>
+`,
+		link,
+		link,
+		int(validFor.Minutes()),
+	)
+
+	return body
+}
+
+// GetPasswordResetSubject returns the subject line for the password reset email
+func GetPasswordResetSubject() string {
+	return "【模擬授業】パスワード再設定のご案内"
+}
+
+// GenerateEmailVerification creates the HTML body of the signup address confirmation email
+func GenerateEmailVerification(link string, validFor time.Duration) string {
+	link = html.EscapeString(link)
+
+	body := fmt.Sprintf(`
+<!DOCTYPE html>
+<html lang="ja">
+<head>
+    <meta charset="UTF-8">
+    <meta name="viewport" content="width=device-width, initial-scale=1.0">
+    <title>メールアドレスの確認</title>
+</head>
+<body style="font-family: 'メイリオ', Meiryo, 'ヒラギノ角ゴ Pro', 'Hiragino Kaku Gothic Pro', sans-serif; line-height: 1.6; color: #333; max-width: 600px; margin: 0 auto; padding: 20px;">
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 30px; margin-bottom: 20px;">
+        <h1 style="color: #0066cc; margin-top: 0;">メールアドレスの確認</h1>
+        <p>模擬授業予約システムへのご登録ありがとうございます。以下のボタンからメールアドレスの確認を完了してください。確認が完了するまで授業への申込はできません。</p>
+        <p style="text-align: center; margin: 30px 0;">
+            <a href="%s" style="background-color: #0066cc; color: #ffffff; padding: 12px 30px; border-radius: 4px; text-decoration: none; font-weight: bold;">メールアドレスを確認する</a>
+        </p>
+        <p style="font-size: 0.9em; word-break: break-all;">ボタンが押せない場合は次のURLをブラウザに貼り付けてください:<br>%s</p>
+    </div>
+
+    <div style="background-color: #fff3cd; border: 1px solid #ffc107; border-radius: 8px; padding: 15px; margin-bottom: 20px;">
+        <ul style="margin: 0; padding-left: 20px; color: #856404;">
+            <li>このリンクの有効期限は%d時間です。期限が切れた場合はマイページから再送できます</li>
+            <li>お心当たりのない場合は、このメールを破棄してください</li>
+        </ul>
+    </div>
+
+    <div style="background-color: #f8f9fa; border-radius: 8px; padding: 15px; text-align: center; font-size: 0.9em; color: #6c757d;">
+        <p style="margin: 0;">このメールは送信専用です。ご返信いただいても対応できませんのでご了承ください。</p>
+    </div>
+</body>
+</html>
+`,
+		link,
+		link,
+		int(validFor.Hours()),
+	)
+
+	return body
+}
+
+// GetEmailVerificationSubject returns the subject line for the address confirmation email
+func GetEmailVerificationSubject() string {
+	return "【模擬授業】メールアドレスの確認"
+}
@@ -3,99 +3,228 @@ package handlers
 
 import (
 	"fmt"
-	"io"
-	"os"
-	"path/filepath"
 	"net/http"
 	"strconv"
 	"time"
 
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/auth"
 	"example.com/myapp/internal/models"
+	"example.com/myapp/internal/upload"
+	"example.com/myapp/internal/validate"
 )
 
 // Make sure you import: "database/sql", "time", "example.com/myapp/internal/models"
 func (h *Handler) AdminPage(w http.ResponseWriter, r *http.Request) {
-	h.tpl.Render(w, "admin_index.html", nil)
+	role := currentStaff(r).Role
+	h.tpl.Render(w, "admin_index.html", map[string]any{
+		"RoleLabel": role.Label(),
+		"Can":       role.Permissions(), // menu cards are shown per permission
+	})
 }
 
 // AdminConfig handles GET (show form) and POST (save data)
 func (h *Handler) AdminConfig(w http.ResponseWriter, r *http.Request) {
     if r.Method == http.MethodPost {
         // 1. Process Form Submit
-        d1 := r.FormValue("event_day1")
-        d2 := r.FormValue("event_day2")
-        
-        err := models.UpdateEventDates(h.db, d1, d2)
+        before, err := h.settingsSnapshot()
         if err != nil {
+            http.Error(w, "DB Error", http.StatusInternalServerError)
+            return
+        }
+
+        // Every field is checked before anything is saved
+        errs := validate.Errors{}
+        hours, err := strconv.Atoi(r.FormValue("cancel_deadline_hours"))
+        if err != nil || hours < 0 {
+            errs.Add("cancel_deadline_hours", "キャンセル期限には0以上の数値を入力してください")
+        }
+        rules := parseEnrollmentRules(r, errs)
+        if !errs.OK() {
+            // Shown again with a message next to each wrong field
+            h.renderConfig(w, http.StatusUnprocessableEntity, r.FormValue("cancel_deadline_hours"), rules, errs)
+            return
+        }
+
+        // Saved together with the audit entry, so the page is never half applied
+        tx, err := h.db.Begin()
+        if err != nil {
+            http.Error(w, "DB Error", http.StatusInternalServerError)
+            return
+        }
+        defer tx.Rollback() // no-op after Commit
+        after := map[string]any{"cancel_deadline_hours": hours, "enrollment_rules": rules}
+        if err := models.UpdateCancelDeadlineHours(tx, hours); err != nil {
+            http.Error(w, "Failed to save", http.StatusInternalServerError)
+            return
+        }
+        if err := models.UpdateEnrollmentRules(tx, rules); err != nil {
             http.Error(w, "Failed to save", http.StatusInternalServerError)
             return
         }
-        
+        if err := audit.Record(tx, auditEntry(r, audit.ActionSettingsSave, "settings", "", before, after)); err != nil {
+            http.Error(w, "Failed to save", http.StatusInternalServerError)
+            return
+        }
+        if err := tx.Commit(); err != nil {
+            http.Error(w, "Failed to save", http.StatusInternalServerError)
+            return
+        }
+
         // Redirect back to Admin Home after save
         http.Redirect(w, r, "/admin", http.StatusSeeOther)
         return
     }
 
     // 2. Render Page (GET)
-    dates, err := models.GetEventDates(h.db)
+    cancelHours, err := models.GetCancelDeadlineHours(h.db)
     if err != nil {
         http.Error(w, "DB Error", http.StatusInternalServerError)
         return
     }
     
-    // Render the template with current dates
-    h.tpl.Render(w, "admin_config_edit.html", dates)
+    rules, err := models.GetEnrollmentRules(h.db)
+    if err != nil {
+        http.Error(w, "DB Error", http.StatusInternalServerError)
+        return
+    }
+    h.renderConfig(w, http.StatusOK, cancelHours, rules, nil)
+}
+
+// renderConfig shows the config form. cancelHours is the saved setting, or
+// the text entered when the form comes back with errors.
+func (h *Handler) renderConfig(w http.ResponseWriter, status int, cancelHours any, rules models.EnrollmentRules, errs validate.Errors) {
+    days, err := models.GetEventDays(h.db, 0)
+    if err != nil {
+        http.Error(w, "DB Error", http.StatusInternalServerError)
+        return
+    }
+    w.WriteHeader(status)
+    h.tpl.Render(w, "admin_config_edit.html", map[string]any{
+        "Days":                days,
+        "CancelDeadlineHours": cancelHours,
+        "Rules":               rules,
+        "Grades":              models.Grades,
+        "Errors":              errs,
+    })
 }
 
+// settingsSnapshot collects the settings edited on the config page, for the audit log
+func (h *Handler) settingsSnapshot() (map[string]any, error) {
+    hours, err := models.GetCancelDeadlineHours(h.db)
+    if err != nil {
+        return nil, err
+    }
+    rules, err := models.GetEnrollmentRules(h.db)
+    if err != nil {
+        return nil, err
+    }
+    return map[string]any{"cancel_deadline_hours": hours, "enrollment_rules": rules}, nil
+}
+
+// parseEnrollmentRules reads the enrollment rule fields of the config form.
+// Blank limits mean "no limit" (or "use the default" for per-grade rows).
+// A wrong field is recorded in errs and left at 0.
+func parseEnrollmentRules(r *http.Request, errs validate.Errors) models.EnrollmentRules {
+    limit := func(key, label string) int {
+        v := r.FormValue(key)
+        if v == "" {
+            return 0
+        }
+        n, err := strconv.Atoi(v)
+        if err != nil || n < 0 {
+            errs.Add(key, fmt.Sprintf("%sには0以上の数値を入力してください", label))
+            return 0
+        }
+        return n
+    }
+
+    var rules models.EnrollmentRules
+    rules.MaxPerDay = limit("max_per_day", "1日あたりの上限")
+    rules.MaxTotal = limit("max_total", "全体の上限")
+    rules.ForbidOverlap = r.FormValue("forbid_overlap") != ""
+
+    for _, g := range models.Grades {
+        gl := models.GradeLimit{
+            MaxPerDay: limit("grade_"+g+"_per_day", g+"年生の1日あたりの上限"),
+            MaxTotal:  limit("grade_"+g+"_total", g+"年生の全体の上限"),
+        }
+        if gl.MaxPerDay > 0 || gl.MaxTotal > 0 {
+            if rules.GradeLimits == nil {
+                rules.GradeLimits = make(map[string]models.GradeLimit)
+            }
+            rules.GradeLimits[g] = gl
+        }
+    }
+    return rules
+}
 
 func (h *Handler) AdminCreateClass(w http.ResponseWriter, r *http.Request) {
 	// GET: Show basic form
 	if r.Method == http.MethodGet {
-		h.tpl.Render(w, "admin_class_edit.html", nil)
+		h.tpl.Render(w, "admin_class_edit.html", h.classFormData(nil, nil))
 		return
 	}
 
 	// POST: Create Class Only
 	// Parse form with 10MB limit for files
-	if err := r.ParseMultipartForm(10 << 20); err != nil {
-		http.Error(w, "Form error", http.StatusBadRequest)
+	if !parseUploadForm(w, r) {
 		return
 	}
 
-	// 1. Handle File Upload (The Change)
-	// We call the saveFile helper function we created
+	// 1. Check the input; nothing is saved until it is valid
+	class, teachers, errs, err := h.parseClassForm(r)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if _, _, err := r.FormFile("syllabus_pdf"); err == http.ErrMissingFile {
+		errs.Add("syllabus_pdf", "授業概要PDFを選択してください")
+	}
+	if !errs.OK() {
+		h.renderClassForm(w, r, class, teachers, errs)
+		return
+	}
+
+	// 2. Handle File Upload
 	pdfName, err := h.saveFile(r, "syllabus_pdf")
+	if msg, ok := syllabusError(err); ok {
+		errs.Add("syllabus_pdf", msg)
+		h.renderClassForm(w, r, class, teachers, errs)
+		return
+	}
 	if err != nil {
 		// If the upload fails (e.g. permission error), stop and show error
 		http.Error(w, "File upload error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	class.SyllabusPDFURL = pdfName
+	preview := h.syllabusPreview(r.Context(), pdfName)
+	class.SyllabusThumb, class.SyllabusExcerpt = preview.Thumb, preview.Excerpt
 
-	layout := "2006-01-02T15:04"
-	start, _ := time.Parse(layout, r.FormValue("reception_start"))
-	end, _ := time.Parse(layout, r.FormValue("reception_end"))
-
-	class := models.Class{
-		ClassName:           r.FormValue("class_name"),
-		SyllabusPDFURL:      pdfName, // <--- Now uses the actual saved filename
-		RoomNumber:          r.FormValue("room_number"),
-		RoomName:            r.FormValue("room_name"),
-		RegistrationStartAt: start,
-		RegistrationEndAt:   end,
+	class.ImageURL, err = h.saveImage(r, "class_image")
+	if msg, ok := imageError(err); ok {
+		h.removeSyllabus(pdfName)
+		errs.Add("class_image", msg)
+		h.renderClassForm(w, r, class, teachers, errs)
+		return
 	}
-
-	// 2. Instructors
-	teachers := []string{r.FormValue("teacher_name_1")}
-	if t2 := r.FormValue("teacher_name_2"); t2 != "" {
-		teachers = append(teachers, t2)
+	if err != nil {
+		h.removeSyllabus(pdfName)
+		http.Error(w, "File upload error: "+err.Error(), http.StatusInternalServerError)
+		return
 	}
 
 	// 3. Save Class
 	classID, err := models.CreateClassWithInstructors(h.db, class, teachers)
 	if err != nil {
+		h.removeSyllabus(pdfName)
+		h.removeClassImage(class.ImageURL)
 		http.Error(w, "DB Error: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	class.ID = classID
+	h.logAudit(r, audit.ActionClassCreate, "class", classID, nil, classSnapshot(class, teachers))
 
 	// Redirect to the "Session Management" page for this new class
 	http.Redirect(w, r, fmt.Sprintf("/admin/classes/detail?id=%d", classID), http.StatusSeeOther)
@@ -105,7 +234,16 @@ func (h *Handler) AdminClassDetail(w http.ResponseWriter, r *http.Request) {
 	// 1. Get ID from URL query ?id=1
 	idStr := r.URL.Query().Get("id")
 	id, _ := strconv.Atoi(idStr)
+	if !h.canSeeClass(r, id) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	h.renderClassDetail(w, r, id, nil)
+}
 
+// renderClassDetail shows a class with its sessions. form is a session form
+// that failed validation, shown again as entered; nil on a normal visit.
+func (h *Handler) renderClassDetail(w http.ResponseWriter, r *http.Request, id int, form *sessionForm) {
 	// 2. Fetch Data
 	class, err := models.GetClassByID(h.db, id)
 	if err != nil {
@@ -117,18 +255,43 @@ func (h *Handler) AdminClassDetail(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "DB Error", http.StatusInternalServerError)
 		return
 	}
+	days, err := models.GetEventDays(h.db, class.EditionID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
 	
 	// 3. Prepare Data for Template
+	// Every row gets its own edit form, filled with the session's values
+	rows := make([]sessionRow, 0, len(sessions))
+	for _, s := range sessions {
+		row := sessionRow{Session: s, Form: sessionFormFor(s)}
+		if form != nil && form.SessionID == s.ID {
+			row.Form = form
+		}
+		rows = append(rows, row)
+	}
+	addForm := &sessionForm{Capacity: "40"}
+	if form != nil && form.SessionID == 0 {
+		addForm = form
+	}
+
 	data := map[string]any{
-		"Class":    class,
-		"Sessions": sessions,
+		"Class":     class,
+		"Sessions":  rows,
+		"Days":      days,
+		"AddForm":   addForm,
+		"CanManage": currentStaff(r).Role.Can(auth.PermManageClasses) && !class.Archived,
+	}
+	if form != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
 	}
 	h.tpl.Render(w, "admin_class_detail.html", data)
 }
 
 func combineDateTime(dateStr, timeStr string) (time.Time, error) {
 	fullStr := dateStr + " " + timeStr
-	return time.Parse("2006-01-02 15:04", fullStr)
+	return time.ParseInLocation("2006-01-02 15:04", fullStr, models.EventLocation)
 }
 // ACTION: Adds a single session to a class
 func (h *Handler) AdminAddSession(w http.ResponseWriter, r *http.Request) {
@@ -137,52 +300,69 @@ func (h *Handler) AdminAddSession(w http.ResponseWriter, r *http.Request) {
 	}
 
 	classID, _ := strconv.Atoi(r.FormValue("class_id"))
-	daySeq, _ := strconv.Atoi(r.FormValue("day_sequence"))
-	capacity, _ := strconv.Atoi(r.FormValue("capacity"))
-	
-	// Get "Day 1" or "Day 2" date from DB to combine with time
-	eventDates, _ := models.GetEventDates(h.db)
-	targetDate := eventDates.Day1
-	if daySeq == 2 {
-		targetDate = eventDates.Day2
+	if !h.requireActiveClass(w, classID) {
+		return
+	}
+	class, err := models.GetClassByID(h.db, classID)
+	if err != nil {
+		http.Error(w, "Class not found", http.StatusNotFound)
+		return
 	}
 
-	// Combine Date + Time input
-	startAt, _ := combineDateTime(targetDate, r.FormValue("start_time"))
-	endAt, _ := combineDateTime(targetDate, r.FormValue("end_time"))
-
-	sess := models.Session{
-		ClassID:     classID,
-		DaySequence: daySeq,
-		StartAt:     startAt,
-		EndAt:       endAt,
-		Capacity:    capacity, // Per session capacity!
+	// The picked event day gives the date to combine with the times
+	sess, form, err := h.parseSessionForm(r, class)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !form.Errors.OK() {
+		h.renderClassDetail(w, r, classID, form)
+		return
 	}
 
-	if err := models.CreateSession(h.db, sess); err != nil {
+	sessID, err := models.CreateSession(h.db, sess)
+	if err != nil {
 		http.Error(w, "Failed to add session: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
+	sess.ID = sessID
+	h.logAudit(r, audit.ActionSessionCreate, "session", sessID, nil, sess)
 
 	// Redirect back to the detail page to see the new list
 	http.Redirect(w, r, fmt.Sprintf("/admin/classes/detail?id=%d", classID), http.StatusSeeOther)
 }
 
-// AdminClassList shows all classes so admin can select one to manage
+// AdminClassList shows the classes of one edition (default: the active one)
+// so admin can select one to manage
 func (h *Handler) AdminClassList(w http.ResponseWriter, r *http.Request) {
-	classes, err := models.GetAllClasses(h.db)
+	edition, editions, err := h.selectedEdition(r)
+	if err != nil {
+		http.Error(w, "Edition not found", http.StatusNotFound)
+		return
+	}
+	classes, err := models.GetEditionClasses(h.db, edition.ID)
 	if err != nil {
 		http.Error(w, "DB Error", http.StatusInternalServerError)
 		return
 	}
-	
-	h.tpl.Render(w, "admin_class_list.html", classes)
+	if instructorID := instructorScope(r); instructorID > 0 {
+		classes, _ = h.scopeToInstructor(instructorID, classes, nil)
+	}
+
+	h.tpl.Render(w, "admin_class_list.html", map[string]any{
+		"Edition":   edition,
+		"Editions":  editions,
+		"Classes":   classes,
+		"CanManage": currentStaff(r).Role.Can(auth.PermManageClasses) && !edition.IsArchived(),
+	})
 }
 
-// saveFile saves an uploaded file and returns the filename
+// saveFile stores an uploaded syllabus PDF and returns its file name, or ""
+// if nothing was uploaded. Content that isn't a PDF is refused with the
+// errors of the upload package.
 func (h *Handler) saveFile(r *http.Request, formKey string) (string, error) {
     // 1. Get the file from the form
-    file, header, err := r.FormFile(formKey)
+    file, _, err := r.FormFile(formKey)
     if err != nil {
         if err == http.ErrMissingFile {
             return "", nil // No file uploaded, which is fine
@@ -191,33 +371,7 @@ func (h *Handler) saveFile(r *http.Request, formKey string) (string, error) {
     }
     defer file.Close()
 
-    // 2. Determine where to save
-    uploadDir := os.Getenv("UPLOAD_DIR")
-    if uploadDir == "" {
-        uploadDir = "./web/static/uploads"
-    }
-    
-    // Ensure dir exists (just in case)
-    os.MkdirAll(uploadDir, 0755)
-
-    // 3. Create a unique filename (to avoid overwrites)
-    // e.g. "syllabus_1735689201.pdf"
-    ext := filepath.Ext(header.Filename)
-    filename := fmt.Sprintf("syllabus_%d%s", time.Now().Unix(), ext)
-    dstPath := filepath.Join(uploadDir, filename)
-
-    // 4. Create the destination file
-    dst, err := os.Create(dstPath)
-    if err != nil {
-        return "", err
-    }
-    defer dst.Close()
-
-    // 5. Copy the content
-    _, err = io.Copy(dst, file)
-    if err != nil {
-        return "", err
-    }
-
-    return filename, nil
+    // 2. Check the content and store it under its hash; the file name and
+    // type the browser sent are ignored
+    return upload.SavePDF(h.store, file)
 }
@@ -6,13 +6,25 @@ import (
 	"net/http"
 	"strconv"
 
+	"example.com/myapp/internal/audit"
 	"example.com/myapp/internal/models"
 )
 
 func (h *Handler) AdminDataPage(w http.ResponseWriter, r *http.Request) {
-	// A. Dropdown Data
-	classes, _ := models.GetAllClasses(h.db)
-	sessions, _ := models.GetAllSessionsForDropdown(h.db)
+	// Archived editions stay reportable: ?edition= picks one, default is the active one
+	edition, editions, err := h.selectedEdition(r)
+	if err != nil {
+		http.Error(w, "Edition not found", http.StatusNotFound)
+		return
+	}
+
+	// A. Dropdown Data (instructors only see their own classes)
+	instructorID := instructorScope(r)
+	classes, _ := models.GetEditionClasses(h.db, edition.ID)
+	sessions, _ := models.GetAllSessionsForDropdown(h.db, edition.ID)
+	if instructorID > 0 {
+		classes, sessions = h.scopeToInstructor(instructorID, classes, sessions)
+	}
 
 	// B. Get Filters from URL
 	classID, _ := strconv.Atoi(r.URL.Query().Get("class_id"))
@@ -20,16 +32,22 @@ func (h *Handler) AdminDataPage(w http.ResponseWriter, r *http.Request) {
 
 	// C. Fetch BOTH Reports using the SAME filters
 	// Table 1: Participants
-	previewData, _ := models.GetApplicantsReport(h.db, classID, sessionID)
+	previewData, _ := models.GetApplicantsReport(h.db, edition.ID, classID, sessionID, instructorID)
 	
 	// Table 2: Class Info (Now Dynamic!)
-	statuses, _ := models.GetClassStatusReport(h.db, classID, sessionID)
+	statuses, _ := models.GetClassStatusReport(h.db, edition.ID, classID, sessionID, instructorID)
+
+	// Table 3: Waitlist
+	waitlist, _ := models.GetWaitlistReport(h.db, edition.ID, classID, sessionID, instructorID)
 
 	data := map[string]any{
+		"Edition":       edition,
+		"Editions":      editions,
 		"Classes":       classes,
 		"Sessions":      sessions,
 		"PreviewData":   previewData, // Participants
 		"Statuses":      statuses,    // Class Info
+		"Waitlist":      waitlist,    // Waitlist positions
 		"SelectedClass": classID,
 		"SelectedSess":  sessionID,
 	}
@@ -41,16 +59,20 @@ func (h *Handler) AdminDownloadCSV(w http.ResponseWriter, r *http.Request) {
 	classID, _ := strconv.Atoi(r.URL.Query().Get("class_id"))
 	sessionID, _ := strconv.Atoi(r.URL.Query().Get("session_id"))
 
-	data, _ := models.GetApplicantsReport(h.db, classID, sessionID)
+	editionID := h.editionParam(r)
+
+	data, _ := models.GetApplicantsReport(h.db, editionID, classID, sessionID, instructorScope(r))
+	h.logAudit(r, audit.ActionDataExport, "participants", "", nil, exportSnapshot(editionID, classID, sessionID, len(data)))
 	
 	setCSVHeaders(w, "participants_list.csv")
 	writer := csv.NewWriter(w)
 	defer writer.Flush()
 
-	writer.Write([]string{"ID", "中学生氏名", "保護者", "メール", "登録日時", "授業名", "実施回"})
+	writer.Write([]string{"ID", "中学生氏名", "ふりがな", "保護者", "同伴保護者数", "メール", "電話番号", "配慮事項", "登録日時", "授業名", "実施回"})
 	for _, row := range data {
 		writer.Write([]string{
-			strconv.Itoa(row.UserID), row.StudentName, row.GuardianName, row.Email, 
+			strconv.Itoa(row.UserID), row.StudentName, row.StudentKana, row.GuardianName, strconv.Itoa(row.GuardianCount),
+			row.Email, row.Phone, row.AccessibilityNeeds,
 			row.RegDate.Format("2006-01-02 15:04"), row.ClassName, row.SessionTime,
 		})
 	}
@@ -59,7 +81,10 @@ func (h *Handler) AdminDownloadClasses(w http.ResponseWriter, r *http.Request) {
 	classID, _ := strconv.Atoi(r.URL.Query().Get("class_id"))
 	sessionID, _ := strconv.Atoi(r.URL.Query().Get("session_id"))
 
-	data, _ := models.GetClassStatusReport(h.db, classID, sessionID)
+	editionID := h.editionParam(r)
+
+	data, _ := models.GetClassStatusReport(h.db, editionID, classID, sessionID, instructorScope(r))
+	h.logAudit(r, audit.ActionDataExport, "classes", "", nil, exportSnapshot(editionID, classID, sessionID, len(data)))
 
 	setCSVHeaders(w, "class_info.csv")
 	writer := csv.NewWriter(w)
@@ -80,6 +105,32 @@ func (h *Handler) AdminDownloadClasses(w http.ResponseWriter, r *http.Request) {
 		})
 	}
 }
+// exportSnapshot describes what a CSV download contained
+func exportSnapshot(editionID, classID, sessionID, rows int) map[string]int {
+	return map[string]int{"edition_id": editionID, "class_id": classID, "session_id": sessionID, "rows": rows}
+}
+
+// scopeToInstructor drops classes and sessions the instructor isn't linked to
+func (h *Handler) scopeToInstructor(instructorID int, classes []models.Class, sessions []models.SessionOption) ([]models.Class, []models.SessionOption) {
+	allowed, err := models.GetInstructorClassIDs(h.db, instructorID)
+	if err != nil {
+		return nil, nil
+	}
+	var cs []models.Class
+	for _, c := range classes {
+		if allowed[c.ID] {
+			cs = append(cs, c)
+		}
+	}
+	var ss []models.SessionOption
+	for _, s := range sessions {
+		if allowed[s.ClassID] {
+			ss = append(ss, s)
+		}
+	}
+	return cs, ss
+}
+
 func setCSVHeaders(w http.ResponseWriter, filename string) {
 	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
 	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
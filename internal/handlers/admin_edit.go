@@ -0,0 +1,500 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/email"
+	"example.com/myapp/internal/models"
+	"example.com/myapp/internal/validate"
+)
+
+// classFormData prepares admin_class_edit.html. class is nil (or has no ID)
+// when creating a new class.
+func (h *Handler) classFormData(class *models.Class, teachers []string) map[string]any {
+	data := map[string]any{
+		"Class":   class,
+		"Editing": class != nil && class.ID > 0,
+		"Errors":  validate.Errors{},
+		"Grades":  models.Grades,
+	}
+	// Categories already in use, offered as suggestions
+	categories, err := models.GetClassCategories(h.db)
+	if err != nil {
+		log.Printf("Failed to load class categories: %v", err)
+	}
+	data["Categories"] = categories
+	checked := map[string]bool{}
+	if class != nil {
+		data["RegStart"] = class.RegistrationStartAt.In(models.EventLocation).Format("2006-01-02T15:04")
+		data["RegEnd"] = class.RegistrationEndAt.In(models.EventLocation).Format("2006-01-02T15:04")
+		for _, g := range class.TargetGrades {
+			checked[g] = true
+		}
+	}
+	data["GradeChecked"] = checked
+	if len(teachers) > 0 {
+		data["Teacher1"] = teachers[0]
+	}
+	if len(teachers) > 1 {
+		data["Teacher2"] = teachers[1]
+	}
+	return data
+}
+
+// renderClassForm shows the class form again with the submitted input and
+// a message next to each invalid field
+func (h *Handler) renderClassForm(w http.ResponseWriter, r *http.Request, class models.Class, teachers []string, errs validate.Errors) {
+	data := h.classFormData(&class, teachers)
+	// Keep the raw input: it may not have parsed
+	data["RegStart"] = r.FormValue("reception_start")
+	data["RegEnd"] = r.FormValue("reception_end")
+	data["Errors"] = errs
+	w.WriteHeader(http.StatusUnprocessableEntity)
+	h.tpl.Render(w, "admin_class_edit.html", data)
+}
+
+// parseClassForm reads and checks the class form. Registration has to close
+// before the first event day of the active edition starts. The returned
+// error is for database failures only; input problems are in Errors.
+func (h *Handler) parseClassForm(r *http.Request) (models.Class, []string, validate.Errors, error) {
+	errs := validate.Errors{}
+	class := models.Class{
+		ClassName:     errs.Required("class_name", r.FormValue("class_name"), "模擬授業名"),
+		Description:   r.FormValue("description"),
+		Category:      strings.TrimSpace(r.FormValue("category")),
+		Prerequisites: strings.TrimSpace(r.FormValue("prerequisites")),
+		RoomNumber:    errs.Required("room_number", r.FormValue("room_number"), "部屋番号"),
+		RoomName:      errs.Required("room_name", r.FormValue("room_name"), "部屋名"),
+	}
+	errs.MaxLength("class_name", class.ClassName, 60, "模擬授業名")
+	errs.MaxLength("category", class.Category, 50, "分野")
+	errs.MaxLength("prerequisites", class.Prerequisites, 500, "受講の前提")
+	errs.MaxLength("room_number", class.RoomNumber, 50, "部屋番号")
+	// room_name and description are TEXT columns; these limits keep the
+	// class pages and printed rosters readable
+	errs.MaxLength("room_name", class.RoomName, 100, "部屋名")
+	errs.MaxLength("description", class.Description, 5000, "授業の紹介文")
+	// No grade checked means the class is open to every grade
+	for _, g := range r.Form["target_grades"] {
+		errs.OneOf("target_grades", g, models.Grades, "対象学年")
+		class.TargetGrades = append(class.TargetGrades, g)
+	}
+
+	teachers := []string{errs.Required("teacher_name_1", r.FormValue("teacher_name_1"), "担当教職員1")}
+	if t2 := strings.TrimSpace(r.FormValue("teacher_name_2")); t2 != "" {
+		if t2 == teachers[0] {
+			errs.Add("teacher_name_2", "担当教職員1と同じ名前です")
+		}
+		teachers = append(teachers, t2)
+	}
+
+	// datetime-local inputs carry no zone: read them as event-local time
+	class.RegistrationStartAt = errs.Time("reception_start", r.FormValue("reception_start"),
+		validate.DateTimeLayout, models.EventLocation, "受付開始日時")
+	class.RegistrationEndAt = errs.Time("reception_end", r.FormValue("reception_end"),
+		validate.DateTimeLayout, models.EventLocation, "受付終了日時")
+	errs.After("reception_end", class.RegistrationStartAt, class.RegistrationEndAt,
+		"受付終了日時は受付開始日時より後にしてください")
+
+	days, err := models.GetEventDays(h.db, 0)
+	if err != nil {
+		return class, teachers, errs, err
+	}
+	if len(days) > 0 && !class.RegistrationEndAt.IsZero() && class.RegistrationEndAt.After(days[0].Time()) {
+		errs.Add("reception_end", fmt.Sprintf("受付終了日時は最初の開催日（%s: %s）より前にしてください", days[0].Label, days[0].Date))
+	}
+	return class, teachers, errs, nil
+}
+
+// sessionForm is the input of a session form, kept so the form can be shown
+// again with its errors
+type sessionForm struct {
+	SessionID int // 0 for the add form
+	DayID     int
+	StartTime string
+	EndTime   string
+	Capacity  string
+	Errors    validate.Errors
+}
+
+// sessionFormFor fills an edit form with a session's current values
+func sessionFormFor(s models.Session) *sessionForm {
+	return &sessionForm{
+		SessionID: s.ID,
+		DayID:     s.DayID,
+		StartTime: s.StartAt.In(models.EventLocation).Format(validate.TimeLayout),
+		EndTime:   s.EndAt.In(models.EventLocation).Format(validate.TimeLayout),
+		Capacity:  strconv.Itoa(s.Capacity),
+	}
+}
+
+// sessionRow is a session on the class page with its edit form
+type sessionRow struct {
+	models.Session
+	Form *sessionForm
+}
+
+// parseSessionForm reads and checks a session form of a class. The session
+// takes place on the picked event day, which must belong to the class's
+// edition, and may not start before the class's registration closes.
+// The returned error is for database failures only.
+func (h *Handler) parseSessionForm(r *http.Request, class *models.Class) (models.Session, *sessionForm, error) {
+	form := &sessionForm{
+		StartTime: r.FormValue("start_time"),
+		EndTime:   r.FormValue("end_time"),
+		Capacity:  r.FormValue("capacity"),
+		Errors:    validate.Errors{},
+	}
+	form.SessionID, _ = strconv.Atoi(r.FormValue("session_id"))
+	form.DayID, _ = strconv.Atoi(r.FormValue("day_id"))
+	errs := form.Errors
+	sess := models.Session{ID: form.SessionID, ClassID: class.ID}
+
+	day, err := models.GetEventDay(h.db, form.DayID)
+	switch {
+	case err == sql.ErrNoRows:
+		errs.Add("day_id", "開催日を選択してください")
+	case err != nil:
+		return sess, form, err
+	case day.EditionID != class.EditionID:
+		errs.Add("day_id", "この授業の年度の開催日を選択してください")
+	default:
+		sess.DayID, sess.DayLabel = day.ID, day.Label
+	}
+
+	start := errs.Time("start_time", form.StartTime, validate.TimeLayout, models.EventLocation, "開始時刻")
+	end := errs.Time("end_time", form.EndTime, validate.TimeLayout, models.EventLocation, "終了時刻")
+	errs.After("end_time", start, end, "終了時刻は開始時刻より後にしてください")
+	sess.Capacity = errs.PositiveInt("capacity", form.Capacity, "定員")
+
+	if sess.DayID != 0 && !start.IsZero() && !end.IsZero() {
+		// Both times are on the event day, so the session can't spill into the next one
+		sess.StartAt, _ = combineDateTime(day.Date, form.StartTime)
+		sess.EndAt, _ = combineDateTime(day.Date, form.EndTime)
+		if sess.StartAt.Before(class.RegistrationEndAt) {
+			errs.Add("start_time", fmt.Sprintf("実施日時は受付終了日時（%s）より後にしてください",
+				class.RegistrationEndAt.In(models.EventLocation).Format("2006-01-02 15:04")))
+		}
+	}
+	return sess, form, nil
+}
+
+// classSnapshot is the audit view of a class with its instructors
+func classSnapshot(class models.Class, teachers []string) map[string]any {
+	return map[string]any{"class": class, "instructors": teachers}
+}
+
+// AdminEditClass: GET shows the class form filled in; POST saves the changes
+func (h *Handler) AdminEditClass(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.URL.Query().Get("id"))
+	if id == 0 {
+		id, _ = strconv.Atoi(r.FormValue("id"))
+	}
+
+	old, err := models.GetClassByID(h.db, id)
+	if err != nil {
+		http.Error(w, "Class not found", http.StatusNotFound)
+		return
+	}
+	if !h.requireActiveClass(w, id) {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		teachers, err := models.GetClassInstructors(h.db, id)
+		if err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		h.tpl.Render(w, "admin_class_edit.html", h.classFormData(old, teachers))
+		return
+	}
+
+	if !parseUploadForm(w, r) {
+		return
+	}
+
+	class, teachers, errs, err := h.parseClassForm(r)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	class.ID = id
+	class.SyllabusPDFURL = old.SyllabusPDFURL
+	class.SyllabusThumb, class.SyllabusExcerpt = old.SyllabusThumb, old.SyllabusExcerpt
+	class.ImageURL = old.ImageURL
+	if !errs.OK() {
+		h.renderClassForm(w, r, class, teachers, errs)
+		return
+	}
+
+	// A new PDF replaces the old one; no upload keeps the current file
+	pdfName, err := h.saveFile(r, "syllabus_pdf")
+	if msg, ok := syllabusError(err); ok {
+		errs.Add("syllabus_pdf", msg)
+		h.renderClassForm(w, r, class, teachers, errs)
+		return
+	}
+	if err != nil {
+		http.Error(w, "File upload error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if pdfName != "" {
+		class.SyllabusPDFURL = pdfName
+	}
+	// A new image replaces the old one; the checkbox removes it
+	imageName, err := h.saveImage(r, "class_image")
+	if msg, ok := imageError(err); ok {
+		h.removeSyllabus(pdfName)
+		errs.Add("class_image", msg)
+		h.renderClassForm(w, r, class, teachers, errs)
+		return
+	}
+	if err != nil {
+		h.removeSyllabus(pdfName)
+		http.Error(w, "File upload error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	switch {
+	case imageName != "":
+		class.ImageURL = imageName
+	case r.FormValue("remove_image") == "1":
+		class.ImageURL = ""
+	}
+	// A new PDF gets a preview, and so does one uploaded before previews existed
+	if pdfName != "" || (class.SyllabusPDFURL != "" && class.SyllabusThumb == "" && class.SyllabusExcerpt == "") {
+		preview := h.syllabusPreview(r.Context(), class.SyllabusPDFURL)
+		class.SyllabusThumb, class.SyllabusExcerpt = preview.Thumb, preview.Excerpt
+	}
+
+	oldTeachers, err := models.GetClassInstructors(h.db, id)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	if err := models.UpdateClassWithInstructors(h.db, class, teachers); err != nil {
+		if class.SyllabusPDFURL != old.SyllabusPDFURL {
+			h.removeSyllabus(class.SyllabusPDFURL)
+		}
+		if class.ImageURL != old.ImageURL {
+			h.removeClassImage(class.ImageURL)
+		}
+		http.Error(w, "DB Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The replaced PDF goes unless another class uses the same file
+	if class.SyllabusPDFURL != old.SyllabusPDFURL {
+		h.removeSyllabus(old.SyllabusPDFURL)
+	}
+	if class.ImageURL != old.ImageURL {
+		h.removeClassImage(old.ImageURL)
+	}
+	h.logAudit(r, audit.ActionClassUpdate, "class", id, classSnapshot(*old, oldTeachers), classSnapshot(class, teachers))
+
+	// Tell students if the room moved
+	if old.RoomNumber != class.RoomNumber || old.RoomName != class.RoomName {
+		change := fmt.Sprintf("教室: %s %s → %s %s", old.RoomNumber, old.RoomName, class.RoomNumber, class.RoomName)
+		h.notifyClassChange(id, 0, []string{change})
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/classes/detail?id=%d", id), http.StatusSeeOther)
+}
+
+// AdminDeleteClass deletes a class with all its sessions and enrollments
+func (h *Handler) AdminDeleteClass(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	if !h.requireActiveClass(w, id) {
+		return
+	}
+
+	// Collect the notices and the audit snapshot before the rows disappear
+	notices := h.cancellationNotices(id, 0)
+	var before any
+	var syllabus, image string
+	if old, err := models.GetClassByID(h.db, id); err == nil {
+		teachers, _ := models.GetClassInstructors(h.db, id)
+		before = classSnapshot(*old, teachers)
+		syllabus, image = old.SyllabusPDFURL, old.ImageURL
+	}
+
+	if err := models.DeleteClass(h.db, id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Class not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "DB Error: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	h.logAudit(r, audit.ActionClassDelete, "class", id, before, nil)
+	h.removeSyllabus(syllabus)
+	h.removeClassImage(image)
+	h.sendCancellationNotices(notices)
+	http.Redirect(w, r, "/admin/classes", http.StatusSeeOther)
+}
+
+// AdminEditSession updates the day, times and capacity of one session
+func (h *Handler) AdminEditSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	sessID, _ := strconv.Atoi(r.FormValue("session_id"))
+	old, err := models.GetSessionByID(h.db, sessID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !h.requireActiveClass(w, old.ClassID) {
+		return
+	}
+
+	class, err := models.GetClassByID(h.db, old.ClassID)
+	if err != nil {
+		http.Error(w, "Class not found", http.StatusNotFound)
+		return
+	}
+	sess, form, err := h.parseSessionForm(r, class)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if !form.Errors.OK() {
+		h.renderClassDetail(w, r, old.ClassID, form)
+		return
+	}
+
+	if err := models.UpdateSession(h.db, sess); err != nil {
+		if err == models.ErrCapacityBelowEnrollment {
+			// The count may have grown since the page was loaded
+			if cur, err := models.GetSessionByID(h.db, sessID); err == nil {
+				old = cur
+			}
+			form.Errors.Add("capacity", fmt.Sprintf("定員は現在の申込数 (%d名) より少なくできません", old.CurrentEnrolledCount))
+			h.renderClassDetail(w, r, old.ClassID, form)
+			return
+		}
+		http.Error(w, "Failed to update session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	startAt, endAt := sess.StartAt, sess.EndAt
+	h.logAudit(r, audit.ActionSessionUpdate, "session", sessID, old, sess)
+
+	// Tell students if the time moved
+	if !old.StartAt.Equal(startAt) || !old.EndAt.Equal(endAt) {
+		change := fmt.Sprintf("日時: %s〜%s → %s〜%s",
+			old.StartAt.In(models.EventLocation).Format("01月02日 15:04"), old.EndAt.In(models.EventLocation).Format("15:04"),
+			startAt.Format("01月02日 15:04"), endAt.Format("15:04"))
+		h.notifyClassChange(old.ClassID, sessID, []string{change})
+	}
+
+	// More seats: move students up from the waitlist
+	if sess.Capacity > old.Capacity {
+		h.promoteWaitlist(sessID)
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/admin/classes/detail?id=%d", old.ClassID), http.StatusSeeOther)
+}
+
+// AdminDeleteSession deletes one session and its enrollments
+func (h *Handler) AdminDeleteSession(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		return
+	}
+
+	sessID, _ := strconv.Atoi(r.FormValue("session_id"))
+	old, err := models.GetSessionByID(h.db, sessID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	}
+	if !h.requireActiveClass(w, old.ClassID) {
+		return
+	}
+
+	notices := h.cancellationNotices(old.ClassID, sessID)
+
+	if err := models.DeleteSession(h.db, sessID); err != nil {
+		http.Error(w, "Failed to delete session: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionSessionDelete, "session", sessID, old, nil)
+
+	h.sendCancellationNotices(notices)
+	http.Redirect(w, r, fmt.Sprintf("/admin/classes/detail?id=%d", old.ClassID), http.StatusSeeOther)
+}
+
+// notifyClassChange emails everyone in a class (or one session of it) about a change
+func (h *Handler) notifyClassChange(classID, sessionID int, changes []string) {
+	participants, err := models.GetClassParticipants(h.db, classID, sessionID)
+	if err != nil {
+		log.Printf("Failed to load participants of class %d: %v", classID, err)
+		return
+	}
+
+	go func() {
+		for _, p := range participants {
+			emailData, err := h.enrollmentEmailData(p.UserID, p.SessionID)
+			if err != nil {
+				log.Printf("Failed to build change notice for user %d: %v", p.UserID, err)
+				continue
+			}
+			body := email.GenerateClassChangeNotice(email.ChangeNoticeData{
+				EnrollmentData: emailData,
+				Changes:        changes,
+			})
+			if err := h.mailer.Send(p.Email, email.GetClassChangeSubject(), body); err != nil {
+				log.Printf("Failed to send change notice to user %d: %v", p.UserID, err)
+			}
+		}
+	}()
+}
+
+// cancellationNotice is an email prepared before its class or session is deleted
+type cancellationNotice struct {
+	to   string
+	data email.EnrollmentData
+}
+
+// cancellationNotices builds the "授業中止" emails for a class (or one session of it).
+// It must run before the delete, while the session details still exist.
+func (h *Handler) cancellationNotices(classID, sessionID int) []cancellationNotice {
+	participants, err := models.GetClassParticipants(h.db, classID, sessionID)
+	if err != nil {
+		log.Printf("Failed to load participants of class %d: %v", classID, err)
+		return nil
+	}
+
+	var notices []cancellationNotice
+	for _, p := range participants {
+		emailData, err := h.enrollmentEmailData(p.UserID, p.SessionID)
+		if err != nil {
+			log.Printf("Failed to build cancellation notice for user %d: %v", p.UserID, err)
+			continue
+		}
+		notices = append(notices, cancellationNotice{to: p.Email, data: emailData})
+	}
+	return notices
+}
+
+func (h *Handler) sendCancellationNotices(notices []cancellationNotice) {
+	go func() {
+		for _, n := range notices {
+			body := email.GenerateClassCancelledNotice(n.data)
+			if err := h.mailer.Send(n.to, email.GetClassCancelledSubject(), body); err != nil {
+				log.Printf("Failed to send cancellation notice to %s: %v", n.to, err)
+			}
+		}
+	}()
+}
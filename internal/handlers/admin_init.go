@@ -24,10 +24,11 @@ func EnsureAdmin(db *sql.DB) error {
 
 	// upsert admin user
 	_, err = db.Exec(`
-		INSERT INTO users (email, password_hash, is_admin)
-		VALUES ($1, $2, true)
+		INSERT INTO users (email, password_hash, role, email_verified_at)
+		VALUES ($1, $2, 'super_admin', NOW())
 		ON CONFLICT (email)
-		DO UPDATE SET password_hash = $2, is_admin = true
+		DO UPDATE SET password_hash = $2, role = 'super_admin',
+			email_verified_at = COALESCE(users.email_verified_at, NOW())
 	`, email, string(hash))
 
 	if err != nil {
@@ -3,8 +3,10 @@ package handlers
 import (
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
+	"strconv"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/models"
 )
 
 // AdminResetPage shows the reset confirmation page
@@ -26,6 +28,15 @@ func (h *Handler) AdminResetExecute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Safety net: nothing is deleted unless a snapshot was written first
+	snapshot, manifest, err := h.writeSnapshot()
+	if err != nil {
+		log.Printf("Failed to write snapshot before reset: %v", err)
+		http.Error(w, "エラー: バックアップを作成できなかったため、リセットを中止しました", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionSystemBackup, "snapshot", snapshot, nil, manifest)
+
 	// Start transaction
 	tx, err := h.db.Begin()
 	if err != nil {
@@ -63,28 +74,35 @@ func (h *Handler) AdminResetExecute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 5. Delete all instructors
+	// 5. Delete archived editions (the active one and its event dates are kept)
+	if _, err := tx.Exec("DELETE FROM event_editions WHERE status <> 'active'"); err != nil {
+		log.Printf("Failed to delete editions: %v", err)
+		http.Error(w, "エラー: 年度データの削除に失敗しました", http.StatusInternalServerError)
+		return
+	}
+
+	// 6. Delete all instructors
 	if _, err := tx.Exec("DELETE FROM instructors"); err != nil {
 		log.Printf("Failed to delete instructors: %v", err)
 		http.Error(w, "エラー: 講師データの削除に失敗しました", http.StatusInternalServerError)
 		return
 	}
 
-	// 6. Delete all user profiles (students only - admin profiles don't exist typically)
-	if _, err := tx.Exec("DELETE FROM user_profiles WHERE user_id IN (SELECT id FROM users WHERE is_admin = FALSE)"); err != nil {
+	// 7. Delete all user profiles (students only - admin profiles don't exist typically)
+	if _, err := tx.Exec("DELETE FROM user_profiles WHERE user_id IN (SELECT id FROM users WHERE role = 'student')"); err != nil {
 		log.Printf("Failed to delete user profiles: %v", err)
 		http.Error(w, "エラー: ユーザープロファイルの削除に失敗しました", http.StatusInternalServerError)
 		return
 	}
 
-	// 7. Delete all non-admin users
-	if _, err := tx.Exec("DELETE FROM users WHERE is_admin = FALSE"); err != nil {
+	// 8. Delete all family accounts (staff accounts are kept)
+	if _, err := tx.Exec("DELETE FROM users WHERE role = 'student'"); err != nil {
 		log.Printf("Failed to delete users: %v", err)
 		http.Error(w, "エラー: ユーザーデータの削除に失敗しました", http.StatusInternalServerError)
 		return
 	}
 
-	// 8. Reset system settings to defaults
+	// 9. Reset system settings to defaults
 	if _, err := tx.Exec("DELETE FROM system_settings"); err != nil {
 		log.Printf("Failed to delete system_settings: %v", err)
 		http.Error(w, "エラー: システム設定の削除に失敗しました", http.StatusInternalServerError)
@@ -94,14 +112,22 @@ func (h *Handler) AdminResetExecute(w http.ResponseWriter, r *http.Request) {
 	// Insert default settings
 	if _, err := tx.Exec(`
 		INSERT INTO system_settings (setting_key, setting_value) VALUES
-		('event_date_1', '2025-08-01'),
-		('event_date_2', '2025-08-02')
-	`); err != nil {
+		('cancel_deadline_hours', $1),
+		('enrollment_rules', '{"max_per_day": 2, "max_total": 3, "forbid_overlap": true}'),
+		('retention_days', $2)
+	`, strconv.Itoa(models.DefaultCancelDeadlineHours), strconv.Itoa(models.DefaultRetentionDays)); err != nil {
 		log.Printf("Failed to insert default settings: %v", err)
 		http.Error(w, "エラー: デフォルト設定の追加に失敗しました", http.StatusInternalServerError)
 		return
 	}
 
+	// The reset is recorded in the same transaction: no record, no reset
+	if err := audit.Record(tx, auditEntry(r, audit.ActionSystemReset, "system", "", nil, map[string]string{"snapshot": snapshot})); err != nil {
+		log.Printf("Failed to write audit log: %v", err)
+		http.Error(w, "エラー: 監査ログの記録に失敗しました", http.StatusInternalServerError)
+		return
+	}
+
 	// Commit database changes
 	if err := tx.Commit(); err != nil {
 		log.Printf("Failed to commit transaction: %v", err)
@@ -109,51 +135,33 @@ func (h *Handler) AdminResetExecute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// 9. Delete all files in uploads directory
-	uploadDir := os.Getenv("UPLOAD_DIR")
-	if uploadDir == "" {
-		uploadDir = "./web/static/uploads"
-	}
-
-	if err := clearUploadDirectory(uploadDir); err != nil {
+	// 10. Delete all uploaded files
+	if err := h.clearUploads(); err != nil {
 		log.Printf("Warning: Failed to clear upload directory: %v", err)
 		// Don't fail the entire operation if file deletion fails
 	}
 
 	log.Println("System reset completed successfully")
 
-	// Redirect to admin home with success message
-	// You could also render a success page here
-	http.Redirect(w, r, "/admin?reset=success", http.StatusSeeOther)
+	// Show the snapshot so it can be downloaded (or restored) right away
+	http.Redirect(w, r, "/admin/backups?reset="+snapshot, http.StatusSeeOther)
 }
 
-// clearUploadDirectory removes all files from the uploads directory
-func clearUploadDirectory(uploadDir string) error {
-	// Check if directory exists
-	if _, err := os.Stat(uploadDir); os.IsNotExist(err) {
-		// Directory doesn't exist, nothing to clear
-		return nil
-	}
-
-	// Read all files in directory
-	entries, err := os.ReadDir(uploadDir)
+// clearUploads removes all uploaded files from the store
+func (h *Handler) clearUploads() error {
+	files, err := h.store.List()
 	if err != nil {
 		return err
 	}
 
 	// Delete each file
-	for _, entry := range entries {
-		if entry.IsDir() {
-			continue // Skip subdirectories
-		}
-
-		filePath := filepath.Join(uploadDir, entry.Name())
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("Warning: Failed to delete file %s: %v", filePath, err)
+	for _, f := range files {
+		if err := h.store.Delete(f.Name); err != nil {
+			log.Printf("Warning: Failed to delete file %s: %v", f.Name, err)
 			// Continue deleting other files even if one fails
 		}
 	}
 
-	log.Printf("Cleared %d files from upload directory", len(entries))
+	log.Printf("Cleared %d uploaded files", len(files))
 	return nil
 }
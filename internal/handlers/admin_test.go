@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/models"
+)
+
+func TestAdminConfigSavesAllOrNothing(t *testing.T) {
+	h, db, _ := newTestHandler(t)
+	hoursBefore, err := models.GetCancelDeadlineHours(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rulesBefore, err := models.GetEnrollmentRules(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A valid deadline with an invalid rule saves neither
+	w := postForm(h.AdminConfig, "/admin/config", url.Values{
+		"cancel_deadline_hours": {"72"},
+		"max_per_day":           {"1"},
+		"max_total":             {"-1"},
+	})
+	if w.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("invalid form: status %d", w.Code)
+	}
+	// The form comes back with the message next to the field and what was entered
+	body := w.Body.String()
+	if !strings.Contains(body, "全体の上限には0以上の数値を入力してください") || !strings.Contains(body, `value="72"`) {
+		t.Errorf("form not shown again with its error:\n%s", body)
+	}
+	if hours, _ := models.GetCancelDeadlineHours(db); hours != hoursBefore {
+		t.Errorf("cancel deadline saved from a rejected form: %d", hours)
+	}
+	if rules, _ := models.GetEnrollmentRules(db); rules.MaxPerDay != rulesBefore.MaxPerDay {
+		t.Errorf("rules saved from a rejected form: %+v", rules)
+	}
+	if entries, _ := audit.List(db, audit.Filter{Action: audit.ActionSettingsSave}); len(entries) != 0 {
+		t.Errorf("rejected form was audited: %d entries", len(entries))
+	}
+
+	w = postForm(h.AdminConfig, "/admin/config", url.Values{
+		"cancel_deadline_hours": {"72"},
+		"max_per_day":           {"1"},
+		"max_total":             {"4"},
+		"grade_3_total":         {"2"},
+	})
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("valid form: status %d", w.Code)
+	}
+	if hours, _ := models.GetCancelDeadlineHours(db); hours != 72 {
+		t.Errorf("cancel deadline = %d, want 72", hours)
+	}
+	rules, _ := models.GetEnrollmentRules(db)
+	if rules.MaxPerDay != 1 || rules.MaxTotal != 4 || rules.GradeLimits["3"].MaxTotal != 2 || rules.ForbidOverlap {
+		t.Errorf("rules = %+v", rules)
+	}
+	if entries, _ := audit.List(db, audit.Filter{Action: audit.ActionSettingsSave}); len(entries) != 1 {
+		t.Errorf("%d audit entries, want 1", len(entries))
+	}
+}
+
+func TestParseClassFormLengths(t *testing.T) {
+	h, _, _ := newTestHandler(t)
+	tests := []struct {
+		field string
+		max   int
+	}{
+		{"class_name", 60},
+		{"room_name", 100},
+		{"description", 5000},
+	}
+	for _, tt := range tests {
+		for _, n := range []int{tt.max, tt.max + 1} {
+			t.Run(fmt.Sprintf("%s/%d", tt.field, n), func(t *testing.T) {
+				form := url.Values{
+					"class_name":      {"ロボット入門"},
+					"room_number":     {"1-101"},
+					"room_name":       {"第1演習室"},
+					"teacher_name_1":  {"担当 一郎"},
+					"reception_start": {"2020-01-01T09:00"},
+					"reception_end":   {"2020-01-02T09:00"},
+				}
+				form.Set(tt.field, strings.Repeat("あ", n))
+				r := httptest.NewRequest(http.MethodPost, "/admin/classes/new", strings.NewReader(form.Encode()))
+				r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+				_, _, errs, err := h.parseClassForm(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got, want := errs.Has(tt.field), n > tt.max; got != want {
+					t.Errorf("error on %s = %v, want %v (%v)", tt.field, got, want, errs)
+				}
+				if n == tt.max && !errs.OK() {
+					t.Errorf("errors on a valid form: %v", errs)
+				}
+			})
+		}
+	}
+}
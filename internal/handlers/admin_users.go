@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/models"
+)
+
+// AdminUserList shows registered accounts; ?filter=unverified lists only
+// accounts whose email address hasn't been confirmed yet
+func (h *Handler) AdminUserList(w http.ResponseWriter, r *http.Request) {
+	filter := r.URL.Query().Get("filter")
+
+	users, err := models.ListUsers(h.db, filter == "unverified")
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	locked, err := h.throttle.LockedAccounts()
+	if err != nil {
+		log.Printf("Failed to load locked accounts: %v", err)
+	}
+	rows := make([]userRow, 0, len(users))
+	for _, u := range users {
+		role, _ := auth.ParseRole(u.Role)
+		rows = append(rows, userRow{
+			UserSummary: u,
+			RoleLabel:   role.Label(),
+			LockedUntil: locked[strings.ToLower(u.Email)],
+		})
+	}
+
+	// role assignment controls are only shown to those allowed to use them
+	me, _, _ := currentUser(r)
+	canAssign := currentStaff(r).Role.Can(auth.PermAssignRoles)
+	var instructors []models.Instructor
+	if canAssign {
+		instructors, _ = models.GetAllInstructors(h.db)
+	}
+
+	h.tpl.Render(w, "admin_users.html", map[string]any{
+		"Users":          rows,
+		"Filter":         filter,
+		"CanAssignRoles": canAssign,
+		"Roles":          roleOptions(),
+		"Instructors":    instructors,
+		"Me":             me,
+		"Error":          r.URL.Query().Get("error"),
+	})
+}
+
+// roleOption is one entry of the role select box
+type roleOption struct {
+	Value string
+	Label string
+}
+
+func roleOptions() []roleOption {
+	var opts []roleOption
+	for _, role := range auth.Roles() {
+		opts = append(opts, roleOption{Value: string(role), Label: role.Label()})
+	}
+	return opts
+}
+
+// AdminAssignRole changes a user's role, linking instructor accounts to
+// the instructor whose classes they may see
+func (h *Handler) AdminAssignRole(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	back := "/admin/users?filter=" + r.FormValue("filter")
+
+	userID, _ := strconv.Atoi(r.FormValue("user_id"))
+	role, ok := auth.ParseRole(r.FormValue("role"))
+	if !ok {
+		http.Error(w, "invalid role", http.StatusBadRequest)
+		return
+	}
+	instructorID, _ := strconv.Atoi(r.FormValue("instructor_id"))
+
+	// An admin demoting themselves could leave nobody able to assign roles
+	if me, _, _ := currentUser(r); me == userID {
+		http.Redirect(w, r, back+"&error=self", http.StatusSeeOther)
+		return
+	}
+	if role == auth.RoleInstructor && instructorID == 0 {
+		http.Redirect(w, r, back+"&error=instructor", http.StatusSeeOther)
+		return
+	}
+
+	oldRole, oldInstructor, err := models.GetUserRole(h.db, userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := models.UpdateUserRole(h.db, userID, string(role), instructorID); err != nil {
+		log.Printf("Failed to assign role %s to user %d: %v", role, userID, err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	if role != auth.RoleInstructor {
+		instructorID = 0
+	}
+	h.logAudit(r, audit.ActionUserRole, "user", userID,
+		map[string]any{"role": oldRole, "instructor_id": oldInstructor},
+		map[string]any{"role": role, "instructor_id": instructorID})
+	http.Redirect(w, r, back, http.StatusSeeOther)
+}
+
+// userRow adds login lockout state to a user list entry
+type userRow struct {
+	models.UserSummary
+	RoleLabel   string
+	LockedUntil time.Time // zero unless locked out by failed logins
+}
+
+// AdminUnlockUser lifts a lockout caused by failed logins
+func (h *Handler) AdminUnlockUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.throttle.Unlock(r.FormValue("email"), clientIP(r)); err != nil {
+		log.Printf("Failed to unlock %s: %v", r.FormValue("email"), err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	// The log names the account by ID: entries can't be scrubbed later
+	target := ""
+	if u, err := models.GetUserByEmail(h.db, r.FormValue("email")); err == nil {
+		target = strconv.Itoa(u.ID)
+	}
+	h.logAudit(r, audit.ActionUserUnlock, "user", target, nil, nil)
+	http.Redirect(w, r, "/admin/users?filter="+r.FormValue("filter"), http.StatusSeeOther)
+}
+
+// AdminVerifyUser marks an account as verified, e.g. after confirming the
+// address with the family by phone
+func (h *Handler) AdminVerifyUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	userID, _ := strconv.Atoi(r.FormValue("user_id"))
+
+	if err := models.MarkEmailVerified(h.db, userID); err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionUserVerify, "user", userID, nil, nil)
+	http.Redirect(w, r, "/admin/users?filter="+r.FormValue("filter"), http.StatusSeeOther)
+}
+
+// AdminRevokeSessions logs a user out on every device, e.g. when a family
+// reports a lost phone or a shared PC
+func (h *Handler) AdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/users", http.StatusSeeOther)
+		return
+	}
+	userID, _ := strconv.Atoi(r.FormValue("user_id"))
+
+	if err := h.sessions.EndAll(userID); err != nil {
+		log.Printf("Failed to revoke sessions of user %d: %v", userID, err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionUserLogout, "user", userID, nil, nil)
+	http.Redirect(w, r, "/admin/users?filter="+r.FormValue("filter"), http.StatusSeeOther)
+}
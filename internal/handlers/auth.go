@@ -3,7 +3,10 @@ package handlers
 
 import (
 	"database/sql"
+	"fmt"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"example.com/myapp/internal/auth"
@@ -11,6 +14,8 @@ import (
 	"example.com/myapp/internal/template"
 	"example.com/myapp/internal/config"
 	"example.com/myapp/internal/email"
+	"example.com/myapp/internal/storage"
+	"example.com/myapp/internal/validate"
 
 	"crypto/rand"
 	"encoding/hex"
@@ -19,36 +24,35 @@ import (
 
 
 type Handler struct {
-	db     *sql.DB
-	tpl    *template.Renderer
-	cfg    config.Config
-	sess   *auth.Session
-	mailer *email.Mailer
+	db       *sql.DB
+	tpl      *template.Renderer
+	cfg      config.Config
+	sess     *auth.Session // signs the CSRF cookie
+	sessions *auth.SessionManager
+	throttle *auth.Throttler
+	mailer   email.Sender
+	store    storage.Storage // uploaded syllabus files
 }
 
-func New(db *sql.DB, tpl *template.Renderer, cfg config.Config) *Handler {
-	// if cookie keys not provided, generate ephemeral keys (dev only)
+func New(db *sql.DB, tpl *template.Renderer, cfg config.Config, store storage.Storage, mailer email.Sender) *Handler {
+	// if cookie keys not provided, generate ephemeral keys (dev only).
+	// Logins are stored server-side and survive a restart; only the CSRF
+	// cookie is re-issued, so an open form may need a reload.
 	hash := cfg.CookieHash
 	if hash == "" {
 		hash = string(authRandom(32))
 	}
 	block := cfg.CookieBlock
 
-	// Initialize email mailer
-	emailConfig := email.Config{
-		Host:     cfg.SMTPHost,
-		Port:     email.ParsePort(cfg.SMTPPort),
-		Username: cfg.SMTPUsername,
-		Password: cfg.SMTPPassword,
-		From:     cfg.SMTPFrom,
-	}
-
 	return &Handler{
-		db:     db,
-		tpl:    tpl,
-		cfg:    cfg,
-		sess:   auth.NewSecureCookie(hash, block),
-		mailer: email.NewMailer(emailConfig),
+		db:       db,
+		tpl:      tpl,
+		cfg:      cfg,
+		sess:     auth.NewSecureCookie(hash, block),
+		sessions: auth.NewSessionManager(auth.NewPostgresStore(db)),
+		throttle: auth.NewThrottler(auth.NewPostgresAttemptStore(db)),
+		mailer:   mailer,
+		store:    store,
 	}
 }
 
@@ -73,9 +77,11 @@ func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
     sSchool := "-"
     sGrade := "-"
     sGuardian := "-"
+    var extra models.UserProfile // furigana, phone etc.; empty without a profile
 
     // Only overwrite if profile actually exists
     if err == nil && profile != nil {
+        extra = *profile
         if profile.StudentName.Valid { sName = profile.StudentName.String }
         if profile.SchoolName.Valid  { sSchool = profile.SchoolName.String }
         if profile.Grade.Valid       { sGrade = profile.Grade.String }
@@ -88,14 +94,63 @@ func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
         mySessions = nil // Handle error gracefully
     }
 
+    // Work out which reservations can still be cancelled
+    deadline, err := models.GetCancelDeadline(h.db)
+    if err != nil {
+        log.Printf("Failed to load cancel deadline: %v", err)
+        http.Error(w, "DB Error", http.StatusInternalServerError)
+        return
+    }
+    now := time.Now()
+    var reservations []ReservationView
+    for _, s := range mySessions {
+        cancelBy := s.StartAt.Add(-deadline)
+        reservations = append(reservations, ReservationView{
+            EnrolledSession: s,
+            CanCancel:       s.IsWaitlisted() || now.Before(cancelBy),
+            CancelDeadline:  cancelBy,
+        })
+    }
+
+    // Result message from a cancel redirect (?cancel=...)
+    var notice, noticeErr string
+    switch r.URL.Query().Get("cancel") {
+    case "success":
+        notice = "申込をキャンセルしました。確認メールをお送りしました。"
+    case "deadline":
+        noticeErr = "キャンセル期限を過ぎているため、キャンセルできません。"
+    case "notfound":
+        noticeErr = "キャンセル対象の申込が見つかりませんでした。"
+    }
+    if pos := r.URL.Query().Get("waitlist"); pos != "" {
+        notice = "キャンセル待ちに登録しました (" + pos + "番目)。空きが出ると自動で申込が確定し、メールでお知らせします。"
+    }
+    switch r.URL.Query().Get("verify") {
+    case "sent":
+        notice = "確認メールを再送しました。メール内のリンクからメールアドレスの確認を完了してください。"
+    case "limited":
+        noticeErr = "確認メールの再送回数が上限に達しました。しばらく時間をおいてからお試しください。"
+    }
+
+    verified, err := models.IsEmailVerified(h.db, userID)
+    if err != nil {
+        log.Printf("Failed to check email verification for user %d: %v", userID, err)
+        verified = true // don't nag on a transient DB error
+    }
+
     // 5. Prepare View
     view := map[string]any{
         "StudentName":  sName,      // <--- Now using the safe variable
         "SchoolName":   sSchool,
         "Grade":        sGrade,
         "GuardianName": sGuardian,
+        "Profile":      extra,
         "Email":        data["email"],
-        "Reservations": mySessions,
+        "Reservations": reservations,
+        "Notice":       notice,
+        "NoticeError":  noticeErr,
+        "CancelHours":  int(deadline.Hours()),
+        "Unverified":   !verified,
     }
 
     h.tpl.Render(w, "mypage.html", view)
@@ -104,7 +159,7 @@ func (h *Handler) Home(w http.ResponseWriter, r *http.Request) {
 
 func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
     if r.Method == http.MethodGet {
-        h.tpl.Render(w, "signup.html", nil)
+        h.tpl.Render(w, "signup.html", signupFormData(signupForm{}, nil))
         return
     }
 
@@ -113,51 +168,106 @@ func (h *Handler) Signup(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    email := r.PostForm.Get("Email")
-    pw := r.PostForm.Get("password")
-    studentName := r.PostForm.Get("student_name")
-    schoolName := r.PostForm.Get("school_name")
-    grade := r.PostForm.Get("grade")
-    guardianName := r.PostForm.Get("guardian_name")
-
-    if email == "" || pw == "" || studentName == "" || schoolName == "" || grade == "" || guardianName == "" {
-        http.Error(w, "invalid input", http.StatusBadRequest)
+    form, errs := parseSignupForm(r)
+    if !errs.OK() {
+        w.WriteHeader(http.StatusUnprocessableEntity)
+        h.tpl.Render(w, "signup.html", signupFormData(form, errs))
         return
     }
 
-    hashed, err := auth.HashPassword(pw)
+    hashed, err := auth.HashPassword(form.Password)
     if err != nil {
         http.Error(w, "server error", http.StatusInternalServerError)
         return
     }
 
-    userID, err := models.CreateUser(h.db, email, hashed)
-    if err != nil {
-	    if err == models.ErrUserExists {
-		    http.Error(w, "email already exists", http.StatusConflict)
-		    return
-	    }
-	    log.Printf("Signup error: %v", err) // Good practice to log the real error
-	    http.Error(w, "server error", http.StatusInternalServerError)
-	    return
-    }
-
-    // insert into user_profiles table
-    err = models.CreateUserProfile(h.db, userID, studentName, schoolName, grade, guardianName)
-
+    // account and profile are created together, or not at all
+    userID, err := models.CreateStudent(h.db, form.Email, hashed, form.Profile)
     if err != nil {
+        if err == models.ErrUserExists {
+            errs.Add("Email", "このメールアドレスは既に登録されています")
+            w.WriteHeader(http.StatusConflict)
+            h.tpl.Render(w, "signup.html", signupFormData(form, errs))
+            return
+        }
+        log.Printf("Signup error: %v", err) // Good practice to log the real error
         http.Error(w, "server error", http.StatusInternalServerError)
         return
     }
 
+    // send the address confirmation link; the account can log in but not enroll until it's used
+    if err := h.sendVerificationEmail(userID, form.Email); err != nil {
+        log.Printf("Failed to send verification email to user %d: %v", userID, err)
+    }
+
     // redirect to login page after successful signup
-    http.Redirect(w, r, "/login", http.StatusSeeOther)
+    http.Redirect(w, r, "/login?signup=verify", http.StatusSeeOther)
+}
+
+// signupForm is the input of the signup form
+type signupForm struct {
+    Email    string
+    Password string
+    Profile  models.StudentProfile
+}
+
+// signupFormData prepares signup.html. The password is never sent back.
+func signupFormData(form signupForm, errs validate.Errors) map[string]any {
+    if errs == nil {
+        errs = validate.Errors{}
+    }
+    return map[string]any{
+        "Email":        form.Email,
+        "Profile":      form.Profile,
+        "Grades":       models.Grades,
+        "MaxGuardians": models.MaxAccompanyingGuardians,
+        "Errors":       errs,
+    }
+}
+
+// parseSignupForm reads and checks the signup form. Lengths match the
+// user_profiles columns.
+func parseSignupForm(r *http.Request) (signupForm, validate.Errors) {
+    errs := validate.Errors{}
+    f := r.PostForm
+    form := signupForm{
+        Email:    errs.Email("Email", f.Get("Email"), "メールアドレス"),
+        Password: f.Get("password"),
+    }
+    errs.MaxLength("Email", form.Email, 255, "メールアドレス")
+
+    errs.Password("password", form.Password)
+
+    p := &form.Profile
+    p.StudentName = errs.Required("student_name", f.Get("student_name"), "中学生氏名")
+    errs.MaxLength("student_name", p.StudentName, 100, "中学生氏名")
+    p.StudentKana = errs.Required("student_kana", f.Get("student_kana"), "ふりがな")
+    errs.MaxLength("student_kana", p.StudentKana, 100, "ふりがな")
+    errs.Kana("student_kana", p.StudentKana, "ふりがな")
+    p.SchoolName = errs.Required("school_name", f.Get("school_name"), "中学校名")
+    errs.MaxLength("school_name", p.SchoolName, 100, "中学校名")
+    p.Grade = f.Get("grade")
+    errs.OneOf("grade", p.Grade, models.Grades, "学年")
+    p.GuardianName = errs.Required("guardian_name", f.Get("guardian_name"), "保護者氏名")
+    errs.MaxLength("guardian_name", p.GuardianName, 100, "保護者氏名")
+    p.Phone = errs.Required("phone", f.Get("phone"), "電話番号")
+    errs.MaxLength("phone", p.Phone, 20, "電話番号")
+    errs.Phone("phone", p.Phone, "電話番号")
+    p.GuardianCount = errs.IntRange("guardian_count", f.Get("guardian_count"), 0, models.MaxAccompanyingGuardians, "同伴する保護者の人数")
+    p.AccessibilityNeeds = strings.TrimSpace(f.Get("accessibility_needs"))
+    errs.MaxLength("accessibility_needs", p.AccessibilityNeeds, 500, "配慮が必要な事項")
+    return form, errs
 }
 
 // Login: GET shows form; POST authenticates
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 	if r.Method == http.MethodGet {
-		h.tpl.Render(w, "login.html", nil)
+		h.tpl.Render(w, "login.html", map[string]any{
+			"ResetDone":  r.URL.Query().Get("reset") == "success",
+			"SignupDone": r.URL.Query().Get("signup") == "verify",
+			"LogoutAll":  r.URL.Query().Get("logout") == "all",
+			"Restored":   r.URL.Query().Get("restored") == "1",
+		})
 		return
 	}
 	if err := r.ParseForm(); err != nil {
@@ -171,68 +281,103 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// refuse before touching bcrypt if this account or address is being hammered
+	ip := clientIP(r)
+	decision, err := h.throttle.Check(email, ip)
+	if err != nil {
+		log.Printf("Login throttle check failed: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if !decision.Allowed {
+		msg := fmt.Sprintf("ログイン試行が続けて失敗したため、%d秒後に再度お試しください。", int(decision.RetryAfter.Seconds())+1)
+		if decision.Locked {
+			msg = fmt.Sprintf("ログインの失敗が続いたため、一時的にロックされています。約%d分後に再度お試しいただくか、管理者にお問い合わせください。", int(decision.RetryAfter.Minutes())+1)
+		}
+		w.Header().Set("Retry-After", strconv.Itoa(int(decision.RetryAfter.Seconds())+1))
+		w.WriteHeader(http.StatusTooManyRequests)
+		h.tpl.Render(w, "login.html", map[string]any{"Error": msg})
+		return
+	}
+
 	u, err := models.GetUserByEmail(h.db, email)
 	if err != nil {
+		h.recordLoginFailure(email, ip)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
 	if err := auth.CompareHash(u.PasswordHash, pw); err != nil {
+		h.recordLoginFailure(email, ip)
 		http.Error(w, "invalid credentials", http.StatusUnauthorized)
 		return
 	}
 
-	// determine admin flag from DB (ensure models.User or DB has this column)
-	var isAdmin bool
-	if err := h.db.QueryRow("SELECT is_admin FROM users WHERE id = $1", u.ID).Scan(&isAdmin); err != nil {
+	if err := h.throttle.RecordSuccess(email, ip); err != nil {
+		log.Printf("Failed to record login success: %v", err)
+	}
+
+	// determine role from DB
+	roleName, _, err := models.GetUserRole(h.db, u.ID)
+	if err != nil {
 		// If this fails, treat as server error rather than letting login succeed silently
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
+	role, _ := auth.ParseRole(roleName)
 
-	// create session payload
-	payload := map[string]any{
-		"user_id": u.ID,
-		"email":   u.Email,
-		"exp":     time.Now().Add(24 * time.Hour).Unix(),
-	}
-	encoded, err := h.sess.Secure.Encode(h.sess.Key, payload)
-	if err != nil {
+	// record the login server-side; the cookie only carries an opaque ID
+	if err := h.sessions.Start(w, u.ID, u.Email); err != nil {
+		log.Printf("Failed to start session for user %d: %v", u.ID, err)
 		http.Error(w, "server error", http.StatusInternalServerError)
 		return
 	}
-	c := &http.Cookie{
-		Name:     h.sess.Key,
-		Value:    encoded,
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  time.Now().Add(24 * time.Hour),
-		// Secure: true, // enable in production with HTTPS
-	}
-	http.SetCookie(w, c)
 
 	// redirect based on role
-	if isAdmin {
+	if role == auth.RoleInstructor {
+		http.Redirect(w, r, "/instructor", http.StatusSeeOther)
+	} else if role.IsStaff() {
 		http.Redirect(w, r, "/admin", http.StatusSeeOther)
 	} else {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 	}
 }
 
-// Logout
+// recordLoginFailure counts a failed attempt towards the throttling limits
+func (h *Handler) recordLoginFailure(email, ip string) {
+	if err := h.throttle.RecordFailure(email, ip); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+// Logout ends this browser's session
 func (h *Handler) Logout(w http.ResponseWriter, r *http.Request) {
-	c := &http.Cookie{
-		Name:     h.sess.Key,
-		Value:    "",
-		Path:     "/",
-		HttpOnly: true,
-		Expires:  time.Unix(0, 0),
-		MaxAge:   -1,
-	}
-	http.SetCookie(w, c)
+	if err := h.sessions.End(w, r); err != nil {
+		log.Printf("Failed to end session: %v", err)
+	}
 	http.Redirect(w, r, "/login", http.StatusSeeOther)
 }
 
+// LogoutAll ends every session of the current user, e.g. after using a shared PC
+func (h *Handler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	userID, _, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := h.sessions.EndAll(userID); err != nil {
+		log.Printf("Failed to end sessions of user %d: %v", userID, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	_ = h.sessions.End(w, r) // clears this browser's cookie too
+	http.Redirect(w, r, "/login?logout=all", http.StatusSeeOther)
+}
+
 
 // authRandom generates a random byte slice of length n, returns hex bytes
 func authRandom(n int) []byte {
@@ -0,0 +1,286 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/backup"
+	"example.com/myapp/internal/models"
+)
+
+// maxSnapshotUpload caps an uploaded snapshot. Snapshots include the
+// uploaded files; a larger one can still be restored from the stored list.
+const maxSnapshotUpload = 256 << 20 // 256MB
+
+// snapshotFile is a snapshot stored in the backup directory
+type snapshotFile struct {
+	Name      string
+	Size      int64
+	CreatedAt time.Time
+}
+
+// snapshotTimeFormat dates snapshot names. The sub-second digits keep the
+// names in creation order even for several snapshots in one second.
+const snapshotTimeFormat = "20060102-150405.000000"
+
+// isSnapshotName accepts only names writeSnapshot produces, so a request
+// can't reach files outside the backup directory
+func isSnapshotName(name string) bool {
+	return name == filepath.Base(name) && strings.HasPrefix(name, "snapshot-") && strings.HasSuffix(name, ".zip")
+}
+
+// writeSnapshot saves a snapshot of the whole system into the backup
+// directory and returns its file name
+func (h *Handler) writeSnapshot() (string, backup.Manifest, error) {
+	if err := os.MkdirAll(h.cfg.BackupDir, 0700); err != nil {
+		return "", backup.Manifest{}, err
+	}
+
+	// Written under a temporary name so a half-written file is never listed
+	tmp, err := os.CreateTemp(h.cfg.BackupDir, ".snapshot-*")
+	if err != nil {
+		return "", backup.Manifest{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	m, err := backup.Write(h.db, h.store, tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return "", m, err
+	}
+	name, err := h.keepSnapshot(tmp.Name())
+	if err != nil {
+		return "", m, err
+	}
+	h.PruneSnapshots()
+	return name, m, nil
+}
+
+// keepSnapshot links the finished file at tmp under a snapshot name and
+// returns the name. Unlike a rename, the link never replaces a snapshot
+// that already has the name; another try gets a later time.
+func (h *Handler) keepSnapshot(tmp string) (string, error) {
+	for range 100 {
+		name := fmt.Sprintf("snapshot-%s.zip", time.Now().In(models.EventLocation).Format(snapshotTimeFormat))
+		err := os.Link(tmp, filepath.Join(h.cfg.BackupDir, name))
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return "", err
+		}
+	}
+	return "", errors.New("no free snapshot name")
+}
+
+// PruneSnapshots deletes snapshots older than the retention period
+// (BACKUP_RETENTION_DAYS). They hold password hashes and every student's
+// details, so they shouldn't pile up. The newest one is always kept.
+func (h *Handler) PruneSnapshots() {
+	if h.cfg.BackupRetentionDays <= 0 {
+		return // keep everything
+	}
+	list, err := h.listSnapshots()
+	if err != nil {
+		log.Printf("Failed to list snapshots for pruning: %v", err)
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -h.cfg.BackupRetentionDays)
+	for i, s := range list {
+		if i == 0 || !s.CreatedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(h.cfg.BackupDir, s.Name)); err != nil {
+			log.Printf("Failed to delete old snapshot %s: %v", s.Name, err)
+			continue
+		}
+		log.Printf("Deleted snapshot %s (older than %d days)", s.Name, h.cfg.BackupRetentionDays)
+	}
+}
+
+// replaceSnapshots takes a fresh snapshot and deletes every older one.
+// It runs after anonymizing an edition: the older snapshots still hold the
+// names and addresses that were just scrubbed. Returns how many were deleted.
+func (h *Handler) replaceSnapshots() (int, error) {
+	name, _, err := h.writeSnapshot()
+	if err != nil {
+		return 0, err
+	}
+	list, err := h.listSnapshots()
+	if err != nil {
+		return 0, err
+	}
+	deleted := 0
+	for _, s := range list {
+		if s.Name == name {
+			continue
+		}
+		if err := os.Remove(filepath.Join(h.cfg.BackupDir, s.Name)); err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// listSnapshots returns the stored snapshots, newest first
+func (h *Handler) listSnapshots() ([]snapshotFile, error) {
+	entries, err := os.ReadDir(h.cfg.BackupDir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var list []snapshotFile
+	for _, e := range entries {
+		if !isSnapshotName(e.Name()) {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, snapshotFile{Name: e.Name(), Size: info.Size(), CreatedAt: info.ModTime().In(models.EventLocation)})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name > list[j].Name })
+	return list, nil
+}
+
+// AdminBackups lists the snapshots and offers download and restore
+func (h *Handler) AdminBackups(w http.ResponseWriter, r *http.Request) {
+	snapshots, err := h.listSnapshots()
+	if err != nil {
+		log.Printf("Failed to list snapshots: %v", err)
+		http.Error(w, "バックアップ一覧を読み込めませんでした", http.StatusInternalServerError)
+		return
+	}
+	q := r.URL.Query()
+	h.tpl.Render(w, "admin_backups.html", map[string]any{
+		"Snapshots": snapshots,
+		"Retention": h.cfg.BackupRetentionDays,
+		"Created":   q.Get("created"),
+		"Reset":     q.Get("reset"),
+		"Error":     q.Get("error"),
+	})
+}
+
+// AdminCreateBackup takes a snapshot on demand
+func (h *Handler) AdminCreateBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/backups", http.StatusSeeOther)
+		return
+	}
+	name, m, err := h.writeSnapshot()
+	if err != nil {
+		log.Printf("Failed to write snapshot: %v", err)
+		http.Error(w, "バックアップの作成に失敗しました", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionSystemBackup, "snapshot", name, nil, m)
+	http.Redirect(w, r, "/admin/backups?created="+name, http.StatusSeeOther)
+}
+
+// AdminDownloadBackup sends one stored snapshot
+func (h *Handler) AdminDownloadBackup(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if !isSnapshotName(name) {
+		http.NotFound(w, r)
+		return
+	}
+	f, err := os.Open(filepath.Join(h.cfg.BackupDir, name))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "File error", http.StatusInternalServerError)
+		return
+	}
+
+	h.logAudit(r, audit.ActionDataExport, "snapshot", name, nil, nil)
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	http.ServeContent(w, r, name, info.ModTime(), f)
+}
+
+// AdminRestoreBackup loads a snapshot (uploaded, or picked from the stored
+// ones) into a database without event data, e.g. right after a reset.
+// Staff accounts are replaced too, so everyone has to log in again.
+func (h *Handler) AdminRestoreBackup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/backups", http.StatusSeeOther)
+		return
+	}
+	// CSRF normally parsed the form already, under multipartLimits
+	if r.MultipartForm == nil {
+		r.Body = http.MaxBytesReader(w, r.Body, maxSnapshotUpload)
+	}
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		http.Redirect(w, r, "/admin/backups?error=upload", http.StatusSeeOther)
+		return
+	}
+
+	var (
+		m    backup.Manifest
+		err  error
+		from string
+	)
+	if file, header, ferr := r.FormFile("snapshot"); ferr == nil {
+		defer file.Close()
+		from = header.Filename
+		m, err = backup.Restore(h.db, h.store, file, header.Size)
+	} else if name := r.FormValue("name"); isSnapshotName(name) {
+		from = name
+		m, err = h.restoreStored(name)
+	} else {
+		http.Redirect(w, r, "/admin/backups?error=nofile", http.StatusSeeOther)
+		return
+	}
+
+	switch {
+	case err == nil:
+	case errors.Is(err, backup.ErrNotEmpty):
+		http.Redirect(w, r, "/admin/backups?error=notempty", http.StatusSeeOther)
+		return
+	case errors.Is(err, backup.ErrUnsupportedFormat):
+		log.Printf("Rejected snapshot %s: %v", from, err)
+		http.Redirect(w, r, "/admin/backups?error=format", http.StatusSeeOther)
+		return
+	default:
+		log.Printf("Failed to restore snapshot %s: %v", from, err)
+		http.Error(w, "復元に失敗しました。データベースは変更されていません", http.StatusInternalServerError)
+		return
+	}
+
+	h.logAudit(r, audit.ActionSystemRestore, "snapshot", from, nil, m)
+	// The restored users table replaced the current logins
+	http.Redirect(w, r, "/login?restored=1", http.StatusSeeOther)
+}
+
+func (h *Handler) restoreStored(name string) (backup.Manifest, error) {
+	f, err := os.Open(filepath.Join(h.cfg.BackupDir, name))
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return backup.Manifest{}, err
+	}
+	return backup.Restore(h.db, h.store, f, info.Size())
+}
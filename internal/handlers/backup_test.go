@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/config"
+)
+
+func TestPruneSnapshots(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	ages := map[string]time.Duration{
+		"snapshot-20250101-090000.zip": 90 * 24 * time.Hour,
+		"snapshot-20250301-090000.zip": 40 * 24 * time.Hour,
+		"snapshot-20250401-090000.zip": 2 * 24 * time.Hour,
+		"notes.txt":                    400 * 24 * time.Hour, // not a snapshot: left alone
+	}
+	for name, age := range ages {
+		p := filepath.Join(dir, name)
+		if err := os.WriteFile(p, []byte("x"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(p, now.Add(-age), now.Add(-age)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := &Handler{cfg: config.Config{BackupDir: dir, BackupRetentionDays: 30}}
+	h.PruneSnapshots()
+	if got, want := dirNames(t, dir), []string{"notes.txt", "snapshot-20250401-090000.zip"}; !slices.Equal(got, want) {
+		t.Fatalf("left %v, want %v", got, want)
+	}
+
+	// The newest snapshot stays even when it's past the period
+	if err := os.Chtimes(filepath.Join(dir, "snapshot-20250401-090000.zip"), now.AddDate(0, 0, -100), now.AddDate(0, 0, -100)); err != nil {
+		t.Fatal(err)
+	}
+	h.PruneSnapshots()
+	if got := dirNames(t, dir); len(got) != 2 {
+		t.Fatalf("newest snapshot was deleted: %v", got)
+	}
+
+	// 0 keeps everything
+	old := filepath.Join(dir, "snapshot-20240101-090000.zip")
+	os.WriteFile(old, []byte("x"), 0600)
+	os.Chtimes(old, now.AddDate(-1, 0, 0), now.AddDate(-1, 0, 0))
+	(&Handler{cfg: config.Config{BackupDir: dir}}).PruneSnapshots()
+	if _, err := os.Stat(old); err != nil {
+		t.Fatalf("retention 0 deleted a snapshot: %v", err)
+	}
+}
+
+func dirNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range entries {
+		names = append(names, e.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestKeepSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	h := &Handler{cfg: config.Config{BackupDir: dir}}
+	tmp := filepath.Join(dir, ".snapshot-1")
+	if err := os.WriteFile(tmp, []byte("zip"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Snapshots taken in quick succession never overwrite each other
+	var names []string
+	for range 50 {
+		name, err := h.keepSnapshot(tmp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isSnapshotName(name) {
+			t.Fatalf("name %q is not a snapshot name", name)
+		}
+		names = append(names, name)
+	}
+	list, err := h.listSnapshots()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != len(names) {
+		t.Fatalf("%d snapshots stored, want %d", len(list), len(names))
+	}
+	// Names sort in creation order, which listSnapshots relies on
+	if list[0].Name != names[len(names)-1] || !slices.IsSorted(names) {
+		t.Errorf("newest listed is %s, want %s", list[0].Name, names[len(names)-1])
+	}
+}
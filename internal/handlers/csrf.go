@@ -0,0 +1,131 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+)
+
+// CSRF protection uses the double-submit pattern: a random token lives in a
+// cookie signed with the session keys, and every state-changing request must
+// echo it back in the csrf_token form field (or the X-CSRF-Token header).
+// A cross-site form can make the browser send the cookie but can't read it,
+// so it can't supply the matching field.
+const (
+	csrfCookieName = "csrf"
+	csrfFieldName  = "csrf_token"
+	csrfHeaderName = "X-CSRF-Token"
+)
+
+// The token field sits in the request body, so CSRF is the first to parse
+// it and has to cap the body first; a handler's own MaxBytesReader would
+// come too late.
+const (
+	maxFormBody     = 1 << 20 // plain forms, and multipart forms not in multipartLimits
+	multipartMemory = 8 << 20 // larger multipart forms spill to temporary files
+)
+
+// multipartLimits caps the body of each form that uploads files, by path
+var multipartLimits = map[string]int64{
+	"/admin/classes/new":     classFormLimit,
+	"/admin/classes/edit":    classFormLimit,
+	"/admin/backups/restore": maxSnapshotUpload,
+}
+
+// csrfResponseWriter carries the request's token to template.Renderer,
+// which uses it for the csrfField template function
+type csrfResponseWriter struct {
+	http.ResponseWriter
+	token string
+}
+
+func (w *csrfResponseWriter) CSRFToken() string { return w.token }
+
+// CSRF wraps the whole mux: it issues the token cookie on first visit and
+// rejects POST/PUT/PATCH/DELETE requests whose token doesn't match it
+func (h *Handler) CSRF(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := h.csrfCookieToken(r)
+		if token == "" {
+			token = string(authRandom(32))
+			encoded, err := h.sess.Secure.Encode(csrfCookieName, token)
+			if err != nil {
+				http.Error(w, "server error", http.StatusInternalServerError)
+				return
+			}
+			http.SetCookie(w, &http.Cookie{
+				Name:     csrfCookieName,
+				Value:    encoded,
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			field, err := readCSRFField(w, r)
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				http.Error(w, fmt.Sprintf("送信できるサイズの上限（%dMB）を超えています", tooLarge.Limit>>20), http.StatusRequestEntityTooLarge)
+				return
+			}
+			if err != nil {
+				http.Error(w, "Form error", http.StatusBadRequest)
+				return
+			}
+			sent := r.Header.Get(csrfHeaderName)
+			if sent == "" {
+				sent = field
+			}
+			if subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+				http.Error(w, "Forbidden: invalid CSRF token. Please reload the page and try again.", http.StatusForbidden)
+				return
+			}
+		}
+
+		next.ServeHTTP(&csrfResponseWriter{ResponseWriter: w, token: token}, r)
+	})
+}
+
+// readCSRFField caps and parses a form body and returns its token field.
+// Bodies of other types are left unread; only the header can carry their
+// token.
+func readCSRFField(w http.ResponseWriter, r *http.Request) (string, error) {
+	contentType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch contentType {
+	case "application/x-www-form-urlencoded":
+		r.Body = http.MaxBytesReader(w, r.Body, maxFormBody)
+		if err := r.ParseForm(); err != nil {
+			return "", err
+		}
+	case "multipart/form-data":
+		limit, ok := multipartLimits[r.URL.Path]
+		if !ok {
+			limit = maxFormBody
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		if err := r.ParseMultipartForm(multipartMemory); err != nil {
+			return "", err
+		}
+	default:
+		return "", nil
+	}
+	return r.PostForm.Get(csrfFieldName), nil
+}
+
+// csrfCookieToken returns the token from a valid csrf cookie, or "" if there is none
+func (h *Handler) csrfCookieToken(r *http.Request) string {
+	c, err := r.Cookie(csrfCookieName)
+	if err != nil {
+		return ""
+	}
+	var token string
+	if err := h.sess.Secure.Decode(csrfCookieName, c.Value, &token); err != nil {
+		return ""
+	}
+	return token
+}
@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"example.com/myapp/internal/auth"
+)
+
+const testCSRFToken = "0123456789abcdef"
+
+// csrfTestServer wraps a handler that records whether it ran
+func csrfTestServer(t *testing.T) (*Handler, http.Handler, *bool) {
+	t.Helper()
+	h := &Handler{sess: auth.NewSecureCookie("test-hash-key-0123456789abcdef", "")}
+	reached := false
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached = true
+		w.WriteHeader(http.StatusOK)
+	})
+	return h, h.CSRF(next), &reached
+}
+
+// withCSRFCookie adds the signed cookie holding testCSRFToken
+func withCSRFCookie(t *testing.T, h *Handler, r *http.Request) *http.Request {
+	t.Helper()
+	encoded, err := h.sess.Secure.Encode(csrfCookieName, testCSRFToken)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.AddCookie(&http.Cookie{Name: csrfCookieName, Value: encoded})
+	return r
+}
+
+func formRequest(values url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, "/admin/days/add", strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func multipartRequest(t *testing.T, path string, fields map[string]string, fileSize int) *http.Request {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	if fileSize > 0 {
+		fw, err := mw.CreateFormFile("syllabus_pdf", "a.pdf")
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(bytes.Repeat([]byte("x"), fileSize))
+	}
+	mw.Close()
+	r := httptest.NewRequest(http.MethodPost, path, &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestCSRF(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    func(t *testing.T) *http.Request
+		cookie bool
+		status int
+	}{
+		{"no token", func(t *testing.T) *http.Request {
+			return formRequest(url.Values{"label": {"1日目"}})
+		}, true, http.StatusForbidden},
+		{"no cookie", func(t *testing.T) *http.Request {
+			return formRequest(url.Values{csrfFieldName: {testCSRFToken}})
+		}, false, http.StatusForbidden},
+		{"wrong field", func(t *testing.T) *http.Request {
+			return formRequest(url.Values{csrfFieldName: {"wrong"}})
+		}, true, http.StatusForbidden},
+		{"wrong header", func(t *testing.T) *http.Request {
+			r := formRequest(url.Values{csrfFieldName: {testCSRFToken}})
+			r.Header.Set(csrfHeaderName, "wrong")
+			return r
+		}, true, http.StatusForbidden},
+		{"matching field", func(t *testing.T) *http.Request {
+			return formRequest(url.Values{csrfFieldName: {testCSRFToken}})
+		}, true, http.StatusOK},
+		{"matching header", func(t *testing.T) *http.Request {
+			r := httptest.NewRequest(http.MethodPost, "/logout", nil)
+			r.Header.Set(csrfHeaderName, testCSRFToken)
+			return r
+		}, true, http.StatusOK},
+		{"matching multipart field", func(t *testing.T) *http.Request {
+			return multipartRequest(t, "/admin/classes/new", map[string]string{csrfFieldName: testCSRFToken}, 1000)
+		}, true, http.StatusOK},
+		{"query string is not a token", func(t *testing.T) *http.Request {
+			return httptest.NewRequest(http.MethodPost, "/logout?"+csrfFieldName+"="+testCSRFToken, nil)
+		}, true, http.StatusForbidden},
+		{"plain form over the cap", func(t *testing.T) *http.Request {
+			return formRequest(url.Values{csrfFieldName: {testCSRFToken}, "x": {strings.Repeat("a", maxFormBody)}})
+		}, true, http.StatusRequestEntityTooLarge},
+		{"upload to a path without a limit", func(t *testing.T) *http.Request {
+			return multipartRequest(t, "/admin/days/add", map[string]string{csrfFieldName: testCSRFToken}, maxFormBody)
+		}, true, http.StatusRequestEntityTooLarge},
+		{"upload over the class form cap", func(t *testing.T) *http.Request {
+			return multipartRequest(t, "/admin/classes/new", map[string]string{csrfFieldName: testCSRFToken}, classFormLimit)
+		}, true, http.StatusRequestEntityTooLarge},
+		{"GET needs no token", func(t *testing.T) *http.Request {
+			return httptest.NewRequest(http.MethodGet, "/lesson", nil)
+		}, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, srv, reached := csrfTestServer(t)
+			r := tt.req(t)
+			if tt.cookie {
+				r = withCSRFCookie(t, h, r)
+			}
+			w := httptest.NewRecorder()
+			srv.ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Errorf("status = %d, want %d (%s)", w.Code, tt.status, strings.TrimSpace(w.Body.String()))
+			}
+			if *reached != (tt.status == http.StatusOK) {
+				t.Errorf("handler reached = %v with status %d", *reached, w.Code)
+			}
+		})
+	}
+}
+
+// The token cookie is issued on the first visit
+func TestCSRFIssuesCookie(t *testing.T) {
+	_, srv, _ := csrfTestServer(t)
+	w := httptest.NewRecorder()
+	srv.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/login", nil))
+	var found bool
+	for _, c := range w.Result().Cookies() {
+		if c.Name == csrfCookieName && c.HttpOnly && c.Value != "" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("no csrf cookie issued")
+	}
+}
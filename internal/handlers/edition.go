@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/models"
+)
+
+// rolloverKeyword must be typed to start a new edition
+const rolloverKeyword = "新年度を開始する"
+
+// editionParam returns the edition picked with ?edition=, or the active one
+func (h *Handler) editionParam(r *http.Request) int {
+	if id, _ := strconv.Atoi(r.FormValue("edition")); id > 0 {
+		return id
+	}
+	e, err := models.GetActiveEdition(h.db)
+	if err != nil {
+		log.Printf("Failed to load active edition: %v", err)
+		return 0
+	}
+	return e.ID
+}
+
+// selectedEdition loads the edition picked with ?edition= (default: active)
+// along with every edition, for an edition dropdown
+func (h *Handler) selectedEdition(r *http.Request) (*models.Edition, []models.Edition, error) {
+	editions, err := models.ListEditions(h.db)
+	if err != nil {
+		return nil, nil, err
+	}
+	edition, err := models.GetEdition(h.db, h.editionParam(r))
+	if err != nil {
+		return nil, nil, err
+	}
+	return edition, editions, nil
+}
+
+// requireActiveClass rejects changes to a class of an archived edition.
+// It writes the error response and returns false if the change must stop.
+func (h *Handler) requireActiveClass(w http.ResponseWriter, classID int) bool {
+	archived, err := models.IsClassArchived(h.db, classID)
+	if err != nil {
+		http.Error(w, "Class not found", http.StatusNotFound)
+		return false
+	}
+	if archived {
+		http.Error(w, "アーカイブ済みの年度の授業は変更できません", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+// editionRow adds event days and retention state to an edition for the
+// editions page
+type editionRow struct {
+	models.Edition
+	Days            []models.EventDay
+	RetentionEndsAt time.Time
+	CanAnonymize    bool
+}
+
+// AdminEditions lists the yearly editions and offers rollover and anonymization
+func (h *Handler) AdminEditions(w http.ResponseWriter, r *http.Request) {
+	editions, err := models.ListEditions(h.db)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	retention, err := models.GetRetentionDays(h.db)
+	if err != nil {
+		log.Printf("Failed to load retention days: %v", err)
+	}
+
+	now := time.Now()
+	rows := make([]editionRow, 0, len(editions))
+	for _, e := range editions {
+		row := editionRow{Edition: e}
+		if row.Days, err = models.GetEventDays(h.db, e.ID); err != nil {
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		if e.IsArchived() {
+			row.RetentionEndsAt = e.RetentionEndsAt(retention).In(models.EventLocation)
+			row.CanAnonymize = e.CanAnonymize(now, retention)
+		}
+		rows = append(rows, row)
+	}
+
+	q := r.URL.Query()
+	h.tpl.Render(w, "admin_editions.html", map[string]any{
+		"Editions":      rows,
+		"RetentionDays": retention,
+		"Keyword":       rolloverKeyword,
+		"Error":         q.Get("error"),
+		"Anonymized":    q.Get("anonymized"),
+	})
+}
+
+// AdminRolloverEdition archives the active edition and starts the next one.
+// Nothing is deleted: last year's classes and enrollments stay reportable.
+func (h *Handler) AdminRolloverEdition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/editions", http.StatusSeeOther)
+		return
+	}
+	if r.FormValue("confirm_keyword") != rolloverKeyword {
+		http.Redirect(w, r, "/admin/editions?error=keyword", http.StatusSeeOther)
+		return
+	}
+
+	name := strings.TrimSpace(r.FormValue("name"))
+	firstDay := r.FormValue("first_day")
+	if _, err := time.Parse("2006-01-02", firstDay); name == "" || err != nil {
+		http.Redirect(w, r, "/admin/editions?error=input", http.StatusSeeOther)
+		return
+	}
+
+	old, err := models.GetActiveEdition(h.db)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	id, err := models.RolloverEdition(h.db, name, firstDay)
+	if err == models.ErrEditionNameTaken {
+		http.Redirect(w, r, "/admin/editions?error=name", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to roll over edition: %v", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	h.logAudit(r, audit.ActionEditionRollover, "edition", id,
+		map[string]any{"active_edition": old.ID, "name": old.Name},
+		map[string]any{"active_edition": id, "name": name, "first_day": firstDay})
+	http.Redirect(w, r, "/admin/editions", http.StatusSeeOther)
+}
+
+// AdminAnonymizeEdition scrubs student PII of an archived edition whose
+// retention period has passed
+func (h *Handler) AdminAnonymizeEdition(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/editions", http.StatusSeeOther)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("edition_id"))
+
+	retention, err := models.GetRetentionDays(h.db)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	count, err := models.AnonymizeEdition(h.db, id, retention)
+	if err == models.ErrRetentionNotPassed {
+		http.Redirect(w, r, "/admin/editions?error=retention", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to anonymize edition %d: %v", id, err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	// Stored snapshots taken before now still hold the scrubbed data
+	deleted, err := 0, error(nil)
+	if count > 0 {
+		deleted, err = h.replaceSnapshots()
+	}
+	h.logAudit(r, audit.ActionEditionAnonymize, "edition", id, nil,
+		map[string]int{"accounts": count, "retention_days": retention, "snapshots_deleted": deleted})
+	if err != nil {
+		log.Printf("Failed to replace snapshots after anonymizing edition %d: %v", id, err)
+		http.Redirect(w, r, "/admin/editions?error=snapshots&anonymized="+strconv.Itoa(count), http.StatusSeeOther)
+		return
+	}
+	http.Redirect(w, r, "/admin/editions?anonymized="+strconv.Itoa(count), http.StatusSeeOther)
+}
+
+// AdminRetention sets how long student data of archived editions is kept
+func (h *Handler) AdminRetention(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/editions", http.StatusSeeOther)
+		return
+	}
+	days, err := strconv.Atoi(r.FormValue("retention_days"))
+	if err != nil || days < 0 {
+		http.Redirect(w, r, "/admin/editions?error=retention_days", http.StatusSeeOther)
+		return
+	}
+
+	old, _ := models.GetRetentionDays(h.db)
+	if err := models.UpdateRetentionDays(h.db, days); err != nil {
+		http.Error(w, "Failed to save", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionSettingsSave, "settings", "retention_days",
+		map[string]int{"retention_days": old}, map[string]int{"retention_days": days})
+	http.Redirect(w, r, "/admin/editions", http.StatusSeeOther)
+}
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/models"
+)
+
+// eventDayForm reads the label and date of the days form. ok is false if
+// either is missing or invalid.
+func eventDayForm(r *http.Request) (label, date string, ok bool) {
+	label = strings.TrimSpace(r.FormValue("label"))
+	date = r.FormValue("event_date")
+	if label == "" || utf8.RuneCountInString(label) > 50 {
+		return label, date, false
+	}
+	if _, err := time.Parse("2006-01-02", date); err != nil {
+		return label, date, false
+	}
+	return label, date, true
+}
+
+// AdminEventDays lists the days of the active edition
+func (h *Handler) AdminEventDays(w http.ResponseWriter, r *http.Request) {
+	edition, err := models.GetActiveEdition(h.db)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	days, err := models.GetEventDays(h.db, edition.ID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	h.tpl.Render(w, "admin_event_days.html", map[string]any{
+		"Edition": edition,
+		"Days":    days,
+		"Error":   r.URL.Query().Get("error"),
+	})
+}
+
+// AdminAddEventDay adds a day to the active edition
+func (h *Handler) AdminAddEventDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/days", http.StatusSeeOther)
+		return
+	}
+	label, date, ok := eventDayForm(r)
+	if !ok {
+		http.Redirect(w, r, "/admin/days?error=input", http.StatusSeeOther)
+		return
+	}
+
+	id, err := models.CreateEventDay(h.db, label, date)
+	if err == models.ErrEventDayLabelTaken {
+		http.Redirect(w, r, "/admin/days?error=label", http.StatusSeeOther)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to add event day: %v", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionEventDayCreate, "event_day", id, nil, map[string]string{"label": label, "date": date})
+	http.Redirect(w, r, "/admin/days", http.StatusSeeOther)
+}
+
+// AdminEditEventDay renames a day or moves it to another date. Sessions on
+// the day move with it and their students are told.
+func (h *Handler) AdminEditEventDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/days", http.StatusSeeOther)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("day_id"))
+	old, err := models.GetEventDay(h.db, id)
+	if err != nil {
+		http.Error(w, "Event day not found", http.StatusNotFound)
+		return
+	}
+	label, date, ok := eventDayForm(r)
+	if !ok {
+		http.Redirect(w, r, "/admin/days?error=input", http.StatusSeeOther)
+		return
+	}
+
+	moved, err := models.UpdateEventDay(h.db, id, label, date)
+	switch {
+	case err == models.ErrEventDayLabelTaken:
+		http.Redirect(w, r, "/admin/days?error=label", http.StatusSeeOther)
+		return
+	case err == models.ErrEventDayBeforeRegistrationEnd:
+		http.Redirect(w, r, "/admin/days?error=registration", http.StatusSeeOther)
+		return
+	case err == models.ErrEditionArchived:
+		http.Error(w, "アーカイブ済みの年度の開催日は変更できません", http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("Failed to update event day %d: %v", id, err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionEventDayUpdate, "event_day", id,
+		map[string]string{"label": old.Label, "date": old.Date},
+		map[string]any{"label": label, "date": date, "moved_sessions": len(moved)})
+
+	for _, m := range moved {
+		change := fmt.Sprintf("日時: %s → %s〜%s",
+			m.OldStart.In(models.EventLocation).Format("01月02日 15:04"),
+			m.NewStart.In(models.EventLocation).Format("01月02日 15:04"), m.NewEnd.In(models.EventLocation).Format("15:04"))
+		h.notifyClassChange(m.ClassID, m.SessionID, []string{change})
+	}
+	http.Redirect(w, r, "/admin/days", http.StatusSeeOther)
+}
+
+// AdminDeleteEventDay removes a day that has no sessions
+func (h *Handler) AdminDeleteEventDay(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/admin/days", http.StatusSeeOther)
+		return
+	}
+	id, _ := strconv.Atoi(r.FormValue("day_id"))
+	old, err := models.GetEventDay(h.db, id)
+	if err != nil {
+		http.Error(w, "Event day not found", http.StatusNotFound)
+		return
+	}
+
+	switch err := models.DeleteEventDay(h.db, id); {
+	case err == models.ErrEventDayInUse:
+		http.Redirect(w, r, "/admin/days?error=in_use", http.StatusSeeOther)
+		return
+	case err == models.ErrEditionArchived:
+		http.Error(w, "アーカイブ済みの年度の開催日は変更できません", http.StatusForbidden)
+		return
+	case err != nil:
+		log.Printf("Failed to delete event day %d: %v", id, err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionEventDayDelete, "event_day", id, map[string]string{"label": old.Label, "date": old.Date}, nil)
+	http.Redirect(w, r, "/admin/days", http.StatusSeeOther)
+}
@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"example.com/myapp/internal/audit"
+	"example.com/myapp/internal/models"
+)
+
+// InstructorHome lists the logged-in instructor's classes and sessions
+func (h *Handler) InstructorHome(w http.ResponseWriter, r *http.Request) {
+	instructorID := currentStaff(r).InstructorID
+
+	name, err := models.GetInstructorName(h.db, instructorID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	sessions, err := models.GetInstructorSessions(h.db, instructorID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	classes, err := models.GetAllClasses(h.db)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	classes, _ = h.scopeToInstructor(instructorID, classes, nil)
+
+	h.tpl.Render(w, "instructor_home.html", map[string]any{
+		"Name":     name,
+		"Classes":  classes,
+		"Sessions": sessions,
+		"Saved":    r.URL.Query().Get("saved") == "1",
+	})
+}
+
+// InstructorRoster shows the confirmed participants of one of the instructor's sessions
+func (h *Handler) InstructorRoster(w http.ResponseWriter, r *http.Request) {
+	detail, roster, ok := h.instructorRoster(w, r)
+	if !ok {
+		return
+	}
+	rows := make([]rosterRow, len(roster))
+	for i, p := range roster {
+		rows[i] = rosterRow{No: i + 1, ApplicantReport: p}
+	}
+	h.tpl.Render(w, "instructor_roster.html", map[string]any{
+		"Session": detail,
+		"Roster":  rows,
+	})
+}
+
+// rosterRow numbers a participant for the printed roster
+type rosterRow struct {
+	No int
+	models.ApplicantReport
+}
+
+// InstructorRosterDownload exports the roster as CSV with a blank attendance column
+func (h *Handler) InstructorRosterDownload(w http.ResponseWriter, r *http.Request) {
+	detail, roster, ok := h.instructorRoster(w, r)
+	if !ok {
+		return
+	}
+
+	setCSVHeaders(w, fmt.Sprintf("roster_%d.csv", detail.SessionID))
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	writer.Write([]string{detail.ClassName, detail.StartAt.Format("2006-01-02 15:04") + "-" + detail.EndAt.Format("15:04"), detail.RoomNumber + " " + detail.RoomName})
+	writer.Write([]string{"No.", "中学生氏名", "中学校名", "学年", "出欠"})
+	for i, row := range roster {
+		writer.Write([]string{strconv.Itoa(i + 1), row.StudentName, row.SchoolName, row.Grade, ""})
+	}
+}
+
+// instructorRoster loads the session from ?session_id= and its roster,
+// refusing sessions of classes the instructor doesn't teach
+func (h *Handler) instructorRoster(w http.ResponseWriter, r *http.Request) (*models.SessionDetail, []models.ApplicantReport, bool) {
+	instructorID := currentStaff(r).InstructorID
+	sessionID, _ := strconv.Atoi(r.URL.Query().Get("session_id"))
+
+	sess, err := models.GetSessionByID(h.db, sessionID)
+	if err != nil {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+	if !h.canSeeClass(r, sess.ClassID) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	detail, err := models.GetSessionDetail(h.db, sessionID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	roster, err := models.GetApplicantsReport(h.db, 0, 0, sessionID, instructorID)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return detail, roster, true
+}
+
+// InstructorEditClass lets an instructor rewrite the description of their own class
+func (h *Handler) InstructorEditClass(w http.ResponseWriter, r *http.Request) {
+	id, _ := strconv.Atoi(r.FormValue("id"))
+	if !h.canSeeClass(r, id) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		if !h.requireActiveClass(w, id) {
+			return
+		}
+		old, err := models.GetClassByID(h.db, id)
+		if err != nil {
+			http.Error(w, "Class not found", http.StatusNotFound)
+			return
+		}
+		description := r.FormValue("description")
+		if err := models.UpdateClassDescription(h.db, id, description); err != nil {
+			if err == sql.ErrNoRows {
+				http.Error(w, "Class not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("Failed to update description of class %d: %v", id, err)
+			http.Error(w, "DB Error", http.StatusInternalServerError)
+			return
+		}
+		h.logAudit(r, audit.ActionDescription, "class", id,
+			map[string]string{"description": old.Description},
+			map[string]string{"description": description})
+		http.Redirect(w, r, "/instructor?saved=1", http.StatusSeeOther)
+		return
+	}
+
+	class, err := models.GetClassByID(h.db, id)
+	if err != nil {
+		http.Error(w, "Class not found", http.StatusNotFound)
+		return
+	}
+	h.tpl.Render(w, "instructor_class_edit.html", class)
+}
@@ -2,9 +2,11 @@ package handlers
 
 import (
 	"context"
+	"net"
 	"net/http"
-	"strconv"
-	"time"
+
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/models"
 )
 
 // 1. Define the Context Key (Private to this file/package)
@@ -13,92 +15,126 @@ const sessionKey contextKey = "session_data"
 
 // ---------------------------------------------------------
 // Middleware 1: Require Login (The Producer)
-// Decodes cookie -> Saves to Context
+// Resolves session cookie -> Saves to Context
 // ---------------------------------------------------------
 func (h *Handler) RequireLogin(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		// A. Get Cookie
-		c, err := r.Cookie(h.sess.Key)
-		if err != nil {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
-		}
-
-		// B. Decode Data
-		var data map[string]any
-		if err := h.sess.Secure.Decode(h.sess.Key, c.Value, &data); err != nil {
+		// A. Look up the server-side session (also slides its expiry)
+		rec, ok := h.sessions.Load(w, r)
+		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		// C. Check Expiry
-		if !isSessionValid(data) {
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
-			return
+		// B. Save to Context
+		data := map[string]any{
+			"user_id": rec.UserID,
+			"email":   rec.Email,
 		}
-
-		// D. Save to Context
 		ctx := context.WithValue(r.Context(), sessionKey, data)
 		next(w, r.WithContext(ctx))
 	}
 }
 
 // ---------------------------------------------------------
-// Middleware 2: Require Admin (The Consumer)
-// Reads Context -> Checks Database -> Allows/Blocks
+// Middleware 2: Require Permission (The Consumer)
+// Reads Context -> Checks Role in Database -> Allows/Blocks
 // ---------------------------------------------------------
-func (h *Handler) RequireAdmin(next http.HandlerFunc) http.HandlerFunc {
+func (h *Handler) RequirePermission(perm auth.Permission, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 
-		// A. Retrieve data from Context (Must be logged in first!)
-		data, ok := r.Context().Value(sessionKey).(map[string]any)
+		// A. Retrieve user from Context (Must be logged in first!)
+		uid, _, ok := currentUser(r)
 		if !ok {
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
 
-		// B. Extract User ID
-		var uid int
-		switch v := data["user_id"].(type) {
-		case float64:
-			uid = int(v)
-		case int:
-			uid = v
-		default:
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		// B. Look up the role on every request, so changes apply immediately
+		roleName, instructorID, err := models.GetUserRole(h.db, uid)
+		if err != nil {
+			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
-
-		// C. Check Admin Status in DB
-		var isAdmin bool
-		err := h.db.QueryRow("SELECT is_admin FROM users WHERE id=$1", uid).Scan(&isAdmin)
-		if err != nil || !isAdmin {
+		role, _ := auth.ParseRole(roleName)
+		if !role.Can(perm) {
 			http.Error(w, "Forbidden", http.StatusForbidden)
 			return
 		}
+		if role == auth.RoleInstructor && instructorID == 0 {
+			http.Error(w, "Forbidden: this account isn't linked to an instructor yet", http.StatusForbidden)
+			return
+		}
 
-		// D. Pass through
-		next(w, r)
+		// C. Pass the role on for handlers that show or scope by it
+		ctx := context.WithValue(r.Context(), staffKey, staffAccess{Role: role, InstructorID: instructorID})
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// staffAccess is what RequirePermission learned about the current staff member
+type staffAccess struct {
+	Role         auth.Role
+	InstructorID int // set for the instructor role
+}
+
+const staffKey contextKey = "staff_access"
+
+// currentStaff returns the role RequirePermission stored in the context
+func currentStaff(r *http.Request) staffAccess {
+	s, _ := r.Context().Value(staffKey).(staffAccess)
+	return s
+}
+
+// instructorScope returns the instructor whose classes the current staff
+// member is limited to, or 0 if they can see every class
+func instructorScope(r *http.Request) int {
+	if s := currentStaff(r); s.Role == auth.RoleInstructor {
+		return s.InstructorID
+	}
+	return 0
+}
+
+// canSeeClass reports whether the current staff member may view a class
+func (h *Handler) canSeeClass(r *http.Request, classID int) bool {
+	instructorID := instructorScope(r)
+	if instructorID == 0 {
+		return true
 	}
+	linked, err := models.IsClassInstructor(h.db, classID, instructorID)
+	return err == nil && linked
 }
 
 // ---------------------------------------------------------
 // Helper Functions
 // ---------------------------------------------------------
-func isSessionValid(data map[string]any) bool {
-	expVal, ok := data["exp"]
+
+// currentUser extracts the logged-in user's ID and email from the context
+func currentUser(r *http.Request) (int, string, bool) {
+	data, ok := r.Context().Value(sessionKey).(map[string]any)
 	if !ok {
-		return false
+		return 0, "", false
 	}
-	var exp int64
-	switch v := expVal.(type) {
-	case int64:
-		exp = v
+	var uid int
+	switch v := data["user_id"].(type) {
+	case int:
+		uid = v
 	case float64:
-		exp = int64(v)
-	case string:
-		exp, _ = strconv.ParseInt(v, 10, 64)
+		uid = int(v)
+	default:
+		return 0, "", false
+	}
+	email, _ := data["email"].(string)
+	return uid, email, true
+}
+
+// clientIP is the address the request came from. X-Forwarded-For is
+// ignored on purpose: anyone can set it, which would defeat per-address limits.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
 	}
-	return time.Now().Unix() < exp
+	return host
 }
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/models"
+)
+
+// taughtClass is a class seeded for one instructor: a session of one seat,
+// taken by one student, with another on the waitlist
+type taughtClass struct {
+	ClassID, SessionID   int
+	Enrolled, Waitlisted string // student names
+}
+
+func seedTaughtClass(t *testing.T, db *sql.DB, instructor string) taughtClass {
+	t.Helper()
+	c := taughtClass{Enrolled: instructor + "の生徒", Waitlisted: instructor + "の待ち生徒"}
+	now := time.Now()
+	var instructorID int
+	if err := db.QueryRow("INSERT INTO instructors (name) VALUES ($1) RETURNING instructor_id", instructor).Scan(&instructorID); err != nil {
+		t.Fatal(err)
+	}
+	err := db.QueryRow(`
+		INSERT INTO classes (class_name, room_number, room_name, registration_start_at, registration_end_at, edition_id)
+		VALUES ($1, '1-101', '演習室', $2, $3, (SELECT edition_id FROM event_editions WHERE status = 'active'))
+		RETURNING class_id
+	`, instructor+"の授業", now.Add(-time.Hour), now.Add(time.Hour)).Scan(&c.ClassID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("INSERT INTO class_instructors (class_id, instructor_id) VALUES ($1, $2)", c.ClassID, instructorID); err != nil {
+		t.Fatal(err)
+	}
+	err = db.QueryRow(`
+		INSERT INTO class_sessions (class_id, day_id, start_at, end_at, capacity)
+		VALUES ($1, (SELECT MIN(day_id) FROM event_days), $2, $3, 1)
+		RETURNING session_id
+	`, c.ClassID, now.Add(48*time.Hour), now.Add(49*time.Hour)).Scan(&c.SessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, name := range []string{c.Enrolled, c.Waitlisted} {
+		id := createUser(t, db, fmt.Sprintf("student%d-%d@example.com", c.ClassID, i), "pass1234")
+		if _, err := db.Exec(`
+			INSERT INTO user_profiles (user_id, student_name, guardian_name, school_name, grade)
+			VALUES ($1, $2, '保護者', '中学校', '2')
+		`, id, name); err != nil {
+			t.Fatal(err)
+		}
+		if i == 0 {
+			err = models.EnrollUser(db, c.SessionID, id)
+		} else {
+			_, err = models.JoinWaitlist(db, c.SessionID, id)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c
+}
+
+// createStaff adds a staff account; instructor names the instructor it is linked to
+func createStaff(t *testing.T, db *sql.DB, addr string, role auth.Role, instructor string) int {
+	t.Helper()
+	id := createUser(t, db, addr, "pass1234")
+	_, err := db.Exec(`
+		UPDATE users SET role = $2, instructor_id = (SELECT instructor_id FROM instructors WHERE name = $3)
+		WHERE id = $1
+	`, id, string(role), instructor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// asStaff requests path from next behind RequirePermission, logged in as userID
+func asStaff(h *Handler, userID int, perm auth.Permission, next http.HandlerFunc, path string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodGet, path, nil)
+	r = r.WithContext(context.WithValue(r.Context(), sessionKey, map[string]any{"user_id": userID, "email": "staff@example.com"}))
+	w := httptest.NewRecorder()
+	h.RequirePermission(perm, next)(w, r)
+	return w
+}
+
+func TestInstructorScope(t *testing.T) {
+	h, db, _ := newTestHandler(t)
+	own := seedTaughtClass(t, db, "講師A")
+	other := seedTaughtClass(t, db, "講師B")
+	instructor := createStaff(t, db, "a@example.com", auth.RoleInstructor, "講師A")
+	viewer := createStaff(t, db, "viewer@example.com", auth.RoleViewer, "")
+
+	type page struct {
+		name string
+		perm auth.Permission
+		next http.HandlerFunc
+		path func(c taughtClass) string
+		// students the page lists for c
+		shows func(c taughtClass) []string
+	}
+	pages := []page{
+		{"class detail", auth.PermViewClasses, h.AdminClassDetail,
+			func(c taughtClass) string { return fmt.Sprintf("/admin/classes/detail?id=%d", c.ClassID) },
+			func(c taughtClass) []string { return nil }},
+		{"roster", auth.PermInstructorPortal, h.InstructorRoster,
+			func(c taughtClass) string { return fmt.Sprintf("/instructor/roster?session_id=%d", c.SessionID) },
+			func(c taughtClass) []string { return []string{c.Enrolled} }},
+		{"roster download", auth.PermInstructorPortal, h.InstructorRosterDownload,
+			func(c taughtClass) string {
+				return fmt.Sprintf("/instructor/roster/download?session_id=%d", c.SessionID)
+			},
+			func(c taughtClass) []string { return []string{c.Enrolled} }},
+	}
+
+	tests := []struct {
+		name  string
+		user  int
+		class taughtClass
+		ok    bool
+	}{
+		{"instructor, own class", instructor, own, true},
+		{"instructor, other class", instructor, other, false},
+	}
+	for _, p := range pages {
+		for _, tt := range tests {
+			t.Run(p.name+"/"+tt.name, func(t *testing.T) {
+				w := asStaff(h, tt.user, p.perm, p.next, p.path(tt.class))
+				if !tt.ok {
+					if w.Code != http.StatusForbidden {
+						t.Fatalf("status %d, want 403", w.Code)
+					}
+					return
+				}
+				if w.Code != http.StatusOK {
+					t.Fatalf("status %d, want 200", w.Code)
+				}
+				for _, name := range p.shows(tt.class) {
+					if !strings.Contains(w.Body.String(), name) {
+						t.Errorf("%s is missing", name)
+					}
+				}
+			})
+		}
+	}
+
+	// Other staff see every class
+	if w := asStaff(h, viewer, auth.PermViewClasses, h.AdminClassDetail, fmt.Sprintf("/admin/classes/detail?id=%d", other.ClassID)); w.Code != http.StatusOK {
+		t.Errorf("viewer, class detail: status %d", w.Code)
+	}
+
+	// The participant and waitlist tables leave out other classes, even
+	// when one is asked for by ID
+	data := []struct {
+		name      string
+		user      int
+		path      string
+		see, hide []string
+	}{
+		{"instructor", instructor, "/admin/data",
+			[]string{own.Enrolled, own.Waitlisted}, []string{other.Enrolled, other.Waitlisted}},
+		{"instructor, other class asked for", instructor, fmt.Sprintf("/admin/data?class_id=%d", other.ClassID),
+			nil, []string{other.Enrolled, other.Waitlisted}},
+		{"viewer", viewer, "/admin/data",
+			[]string{own.Enrolled, own.Waitlisted, other.Enrolled, other.Waitlisted}, nil},
+	}
+	for _, tt := range data {
+		t.Run("data/"+tt.name, func(t *testing.T) {
+			w := asStaff(h, tt.user, auth.PermViewParticipants, h.AdminDataPage, tt.path)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status %d", w.Code)
+			}
+			body := w.Body.String()
+			for _, name := range tt.see {
+				if !strings.Contains(body, name) {
+					t.Errorf("%s is missing", name)
+				}
+			}
+			for _, name := range tt.hide {
+				if strings.Contains(body, name) {
+					t.Errorf("%s is shown", name)
+				}
+			}
+		})
+	}
+
+	// A viewer has no instructor portal
+	if w := asStaff(h, viewer, auth.PermInstructorPortal, h.InstructorRoster, fmt.Sprintf("/instructor/roster?session_id=%d", own.SessionID)); w.Code != http.StatusForbidden {
+		t.Errorf("viewer, roster: status %d", w.Code)
+	}
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/email"
+	"example.com/myapp/internal/models"
+	"example.com/myapp/internal/validate"
+)
+
+const (
+	passwordResetTTL     = 30 * time.Minute // how long an emailed link stays valid
+	passwordResetPerHour = 3                // links one account can request per hour
+)
+
+// ForgotPassword: GET shows the form; POST emails a reset link.
+// The response is the same whether or not the address exists, so the
+// form can't be used to probe for registered emails.
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		h.tpl.Render(w, "password_forgot.html", nil)
+		return
+	}
+
+	addr := r.FormValue("email")
+	if addr == "" {
+		h.tpl.Render(w, "password_forgot.html", map[string]any{"Error": "メールアドレスを入力してください"})
+		return
+	}
+
+	sent := map[string]any{"Sent": true}
+
+	u, err := models.GetUserByEmail(h.db, addr)
+	if err == sql.ErrNoRows {
+		h.tpl.Render(w, "password_forgot.html", sent)
+		return
+	}
+	if err != nil {
+		log.Printf("Forgot password lookup error: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// Rate limit per account
+	recent, err := models.CountPasswordResetsSince(h.db, u.ID, time.Now().Add(-time.Hour))
+	if err != nil {
+		log.Printf("Forgot password rate check error: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if recent >= passwordResetPerHour {
+		log.Printf("Password reset rate limit hit for user %d", u.ID)
+		h.tpl.Render(w, "password_forgot.html", sent)
+		return
+	}
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if err := models.CreatePasswordResetToken(h.db, u.ID, hash, time.Now().Add(passwordResetTTL)); err != nil {
+		log.Printf("Failed to store reset token: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	link := h.cfg.BaseURL + "/password/reset?token=" + token
+	go func() {
+		body := email.GeneratePasswordReset(link, passwordResetTTL)
+		if err := h.mailer.Send(u.Email, email.GetPasswordResetSubject(), body); err != nil {
+			log.Printf("Failed to send password reset email to user %d: %v", u.ID, err)
+		}
+	}()
+
+	h.tpl.Render(w, "password_forgot.html", sent)
+}
+
+// ResetPassword: GET shows the new-password form for a token; POST applies it
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+	hash := auth.HashToken(token)
+
+	valid, err := models.IsPasswordResetTokenValid(h.db, hash)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	view := map[string]any{"Token": token, "Invalid": !valid}
+
+	if r.Method == http.MethodGet || !valid {
+		h.tpl.Render(w, "password_reset.html", view)
+		return
+	}
+
+	pw := r.FormValue("password")
+	errs := validate.Errors{}
+	errs.Password("password", pw)
+	if !errs.OK() {
+		view["Error"] = errs["password"]
+		h.tpl.Render(w, "password_reset.html", view)
+		return
+	}
+	if pw != r.FormValue("password_confirm") {
+		view["Error"] = "確認用パスワードが一致しません"
+		h.tpl.Render(w, "password_reset.html", view)
+		return
+	}
+
+	hashed, err := auth.HashPassword(pw)
+	if err != nil {
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := models.ResetPasswordWithToken(h.db, hash, hashed)
+	if err != nil {
+		if err == models.ErrInvalidResetToken {
+			view["Invalid"] = true
+			h.tpl.Render(w, "password_reset.html", view)
+			return
+		}
+		log.Printf("Password reset error: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	// whoever knew the old password is logged out everywhere
+	if err := h.sessions.EndAll(userID); err != nil {
+		log.Printf("Failed to end sessions of user %d after password reset: %v", userID, err)
+	}
+	// proving control of the mailbox also lifts a lockout
+	if u, err := models.GetUserByID(h.db, userID); err == nil {
+		if err := h.throttle.Unlock(u.Email, clientIP(r)); err != nil {
+			log.Printf("Failed to unlock user %d after password reset: %v", userID, err)
+		}
+	}
+
+	http.Redirect(w, r, "/login?reset=success", http.StatusSeeOther)
+}
@@ -0,0 +1,168 @@
+package handlers
+
+import (
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/config"
+	"example.com/myapp/internal/database/dbtest"
+	"example.com/myapp/internal/models"
+	"example.com/myapp/internal/storage"
+	"example.com/myapp/internal/template"
+)
+
+// sentMail is one message handed to fakeMailer
+type sentMail struct {
+	To, Subject, Body string
+}
+
+// fakeMailer records messages instead of sending them. Handlers send from
+// goroutines, so messages arrive on a channel.
+type fakeMailer struct {
+	sent chan sentMail
+}
+
+func newFakeMailer() *fakeMailer {
+	return &fakeMailer{sent: make(chan sentMail, 10)}
+}
+
+func (m *fakeMailer) Send(to, subject, htmlBody string) error {
+	m.sent <- sentMail{to, subject, htmlBody}
+	return nil
+}
+
+// next waits for the next message
+func (m *fakeMailer) next(t *testing.T) sentMail {
+	t.Helper()
+	select {
+	case msg := <-m.sent:
+		return msg
+	case <-time.After(5 * time.Second):
+		t.Fatal("no email was sent")
+		return sentMail{}
+	}
+}
+
+// newTestHandler returns a Handler on a test database with the real
+// templates and a fake mailer
+func newTestHandler(t *testing.T) (*Handler, *sql.DB, *fakeMailer) {
+	t.Helper()
+	db := dbtest.Open(t)
+	mailer := newFakeMailer()
+	cfg := config.Config{BaseURL: "http://test.example", CookieHash: "test-hash-key-0123456789abcdef"}
+	return New(db, template.Load("../../web/templates"), cfg, storage.NewMemory(), mailer), db, mailer
+}
+
+func postForm(h http.HandlerFunc, path string, form url.Values) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+// createUser adds a student with the given password and returns the ID
+func createUser(t *testing.T, db *sql.DB, addr, pw string) int {
+	t.Helper()
+	hashed, err := auth.HashPassword(pw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var id int
+	if err := db.QueryRow("INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id", addr, hashed).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	return id
+}
+
+// passwordIs reports whether the user's stored hash matches pw
+func passwordIs(t *testing.T, db *sql.DB, id int, pw string) bool {
+	t.Helper()
+	u, err := models.GetUserByID(db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return auth.CompareHash(u.PasswordHash, pw) == nil
+}
+
+var resetLink = regexp.MustCompile(`/password/reset\?token=([0-9a-f]{64})`)
+
+func TestPasswordResetSingleUse(t *testing.T) {
+	h, db, mailer := newTestHandler(t)
+	const addr = "family@example.com"
+	id := createUser(t, db, addr, "oldpass123")
+
+	w := postForm(h.ForgotPassword, "/password/forgot", url.Values{"email": {addr}})
+	if w.Code != http.StatusOK {
+		t.Fatalf("forgot: status %d", w.Code)
+	}
+	msg := mailer.next(t)
+	if msg.To != addr {
+		t.Fatalf("mail sent to %q", msg.To)
+	}
+	m := resetLink.FindStringSubmatch(msg.Body)
+	if m == nil {
+		t.Fatalf("no reset link in the email:\n%s", msg.Body)
+	}
+	token := m[1]
+
+	// The shared policy applies here as on signup
+	for _, weak := range []string{"short1", "onlyletters", "12345678", strings.Repeat("a1", 37)} {
+		w = postForm(h.ResetPassword, "/password/reset", url.Values{
+			"token": {token}, "password": {weak}, "password_confirm": {weak},
+		})
+		if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "notice-error") {
+			t.Errorf("weak password %q accepted: status %d", weak, w.Code)
+		}
+	}
+
+	form := url.Values{"token": {token}, "password": {"newpass456"}, "password_confirm": {"newpass456"}}
+	w = postForm(h.ResetPassword, "/password/reset", form)
+	if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/login?reset=success" {
+		t.Fatalf("reset: status %d, Location %q", w.Code, w.Header().Get("Location"))
+	}
+	if !passwordIs(t, db, id, "newpass456") {
+		t.Fatal("password was not changed")
+	}
+
+	// The same link can't be used again
+	form.Set("password", "again789x")
+	form.Set("password_confirm", "again789x")
+	w = postForm(h.ResetPassword, "/password/reset", form)
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "無効") {
+		t.Fatalf("reused token: status %d", w.Code)
+	}
+	if !passwordIs(t, db, id, "newpass456") {
+		t.Fatal("reused token changed the password")
+	}
+}
+
+func TestPasswordResetExpired(t *testing.T) {
+	h, db, _ := newTestHandler(t)
+	id := createUser(t, db, "family@example.com", "oldpass123")
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreatePasswordResetToken(db, id, hash, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	w := postForm(h.ResetPassword, "/password/reset", url.Values{
+		"token": {token}, "password": {"newpass456"}, "password_confirm": {"newpass456"},
+	})
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "無効") {
+		t.Fatalf("expired token: status %d", w.Code)
+	}
+	if !passwordIs(t, db, id, "oldpass123") {
+		t.Fatal("expired token changed the password")
+	}
+}
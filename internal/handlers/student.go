@@ -1,12 +1,19 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
+	"example.com/myapp/internal/audit"
 	"example.com/myapp/internal/email"
 	"example.com/myapp/internal/models"
+	"example.com/myapp/internal/validate"
 )
 
 // ClassView is a helper struct just for the Template
@@ -14,16 +21,78 @@ import (
 type ClassView struct {
 	Class    models.Class
 	Sessions []SessionView
+
+	// Registration window state, e.g. "受付中", "受付前", "受付終了"
+	RegistrationOpen  bool
+	RegistrationLabel string
+	Countdown         string    // e.g. "受付開始まで あと2日3時間"
+	CountdownTarget   time.Time // instant the countdown runs to (zero if none)
 }
 
 type SessionView struct {
 	Session        models.Session
 	IsFull         bool
 	IsEnrolled     bool
-	ButtonLabel    string // e.g. "受付中" (Open), "満席" (Full), "申込済" (Joined)
+	IsWaitlisted   bool
+	HasConflict    bool // overlaps one of the student's confirmed sessions
+	ButtonLabel    string // e.g. "受付中" (Open), "キャンセル待ち" (Full), "申込済" (Joined)
 	ButtonDisabled bool
 }
 
+// formatCountdown renders a remaining duration as e.g. "あと2日3時間"
+func formatCountdown(d time.Duration) string {
+	if d < time.Minute {
+		return "まもなく"
+	}
+	days := int(d / (24 * time.Hour))
+	hours := int(d % (24 * time.Hour) / time.Hour)
+	minutes := int(d % time.Hour / time.Minute)
+	switch {
+	case days > 0:
+		return fmt.Sprintf("あと%d日%d時間", days, hours)
+	case hours > 0:
+		return fmt.Sprintf("あと%d時間%d分", hours, minutes)
+	default:
+		return fmt.Sprintf("あと%d分", minutes)
+	}
+}
+
+// ReservationView is one row of the "現在の予約状況" list on MyPage
+type ReservationView struct {
+	models.EnrolledSession
+	CanCancel      bool
+	CancelDeadline time.Time
+}
+
+// maxKeywordLength bounds the lesson search; each word is one more condition
+const maxKeywordLength = 100
+
+// lessonFilter reads the search form of the lesson list. Malformed values
+// are ignored rather than reported, as with a hand-edited URL.
+func lessonFilter(q url.Values) models.ClassFilter {
+	keyword := []rune(strings.TrimSpace(q.Get("q")))
+	if len(keyword) > maxKeywordLength {
+		keyword = keyword[:maxKeywordLength]
+	}
+	f := models.ClassFilter{
+		Keyword:   string(keyword),
+		Category:  q.Get("category"),
+		Available: q.Get("available") == "1",
+	}
+	f.DayID, _ = strconv.Atoi(q.Get("day"))
+	if _, err := time.Parse(validate.TimeLayout, q.Get("from")); err == nil {
+		f.From = q.Get("from")
+	}
+	if _, err := time.Parse(validate.TimeLayout, q.Get("to")); err == nil {
+		f.To = q.Get("to")
+	}
+	switch q.Get("sort") {
+	case models.ClassSortStart, models.ClassSortSeats:
+		f.Sort = q.Get("sort")
+	}
+	return f
+}
+
 // StudentLessonList handles the main catalog page
 func (h *Handler) StudentLessonList(w http.ResponseWriter, r *http.Request) {
 	// 1. Get current User ID from Context (to check "Already Joined")
@@ -38,32 +107,91 @@ func (h *Handler) StudentLessonList(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// 2. Fetch All Classes
-	classes, err := models.GetAllClasses(h.db)
+	// 2. Fetch the classes that match the search, narrowed (unless the
+	// student asked for all) to classes meant for their grade
+	q := r.URL.Query()
+	filter := lessonFilter(q)
+	allGrades := q.Get("all_grades") == "1"
+	grade := ""
+	if userID > 0 {
+		if profile, err := models.GetUserProfile(h.db, userID); err != nil {
+			log.Printf("Failed to load profile of user %d: %v", userID, err)
+		} else if profile != nil && profile.Grade.Valid {
+			grade = profile.Grade.String
+		}
+	}
+	if !allGrades {
+		filter.Grade = grade
+	}
+	classes, err := models.FindClasses(h.db, filter)
+	if err != nil {
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+	categories, err := models.GetClassCategories(h.db)
+	if err != nil {
+		log.Printf("Failed to load class categories: %v", err)
+	}
+	days, err := models.GetEventDays(h.db, 0)
+	if err != nil {
+		log.Printf("Failed to load event days: %v", err)
+	}
+
+	// The sessions of every listed class, in one query
+	classIDs := make([]int, len(classes))
+	for i, c := range classes {
+		classIDs[i] = c.ID
+	}
+	sessionsByClass, err := models.FindSessions(h.db, classIDs, filter)
 	if err != nil {
 		http.Error(w, "DB Error", http.StatusInternalServerError)
 		return
 	}
 
+	// The student's sessions: their status on each, and (when overlaps are
+	// forbidden) the confirmed ones for time-conflict marking
+	rules, err := models.GetEnrollmentRules(h.db)
+	if err != nil {
+		log.Printf("Failed to load enrollment rules: %v", err)
+	}
+	var mySessions []models.EnrolledSession
+	myStatus := map[int]string{} // by session ID
+	if userID > 0 {
+		mySessions, err = models.GetUserEnrollments(h.db, userID)
+		if err != nil {
+			log.Printf("Failed to load enrollments of user %d: %v", userID, err)
+		}
+		for _, m := range mySessions {
+			myStatus[m.SessionID] = m.Status
+		}
+		if !rules.ForbidOverlap {
+			mySessions = nil
+		}
+	}
+
 	// 3. Build the View Data
 	var viewData []ClassView
+	now := time.Now()
 
 	for _, c := range classes {
-		// Fetch sessions for this class
-		sessions, err := models.GetSessionsByClassID(h.db, c.ID)
-		if err != nil {
-			continue
-		}
+		regState := c.RegistrationStateAt(now)
 
 		var sessViews []SessionView
-		for _, s := range sessions {
+		for _, s := range sessionsByClass[c.ID] {
 			// A. Check Capacity
 			isFull := s.CurrentEnrolledCount >= s.Capacity
 
-			// B. Check if User is Enrolled (Only if logged in)
-			isEnrolled := false
-			if userID > 0 {
-				isEnrolled, _ = models.HasUserJoined(h.db, s.ID, userID)
+			// B. Check if User is Enrolled or Waitlisted (Only if logged in)
+			status := myStatus[s.ID]
+			isEnrolled := status == models.StatusConfirmed
+			isWaitlisted := status == models.StatusWaitlisted
+
+			hasConflict := false
+			for _, m := range mySessions {
+				if m.SessionID != s.ID && !m.IsWaitlisted() && models.Overlaps(m.StartAt, m.EndAt, s.StartAt, s.EndAt) {
+					hasConflict = true
+					break
+				}
 			}
 
 			// C. Determine Button State
@@ -73,9 +201,20 @@ func (h *Handler) StudentLessonList(w http.ResponseWriter, r *http.Request) {
 			if isEnrolled {
 				label = "申込済" // Already Joined
 				disabled = true
-			} else if isFull {
-				label = "満席" // Full
+			} else if isWaitlisted {
+				label = "キャンセル待ち中" // Already queued
+				disabled = true
+			} else if regState == models.RegistrationNotStarted {
+				label = "受付前" // Not open yet
+				disabled = true
+			} else if regState == models.RegistrationClosed {
+				label = "受付終了" // Closed
 				disabled = true
+			} else if hasConflict {
+				label = "時間重複" // Overlaps another of the student's sessions
+				disabled = true
+			} else if isFull {
+				label = "満席・キャンセル待ち" // Full, but can join the waitlist
 			} else if s.CurrentEnrolledCount >= s.Capacity-5 {
 				label = "残りわずか" // Low stock
 			}
@@ -87,20 +226,43 @@ func (h *Handler) StudentLessonList(w http.ResponseWriter, r *http.Request) {
 				Session:        s,
 				IsFull:         isFull,
 				IsEnrolled:     isEnrolled,
+				IsWaitlisted:   isWaitlisted,
+				HasConflict:    hasConflict,
 				ButtonLabel:    label,
 				ButtonDisabled: disabled,
 			})
 		}
 
-		viewData = append(viewData, ClassView{
-			Class:    c,
-			Sessions: sessViews,
-		})
+		cv := ClassView{
+			Class:            c,
+			Sessions:         sessViews,
+			RegistrationOpen: regState == models.RegistrationOpen,
+		}
+		switch regState {
+		case models.RegistrationNotStarted:
+			cv.RegistrationLabel = "受付前"
+			cv.CountdownTarget = c.RegistrationStartAt
+			cv.Countdown = "受付開始まで " + formatCountdown(c.RegistrationStartAt.Sub(now))
+		case models.RegistrationClosed:
+			cv.RegistrationLabel = "受付終了"
+		default:
+			cv.RegistrationLabel = "受付中"
+			cv.CountdownTarget = c.RegistrationEndAt
+			cv.Countdown = "受付終了まで " + formatCountdown(c.RegistrationEndAt.Sub(now))
+		}
+		viewData = append(viewData, cv)
 	}
 
 	// 4. Render
 	// We pass 'viewData' which contains everything the HTML needs
-	h.tpl.Render(w, "lesson_list.html", viewData)
+	h.tpl.Render(w, "lesson_list.html", map[string]any{
+		"Classes":    viewData,
+		"Categories": categories,
+		"Days":       days,
+		"Filter":     filter,
+		"Grade":      grade,
+		"AllGrades":  allGrades,
+	})
 }
 // Application Page: 
 // GET: Shows confirmation form
@@ -153,23 +315,66 @@ func (h *Handler) StudentApplication(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    cancelHours, _ := models.GetCancelDeadlineHours(h.db)
+
+    regState := detail.RegistrationStateAt(time.Now())
+
+    // Rules shown in the consent box, worded for this student's grade
+    rules, err := models.GetEnrollmentRules(h.db)
+    if err != nil {
+        log.Printf("Failed to load enrollment rules: %v", err)
+    }
+    grade := ""
+    if profile != nil && profile.Grade.Valid {
+        grade = profile.Grade.String
+    }
+
+    // Warn up front if this session clashes with one already booked
+    timeConflict := ""
+    if err := models.CheckEnrollmentLimits(h.db, userID, sessID); errors.Is(err, models.ErrTimeConflict) {
+        var v *models.RuleViolation
+        if errors.As(err, &v) {
+            timeConflict = v.Message()
+        }
+    }
+
+    // Enrollment is locked until the student has confirmed their email address
+    verified, err := models.IsEmailVerified(h.db, userID)
+    if err != nil {
+        http.Error(w, "DB Error", http.StatusInternalServerError)
+        return
+    }
+
     viewData := map[string]any{
-        "Session": detail,
-        "User":    profile,
-        "Email":   data["email"],
-        "Error":   "",
+        "Unverified":        !verified,
+        "TimeConflict":      timeConflict,
+        "WrongGrade":        !detail.ForGrade(grade),
+        "Session":           detail,
+        "User":              profile,
+        "Email":             data["email"],
+        "Error":             "",
+        "CancelHours":       cancelHours,
+        "RegistrationOpen":  regState == models.RegistrationOpen,
+        "RegistrationStart": detail.RegistrationStartAt.In(models.EventLocation),
+        "RegistrationEnd":   detail.RegistrationEndAt.In(models.EventLocation),
+        "Rules":             rules.Describe(grade),
     }
 
-    // --- POST: PROCESS APPLICATION ---
-    if r.Method == http.MethodPost {
+    if r.Method == http.MethodPost && !verified {
+        viewData["Error"] = "メールアドレスの確認が完了していないため申し込めません。マイページから確認メールを再送できます。"
+        h.tpl.Render(w, "application.html", viewData)
+        return
+    }
+
+    // --- POST: JOIN WAITLIST ---
+    if r.Method == http.MethodPost && r.FormValue("action") == "waitlist" {
         var errorMsg string
 
-        // Check enrollment limits before allowing enrollment
+        // A student who couldn't enroll anyway shouldn't hold a place in the queue
         if err := models.CheckEnrollmentLimits(h.db, userID, sessID); err != nil {
-            if err == models.ErrDayLimitExceeded {
-                errorMsg = "申込数の上限を超えています。同じ日に申し込める授業は2つまでです。"
-            } else if err == models.ErrTotalLimitExceeded {
-                errorMsg = "申込数の上限を超えています。申し込める授業は全体で3つまでです。"
+            var v *models.RuleViolation
+            if errors.As(err, &v) {
+                errorMsg = v.Message()
             } else {
                 errorMsg = "エラーが発生しました: " + err.Error()
             }
@@ -178,14 +383,58 @@ func (h *Handler) StudentApplication(w http.ResponseWriter, r *http.Request) {
             return
         }
 
-        // Proceed with enrollment
+        position, err := models.JoinWaitlist(h.db, sessID, userID)
+        if err != nil {
+            if err == models.ErrAlreadyWaitlisted {
+                errorMsg = "この授業のキャンセル待ちには既に登録しています。"
+            } else if err == models.ErrAlreadyEnrolled {
+                errorMsg = "この授業には既に申し込んでいます。"
+            } else if err == models.ErrRegistrationNotOpen {
+                errorMsg = "この授業はまだ申込受付前です。"
+            } else if err == models.ErrRegistrationClosed || err == models.ErrEditionArchived {
+                errorMsg = "この授業の申込受付は終了しました。"
+            } else if err == models.ErrSessionNotFull {
+                errorMsg = "この授業には空きがあります。通常の申し込みを行ってください。"
+            } else if err == models.ErrWrongGrade {
+                errorMsg = "この授業は" + detail.GradesLabel() + "が対象です。"
+            } else if err == models.ErrProfileNotFound {
+                errorMsg = "生徒情報が登録されていないため申し込めません。"
+            } else {
+                errorMsg = "キャンセル待ちの登録に失敗しました: " + err.Error()
+            }
+            viewData["Error"] = errorMsg
+            h.tpl.Render(w, "application.html", viewData)
+            return
+        }
+
+        h.logAudit(r, audit.ActionWaitlistJoin, "session", sessID, nil, map[string]int{"user_id": userID, "position": position})
+        http.Redirect(w, r, "/?waitlist="+strconv.Itoa(position), http.StatusSeeOther)
+        return
+    }
+
+    // --- POST: PROCESS APPLICATION ---
+    if r.Method == http.MethodPost {
+        var errorMsg string
+
+        // Enrollment checks capacity and limits atomically
         err := models.EnrollUser(h.db, sessID, userID)
         if err != nil {
             // Handle specific errors for better UX
-            if err == models.ErrAlreadyEnrolled {
+            var v *models.RuleViolation
+            if errors.As(err, &v) {
+                errorMsg = v.Message() // generated from the rule that failed
+            } else if err == models.ErrAlreadyEnrolled {
                 errorMsg = "この授業には既に申し込んでいます。"
             } else if err == models.ErrSessionFull {
                 errorMsg = "この授業は満席です。"
+            } else if err == models.ErrRegistrationNotOpen {
+                errorMsg = "この授業はまだ申込受付前です。受付開始日時: " + detail.RegistrationStartAt.In(models.EventLocation).Format("2006年01月02日 15:04")
+            } else if err == models.ErrRegistrationClosed || err == models.ErrEditionArchived {
+                errorMsg = "この授業の申込受付は終了しました。"
+            } else if err == models.ErrWrongGrade {
+                errorMsg = "この授業は" + detail.GradesLabel() + "が対象です。"
+            } else if err == models.ErrProfileNotFound {
+                errorMsg = "生徒情報が登録されていないため申し込めません。"
             } else {
                 errorMsg = "申込に失敗しました: " + err.Error()
             }
@@ -194,6 +443,8 @@ func (h *Handler) StudentApplication(w http.ResponseWriter, r *http.Request) {
             return
         }
 
+        h.logAudit(r, audit.ActionEnroll, "session", sessID, nil, map[string]int{"user_id": userID})
+
         // Send confirmation email (asynchronously to avoid blocking)
         go func() {
             if err := h.sendEnrollmentEmail(userID, sessID, data["email"].(string)); err != nil {
@@ -210,18 +461,129 @@ func (h *Handler) StudentApplication(w http.ResponseWriter, r *http.Request) {
     h.tpl.Render(w, "application.html", viewData)
 }
 
+// StudentCancel cancels one of the student's enrollments (POST from MyPage)
+func (h *Handler) StudentCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	userID, userEmail, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	sessID, _ := strconv.Atoi(r.FormValue("session_id"))
+
+	// Without the setting we can't tell whether the deadline has passed
+	deadline, err := models.GetCancelDeadline(h.db)
+	if err != nil {
+		log.Printf("Failed to load cancel deadline: %v", err)
+		http.Error(w, "DB Error", http.StatusInternalServerError)
+		return
+	}
+
+	err = models.CancelEnrollment(h.db, sessID, userID, deadline)
+	switch err {
+	case nil:
+	case models.ErrCancelDeadline:
+		http.Redirect(w, r, "/?cancel=deadline", http.StatusSeeOther)
+		return
+	case models.ErrNotEnrolled, models.ErrEditionArchived:
+		http.Redirect(w, r, "/?cancel=notfound", http.StatusSeeOther)
+		return
+	default:
+		log.Printf("Cancel error (user %d, session %d): %v", userID, sessID, err)
+		http.Error(w, "キャンセルに失敗しました", http.StatusInternalServerError)
+		return
+	}
+	h.logAudit(r, audit.ActionCancel, "session", sessID, map[string]int{"user_id": userID}, nil)
+
+	// Send cancellation email (asynchronously to avoid blocking)
+	go func() {
+		if err := h.sendCancellationEmail(userID, sessID, userEmail); err != nil {
+			log.Printf("Failed to send cancellation email to user %d: %v", userID, err)
+		}
+	}()
+
+	// The freed seat goes to the next student on the waitlist
+	h.promoteWaitlist(sessID)
+
+	http.Redirect(w, r, "/?cancel=success", http.StatusSeeOther)
+}
+
+// promoteWaitlist fills free seats of a session from its waitlist and
+// notifies every promoted student by email
+func (h *Handler) promoteWaitlist(sessionID int) {
+	promoted, err := models.PromoteWaitlist(h.db, sessionID)
+	if err != nil {
+		log.Printf("Failed to promote waitlist for session %d: %v", sessionID, err)
+		return
+	}
+
+	for _, p := range promoted {
+		// Promotion is done by the system, not by whoever freed the seat
+		h.writeAudit(audit.Entry{
+			Action:     audit.ActionWaitlistPromote,
+			TargetType: "session",
+			TargetID:   strconv.Itoa(p.SessionID),
+			After:      map[string]int{"user_id": p.UserID},
+		})
+		go func(p models.Promotion) {
+			emailData, err := h.enrollmentEmailData(p.UserID, p.SessionID)
+			if err != nil {
+				log.Printf("Failed to build promotion email for user %d: %v", p.UserID, err)
+				return
+			}
+			subject := email.GetWaitlistPromotionSubject()
+			body := email.GenerateWaitlistPromotion(emailData)
+			if err := h.mailer.Send(p.Email, subject, body); err != nil {
+				log.Printf("Failed to send promotion email to user %d: %v", p.UserID, err)
+			}
+		}(p)
+	}
+}
+
 // sendEnrollmentEmail sends a confirmation email after successful enrollment
 func (h *Handler) sendEnrollmentEmail(userID, sessionID int, userEmail string) error {
+	emailData, err := h.enrollmentEmailData(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	// Generate email content
+	subject := email.GetEnrollmentSubject()
+	body := email.GenerateEnrollmentConfirmation(emailData)
+
+	// Send email
+	return h.mailer.Send(userEmail, subject, body)
+}
+
+// sendCancellationEmail notifies the student that their enrollment was cancelled
+func (h *Handler) sendCancellationEmail(userID, sessionID int, userEmail string) error {
+	emailData, err := h.enrollmentEmailData(userID, sessionID)
+	if err != nil {
+		return err
+	}
+
+	subject := email.GetCancellationSubject()
+	body := email.GenerateCancellationConfirmation(emailData)
+
+	return h.mailer.Send(userEmail, subject, body)
+}
+
+// enrollmentEmailData collects the session and student details used by the enrollment emails
+func (h *Handler) enrollmentEmailData(userID, sessionID int) (email.EnrollmentData, error) {
 	// Get session details
 	sessionDetail, err := models.GetSessionDetail(h.db, sessionID)
 	if err != nil {
-		return err
+		return email.EnrollmentData{}, err
 	}
 
 	// Get user profile
 	profile, err := models.GetUserProfile(h.db, userID)
 	if err != nil {
-		return err
+		return email.EnrollmentData{}, err
 	}
 
 	// Extract student name with fallback
@@ -230,8 +592,7 @@ func (h *Handler) sendEnrollmentEmail(userID, sessionID int, userEmail string) e
 		studentName = profile.StudentName.String
 	}
 
-	// Prepare email data
-	emailData := email.EnrollmentData{
+	return email.EnrollmentData{
 		StudentName: studentName,
 		ClassName:   sessionDetail.ClassName,
 		RoomNumber:  sessionDetail.RoomNumber,
@@ -239,12 +600,5 @@ func (h *Handler) sendEnrollmentEmail(userID, sessionID int, userEmail string) e
 		TeacherName: sessionDetail.TeacherName,
 		StartAt:     sessionDetail.StartAt,
 		EndAt:       sessionDetail.EndAt,
-	}
-
-	// Generate email content
-	subject := email.GetEnrollmentSubject()
-	body := email.GenerateEnrollmentConfirmation(emailData)
-
-	// Send email
-	return h.mailer.Send(userEmail, subject, body)
+	}, nil
 }
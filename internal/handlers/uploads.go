@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"example.com/myapp/internal/models"
+	"example.com/myapp/internal/storage"
+	"example.com/myapp/internal/upload"
+)
+
+// ServeUpload sends a syllabus PDF, its thumbnail or a class image. Whatever
+// a file really holds, it goes out as a PDF, PNG or JPEG the browser must
+// not sniff, so an upload can never run as a page or script on this site.
+// Images are sandboxed as well; PDFs are not, because a sandboxed document
+// can't load the browser's PDF viewer (Chromium shows a blank page).
+func (h *Handler) ServeUpload(w http.ResponseWriter, r *http.Request) {
+	name := strings.TrimPrefix(r.URL.Path, "/uploads/")
+	if !upload.IsSafeName(name) {
+		http.NotFound(w, r)
+		return
+	}
+	// A bucket with a public URL (or a CDN) serves the file itself; it has to
+	// send the same headers, see README
+	if u := h.store.URL(name); u != "" {
+		http.Redirect(w, r, u, http.StatusFound)
+		return
+	}
+	f, info, err := h.store.Get(name)
+	if err == storage.ErrNotFound {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read upload %s: %v", name, err)
+		http.Error(w, "File error", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	// Files from before uploads were checked may not be PDFs at all
+	contentType, filename := "application/pdf", "syllabus.pdf"
+	head := make([]byte, 8)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+	switch {
+	case upload.IsImageName(name) && upload.IsPNG(head):
+		contentType, filename = "image/png", "image.png"
+	case upload.IsImageName(name) && upload.IsJPEG(head):
+		contentType, filename = "image/jpeg", "image.jpg"
+	case upload.IsImageName(name) || !upload.IsPDF(head):
+		http.NotFound(w, r)
+		return
+	}
+
+	hdr := w.Header()
+	hdr.Set("Content-Type", contentType)
+	hdr.Set("X-Content-Type-Options", "nosniff")
+	hdr.Set("Content-Disposition", `inline; filename="`+filename+`"`)
+	if contentType != "application/pdf" {
+		hdr.Set("Content-Security-Policy", "sandbox")
+	}
+	if upload.IsStoredName(name) || upload.IsImageName(name) {
+		// The name is the content's hash, so the file never changes
+		hdr.Set("Cache-Control", "public, max-age=31536000, immutable")
+	}
+	// Local files can seek, which gives range requests (and page-by-page
+	// loading in PDF viewers); a bucket's stream is sent as is
+	if rs, ok := f.(io.ReadSeeker); ok {
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "File error", http.StatusInternalServerError)
+			return
+		}
+		http.ServeContent(w, r, name, info.ModTime, rs)
+		return
+	}
+	if !info.ModTime.IsZero() {
+		hdr.Set("Last-Modified", info.ModTime.UTC().Format(http.TimeFormat))
+	}
+	if info.Size > 0 {
+		hdr.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+	if r.Method == http.MethodHead {
+		return
+	}
+	w.Write(head)
+	io.Copy(w, f)
+}
+
+// removeSyllabus deletes a syllabus file no class links to any more, after
+// its class was deleted or got a new PDF
+func (h *Handler) removeSyllabus(name string) {
+	if name == "" {
+		return
+	}
+	used, err := models.SyllabusInUse(h.db, name)
+	if err != nil {
+		log.Printf("Failed to check use of syllabus %s: %v", name, err)
+		return
+	}
+	if used {
+		return
+	}
+	if err := upload.Remove(h.store, name); err != nil {
+		log.Printf("Failed to remove syllabus %s: %v", name, err)
+	}
+	if err := upload.Remove(h.store, upload.ThumbName(name)); err != nil {
+		log.Printf("Failed to remove thumbnail of syllabus %s: %v", name, err)
+	}
+}
+
+// removeClassImage deletes a class image no class shows any more
+func (h *Handler) removeClassImage(name string) {
+	if name == "" {
+		return
+	}
+	used, err := models.ClassImageInUse(h.db, name)
+	if err != nil {
+		log.Printf("Failed to check use of class image %s: %v", name, err)
+		return
+	}
+	if used {
+		return
+	}
+	if err := upload.Remove(h.store, name); err != nil {
+		log.Printf("Failed to remove class image %s: %v", name, err)
+	}
+}
+
+// saveImage stores the class image of the form, if one was chosen
+func (h *Handler) saveImage(r *http.Request, formKey string) (string, error) {
+	file, _, err := r.FormFile(formKey)
+	if err == http.ErrMissingFile {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	return upload.SaveImage(h.store, file)
+}
+
+// previewTimeout bounds the work on one syllabus preview. Ordinary files
+// take well under a second; a file built to be slow gets no thumbnail.
+const previewTimeout = 5 * time.Second
+
+// syllabusPreview makes the thumbnail and excerpt of a stored syllabus. A
+// PDF we can't read (or not in time) still counts as uploaded; it just has
+// no preview.
+func (h *Handler) syllabusPreview(ctx context.Context, name string) upload.Preview {
+	ctx, cancel := context.WithTimeout(ctx, previewTimeout)
+	defer cancel()
+	p, err := upload.MakePreview(ctx, h.store, name)
+	if err != nil {
+		log.Printf("No preview for syllabus %s: %v", name, err)
+	}
+	return p
+}
+
+// classFormLimit caps the class form, which carries a syllabus and a class
+// image: a little above their two limits, to leave room for the other fields
+const classFormLimit = upload.MaxPDFSize + upload.MaxImageSize + 1<<20
+
+// parseUploadForm parses a multipart form carrying a syllabus and a class
+// image. CSRF normally parsed it already under classFormLimit (see
+// multipartLimits); a body it left unread is capped here before parsing.
+// It writes the error response and returns false on failure.
+func parseUploadForm(w http.ResponseWriter, r *http.Request) bool {
+	if r.MultipartForm == nil {
+		r.Body = http.MaxBytesReader(w, r.Body, classFormLimit)
+	}
+	if err := r.ParseMultipartForm(multipartMemory); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "ファイルサイズはPDFが10MB、画像が5MBまでです", http.StatusRequestEntityTooLarge)
+			return false
+		}
+		http.Error(w, "Form error", http.StatusBadRequest)
+		return false
+	}
+	return true
+}
+
+// syllabusError turns an upload rejection into the message shown on the form
+func syllabusError(err error) (string, bool) {
+	switch err {
+	case upload.ErrNotPDF:
+		return "PDFファイルを選択してください", true
+	case upload.ErrTooLarge:
+		return "ファイルサイズは10MBまでです", true
+	case upload.ErrEmpty:
+		return "空のファイルはアップロードできません", true
+	}
+	return "", false
+}
+
+// imageError turns a class image rejection into the message shown on the form
+func imageError(err error) (string, bool) {
+	switch err {
+	case upload.ErrNotImage:
+		return "JPEGまたはPNGの画像を選択してください", true
+	case upload.ErrTooLarge:
+		return "画像のサイズは5MBまでです", true
+	case upload.ErrEmpty:
+		return "空のファイルはアップロードできません", true
+	}
+	return "", false
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"example.com/myapp/internal/storage"
+)
+
+func TestServeUpload(t *testing.T) {
+	hash := strings.Repeat("0f", 32)
+	var pngData, jpegData bytes.Buffer
+	png.Encode(&pngData, image.NewGray(image.Rect(0, 0, 2, 2)))
+	jpeg.Encode(&jpegData, image.NewGray(image.Rect(0, 0, 2, 2)), nil)
+	pdfData := "%PDF-1.4\n%%EOF\n"
+
+	store := storage.NewMemory()
+	files := map[string]string{
+		hash + ".pdf":                     pdfData,
+		"syllabus_legacy.pdf":             pdfData,
+		"legacy_page.pdf":                 "<html><script>alert(1)</script></html>", // stored before content checks
+		hash + ".png":                     pngData.String(),
+		hash + ".jpg":                     jpegData.String(),
+		strings.Repeat("1e", 32) + ".png": pdfData, // PDF content under an image name
+		strings.Repeat("2d", 32) + ".jpg": "<svg onload=alert(1)>",
+	}
+	for name, data := range files {
+		if err := store.Put(name, strings.NewReader(data), ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+	h := &Handler{store: store}
+
+	tests := []struct {
+		name        string
+		status      int
+		contentType string
+		csp         string // PDF viewers don't run in a sandboxed document
+	}{
+		{hash + ".pdf", http.StatusOK, "application/pdf", ""},
+		{"syllabus_legacy.pdf", http.StatusOK, "application/pdf", ""},
+		{hash + ".png", http.StatusOK, "image/png", "sandbox"},
+		{hash + ".jpg", http.StatusOK, "image/jpeg", "sandbox"},
+		{"legacy_page.pdf", http.StatusNotFound, "", ""},
+		{strings.Repeat("1e", 32) + ".png", http.StatusNotFound, "", ""},
+		{strings.Repeat("2d", 32) + ".jpg", http.StatusNotFound, "", ""},
+		{"missing.pdf", http.StatusNotFound, "", ""},
+		{"..%2fconfig.pdf", http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeUpload(w, httptest.NewRequest(http.MethodGet, "/uploads/"+tt.name, nil))
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d", w.Code, tt.status)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			hdr := w.Header()
+			if got := hdr.Get("Content-Type"); got != tt.contentType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.contentType)
+			}
+			if got := hdr.Get("X-Content-Type-Options"); got != "nosniff" {
+				t.Errorf("X-Content-Type-Options = %q", got)
+			}
+			if got := hdr.Get("Content-Disposition"); !strings.HasPrefix(got, "inline; filename=") {
+				t.Errorf("Content-Disposition = %q", got)
+			}
+			if got := hdr.Get("Content-Security-Policy"); got != tt.csp {
+				t.Errorf("Content-Security-Policy = %q, want %q", got, tt.csp)
+			}
+			if w.Body.String() != files[tt.name] {
+				t.Errorf("body differs from the stored file")
+			}
+		})
+	}
+}
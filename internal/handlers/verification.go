@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/email"
+	"example.com/myapp/internal/models"
+)
+
+const (
+	verificationTTL     = 24 * time.Hour // how long an emailed link stays valid
+	verificationPerHour = 3              // links one account can request per hour
+)
+
+var errVerificationRateLimited = errors.New("too many verification emails requested")
+
+// VerifyEmail confirms an address from the emailed link (public)
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	token := r.URL.Query().Get("token")
+
+	_, err := models.VerifyEmailWithToken(h.db, auth.HashToken(token))
+	if err != nil && err != models.ErrInvalidVerificationToken {
+		log.Printf("Email verification error: %v", err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+
+	h.tpl.Render(w, "verify_result.html", map[string]any{"Success": err == nil})
+}
+
+// ResendVerification emails a fresh verification link to the logged-in user
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+	userID, userEmail, ok := currentUser(r)
+	if !ok {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	if verified, _ := models.IsEmailVerified(h.db, userID); verified {
+		http.Redirect(w, r, "/", http.StatusSeeOther)
+		return
+	}
+
+	if err := h.sendVerificationEmail(userID, userEmail); err != nil {
+		if err == errVerificationRateLimited {
+			http.Redirect(w, r, "/?verify=limited", http.StatusSeeOther)
+			return
+		}
+		log.Printf("Failed to resend verification to user %d: %v", userID, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/?verify=sent", http.StatusSeeOther)
+}
+
+// sendVerificationEmail issues a verification token and emails the link
+func (h *Handler) sendVerificationEmail(userID int, userEmail string) error {
+	recent, err := models.CountEmailVerificationsSince(h.db, userID, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+	if recent >= verificationPerHour {
+		return errVerificationRateLimited
+	}
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		return err
+	}
+	if err := models.CreateEmailVerificationToken(h.db, userID, hash, time.Now().Add(verificationTTL)); err != nil {
+		return err
+	}
+
+	link := h.cfg.BaseURL + "/verify?token=" + token
+	go func() {
+		body := email.GenerateEmailVerification(link, verificationTTL)
+		if err := h.mailer.Send(userEmail, email.GetEmailVerificationSubject(), body); err != nil {
+			log.Printf("Failed to send verification email to user %d: %v", userID, err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/auth"
+	"example.com/myapp/internal/models"
+)
+
+var verifyLink = regexp.MustCompile(`/verify\?token=([0-9a-f]{64})`)
+
+// resend asks for a verification email as the logged-in user
+func resend(h *Handler, userID int, addr string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(http.MethodPost, "/verify/resend", nil)
+	r = r.WithContext(context.WithValue(r.Context(), sessionKey, map[string]any{"user_id": userID, "email": addr}))
+	w := httptest.NewRecorder()
+	h.ResendVerification(w, r)
+	return w
+}
+
+func verify(h *Handler, token string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.VerifyEmail(w, httptest.NewRequest(http.MethodGet, "/verify?token="+token, nil))
+	return w
+}
+
+func verified(t *testing.T, h *Handler, id int) bool {
+	t.Helper()
+	ok, err := models.IsEmailVerified(h.db, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ok
+}
+
+func TestEmailVerificationSingleUse(t *testing.T) {
+	h, db, mailer := newTestHandler(t)
+	const addr = "family@example.com"
+	id := createUser(t, db, addr, "pass1234")
+
+	// Two links: either confirms the address, and using one uses up both
+	var tokens []string
+	for range 2 {
+		w := resend(h, id, addr)
+		if w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/?verify=sent" {
+			t.Fatalf("resend: status %d, Location %q", w.Code, w.Header().Get("Location"))
+		}
+		msg := mailer.next(t)
+		m := verifyLink.FindStringSubmatch(msg.Body)
+		if msg.To != addr || m == nil {
+			t.Fatalf("mail to %q without a verification link:\n%s", msg.To, msg.Body)
+		}
+		tokens = append(tokens, m[1])
+	}
+	if verified(t, h, id) {
+		t.Fatal("verified before the link was opened")
+	}
+
+	if w := verify(h, tokens[1]); !strings.Contains(w.Body.String(), "notice-success") {
+		t.Fatalf("verify: status %d\n%s", w.Code, w.Body)
+	}
+	if !verified(t, h, id) {
+		t.Fatal("address not verified")
+	}
+	for _, token := range append(tokens, "", strings.Repeat("0", 64)) {
+		if w := verify(h, token); !strings.Contains(w.Body.String(), "無効") {
+			t.Errorf("token %q accepted after verification", token)
+		}
+	}
+
+	// A verified account gets no more links
+	if w := resend(h, id, addr); w.Header().Get("Location") != "/" {
+		t.Errorf("resend after verification: Location %q", w.Header().Get("Location"))
+	}
+}
+
+func TestEmailVerificationExpired(t *testing.T) {
+	h, db, _ := newTestHandler(t)
+	id := createUser(t, db, "family@example.com", "pass1234")
+
+	token, hash, err := auth.NewToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := models.CreateEmailVerificationToken(db, id, hash, time.Now().Add(-time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if w := verify(h, token); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "無効") {
+		t.Fatalf("expired token: status %d", w.Code)
+	}
+	if verified(t, h, id) {
+		t.Fatal("expired token verified the address")
+	}
+}
+
+func TestEmailVerificationRateLimit(t *testing.T) {
+	h, db, mailer := newTestHandler(t)
+	const addr = "family@example.com"
+	id := createUser(t, db, addr, "pass1234")
+
+	for i := range verificationPerHour {
+		if w := resend(h, id, addr); w.Header().Get("Location") != "/?verify=sent" {
+			t.Fatalf("resend %d: Location %q", i, w.Header().Get("Location"))
+		}
+		mailer.next(t)
+	}
+	if w := resend(h, id, addr); w.Header().Get("Location") != "/?verify=limited" {
+		t.Fatalf("resend over the limit: Location %q", w.Header().Get("Location"))
+	}
+	select {
+	case msg := <-mailer.sent:
+		t.Errorf("mail sent over the limit: %+v", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,231 @@
+// Package markdown renders the small part of Markdown that class
+// descriptions need. Everything the author writes is escaped; the only
+// HTML in the output is what the renderer itself produces, and links may
+// only point to http(s), mailto or this site.
+//
+// Supported: paragraphs (a single line break is kept), headings (#),
+// lists (-, *, + and 1.), quotes (>), code blocks (```), rules (---),
+// **bold**, *italic*, `code`, [links](https://...) and bare URLs.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"regexp"
+	"strings"
+)
+
+var (
+	headingLine = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	bulletLine  = regexp.MustCompile(`^\s*[-*+]\s+(.*)$`)
+	orderedLine = regexp.MustCompile(`^\s*\d{1,9}[.)]\s+(.*)$`)
+	ruleLine    = regexp.MustCompile(`^\s*([-*_])(\s*[-*_]){2,}\s*$`)
+)
+
+// ToHTML renders src as HTML that is safe to put in a page
+func ToHTML(src string) template.HTML {
+	lines := strings.Split(strings.ReplaceAll(src, "\r\n", "\n"), "\n")
+	var b strings.Builder
+	var para []string // lines of the open paragraph
+	list := ""        // "ul" or "ol" while a list is open
+
+	flush := func() {
+		if len(para) > 0 {
+			b.WriteString("<p>")
+			for i, l := range para {
+				if i > 0 {
+					b.WriteString("<br>\n")
+				}
+				b.WriteString(inline(l))
+			}
+			b.WriteString("</p>\n")
+			para = nil
+		}
+		if list != "" {
+			b.WriteString("</" + list + ">\n")
+			list = ""
+		}
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case trimmed == "":
+			flush()
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			var code []string
+			for i++; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			b.WriteString("<pre><code>" + html.EscapeString(strings.Join(code, "\n")) + "</code></pre>\n")
+
+		case headingLine.MatchString(trimmed):
+			flush()
+			m := headingLine.FindStringSubmatch(trimmed)
+			// Descriptions sit under the page's own headings: # is <h3>
+			level := string(rune('0' + min(len(m[1])+2, 6)))
+			b.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+
+		case ruleLine.MatchString(trimmed):
+			flush()
+			b.WriteString("<hr>\n")
+
+		case strings.HasPrefix(trimmed, ">"):
+			flush()
+			var quote []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				quote = append(quote, strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(lines[i]), ">"), " "))
+			}
+			i--
+			b.WriteString("<blockquote>\n" + string(ToHTML(strings.Join(quote, "\n"))) + "</blockquote>\n")
+
+		case bulletLine.MatchString(line), orderedLine.MatchString(line):
+			kind, m := "ul", bulletLine.FindStringSubmatch(line)
+			if m == nil {
+				kind, m = "ol", orderedLine.FindStringSubmatch(line)
+			}
+			if list != kind {
+				flush()
+				b.WriteString("<" + kind + ">\n")
+				list = kind
+			}
+			b.WriteString("<li>" + inline(m[1]) + "</li>\n")
+
+		case list != "" && (line[0] == ' ' || line[0] == '\t'):
+			// An indented line continues the list item: reopen it
+			s := b.String()
+			s = strings.TrimSuffix(s, "</li>\n") + "<br>\n" + inline(trimmed) + "</li>\n"
+			b.Reset()
+			b.WriteString(s)
+
+		default:
+			if list != "" {
+				flush()
+			}
+			para = append(para, trimmed)
+		}
+	}
+	flush()
+	return template.HTML(b.String())
+}
+
+// inline renders emphasis, code, links and bare URLs in one line of text
+func inline(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '\\' && len(rest) > 1 && strings.ContainsRune("\\`*_[]()#+-.!>", rune(rest[1])):
+			b.WriteString(html.EscapeString(rest[1:2]))
+			i += 2
+			continue
+
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				b.WriteString("<code>" + html.EscapeString(rest[1:1+end]) + "</code>")
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				b.WriteString("<strong>" + inline(rest[2:2+end]) + "</strong>")
+				i += end + 4
+				continue
+			}
+
+		case rest[0] == '*':
+			if end := strings.IndexByte(rest[1:], '*'); end > 0 && rest[1] != ' ' {
+				b.WriteString("<em>" + inline(rest[1:1+end]) + "</em>")
+				i += end + 2
+				continue
+			}
+
+		case rest[0] == '[':
+			if text, url, n, ok := link(rest); ok {
+				if safeURL(url) {
+					b.WriteString(`<a href="` + html.EscapeString(url) + `" target="_blank" rel="noopener noreferrer">` + inline(text) + "</a>")
+				} else {
+					b.WriteString(inline(text))
+				}
+				i += n
+				continue
+			}
+
+		case strings.HasPrefix(rest, "https://") || strings.HasPrefix(rest, "http://"):
+			url := bareURL(rest)
+			b.WriteString(`<a href="` + html.EscapeString(url) + `" target="_blank" rel="noopener noreferrer">` + html.EscapeString(url) + "</a>")
+			i += len(url)
+			continue
+		}
+		b.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return b.String()
+}
+
+// link parses "[text](url)" at the start of s. The text ends at the
+// matching "]", which must be followed by "("; brackets in the text must
+// balance, as must parentheses in the URL.
+func link(s string) (text, url string, n int, ok bool) {
+	mid, depth := -1, 0
+	for i := 1; i < len(s) && mid < 0; i++ {
+		switch s[i] {
+		case '\\':
+			i++ // an escaped character never opens or closes
+		case '[':
+			depth++
+		case ']':
+			if depth == 0 {
+				mid = i
+			}
+			depth--
+		}
+	}
+	if mid < 0 || !strings.HasPrefix(s[mid:], "](") {
+		return "", "", 0, false
+	}
+	depth = 0
+	for i := mid + 2; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			if depth == 0 {
+				return s[1:mid], strings.TrimSpace(s[mid+2 : i]), i + 1, true
+			}
+			depth--
+		}
+	}
+	return "", "", 0, false
+}
+
+// bareURL takes the URL at the start of s, up to a space or a character
+// that can't be part of one (Japanese text often follows without a space)
+func bareURL(s string) string {
+	end := len(s)
+	for i, r := range s {
+		if r <= ' ' || r > '~' || strings.ContainsRune(`<>"'`, r) {
+			end = i
+			break
+		}
+	}
+	return strings.TrimRight(s[:end], ".,;:!?)")
+}
+
+// safeURL allows http(s) and mailto links, and paths on this site. Browsers
+// read "/\host" like "//host", a link to another site, and they drop tabs
+// and line breaks inside URLs, so "/<tab>/host" is one too.
+func safeURL(url string) bool {
+	if strings.ContainsAny(url, "\t\r\n") {
+		return false
+	}
+	lower := strings.ToLower(url)
+	if strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "mailto:") {
+		return true
+	}
+	return strings.HasPrefix(url, "/") && (len(url) == 1 || (url[1] != '/' && url[1] != '\\'))
+}
@@ -0,0 +1,121 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+const linkAttrs = ` target="_blank" rel="noopener noreferrer"`
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"paragraph with a line break", "一行目\n二行目", "<p>一行目<br>\n二行目</p>\n"},
+		{"paragraphs", "a\n\nb", "<p>a</p>\n<p>b</p>\n"},
+		{"heading starts at h3", "# 概要", "<h3>概要</h3>\n"},
+		{"deep heading stops at h6", "###### x", "<h6>x</h6>\n"},
+		{"bullet list", "- 筆記用具\n- 上履き", "<ul>\n<li>筆記用具</li>\n<li>上履き</li>\n</ul>\n"},
+		{"ordered list", "1. 受付\n2. 講義", "<ol>\n<li>受付</li>\n<li>講義</li>\n</ol>\n"},
+		{"list item continued", "- a\n  b", "<ul>\n<li>a<br>\nb</li>\n</ul>\n"},
+		{"rule", "---", "<hr>\n"},
+		{"quote", "> 注意", "<blockquote>\n<p>注意</p>\n</blockquote>\n"},
+		{"code block is escaped", "```\n<b>x</b>\n```", "<pre><code>&lt;b&gt;x&lt;/b&gt;</code></pre>\n"},
+		{"emphasis", "**太字**と*斜体*と`code`", "<p><strong>太字</strong>と<em>斜体</em>と<code>code</code></p>\n"},
+		{"escaped asterisks", `\*not italic\*`, "<p>*not italic*</p>\n"},
+		{"CRLF", "a\r\nb", "<p>a<br>\nb</p>\n"},
+		{"link", "[学校](https://example.ac.jp/)", `<p><a href="https://example.ac.jp/"` + linkAttrs + `>学校</a></p>` + "\n"},
+		{"site link", "[地図](/access)", `<p><a href="/access"` + linkAttrs + `>地図</a></p>` + "\n"},
+		{"link with parentheses", "[wiki](https://example.org/a_(b))", `<p><a href="https://example.org/a_(b)"` + linkAttrs + `>wiki</a></p>` + "\n"},
+		{"bare URL before Japanese", "詳細はhttps://example.ac.jp/infoをご覧ください",
+			`<p>詳細は<a href="https://example.ac.jp/info"` + linkAttrs + `>https://example.ac.jp/info</a>をご覧ください</p>` + "\n"},
+		{"bare URL drops trailing punctuation", "(https://example.ac.jp/).",
+			`<p>(<a href="https://example.ac.jp/"` + linkAttrs + `>https://example.ac.jp/</a>).</p>` + "\n"},
+
+		// Link text stops at the first unmatched "]"
+		{"bracket before a link", "[a] x [b](https://example.ac.jp/)", `<p>[a] x <a href="https://example.ac.jp/"` + linkAttrs + `>b</a></p>` + "\n"},
+		{"nested brackets in text", "[[1]](https://example.ac.jp/)", `<p><a href="https://example.ac.jp/"` + linkAttrs + `>[1]</a></p>` + "\n"},
+		{"escaped bracket in text", `[a\]b](https://example.ac.jp/)`, `<p><a href="https://example.ac.jp/"` + linkAttrs + `>a]b</a></p>` + "\n"},
+		{"unclosed link", "[a](https://example.ac.jp/", "<p>[a](<a href=\"https://example.ac.jp/\"" + linkAttrs + ">https://example.ac.jp/</a></p>\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(ToHTML(tt.src)); got != tt.want {
+				t.Errorf("ToHTML(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToHTMLEscapes(t *testing.T) {
+	tests := []struct {
+		name, src, want string
+	}{
+		{"tags", "<script>alert(1)</script>", "<p>&lt;script&gt;alert(1)&lt;/script&gt;</p>\n"},
+		{"attributes", `<img src=x onerror="alert(1)">`, "<p>&lt;img src=x onerror=&#34;alert(1)&#34;&gt;</p>\n"},
+		{"entities stay text", "&lt;b&gt; &amp;", "<p>&amp;lt;b&amp;gt; &amp;amp;</p>\n"},
+		{"in a heading", "# <i>x</i>", "<h3>&lt;i&gt;x&lt;/i&gt;</h3>\n"},
+		{"in emphasis", "**<b>x</b>**", "<p><strong>&lt;b&gt;x&lt;/b&gt;</strong></p>\n"},
+		{"in code", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"in link text", "[<b>x</b>](/a)", `<p><a href="/a"` + linkAttrs + `>&lt;b&gt;x&lt;/b&gt;</a></p>` + "\n"},
+		{"quote in a link URL", `[x](/a"onmouseover="alert(1))`, `<p><a href="/a&#34;onmouseover=&#34;alert(1)"` + linkAttrs + `>x</a></p>` + "\n"},
+		{"quote ends a bare URL", `https://example.ac.jp/"onmouseover="alert(1)`,
+			`<p><a href="https://example.ac.jp/"` + linkAttrs + `>https://example.ac.jp/</a>&#34;onmouseover=&#34;alert(1)</p>` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(ToHTML(tt.src)); got != tt.want {
+				t.Errorf("ToHTML(%q)\n got %q\nwant %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnsafeLinks(t *testing.T) {
+	for _, url := range []string{
+		"javascript:alert(1)",
+		"JavaScript:alert(1)",
+		" javascript:alert(1)",
+		"data:text/html,<script>alert(1)</script>",
+		"vbscript:msgbox(1)",
+		"//evil.example",
+		`/\evil.example`,
+		"/\t/evil.example",
+		"/\n/evil.example",
+		"evil.example",
+		"",
+	} {
+		got := string(ToHTML("[click](" + url + ")"))
+		if strings.Contains(got, "<a") {
+			t.Errorf("link to %q rendered: %s", url, got)
+		}
+		if !strings.Contains(got, "click") {
+			t.Errorf("link text to %q lost: %s", url, got)
+		}
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		url string
+		ok  bool
+	}{
+		{"https://example.ac.jp/", true},
+		{"HTTP://example.ac.jp/", true},
+		{"mailto:info@example.ac.jp", true},
+		{"/", true},
+		{"/classes?grade=2", true},
+		{"//evil.example", false},
+		{`/\evil.example`, false},
+		{`\\evil.example`, false},
+		{"/\t/evil.example", false},
+		{"javascript:alert(1)", false},
+		{"ftp://example.ac.jp/", false},
+		{"classes", false},
+	}
+	for _, tt := range tests {
+		if got := safeURL(tt.url); got != tt.ok {
+			t.Errorf("safeURL(%q) = %v, want %v", tt.url, got, tt.ok)
+		}
+	}
+}
@@ -2,20 +2,77 @@ package models
 
 import (
 	"database/sql"
+	"fmt"
+	"strings"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 type Class struct {
 	ID                  int
 	ClassName           string
+	Description         string   // Markdown shown to students; instructors can edit it
+	Category            string   // department tag, e.g. "理科"; "" if none
+	TargetGrades        []string // values of Grades the class is meant for; empty means all
+	Prerequisites       string
+	ImageURL            string // stored image name, or ""
 	SyllabusPDFURL      string
+	SyllabusThumb       string // PNG of the PDF's first page, or ""
+	SyllabusExcerpt     string // the PDF's opening text, or ""
 	RoomNumber          string
 	RoomName            string
 	RegistrationStartAt time.Time
 	RegistrationEndAt   time.Time
+	EditionID           int
+	Archived            bool // the edition is archived: read-only
+}
+
+// ForGrade reports whether the class is meant for a student of grade
+func (c Class) ForGrade(grade string) bool {
+	if len(c.TargetGrades) == 0 {
+		return true
+	}
+	for _, g := range c.TargetGrades {
+		if g == grade {
+			return true
+		}
+	}
+	return false
 }
 
-// CreateClassWithInstructors (No changes needed here, this was already correct)
+// GradesLabel describes the target grades, e.g. "中学1・2年生" or "全学年"
+func (c Class) GradesLabel() string {
+	if len(c.TargetGrades) == 0 || len(c.TargetGrades) == len(Grades) {
+		return "全学年"
+	}
+	return "中学" + strings.Join(c.TargetGrades, "・") + "年生"
+}
+
+// RegistrationState describes where a moment falls in a class's registration window
+type RegistrationState int
+
+const (
+	RegistrationOpen RegistrationState = iota
+	RegistrationNotStarted
+	RegistrationClosed
+)
+
+// RegistrationStateAt reports whether registration is open at `now`.
+// The window includes both its start and its end instant.
+// Comparison is between absolute instants, so the time zone of `now` doesn't matter.
+func (c Class) RegistrationStateAt(now time.Time) RegistrationState {
+	if now.Before(c.RegistrationStartAt) {
+		return RegistrationNotStarted
+	}
+	if now.After(c.RegistrationEndAt) {
+		return RegistrationClosed
+	}
+	return RegistrationOpen
+}
+
+// CreateClassWithInstructors inserts a class into the active edition and links
+// its instructors in one transaction
 func CreateClassWithInstructors(db *sql.DB, c Class, teacherNames []string) (int, error) {
 	tx, err := db.Begin()
 	if err != nil {
@@ -32,101 +89,411 @@ func CreateClassWithInstructors(db *sql.DB, c Class, teacherNames []string) (int
 	var classID int
 	err = tx.QueryRow(`
 		INSERT INTO classes (
-			class_name, syllabus_pdf_url, room_number, room_name,
-			registration_start_at, registration_end_at
+			class_name, syllabus_pdf_url, syllabus_thumb, syllabus_excerpt, room_number, room_name,
+			registration_start_at, registration_end_at, description,
+			category, target_grades, prerequisites, image_url, edition_id
 		)
-		VALUES ($1, $2, $3, $4, $5, $6)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, `+activeEditionID+`)
 		RETURNING class_id
 	`,
-		c.ClassName, c.SyllabusPDFURL, c.RoomNumber, c.RoomName,
-		c.RegistrationStartAt, c.RegistrationEndAt,
+		c.ClassName, c.SyllabusPDFURL, c.SyllabusThumb, c.SyllabusExcerpt, c.RoomNumber, c.RoomName,
+		c.RegistrationStartAt, c.RegistrationEndAt, c.Description,
+		c.Category, pq.Array(gradesOrEmpty(c.TargetGrades)), c.Prerequisites, c.ImageURL,
 	).Scan(&classID)
 
 	if err != nil {
 		return 0, err
 	}
 
+	err = linkInstructors(tx, classID, teacherNames)
+	if err != nil {
+		return 0, err
+	}
+
+	return classID, nil
+}
+
+// UpdateClassWithInstructors saves edits to a class and replaces its instructor list
+func UpdateClassWithInstructors(db *sql.DB, c Class, teacherNames []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	res, err := tx.Exec(`
+		UPDATE classes SET
+			class_name = $2, syllabus_pdf_url = $3, room_number = $4, room_name = $5,
+			registration_start_at = $6, registration_end_at = $7, description = $8,
+			syllabus_thumb = $9, syllabus_excerpt = $10,
+			category = $11, target_grades = $12, prerequisites = $13, image_url = $14
+		WHERE class_id = $1
+	`,
+		c.ID, c.ClassName, c.SyllabusPDFURL, c.RoomNumber, c.RoomName,
+		c.RegistrationStartAt, c.RegistrationEndAt, c.Description,
+		c.SyllabusThumb, c.SyllabusExcerpt,
+		c.Category, pq.Array(gradesOrEmpty(c.TargetGrades)), c.Prerequisites, c.ImageURL,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("DELETE FROM class_instructors WHERE class_id = $1", c.ID); err != nil {
+		return err
+	}
+	if err := linkInstructors(tx, c.ID, teacherNames); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// gradesOrEmpty turns nil into an empty list, which pq sends as '{}'
+// rather than NULL (target_grades is NOT NULL)
+func gradesOrEmpty(grades []string) []string {
+	if grades == nil {
+		return []string{}
+	}
+	return grades
+}
+
+// UpdateClassDescription changes only the description (the instructor portal's edit)
+func UpdateClassDescription(db *sql.DB, id int, description string) error {
+	res, err := db.Exec("UPDATE classes SET description = $2 WHERE class_id = $1", id, description)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// DeleteClass removes a class; its sessions and enrollments go with it (ON DELETE CASCADE)
+func DeleteClass(db *sql.DB, id int) error {
+	res, err := db.Exec("DELETE FROM classes WHERE class_id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetClassInstructors returns the instructor names linked to a class
+func GetClassInstructors(db *sql.DB, classID int) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT i.name
+		FROM class_instructors ci
+		JOIN instructors i ON ci.instructor_id = i.instructor_id
+		WHERE ci.class_id = $1
+		ORDER BY i.instructor_id
+	`, classID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+// Instructor is a teacher who can be linked to classes and to a staff account
+type Instructor struct {
+	ID   int
+	Name string
+}
+
+// GetAllInstructors lists instructors by name
+func GetAllInstructors(db *sql.DB) ([]Instructor, error) {
+	rows, err := db.Query("SELECT instructor_id, name FROM instructors ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Instructor
+	for rows.Next() {
+		var i Instructor
+		if err := rows.Scan(&i.ID, &i.Name); err != nil {
+			return nil, err
+		}
+		list = append(list, i)
+	}
+	return list, nil
+}
+
+// GetInstructorClassIDs returns the classes an instructor is linked to
+func GetInstructorClassIDs(db *sql.DB, instructorID int) (map[int]bool, error) {
+	rows, err := db.Query("SELECT class_id FROM class_instructors WHERE instructor_id = $1", instructorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := make(map[int]bool)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids[id] = true
+	}
+	return ids, nil
+}
+
+// IsClassInstructor reports whether an instructor is linked to a class
+func IsClassInstructor(db *sql.DB, classID, instructorID int) (bool, error) {
+	var linked bool
+	err := db.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM class_instructors WHERE class_id = $1 AND instructor_id = $2)
+	`, classID, instructorID).Scan(&linked)
+	return linked, err
+}
+
+// linkInstructors attaches instructors to a class by name, creating unknown names
+func linkInstructors(tx *sql.Tx, classID int, teacherNames []string) error {
 	for _, name := range teacherNames {
 		if name == "" { continue }
 		var instructorID int
-		err = tx.QueryRow("SELECT instructor_id FROM instructors WHERE name = $1", name).Scan(&instructorID)
+		err := tx.QueryRow("SELECT instructor_id FROM instructors WHERE name = $1", name).Scan(&instructorID)
 		if err == sql.ErrNoRows {
 			err = tx.QueryRow("INSERT INTO instructors (name) VALUES ($1) RETURNING instructor_id", name).Scan(&instructorID)
-			if err != nil { return 0, err }
-		} else if err != nil { return 0, err }
+			if err != nil { return err }
+		} else if err != nil { return err }
 
 		_, err = tx.Exec(`
 			INSERT INTO class_instructors (class_id, instructor_id)
 			VALUES ($1, $2)
 			ON CONFLICT (class_id, instructor_id) DO NOTHING
 		`, classID, instructorID)
-		if err != nil { return 0, err }
+		if err != nil { return err }
 	}
-
-	return classID, nil
+	return nil
 }
 
-// GetClassByID: Fixed to include Syllabus and Room Number
-func GetClassByID(db *sql.DB, id int) (*Class, error) {
-	c := &Class{}
-	// 👇 ADDED: syllabus_pdf_url, room_number
-	err := db.QueryRow(`
-		SELECT 
-			class_id, 
-			class_name, 
-			COALESCE(syllabus_pdf_url, ''), 
-			room_number, 
-			room_name, 
-			registration_start_at, 
-			registration_end_at 
-		FROM classes WHERE class_id = $1`, id).Scan(
-		&c.ID, 
-		&c.ClassName, 
-		&c.SyllabusPDFURL, // 👈 Scan this
-		&c.RoomNumber,     // 👈 Scan this
-		&c.RoomName, 
-		&c.RegistrationStartAt, 
-		&c.RegistrationEndAt,
+// classColumns is the SELECT list scanClass reads, over classes c joined
+// with event_editions e
+const classColumns = `
+	c.class_id, c.class_name, COALESCE(c.syllabus_pdf_url, ''),
+	COALESCE(c.syllabus_thumb, ''), COALESCE(c.syllabus_excerpt, ''),
+	c.room_number, c.room_name, c.registration_start_at, c.registration_end_at,
+	c.description, c.category, c.target_grades, c.prerequisites, c.image_url,
+	c.edition_id, e.status = 'archived'
+`
+
+// scanClass reads one row of classColumns
+func scanClass(row interface{ Scan(...any) error }) (Class, error) {
+	var c Class
+	err := row.Scan(
+		&c.ID, &c.ClassName, &c.SyllabusPDFURL,
+		&c.SyllabusThumb, &c.SyllabusExcerpt,
+		&c.RoomNumber, &c.RoomName, &c.RegistrationStartAt, &c.RegistrationEndAt,
+		&c.Description, &c.Category, pq.Array(&c.TargetGrades), &c.Prerequisites, &c.ImageURL,
+		&c.EditionID, &c.Archived,
 	)
 	return c, err
 }
 
-// GetAllClasses: Fixed to include Syllabus and Room Number
+// GetClassByID returns a class of any edition
+func GetClassByID(db *sql.DB, id int) (*Class, error) {
+	c, err := scanClass(db.QueryRow(`
+		SELECT `+classColumns+`
+		FROM classes c
+		JOIN event_editions e ON e.edition_id = c.edition_id
+		WHERE c.class_id = $1`, id))
+	return &c, err
+}
+
+// GetAllClasses returns the classes of the active edition
 func GetAllClasses(db *sql.DB) ([]Class, error) {
-	// 👇 ADDED: syllabus_pdf_url, room_number
+	return GetEditionClasses(db, 0)
+}
+
+// GetEditionClasses returns the classes of one edition (0 for the active one)
+func GetEditionClasses(db *sql.DB, editionID int) ([]Class, error) {
 	rows, err := db.Query(`
-		SELECT 
-			class_id, 
-			class_name, 
-			COALESCE(syllabus_pdf_url, ''), 
-			room_number, 
-			room_name, 
-			registration_start_at, 
-			registration_end_at
-		FROM classes 
-		ORDER BY class_id DESC
-	`)
+		SELECT `+classColumns+`
+		FROM classes c
+		JOIN event_editions e ON e.edition_id = c.edition_id
+		WHERE c.edition_id = COALESCE(NULLIF($1, 0), `+activeEditionID+`)
+		ORDER BY c.class_id DESC
+	`, editionID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return collectClasses(rows)
+}
 
+// Orders of the student lesson list
+const (
+	ClassSortNewest = ""      // newest class first
+	ClassSortStart  = "start" // earliest matching session first
+	ClassSortSeats  = "seats" // most free seats in matching sessions first
+)
+
+// ClassFilter narrows and orders the student lesson list. Zero values
+// don't filter. The session conditions (DayID, From, To, Available) keep
+// classes with at least one such session, and FindClassSessions shows only
+// those sessions.
+type ClassFilter struct {
+	Keyword   string // every word must appear in the name, description or an instructor's name
+	Category  string
+	Grade     string // hides classes whose target grades don't include it
+	DayID     int
+	From      string // "15:04" in EventLocation: sessions starting at or after it
+	To        string // "15:04" in EventLocation: sessions ending by it
+	Available bool   // sessions with a free seat
+	Sort      string // one of the ClassSort values
+}
+
+// hasSessionConds reports whether f narrows sessions
+func (f ClassFilter) hasSessionConds() bool {
+	return f.DayID > 0 || f.From != "" || f.To != "" || f.Available
+}
+
+// sessionConds returns the SQL conditions on the sessions of f over
+// class_sessions s, adding their values to args. It is "TRUE" if f has none.
+func (f ClassFilter) sessionConds(args *[]any) string {
+	conds := []string{"TRUE"}
+	add := func(cond string, v any) {
+		*args = append(*args, v)
+		conds = append(conds, fmt.Sprintf(cond, len(*args)))
+	}
+	if f.DayID > 0 {
+		add("s.day_id = $%d", f.DayID)
+	}
+	if f.From != "" || f.To != "" {
+		*args = append(*args, EventLocation.String())
+		zone := len(*args)
+		if f.From != "" {
+			add(fmt.Sprintf("(s.start_at AT TIME ZONE $%d)::time >= $%%d::time", zone), f.From)
+		}
+		if f.To != "" {
+			add(fmt.Sprintf("(s.end_at AT TIME ZONE $%d)::time <= $%%d::time", zone), f.To)
+		}
+	}
+	if f.Available {
+		conds = append(conds, "s.current_enrolled_count < s.capacity")
+	}
+	return strings.Join(conds, " AND ")
+}
+
+// likeEscaper makes user input match literally in a LIKE pattern
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// FindClasses returns the classes of the active edition that pass f, in
+// the order it asks for
+func FindClasses(db *sql.DB, f ClassFilter) ([]Class, error) {
+	query := `
+		SELECT ` + classColumns + `
+		FROM classes c
+		JOIN event_editions e ON e.edition_id = c.edition_id
+		WHERE c.edition_id = ` + activeEditionID
+	var args []any
+	add := func(cond string, v any) {
+		args = append(args, v)
+		query += fmt.Sprintf(" AND "+cond, len(args))
+	}
+	for _, word := range strings.Fields(f.Keyword) {
+		add(`(
+			c.class_name ILIKE '%%' || $%[1]d || '%%'
+			OR c.description ILIKE '%%' || $%[1]d || '%%'
+			OR EXISTS (
+				SELECT 1 FROM class_instructors ci
+				JOIN instructors i ON i.instructor_id = ci.instructor_id
+				WHERE ci.class_id = c.class_id AND i.name ILIKE '%%' || $%[1]d || '%%'
+			)
+		)`, likeEscaper.Replace(word))
+	}
+	if f.Category != "" {
+		add("c.category = $%d", f.Category)
+	}
+	if f.Grade != "" {
+		add("(cardinality(c.target_grades) = 0 OR $%d = ANY(c.target_grades))", f.Grade)
+	}
+	sessions := f.sessionConds(&args)
+	if f.hasSessionConds() {
+		query += " AND EXISTS (SELECT 1 FROM class_sessions s WHERE s.class_id = c.class_id AND " + sessions + ")"
+	}
+
+	switch f.Sort {
+	case ClassSortStart:
+		query += " ORDER BY (SELECT MIN(s.start_at) FROM class_sessions s WHERE s.class_id = c.class_id AND " + sessions + ") ASC NULLS LAST, c.class_id DESC"
+	case ClassSortSeats:
+		query += " ORDER BY (SELECT COALESCE(SUM(GREATEST(s.capacity - s.current_enrolled_count, 0)), 0) FROM class_sessions s WHERE s.class_id = c.class_id AND " + sessions + ") DESC, c.class_id DESC"
+	default:
+		query += " ORDER BY c.class_id DESC"
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return collectClasses(rows)
+}
+
+// collectClasses scans and closes rows of classColumns
+func collectClasses(rows *sql.Rows) ([]Class, error) {
+	defer rows.Close()
 	var classes []Class
 	for rows.Next() {
-		var c Class
-		// 👇 Updated Scan to match the SELECT
-		if err := rows.Scan(
-			&c.ID, 
-			&c.ClassName, 
-			&c.SyllabusPDFURL, // 👈 Critical Fix
-			&c.RoomNumber,     // 👈 Critical Fix
-			&c.RoomName, 
-			&c.RegistrationStartAt, 
-			&c.RegistrationEndAt,
-		); err != nil {
+		c, err := scanClass(rows)
+		if err != nil {
 			return nil, err
 		}
 		classes = append(classes, c)
 	}
-	return classes, nil
+	return classes, rows.Err()
+}
+
+// GetClassCategories lists the categories used in the active edition, for
+// the category filter and the admin form's suggestions
+func GetClassCategories(db *sql.DB) ([]string, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT category FROM classes
+		WHERE edition_id = ` + activeEditionID + ` AND category <> ''
+		ORDER BY category
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// SyllabusInUse reports whether a class of any edition still links the
+// syllabus file. Identical uploads share one file, so it may be more than one.
+func SyllabusInUse(db *sql.DB, name string) (bool, error) {
+	var used bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM classes WHERE syllabus_pdf_url = $1)", name).Scan(&used)
+	return used, err
+}
+
+// ClassImageInUse reports whether a class of any edition still shows the
+// image file
+func ClassImageInUse(db *sql.DB, name string) (bool, error) {
+	var used bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM classes WHERE image_url = $1)", name).Scan(&used)
+	return used, err
 }
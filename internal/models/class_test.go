@@ -0,0 +1,62 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRegistrationWindow(t *testing.T) {
+	jst := EventLocation
+	// Registration runs from midnight JST on July 1 to 23:59:59 JST on July 31
+	class := Class{
+		RegistrationStartAt: time.Date(2025, 7, 1, 0, 0, 0, 0, jst),
+		RegistrationEndAt:   time.Date(2025, 7, 31, 23, 59, 59, 0, jst),
+	}
+	start, end := class.RegistrationStartAt, class.RegistrationEndAt
+
+	tests := []struct {
+		name  string
+		now   time.Time
+		state RegistrationState
+		err   error
+	}{
+		{"one second before the start", start.Add(-time.Second), RegistrationNotStarted, ErrRegistrationNotOpen},
+		{"exactly the start", start, RegistrationOpen, nil},
+		{"in the window", start.Add(24 * time.Hour), RegistrationOpen, nil},
+		{"exactly the end", end, RegistrationOpen, nil},
+		{"one second after the end", end.Add(time.Second), RegistrationClosed, ErrRegistrationClosed},
+
+		// The start is 2025-06-30 15:00 in UTC: still June 30 there, but open
+		{"start given in UTC", time.Date(2025, 6, 30, 15, 0, 0, 0, time.UTC), RegistrationOpen, nil},
+		{"one second before the start in UTC", time.Date(2025, 6, 30, 14, 59, 59, 0, time.UTC), RegistrationNotStarted, ErrRegistrationNotOpen},
+		// Midnight UTC on July 1 is 09:00 JST: well inside the window
+		{"July 1 midnight UTC", time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC), RegistrationOpen, nil},
+		// 15:00 UTC on July 31 is already August 1 in JST, so closed although
+		// the UTC date is still the 31st
+		{"end date in UTC, after the end in JST", time.Date(2025, 7, 31, 15, 0, 0, 0, time.UTC), RegistrationClosed, ErrRegistrationClosed},
+		{"end given in UTC", time.Date(2025, 7, 31, 14, 59, 59, 0, time.UTC), RegistrationOpen, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := class.RegistrationStateAt(tt.now); got != tt.state {
+				t.Errorf("RegistrationStateAt = %v, want %v", got, tt.state)
+			}
+			if err := checkRegistrationWindow(class, tt.now); !errors.Is(err, tt.err) {
+				t.Errorf("checkRegistrationWindow = %v, want %v", err, tt.err)
+			}
+			s := SessionDetail{RegistrationStartAt: start, RegistrationEndAt: end}
+			if got := s.RegistrationStateAt(tt.now); got != tt.state {
+				t.Errorf("SessionDetail.RegistrationStateAt = %v, want %v", got, tt.state)
+			}
+		})
+	}
+}
+
+func TestRegistrationWindowArchived(t *testing.T) {
+	now := time.Now()
+	class := Class{RegistrationStartAt: now.Add(-time.Hour), RegistrationEndAt: now.Add(time.Hour), Archived: true}
+	if err := checkRegistrationWindow(class, now); !errors.Is(err, ErrEditionArchived) {
+		t.Fatalf("err = %v, want ErrEditionArchived", err)
+	}
+}
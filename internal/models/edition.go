@@ -0,0 +1,291 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+)
+
+// Edition statuses
+const (
+	EditionActive   = "active"
+	EditionArchived = "archived"
+)
+
+var (
+	ErrEditionArchived    = errors.New("this event edition is archived and read-only")
+	ErrEditionNameTaken   = errors.New("an edition with this name already exists")
+	ErrRetentionNotPassed = errors.New("the retention period of this edition has not passed yet")
+)
+
+// DefaultRetentionDays is how long student data of an archived edition is kept
+// before it may be anonymized, when nothing has been configured
+const DefaultRetentionDays = 365
+
+// activeEditionID is a subquery for the ID of the active edition
+const activeEditionID = `(SELECT edition_id FROM event_editions WHERE status = 'active')`
+
+// Edition is one yearly event. Classes (and through them sessions and
+// enrollments) belong to an edition.
+type Edition struct {
+	ID           int
+	Name         string // e.g. "2025年度"
+	Status       string // EditionActive or EditionArchived
+	CreatedAt    time.Time
+	ArchivedAt   time.Time // zero while active
+	AnonymizedAt time.Time // zero until student data was anonymized
+}
+
+// IsArchived reports whether the edition is read-only
+func (e Edition) IsArchived() bool {
+	return e.Status == EditionArchived
+}
+
+// RetentionEndsAt is when the edition's student data may be anonymized
+func (e Edition) RetentionEndsAt(retentionDays int) time.Time {
+	return e.ArchivedAt.AddDate(0, 0, retentionDays)
+}
+
+// CanAnonymize reports whether the anonymization pass may run at `now`
+func (e Edition) CanAnonymize(now time.Time, retentionDays int) bool {
+	return e.IsArchived() && e.AnonymizedAt.IsZero() && !now.Before(e.RetentionEndsAt(retentionDays))
+}
+
+const editionColumns = `
+	edition_id, name, status, created_at, archived_at, anonymized_at
+`
+
+func scanEdition(row interface{ Scan(...any) error }) (*Edition, error) {
+	var e Edition
+	var archived, anonymized sql.NullTime
+	err := row.Scan(&e.ID, &e.Name, &e.Status, &e.CreatedAt, &archived, &anonymized)
+	if err != nil {
+		return nil, err
+	}
+	e.ArchivedAt = archived.Time
+	e.AnonymizedAt = anonymized.Time
+	return &e, nil
+}
+
+// GetActiveEdition returns the edition currently taking registrations
+func GetActiveEdition(q Querier) (*Edition, error) {
+	return scanEdition(q.QueryRow("SELECT " + editionColumns + " FROM event_editions WHERE status = 'active'"))
+}
+
+// GetEdition fetches one edition
+func GetEdition(db *sql.DB, id int) (*Edition, error) {
+	return scanEdition(db.QueryRow("SELECT "+editionColumns+" FROM event_editions WHERE edition_id = $1", id))
+}
+
+// ListEditions returns every edition, newest first
+func ListEditions(db *sql.DB) ([]Edition, error) {
+	rows, err := db.Query("SELECT " + editionColumns + " FROM event_editions ORDER BY created_at DESC, edition_id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []Edition
+	for rows.Next() {
+		e, err := scanEdition(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *e)
+	}
+	return list, rows.Err()
+}
+
+// IsClassArchived reports whether a class belongs to an archived edition
+func IsClassArchived(db *sql.DB, classID int) (bool, error) {
+	var archived bool
+	err := db.QueryRow(`
+		SELECT e.status = 'archived'
+		FROM classes c
+		JOIN event_editions e ON e.edition_id = c.edition_id
+		WHERE c.class_id = $1
+	`, classID).Scan(&archived)
+	return archived, err
+}
+
+// RolloverEdition archives the active edition and starts a new one without
+// classes. Classes, sessions, enrollments and accounts of the old edition are
+// kept unchanged; they just become read-only. The new edition gets the same
+// event days as the old one, moved so the first day falls on firstDay.
+// Returns the new edition's ID.
+func RolloverEdition(db *sql.DB, name, firstDay string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	var taken bool
+	if err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM event_editions WHERE name = $1)", name).Scan(&taken); err != nil {
+		return 0, err
+	}
+	if taken {
+		return 0, ErrEditionNameTaken
+	}
+
+	// Archiving locks the active row, so two rollovers can't both archive it
+	var oldID int
+	err = tx.QueryRow(`
+		UPDATE event_editions SET status = 'archived', archived_at = NOW()
+		WHERE status = 'active'
+		RETURNING edition_id
+	`).Scan(&oldID)
+	if err != nil {
+		return 0, err
+	}
+
+	var id int
+	err = tx.QueryRow(`
+		INSERT INTO event_editions (name) VALUES ($1)
+		RETURNING edition_id
+	`, name).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO event_days (edition_id, label, event_date)
+		SELECT $1, label, $3::date + (event_date - MIN(event_date) OVER ())
+		FROM event_days
+		WHERE edition_id = $2
+	`, id, oldID, firstDay)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// AnonymizeEdition scrubs the personal data of students who took part in an
+// archived edition once its retention period has passed. Students who also
+// took part in the active edition, or in an edition still within its
+// retention period, are left alone. School and grade are kept for statistics,
+// and audit entries keep only user IDs (see package audit). Stored snapshots
+// still hold the old data; the caller replaces them.
+// Returns the number of accounts anonymized.
+func AnonymizeEdition(db *sql.DB, editionID, retentionDays int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	e, err := scanEdition(tx.QueryRow("SELECT "+editionColumns+" FROM event_editions WHERE edition_id = $1 FOR UPDATE", editionID))
+	if err != nil {
+		return 0, err
+	}
+	if !e.CanAnonymize(time.Now(), retentionDays) {
+		return 0, ErrRetentionNotPassed
+	}
+
+	// Students of this edition with no enrollment in an edition still kept
+	rows, err := tx.Query(`
+		SELECT DISTINCT u.id, u.email
+		FROM session_enrollments se
+		JOIN user_profiles up ON up.id = se.user_profile_id
+		JOIN users u ON u.id = up.user_id
+		JOIN class_sessions cs ON cs.session_id = se.session_id
+		JOIN classes c ON c.class_id = cs.class_id
+		WHERE c.edition_id = $1 AND u.role = 'student' AND u.anonymized_at IS NULL
+		  AND NOT EXISTS (
+			SELECT 1
+			FROM session_enrollments se2
+			JOIN class_sessions cs2 ON cs2.session_id = se2.session_id
+			JOIN classes c2 ON c2.class_id = cs2.class_id
+			JOIN event_editions e2 ON e2.edition_id = c2.edition_id
+			WHERE se2.user_profile_id = up.id
+			  AND (e2.status = 'active' OR e2.archived_at > NOW() - make_interval(days => $2))
+		  )
+	`, editionID, retentionDays)
+	if err != nil {
+		return 0, err
+	}
+	var ids []int
+	var emails []string
+	for rows.Next() {
+		var id int
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		// The address becomes unusable and unique; "!" is never a valid bcrypt hash
+		_, err := tx.Exec(`
+			UPDATE users
+			SET email = 'anonymized-' || id || '@invalid', password_hash = '!', anonymized_at = NOW()
+			WHERE id = $1
+		`, id)
+		if err != nil {
+			return 0, err
+		}
+		_, err = tx.Exec(`
+			UPDATE user_profiles
+			SET student_name = $2, student_kana = '', guardian_name = '', phone = '', accessibility_needs = ''
+			WHERE user_id = $1
+		`, id, AnonymizedName)
+		if err != nil {
+			return 0, err
+		}
+		for _, q := range []string{
+			"DELETE FROM user_sessions WHERE user_id = $1",
+			"DELETE FROM password_reset_tokens WHERE user_id = $1",
+			"DELETE FROM email_verification_tokens WHERE user_id = $1",
+		} {
+			if _, err := tx.Exec(q, id); err != nil {
+				return 0, err
+			}
+		}
+		if _, err := tx.Exec("DELETE FROM login_attempts WHERE email = $1", emails[i]); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE event_editions SET anonymized_at = NOW() WHERE edition_id = $1", editionID); err != nil {
+		return 0, err
+	}
+	return len(ids), tx.Commit()
+}
+
+// AnonymizedName replaces the student's name once their data is anonymized
+const AnonymizedName = "（匿名化済み）"
+
+// GetRetentionDays returns how many days after archiving student data is kept
+func GetRetentionDays(db *sql.DB) (int, error) {
+	var v string
+	err := db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key='retention_days'").Scan(&v)
+	if err == sql.ErrNoRows {
+		return DefaultRetentionDays, nil
+	}
+	if err != nil {
+		return DefaultRetentionDays, err
+	}
+	days, err := strconv.Atoi(v)
+	if err != nil || days < 0 {
+		return DefaultRetentionDays, nil
+	}
+	return days, nil
+}
+
+func UpdateRetentionDays(db *sql.DB, days int) error {
+	_, err := db.Exec(`
+		INSERT INTO system_settings (setting_key, setting_value)
+		VALUES ('retention_days', $1)
+		ON CONFLICT (setting_key)
+		DO UPDATE SET setting_value = EXCLUDED.setting_value
+	`, strconv.Itoa(days))
+	return err
+}
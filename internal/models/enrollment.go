@@ -4,58 +4,206 @@ import (
 	"database/sql"
 	"errors"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 // Define errors we can check for later
 var (
-	ErrAlreadyEnrolled    = errors.New("user is already enrolled in this session")
-	ErrSessionFull        = errors.New("class session is full")
-	ErrDayLimitExceeded   = errors.New("cannot enroll in more than 2 classes on the same day")
-	ErrTotalLimitExceeded = errors.New("cannot enroll in more than 3 classes total")
+	ErrAlreadyEnrolled     = errors.New("user is already enrolled in this session")
+	ErrSessionFull         = errors.New("class session is full")
+	ErrDayLimitExceeded    = errors.New("daily enrollment limit reached")
+	ErrTotalLimitExceeded  = errors.New("total enrollment limit reached")
+	ErrTimeConflict        = errors.New("session overlaps another enrolled session")
+	ErrNotEnrolled         = errors.New("user is not enrolled in this session")
+	ErrProfileNotFound     = errors.New("user has no student profile")
+	ErrRegistrationNotOpen = errors.New("registration for this class has not started yet")
+	ErrRegistrationClosed  = errors.New("registration for this class has closed")
+	ErrWrongGrade          = errors.New("class is not open to the student's grade")
+	ErrCancelDeadline      = errors.New("cancellation deadline has passed")
 )
 
 // EnrolledSession represents a class the user has joined (for MyPage)
 type EnrolledSession struct {
-    SessionID   int
-    ClassName   string
-    StartAt     time.Time
-    EndAt       time.Time
+	SessionID        int
+	ClassName        string
+	StartAt          time.Time
+	EndAt            time.Time
+	Status           string // StatusConfirmed or StatusWaitlisted
+	WaitlistPosition int    // 1-based, only set while waitlisted
+}
+
+// IsWaitlisted reports whether the student is still waiting for a seat
+func (s EnrolledSession) IsWaitlisted() bool {
+	return s.Status == StatusWaitlisted
 }
 
-// EnrollUser adds a student to a class session
+// EnrollUser adds a student to a class session.
+//
+// Everything runs in one transaction with row locks, so concurrent requests
+// can't overbook a session or slip past the enrollment limits:
+//   - the session row is locked first, serializing enrollments into it
+//   - the student's profile row is locked next, serializing their limit checks
+//
+// Every writer locks the session before any profile (see CancelEnrollment,
+// JoinWaitlist, PromoteWaitlist), so the lock order never forms a cycle.
+// The CHECK constraints on class_sessions are the final backstop.
 func EnrollUser(db *sql.DB, sessionID, userID int) error {
-	// 1. Check Capacity (Simplified)
-	var current, cap int
-	err := db.QueryRow("SELECT current_enrolled_count, capacity FROM class_sessions WHERE session_id = $1", sessionID).Scan(&current, &cap)
+	tx, err := db.Begin()
 	if err != nil {
 		return err
 	}
-	if current >= cap {
-		return ErrSessionFull
+	defer tx.Rollback() // no-op after Commit
+
+	// 1. Lock the session and read its capacity, registration window and grades
+	var current, capacity int
+	var class Class
+	err = tx.QueryRow(`
+		SELECT cs.current_enrolled_count, cs.capacity, c.registration_start_at, c.registration_end_at,
+			c.edition_id <> `+activeEditionID+`, c.target_grades
+		FROM class_sessions cs
+		JOIN classes c ON cs.class_id = c.class_id
+		WHERE cs.session_id = $1
+		FOR UPDATE OF cs
+	`, sessionID).Scan(&current, &capacity, &class.RegistrationStartAt, &class.RegistrationEndAt, &class.Archived,
+		pq.Array(&class.TargetGrades))
+	if err != nil {
+		return err
+	}
+	if err := checkRegistrationWindow(class, time.Now()); err != nil {
+		return err
 	}
 
-	// 2. Insert Enrollment
-    // We assume you have the user_id, so we find the profile ID via subquery
-	const query = `
-		INSERT INTO session_enrollments (session_id, user_profile_id)
-		SELECT $1, id FROM user_profiles WHERE user_id = $2
-		ON CONFLICT (session_id, user_profile_id) DO NOTHING
-		RETURNING enrollment_id
-	`
-	
-	var enrollmentID int
-	err = db.QueryRow(query, sessionID, userID).Scan(&enrollmentID)
-	
+	// 2. Lock the student's profile; the class must be meant for their grade
+	var profileID int
+	var grade string
+	err = tx.QueryRow("SELECT id, grade FROM user_profiles WHERE user_id = $1 FOR UPDATE", userID).Scan(&profileID, &grade)
 	if err == sql.ErrNoRows {
+		return ErrProfileNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if !class.ForGrade(grade) {
+		return ErrWrongGrade
+	}
+
+	// 3. Already holding a seat?
+	status, err := GetEnrollmentStatus(tx, sessionID, userID)
+	if err != nil {
+		return err
+	}
+	if status == StatusConfirmed {
 		return ErrAlreadyEnrolled
 	}
-    
-    // 3. Update the counter in class_sessions
-    if err == nil {
-        _, _ = db.Exec("UPDATE class_sessions SET current_enrolled_count = current_enrolled_count + 1 WHERE session_id = $1", sessionID)
-    }
-    
-	return err
+
+	// 4. Per-day and total limits, against the rows we now hold locked
+	if err := CheckEnrollmentLimits(tx, userID, sessionID); err != nil {
+		return err
+	}
+
+	// 5. Capacity
+	if current >= capacity {
+		return ErrSessionFull
+	}
+
+	// 6. Insert Enrollment
+	// A waitlist entry for the same session is upgraded to a confirmed seat.
+	_, err = tx.Exec(`
+		INSERT INTO session_enrollments (session_id, user_profile_id, status)
+		VALUES ($1, $2, 'confirmed')
+		ON CONFLICT (session_id, user_profile_id) DO UPDATE
+			SET status = 'confirmed', registered_at = NOW()
+			WHERE session_enrollments.status = 'waitlisted'
+	`, sessionID, profileID)
+	if err != nil {
+		return err
+	}
+
+	// 7. Update the counter in class_sessions
+	_, err = tx.Exec("UPDATE class_sessions SET current_enrolled_count = current_enrolled_count + 1 WHERE session_id = $1", sessionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// checkRegistrationWindow maps the class's registration state to an enrollment error.
+// Classes of an archived edition never take registrations.
+func checkRegistrationWindow(c Class, now time.Time) error {
+	if c.Archived {
+		return ErrEditionArchived
+	}
+	switch c.RegistrationStateAt(now) {
+	case RegistrationNotStarted:
+		return ErrRegistrationNotOpen
+	case RegistrationClosed:
+		return ErrRegistrationClosed
+	}
+	return nil
+}
+
+// CancelEnrollment removes a student's enrollment and releases the seat.
+// The enrollment row and the counter are updated in one transaction.
+// Cancellation is refused once the session starts within `deadline`;
+// leaving the waitlist is always allowed.
+func CancelEnrollment(db *sql.DB, sessionID, userID int, deadline time.Duration) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	// 1. Lock the session row so the counter can't race with EnrollUser
+	var startAt time.Time
+	var archived bool
+	err = tx.QueryRow(`
+		SELECT cs.start_at, c.edition_id <> `+activeEditionID+`
+		FROM class_sessions cs
+		JOIN classes c ON cs.class_id = c.class_id
+		WHERE cs.session_id = $1
+		FOR UPDATE OF cs
+	`, sessionID).Scan(&startAt, &archived)
+	if err != nil {
+		return err
+	}
+	if archived {
+		return ErrEditionArchived
+	}
+
+	// 2. Delete the enrollment
+	var status string
+	err = tx.QueryRow(`
+		DELETE FROM session_enrollments
+		WHERE session_id = $1
+		  AND user_profile_id = (SELECT id FROM user_profiles WHERE user_id = $2)
+		RETURNING status
+	`, sessionID, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return ErrNotEnrolled
+	}
+	if err != nil {
+		return err
+	}
+	if status == StatusWaitlisted {
+		return tx.Commit()
+	}
+	if time.Now().After(startAt.Add(-deadline)) {
+		return ErrCancelDeadline
+	}
+
+	// 3. Release the seat
+	_, err = tx.Exec(`
+		UPDATE class_sessions
+		SET current_enrolled_count = GREATEST(current_enrolled_count - 1, 0)
+		WHERE session_id = $1
+	`, sessionID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // HasUserJoined checks if a user is already in a session
@@ -65,94 +213,79 @@ func HasUserJoined(db *sql.DB, sessionID, userID int) (bool, error) {
 		SELECT EXISTS (
 			SELECT 1 FROM session_enrollments se
 			JOIN user_profiles up ON se.user_profile_id = up.id
-			WHERE se.session_id = $1 AND up.user_id = $2
+			WHERE se.session_id = $1 AND up.user_id = $2 AND se.status = 'confirmed'
 		)
 	`
 	err := db.QueryRow(query, sessionID, userID).Scan(&exists)
 	return exists, err
 }
 
-// GetUserEnrollments fetches the list of classes a student has joined
+// GetUserEnrollments fetches the list of classes a student has joined in the active edition
 func GetUserEnrollments(db *sql.DB, userID int) ([]EnrolledSession, error) {
-    query := `
-        SELECT cs.session_id, c.class_name, cs.start_at, cs.end_at
+	query := `
+        SELECT cs.session_id, c.class_name, cs.start_at, cs.end_at, se.status,
+            CASE WHEN se.status = 'waitlisted' THEN (
+                SELECT COUNT(*) FROM session_enrollments w
+                WHERE w.session_id = se.session_id AND w.status = 'waitlisted'
+                  AND (w.registered_at, w.enrollment_id) <= (se.registered_at, se.enrollment_id)
+            ) ELSE 0 END
         FROM session_enrollments se
         JOIN class_sessions cs ON se.session_id = cs.session_id
         JOIN classes c ON cs.class_id = c.class_id
         JOIN user_profiles up ON se.user_profile_id = up.id
-        WHERE up.user_id = $1
+        WHERE up.user_id = $1 AND c.edition_id = ` + activeEditionID + `
         ORDER BY cs.start_at DESC
     `
-    rows, err := db.Query(query, userID)
-    if err != nil {
-        return nil, err
-    }
-    defer rows.Close()
-
-    var sessions []EnrolledSession
-    for rows.Next() {
-        var s EnrolledSession
-        if err := rows.Scan(&s.SessionID, &s.ClassName, &s.StartAt, &s.EndAt); err != nil {
-            return nil, err
-        }
-        sessions = append(sessions, s)
-    }
-    return sessions, nil
-}
-
-// CheckEnrollmentLimits verifies that the user hasn't exceeded enrollment limits
-// Rules: Max 2 classes per day, Max 3 classes total
-func CheckEnrollmentLimits(db *sql.DB, userID, newSessionID int) error {
-	// Get the day_sequence of the session the user wants to enroll in
-	var newDaySequence int
-	err := db.QueryRow(`
-		SELECT day_sequence
-		FROM class_sessions
-		WHERE session_id = $1
-	`, newSessionID).Scan(&newDaySequence)
+	rows, err := db.Query(query, userID)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	defer rows.Close()
 
-	// Count enrollments per day and total
-	query := `
-		SELECT
-			cs.day_sequence,
-			COUNT(*) as count
+	var sessions []EnrolledSession
+	for rows.Next() {
+		var s EnrolledSession
+		if err := rows.Scan(&s.SessionID, &s.ClassName, &s.StartAt, &s.EndAt, &s.Status, &s.WaitlistPosition); err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, nil
+}
+
+// Participant is a student holding a seat (or waitlist place) in a session,
+// used to notify them about changes
+type Participant struct {
+	UserID    int
+	Email     string
+	SessionID int
+	Status    string
+}
+
+// GetClassParticipants lists everyone enrolled or waitlisted in any session of a class.
+// Pass sessionID > 0 to restrict to one session.
+func GetClassParticipants(db *sql.DB, classID, sessionID int) ([]Participant, error) {
+	rows, err := db.Query(`
+		SELECT u.id, u.email, cs.session_id, se.status
 		FROM session_enrollments se
 		JOIN class_sessions cs ON se.session_id = cs.session_id
 		JOIN user_profiles up ON se.user_profile_id = up.id
-		WHERE up.user_id = $1
-		GROUP BY cs.day_sequence
-	`
-
-	rows, err := db.Query(query, userID)
+		JOIN users u ON up.user_id = u.id
+		WHERE cs.class_id = $1 AND ($2 = 0 OR cs.session_id = $2)
+		ORDER BY cs.session_id, u.id
+	`, classID, sessionID)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer rows.Close()
 
-	dayCounts := make(map[int]int)
-	totalCount := 0
-
+	var list []Participant
 	for rows.Next() {
-		var daySeq, count int
-		if err := rows.Scan(&daySeq, &count); err != nil {
-			return err
+		var p Participant
+		if err := rows.Scan(&p.UserID, &p.Email, &p.SessionID, &p.Status); err != nil {
+			return nil, err
 		}
-		dayCounts[daySeq] = count
-		totalCount += count
+		list = append(list, p)
 	}
-
-	// Check total limit (max 3 classes)
-	if totalCount >= 3 {
-		return ErrTotalLimitExceeded
-	}
-
-	// Check day limit (max 2 classes per day)
-	if dayCounts[newDaySequence] >= 2 {
-		return ErrDayLimitExceeded
-	}
-
-	return nil
+	return list, nil
 }
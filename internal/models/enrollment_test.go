@@ -0,0 +1,313 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+// seedSession adds a class open for registration with one session of the
+// given capacity, and returns the session ID
+func seedSession(t *testing.T, db *sql.DB, capacity int) int {
+	t.Helper()
+	now := time.Now()
+	var classID, sessionID int
+	err := db.QueryRow(`
+		INSERT INTO classes (class_name, room_number, room_name, registration_start_at, registration_end_at, edition_id)
+		VALUES ('テスト授業', '1-101', '演習室', $1, $2, `+activeEditionID+`)
+		RETURNING class_id
+	`, now.Add(-time.Hour), now.Add(time.Hour)).Scan(&classID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.QueryRow(`
+		INSERT INTO class_sessions (class_id, day_id, start_at, end_at, capacity)
+		VALUES ($1, (SELECT MIN(day_id) FROM event_days), $2, $3, $4)
+		RETURNING session_id
+	`, classID, now.Add(48*time.Hour), now.Add(49*time.Hour), capacity).Scan(&sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sessionID
+}
+
+// seedStudents adds n students with profiles and returns their user IDs
+func seedStudents(t *testing.T, db *sql.DB, n int) []int {
+	t.Helper()
+	ids := make([]int, n)
+	for i := range ids {
+		err := db.QueryRow(`
+			INSERT INTO users (email, password_hash, role) VALUES ($1, 'x', 'student') RETURNING id
+		`, fmt.Sprintf("student%d@example.com", i)).Scan(&ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = db.Exec(`
+			INSERT INTO user_profiles (user_id, student_name, guardian_name, school_name, grade)
+			VALUES ($1, '生徒', '保護者', '中学校', '2')
+		`, ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+// seatCounts returns the session's counter and its confirmed rows
+func seatCounts(t *testing.T, db *sql.DB, sessionID int) (counter, rows int) {
+	t.Helper()
+	err := db.QueryRow(`
+		SELECT cs.current_enrolled_count,
+		       (SELECT COUNT(*) FROM session_enrollments se WHERE se.session_id = cs.session_id AND se.status = 'confirmed')
+		FROM class_sessions cs WHERE cs.session_id = $1
+	`, sessionID).Scan(&counter, &rows)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return counter, rows
+}
+
+func TestEnrollUserConcurrentNeverOverbooks(t *testing.T) {
+	db := dbtest.Open(t)
+	const capacity, students = 5, 40
+	sessionID := seedSession(t, db, capacity)
+	users := seedStudents(t, db, students)
+
+	var wg sync.WaitGroup
+	errs := make([]error, students)
+	start := make(chan struct{})
+	for i, uid := range users {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			errs[i] = EnrollUser(db, sessionID, uid)
+		}()
+	}
+	close(start)
+	wg.Wait()
+
+	ok := 0
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, ErrSessionFull):
+		default:
+			t.Errorf("student %d: unexpected error %v", i, err)
+		}
+	}
+	if ok != capacity {
+		t.Errorf("%d enrollments succeeded, want %d", ok, capacity)
+	}
+	counter, rows := seatCounts(t, db, sessionID)
+	if counter != capacity || rows != capacity {
+		t.Errorf("current_enrolled_count = %d, confirmed rows = %d, want %d", counter, rows, capacity)
+	}
+}
+
+func TestEnrollUserConcurrentSameStudent(t *testing.T) {
+	db := dbtest.Open(t)
+	sessionID := seedSession(t, db, 10)
+	uid := seedStudents(t, db, 1)[0]
+
+	const tries = 10
+	var wg sync.WaitGroup
+	errs := make([]error, tries)
+	for i := range errs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = EnrollUser(db, sessionID, uid)
+		}()
+	}
+	wg.Wait()
+
+	ok := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			ok++
+		case errors.Is(err, ErrAlreadyEnrolled):
+		default:
+			t.Errorf("unexpected error %v", err)
+		}
+	}
+	if ok != 1 {
+		t.Errorf("%d enrollments succeeded, want 1", ok)
+	}
+	if counter, rows := seatCounts(t, db, sessionID); counter != 1 || rows != 1 {
+		t.Errorf("current_enrolled_count = %d, confirmed rows = %d, want 1", counter, rows)
+	}
+}
+
+func TestEnrollUserChecksGrade(t *testing.T) {
+	db := dbtest.Open(t)
+	sessionID := seedSession(t, db, 1)
+	users := seedStudents(t, db, 2) // both in grade 2
+	setGrades := func(grades string) {
+		t.Helper()
+		_, err := db.Exec(`
+			UPDATE classes SET target_grades = $1
+			WHERE class_id = (SELECT class_id FROM class_sessions WHERE session_id = $2)
+		`, grades, sessionID)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	setGrades("{1,3}")
+	if err := EnrollUser(db, sessionID, users[0]); !errors.Is(err, ErrWrongGrade) {
+		t.Fatalf("EnrollUser = %v, want ErrWrongGrade", err)
+	}
+	if counter, rows := seatCounts(t, db, sessionID); counter != 0 || rows != 0 {
+		t.Fatalf("refused enrollment took a seat: counter %d, rows %d", counter, rows)
+	}
+
+	setGrades("{2}")
+	if err := EnrollUser(db, sessionID, users[0]); err != nil {
+		t.Fatalf("EnrollUser for the right grade = %v", err)
+	}
+
+	// The session is now full; its waitlist checks the grade too
+	setGrades("{1}")
+	if _, err := JoinWaitlist(db, sessionID, users[1]); !errors.Is(err, ErrWrongGrade) {
+		t.Fatalf("JoinWaitlist = %v, want ErrWrongGrade", err)
+	}
+	setGrades("{}")
+	if _, err := JoinWaitlist(db, sessionID, users[1]); err != nil {
+		t.Fatalf("JoinWaitlist for a class open to all grades = %v", err)
+	}
+}
+
+func TestCancelEnrollment(t *testing.T) {
+	// The session starts in 48 hours; student 0 holds its only seat and
+	// student 1 is on the waitlist
+	tests := []struct {
+		name     string
+		student  int
+		deadline time.Duration
+		archive  bool
+		err      error
+		counter  int // seats taken afterwards
+	}{
+		{"before the deadline", 0, 24 * time.Hour, false, nil, 0},
+		{"after the deadline", 0, 72 * time.Hour, false, ErrCancelDeadline, 1},
+		{"waitlisted, after the deadline", 1, 72 * time.Hour, false, nil, 1},
+		{"not enrolled", 2, 0, false, ErrNotEnrolled, 1},
+		{"archived edition", 0, 0, true, ErrEditionArchived, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t)
+			sessionID := seedSession(t, db, 1)
+			users := seedStudents(t, db, 3)
+			if err := EnrollUser(db, sessionID, users[0]); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := JoinWaitlist(db, sessionID, users[1]); err != nil {
+				t.Fatal(err)
+			}
+			if tt.archive {
+				if _, err := RolloverEdition(db, "次年度", "2099-08-01"); err != nil {
+					t.Fatal(err)
+				}
+			}
+			before, _ := GetEnrollmentStatus(db, sessionID, users[tt.student])
+
+			err := CancelEnrollment(db, sessionID, users[tt.student], tt.deadline)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("CancelEnrollment = %v, want %v", err, tt.err)
+			}
+			if counter, rows := seatCounts(t, db, sessionID); counter != tt.counter || rows != tt.counter {
+				t.Errorf("counter %d, rows %d; want %d", counter, rows, tt.counter)
+			}
+			after, _ := GetEnrollmentStatus(db, sessionID, users[tt.student])
+			if tt.err == nil && after != "" {
+				t.Errorf("enrollment kept as %q", after)
+			}
+			if tt.err != nil && after != before {
+				t.Errorf("refused cancellation changed %q to %q", before, after)
+			}
+		})
+	}
+}
+
+func TestCheckEnrollmentLimitsOverlap(t *testing.T) {
+	// The student already holds a seat (or a waitlist place) in another
+	// class's session, placed relative to the one-hour session they apply for
+	tests := []struct {
+		name     string
+		shift    time.Duration // start of the held session after the new one's
+		length   time.Duration
+		otherDay bool
+		status   string
+		forbid   bool
+		conflict bool
+	}{
+		{"same time", 0, time.Hour, false, StatusConfirmed, true, true},
+		{"partly overlapping", 30 * time.Minute, time.Hour, false, StatusConfirmed, true, true},
+		{"within the new session", 15 * time.Minute, 30 * time.Minute, false, StatusConfirmed, true, true},
+		{"ends as the new one starts", -time.Hour, time.Hour, false, StatusConfirmed, true, false},
+		{"starts as the new one ends", time.Hour, time.Hour, false, StatusConfirmed, true, false},
+		{"another day", 24 * time.Hour, time.Hour, true, StatusConfirmed, true, false},
+		{"waitlisted at the same time", 0, time.Hour, false, StatusWaitlisted, true, false},
+		{"same time, rule off", 0, time.Hour, false, StatusConfirmed, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t)
+			if err := UpdateEnrollmentRules(db, EnrollmentRules{ForbidOverlap: tt.forbid}); err != nil {
+				t.Fatal(err)
+			}
+			newSession := seedSession(t, db, 5)
+			held := seedSession(t, db, 1)
+			var newStart time.Time
+			if err := db.QueryRow("SELECT start_at FROM class_sessions WHERE session_id = $1", newSession).Scan(&newStart); err != nil {
+				t.Fatal(err)
+			}
+			day := "MIN"
+			if tt.otherDay {
+				day = "MAX"
+			}
+			_, err := db.Exec(`
+				UPDATE class_sessions SET start_at = $2, end_at = $3, day_id = (SELECT `+day+`(day_id) FROM event_days)
+				WHERE session_id = $1
+			`, held, newStart.Add(tt.shift), newStart.Add(tt.shift+tt.length))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			users := seedStudents(t, db, 2)
+			student := users[0]
+			if tt.status == StatusWaitlisted {
+				// Someone else takes the only seat first
+				if err := EnrollUser(db, held, users[1]); err != nil {
+					t.Fatal(err)
+				}
+				if _, err := JoinWaitlist(db, held, student); err != nil {
+					t.Fatal(err)
+				}
+			} else if err := EnrollUser(db, held, student); err != nil {
+				t.Fatal(err)
+			}
+
+			err = CheckEnrollmentLimits(db, student, newSession)
+			if got := errors.Is(err, ErrTimeConflict); got != tt.conflict {
+				t.Fatalf("CheckEnrollmentLimits = %v, want conflict %v", err, tt.conflict)
+			}
+			if !tt.conflict && err != nil {
+				t.Fatalf("CheckEnrollmentLimits = %v", err)
+			}
+			var v *RuleViolation
+			if tt.conflict && (!errors.As(err, &v) || !v.ConflictStartAt.Equal(newStart.Add(tt.shift))) {
+				t.Errorf("violation %+v does not name the held session", v)
+			}
+		})
+	}
+}
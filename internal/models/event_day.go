@@ -0,0 +1,210 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrEventDayInUse                 = errors.New("event day still has sessions")
+	ErrEventDayLabelTaken            = errors.New("an event day with this label already exists")
+	ErrEventDayBeforeRegistrationEnd = errors.New("a session on the moved day would start before its class's registration closes")
+)
+
+// EventDay is one day of an edition, e.g. "1日目" on 2026-08-01 or an online day
+type EventDay struct {
+	ID        int
+	EditionID int
+	Label     string
+	Date      string // Format: "YYYY-MM-DD"
+	Sessions  int    // sessions scheduled on this day
+}
+
+// Time returns the start of the day in the event's time zone
+func (d EventDay) Time() time.Time {
+	t, _ := time.ParseInLocation("2006-01-02", d.Date, EventLocation)
+	return t
+}
+
+// MovedSession is a session whose times shifted because its day moved
+type MovedSession struct {
+	SessionID int
+	ClassID   int
+	OldStart  time.Time
+	NewStart  time.Time
+	NewEnd    time.Time
+}
+
+const eventDayColumns = `
+	d.day_id, d.edition_id, d.label, to_char(d.event_date, 'YYYY-MM-DD'),
+	(SELECT COUNT(*) FROM class_sessions s WHERE s.day_id = d.day_id)
+`
+
+// GetEventDays lists the days of an edition (0 for the active one) in date order
+func GetEventDays(db *sql.DB, editionID int) ([]EventDay, error) {
+	rows, err := db.Query(`
+		SELECT `+eventDayColumns+`
+		FROM event_days d
+		WHERE d.edition_id = COALESCE(NULLIF($1, 0), `+activeEditionID+`)
+		ORDER BY d.event_date, d.day_id
+	`, editionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var days []EventDay
+	for rows.Next() {
+		var d EventDay
+		if err := rows.Scan(&d.ID, &d.EditionID, &d.Label, &d.Date, &d.Sessions); err != nil {
+			return nil, err
+		}
+		days = append(days, d)
+	}
+	return days, rows.Err()
+}
+
+// GetEventDay fetches one day
+func GetEventDay(db *sql.DB, id int) (*EventDay, error) {
+	var d EventDay
+	err := db.QueryRow("SELECT "+eventDayColumns+" FROM event_days d WHERE d.day_id = $1", id).
+		Scan(&d.ID, &d.EditionID, &d.Label, &d.Date, &d.Sessions)
+	if err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// CreateEventDay adds a day to the active edition
+func CreateEventDay(db *sql.DB, label, date string) (int, error) {
+	if taken, err := eventDayLabelTaken(db, 0, label); err != nil || taken {
+		if taken {
+			err = ErrEventDayLabelTaken
+		}
+		return 0, err
+	}
+	var id int
+	err := db.QueryRow(`
+		INSERT INTO event_days (edition_id, label, event_date)
+		VALUES (`+activeEditionID+`, $1, $2)
+		RETURNING day_id
+	`, label, date).Scan(&id)
+	return id, err
+}
+
+// UpdateEventDay renames a day of the active edition or moves it to another
+// date. Sessions on a moved day keep their times of day and move with it;
+// the moved sessions are returned so their students can be told. A move
+// that would put a session before its class's registration end is refused
+// with ErrEventDayBeforeRegistrationEnd, and nothing changes.
+func UpdateEventDay(db *sql.DB, id int, label, date string) ([]MovedSession, error) {
+	if taken, err := eventDayLabelTaken(db, id, label); err != nil || taken {
+		if taken {
+			err = ErrEventDayLabelTaken
+		}
+		return nil, err
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	var shiftDays int
+	var archived bool
+	err = tx.QueryRow(`
+		SELECT $2::date - d.event_date, d.edition_id <> `+activeEditionID+`
+		FROM event_days d
+		WHERE d.day_id = $1
+		FOR UPDATE
+	`, id, date).Scan(&shiftDays, &archived)
+	if err != nil {
+		return nil, err
+	}
+	if archived {
+		return nil, ErrEditionArchived
+	}
+
+	if _, err := tx.Exec("UPDATE event_days SET label = $2, event_date = $3 WHERE day_id = $1", id, label, date); err != nil {
+		return nil, err
+	}
+
+	var moved []MovedSession
+	if shiftDays != 0 {
+		rows, err := tx.Query(`
+			UPDATE class_sessions s
+			SET start_at = s.start_at + make_interval(days => $2),
+			    end_at = s.end_at + make_interval(days => $2)
+			FROM class_sessions old
+			WHERE s.session_id = old.session_id AND s.day_id = $1
+			RETURNING s.session_id, s.class_id, old.start_at, s.start_at, s.end_at
+		`, id, shiftDays)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var m MovedSession
+			if err := rows.Scan(&m.SessionID, &m.ClassID, &m.OldStart, &m.NewStart, &m.NewEnd); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			moved = append(moved, m)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+
+		// Sessions start after registration closes (see the session form)
+		var early bool
+		err = tx.QueryRow(`
+			SELECT EXISTS (
+				SELECT 1 FROM class_sessions s
+				JOIN classes c ON c.class_id = s.class_id
+				WHERE s.day_id = $1 AND s.start_at < c.registration_end_at
+			)
+		`, id).Scan(&early)
+		if err != nil {
+			return nil, err
+		}
+		if early {
+			return nil, ErrEventDayBeforeRegistrationEnd
+		}
+	}
+	return moved, tx.Commit()
+}
+
+// DeleteEventDay removes a day of the active edition that has no sessions
+func DeleteEventDay(db *sql.DB, id int) error {
+	d, err := GetEventDay(db, id)
+	if err != nil {
+		return err
+	}
+	if d.Sessions > 0 {
+		return ErrEventDayInUse
+	}
+	res, err := db.Exec("DELETE FROM event_days WHERE day_id = $1 AND edition_id = "+activeEditionID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrEditionArchived
+	}
+	return nil
+}
+
+// eventDayLabelTaken reports whether another day of the edition owning
+// dayID (the active edition for 0) already uses the label
+func eventDayLabelTaken(db *sql.DB, dayID int, label string) (bool, error) {
+	var taken bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM event_days
+			WHERE label = $2 AND day_id <> $1
+			  AND edition_id = COALESCE((SELECT edition_id FROM event_days WHERE day_id = $1), `+activeEditionID+`)
+		)
+	`, dayID, label).Scan(&taken)
+	return taken, err
+}
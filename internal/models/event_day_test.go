@@ -0,0 +1,45 @@
+package models
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+func TestUpdateEventDayKeepsSessionsAfterRegistration(t *testing.T) {
+	db := dbtest.Open(t)
+	sessionID := seedSession(t, db, 5) // on the first day; registration closes in an hour
+	var dayID int
+	var startAt time.Time
+	if err := db.QueryRow("SELECT day_id, start_at FROM class_sessions WHERE session_id = $1", sessionID).Scan(&dayID, &startAt); err != nil {
+		t.Fatal(err)
+	}
+	day, err := GetEventDay(db, dayID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Ten days earlier puts the session before the end of registration
+	earlier := day.Time().AddDate(0, 0, -10).Format("2006-01-02")
+	if _, err := UpdateEventDay(db, dayID, "移動後", earlier); !errors.Is(err, ErrEventDayBeforeRegistrationEnd) {
+		t.Fatalf("UpdateEventDay = %v, want ErrEventDayBeforeRegistrationEnd", err)
+	}
+	after, _ := GetEventDay(db, dayID)
+	var start time.Time
+	db.QueryRow("SELECT start_at FROM class_sessions WHERE session_id = $1", sessionID).Scan(&start)
+	if after.Date != day.Date || after.Label != day.Label || !start.Equal(startAt) {
+		t.Fatalf("refused move changed the day (%+v) or the session (%v)", after, start)
+	}
+
+	// A day later is fine, and the session moves with the day
+	later := day.Time().AddDate(0, 0, 1).Format("2006-01-02")
+	moved, err := UpdateEventDay(db, dayID, day.Label, later)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(moved) != 1 || moved[0].SessionID != sessionID || !moved[0].NewStart.Equal(startAt.AddDate(0, 0, 1)) {
+		t.Errorf("moved = %+v", moved)
+	}
+}
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// InstructorSession is one session on an instructor's portal page
+type InstructorSession struct {
+	SessionID  int
+	ClassID    int
+	ClassName  string
+	RoomNumber string
+	RoomName   string
+	DayLabel   string
+	StartAt    time.Time
+	EndAt      time.Time
+	Capacity   int
+	Enrolled   int
+	Waitlisted int
+}
+
+// GetInstructorSessions lists the sessions of every class an instructor
+// teaches in the active edition
+func GetInstructorSessions(db *sql.DB, instructorID int) ([]InstructorSession, error) {
+	rows, err := db.Query(`
+		SELECT
+			s.session_id, c.class_id, c.class_name, c.room_number, c.room_name,
+			d.label, s.start_at, s.end_at, s.capacity, s.current_enrolled_count,
+			(SELECT COUNT(*) FROM session_enrollments e
+			 WHERE e.session_id = s.session_id AND e.status = $2)
+		FROM class_instructors ci
+		JOIN classes c ON c.class_id = ci.class_id
+		JOIN class_sessions s ON s.class_id = c.class_id
+		JOIN event_days d ON d.day_id = s.day_id
+		WHERE ci.instructor_id = $1 AND c.edition_id = `+activeEditionID+`
+		ORDER BY s.start_at, c.class_name
+	`, instructorID, StatusWaitlisted)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var list []InstructorSession
+	for rows.Next() {
+		var s InstructorSession
+		if err := rows.Scan(
+			&s.SessionID, &s.ClassID, &s.ClassName, &s.RoomNumber, &s.RoomName,
+			&s.DayLabel, &s.StartAt, &s.EndAt, &s.Capacity, &s.Enrolled, &s.Waitlisted,
+		); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, nil
+}
+
+// GetInstructorName returns the display name of an instructor
+func GetInstructorName(db *sql.DB, instructorID int) (string, error) {
+	var name string
+	err := db.QueryRow("SELECT name FROM instructors WHERE instructor_id = $1", instructorID).Scan(&name)
+	return name, err
+}
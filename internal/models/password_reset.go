@@ -0,0 +1,73 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInvalidResetToken = errors.New("password reset token is invalid, used or expired")
+
+// CreatePasswordResetToken stores the hash of a newly issued reset token
+func CreatePasswordResetToken(db *sql.DB, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO password_reset_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	return err
+}
+
+// CountPasswordResetsSince counts reset tokens issued to a user since a given time
+func CountPasswordResetsSince(db *sql.DB, userID int, since time.Time) (int, error) {
+	var n int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM password_reset_tokens
+		WHERE user_id = $1 AND created_at >= $2
+	`, userID, since).Scan(&n)
+	return n, err
+}
+
+// IsPasswordResetTokenValid reports whether a token can still be used
+func IsPasswordResetTokenValid(db *sql.DB, tokenHash string) (bool, error) {
+	var ok bool
+	err := db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM password_reset_tokens
+			WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		)
+	`, tokenHash).Scan(&ok)
+	return ok, err
+}
+
+// ResetPasswordWithToken sets a new password hash for the token's owner.
+// The token is single-use: it and every other outstanding token for the
+// same user are marked used in the same transaction.
+func ResetPasswordWithToken(db *sql.DB, tokenHash, newPasswordHash string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	var userID int
+	err = tx.QueryRow(`
+		SELECT user_id FROM password_reset_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidResetToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET password_hash = $1 WHERE id = $2", newPasswordHash, userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE password_reset_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
@@ -0,0 +1,11 @@
+package models
+
+import "database/sql"
+
+// Querier is satisfied by both *sql.DB and *sql.Tx, so helpers can run
+// either standalone or inside a caller's transaction.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
@@ -18,28 +18,35 @@ type ClassStatusReport struct {
 
 // 2. Struct for Applicants (CSV Export)
 type ApplicantReport struct {
-	UserID       int
-	StudentName  string
-	GuardianName string
-	SchoolName   string
-	Grade        string
-	Email        string
-	RegDate      time.Time
-	ClassName    string
-	SessionTime  string
+	UserID             int
+	StudentName        string
+	GuardianName       string
+	SchoolName         string
+	Grade              string
+	Email              string
+	StudentKana        string
+	Phone              string
+	GuardianCount      int
+	AccessibilityNeeds string
+	RegDate            time.Time
+	ClassName          string
+	SessionTime        string
 }
 
-// GetClassStatusReport fetches data for the "Live Monitor" and Class Info CSV
-func GetClassStatusReport(db *sql.DB, classID int, sessionID int) ([]ClassStatusReport, error) {
+// GetClassStatusReport fetches data for the "Live Monitor" and Class Info CSV.
+// editionID > 0 limits it to one edition, instructorID > 0 to that
+// instructor's classes.
+func GetClassStatusReport(db *sql.DB, editionID int, classID int, sessionID int, instructorID int) ([]ClassStatusReport, error) {
 	query := `
 		SELECT 
 			c.class_name, 
-			s.day_sequence, s.start_at, s.end_at, 
+			d.label, s.start_at, s.end_at, 
 			s.capacity, COALESCE(s.current_enrolled_count, 0),
 			c.room_name,
 			COALESCE(string_agg(i.name, ', '), '') as instructors
 		FROM classes c
 		JOIN class_sessions s ON c.class_id = s.class_id
+		JOIN event_days d ON d.day_id = s.day_id
 		LEFT JOIN class_instructors ci ON c.class_id = ci.class_id
 		LEFT JOIN instructors i ON ci.instructor_id = i.instructor_id
 		WHERE 1=1
@@ -49,6 +56,12 @@ func GetClassStatusReport(db *sql.DB, classID int, sessionID int) ([]ClassStatus
 	var args []any
 	argCounter := 1
 
+	if editionID > 0 {
+		query += fmt.Sprintf(" AND c.edition_id = $%d", argCounter)
+		args = append(args, editionID)
+		argCounter++
+	}
+
 	if classID > 0 {
 		query += fmt.Sprintf(" AND c.class_id = $%d", argCounter)
 		args = append(args, classID)
@@ -61,10 +74,16 @@ func GetClassStatusReport(db *sql.DB, classID int, sessionID int) ([]ClassStatus
 		argCounter++
 	}
 
+	if instructorID > 0 {
+		query += fmt.Sprintf(" AND c.class_id IN (SELECT class_id FROM class_instructors WHERE instructor_id = $%d)", argCounter)
+		args = append(args, instructorID)
+		argCounter++
+	}
+
 	query += `
 		GROUP BY 
 			c.class_id, c.class_name, c.room_name, 
-			s.session_id, s.day_sequence, s.start_at, s.end_at, s.capacity, s.current_enrolled_count
+			s.session_id, d.label, s.start_at, s.end_at, s.capacity, s.current_enrolled_count
 		ORDER BY c.class_id, s.start_at
 	`
 
@@ -75,40 +94,50 @@ func GetClassStatusReport(db *sql.DB, classID int, sessionID int) ([]ClassStatus
 	var reports []ClassStatusReport
 	for rows.Next() {
 		var r ClassStatusReport
-		var daySeq int
+		var day string
 		var start, end time.Time
 		
 		err := rows.Scan(
-			&r.ClassName, &daySeq, &start, &end, 
+			&r.ClassName, &day, &start, &end, 
 			&r.Capacity, &r.Count, &r.RoomName, &r.Instructors,
 		)
 		if err != nil { return nil, err }
 
-		r.SessionTime = fmt.Sprintf("Day %d %s~%s", daySeq, start.Format("15:04"), end.Format("15:04"))
+		r.SessionTime = fmt.Sprintf("%s %s~%s", day, start.Format("15:04"), end.Format("15:04"))
 		reports = append(reports, r)
 	}
 	return reports, nil
 }
-// GetApplicantsReport fetches the main list for CSV Export
-func GetApplicantsReport(db *sql.DB, classID int, sessionID int) ([]ApplicantReport, error) {
+// GetApplicantsReport fetches the main list for CSV Export.
+// editionID > 0 limits it to one edition, instructorID > 0 to that
+// instructor's classes.
+func GetApplicantsReport(db *sql.DB, editionID int, classID int, sessionID int, instructorID int) ([]ApplicantReport, error) {
 	// Base Query
 	query := `
 		SELECT 
 			u.id, u.email, e.registered_at,
 			up.student_name, up.guardian_name, up.school_name, up.grade,
-			c.class_name, s.day_sequence, s.start_at, s.end_at
+			up.student_kana, up.phone, up.guardian_count, up.accessibility_needs,
+			c.class_name, d.label, s.start_at, s.end_at
 		FROM session_enrollments e
 		JOIN user_profiles up ON e.user_profile_id = up.id
 		JOIN users u ON up.user_id = u.id
 		JOIN class_sessions s ON e.session_id = s.session_id
+		JOIN event_days d ON d.day_id = s.day_id
 		JOIN classes c ON s.class_id = c.class_id
-		WHERE 1=1 
+		WHERE e.status = 'confirmed'
 	`
 	
 	// Dynamic Filtering
 	var args []any
 	argCounter := 1
 
+	if editionID > 0 {
+		query += fmt.Sprintf(" AND c.edition_id = $%d", argCounter)
+		args = append(args, editionID)
+		argCounter++
+	}
+
 	if classID > 0 {
 		query += fmt.Sprintf(" AND c.class_id = $%d", argCounter)
 		args = append(args, classID)
@@ -121,6 +150,12 @@ func GetApplicantsReport(db *sql.DB, classID int, sessionID int) ([]ApplicantRep
 		argCounter++
 	}
 
+	if instructorID > 0 {
+		query += fmt.Sprintf(" AND c.class_id IN (SELECT class_id FROM class_instructors WHERE instructor_id = $%d)", argCounter)
+		args = append(args, instructorID)
+		argCounter++
+	}
+
 	query += ` ORDER BY s.start_at, u.id`
 
 	rows, err := db.Query(query, args...)
@@ -130,19 +165,20 @@ func GetApplicantsReport(db *sql.DB, classID int, sessionID int) ([]ApplicantRep
 	var reports []ApplicantReport
 	for rows.Next() {
 		var r ApplicantReport
-		var daySeq int
+		var day string
 		var start, end time.Time
 		var createdAt time.Time
 
 		err := rows.Scan(
 			&r.UserID, &r.Email, &createdAt,
 			&r.StudentName, &r.GuardianName, &r.SchoolName, &r.Grade,
-			&r.ClassName, &daySeq, &start, &end,
+			&r.StudentKana, &r.Phone, &r.GuardianCount, &r.AccessibilityNeeds,
+			&r.ClassName, &day, &start, &end,
 		)
 		if err != nil { return nil, err }
 
 		r.RegDate = createdAt
-		r.SessionTime = fmt.Sprintf("Day %d %s-%s", daySeq, start.Format("15:04"), end.Format("15:04"))
+		r.SessionTime = fmt.Sprintf("%s %s-%s", day, start.Format("15:04"), end.Format("15:04"))
 		reports = append(reports, r)
 	}
 	return reports, nil
@@ -155,23 +191,27 @@ type SessionOption struct {
     DisplayName string
 }
 
-func GetAllSessionsForDropdown(db *sql.DB) ([]SessionOption, error) {
+// GetAllSessionsForDropdown lists the sessions of one edition
+func GetAllSessionsForDropdown(db *sql.DB, editionID int) ([]SessionOption, error) {
     query := `
-        SELECT s.session_id, s.class_id, s.day_sequence, s.start_at, s.end_at
+        SELECT s.session_id, s.class_id, d.label, s.start_at, s.end_at
         FROM class_sessions s
+        JOIN classes c ON c.class_id = s.class_id
+        JOIN event_days d ON d.day_id = s.day_id
+        WHERE c.edition_id = $1
         ORDER BY s.class_id, s.start_at
     `
-    rows, err := db.Query(query)
+    rows, err := db.Query(query, editionID)
     if err != nil { return nil, err }
     defer rows.Close()
 
     var opts []SessionOption
     for rows.Next() {
         var s SessionOption
-        var day int
+        var day string
         var start, end time.Time
         rows.Scan(&s.ID, &s.ClassID, &day, &start, &end)
-        s.DisplayName = fmt.Sprintf("Day %d %s-%s", day, start.Format("15:04"), end.Format("15:04"))
+        s.DisplayName = fmt.Sprintf("%s %s-%s", day, start.Format("15:04"), end.Format("15:04"))
         opts = append(opts, s)
     }
     return opts, nil
@@ -0,0 +1,252 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Grades are the grade values a student profile can carry (中学1〜3年生)
+var Grades = []string{"1", "2", "3"}
+
+// Rule identifiers reported in a RuleViolation
+const (
+	RuleMaxPerDay = "max_per_day"
+	RuleMaxTotal  = "max_total"
+	RuleNoOverlap = "no_overlap"
+)
+
+// EnrollmentRules are the limits a student's enrollments must stay within.
+// They are stored as JSON under the 'enrollment_rules' key of system_settings
+// and edited from /admin/config. A limit of 0 means "no limit".
+type EnrollmentRules struct {
+	MaxPerDay     int                   `json:"max_per_day"`
+	MaxTotal      int                   `json:"max_total"`
+	ForbidOverlap bool                  `json:"forbid_overlap"`
+	GradeLimits   map[string]GradeLimit `json:"grade_limits,omitempty"` // keyed by user_profiles.grade
+}
+
+// GradeLimit overrides the default limits for one grade. 0 means "use the default".
+type GradeLimit struct {
+	MaxPerDay int `json:"max_per_day"`
+	MaxTotal  int `json:"max_total"`
+}
+
+// DefaultEnrollmentRules are the original "2 per day, 3 total" rules,
+// plus the no-overlap rule the application page always promised
+func DefaultEnrollmentRules() EnrollmentRules {
+	return EnrollmentRules{MaxPerDay: 2, MaxTotal: 3, ForbidOverlap: true}
+}
+
+// Overlaps reports whether two [start, end) time ranges intersect.
+// Back-to-back sessions (one ends as the next starts) don't overlap.
+func Overlaps(aStart, aEnd, bStart, bEnd time.Time) bool {
+	return aStart.Before(bEnd) && bStart.Before(aEnd)
+}
+
+// LimitsFor returns the per-day and total limits that apply to a grade
+func (r EnrollmentRules) LimitsFor(grade string) (perDay, total int) {
+	perDay, total = r.MaxPerDay, r.MaxTotal
+	if gl, ok := r.GradeLimits[grade]; ok {
+		if gl.MaxPerDay > 0 {
+			perDay = gl.MaxPerDay
+		}
+		if gl.MaxTotal > 0 {
+			total = gl.MaxTotal
+		}
+	}
+	return perDay, total
+}
+
+// Describe lists the rules that apply to a grade as sentences for the application page
+func (r EnrollmentRules) Describe(grade string) []string {
+	perDay, total := r.LimitsFor(grade)
+	var lines []string
+	if r.ForbidOverlap {
+		lines = append(lines, "同時間帯の他の授業と重複して申し込むことはできません")
+	}
+	if total > 0 {
+		lines = append(lines, fmt.Sprintf("申し込み可能数は全体で最大%d件までです", total))
+	}
+	if perDay > 0 {
+		lines = append(lines, fmt.Sprintf("1日あたりの参加可能数は最大%d件までです", perDay))
+	}
+	return lines
+}
+
+// RuleViolation is returned by CheckEnrollmentLimits when an enrollment would
+// break one of the configured rules. It carries enough detail to tell the
+// student which rule failed.
+type RuleViolation struct {
+	Rule  string // RuleMaxPerDay, RuleMaxTotal or RuleNoOverlap
+	Limit int
+	Grade string // set when a per-grade override produced the limit
+
+	// For RuleNoOverlap: the already-enrolled session that clashes
+	ConflictClass   string
+	ConflictStartAt time.Time
+	ConflictEndAt   time.Time
+}
+
+func (v *RuleViolation) Error() string {
+	return fmt.Sprintf("enrollment rule %s violated (limit %d)", v.Rule, v.Limit)
+}
+
+// Is lets callers keep matching the original sentinel errors with errors.Is
+func (v *RuleViolation) Is(target error) bool {
+	switch v.Rule {
+	case RuleMaxPerDay:
+		return target == ErrDayLimitExceeded
+	case RuleMaxTotal:
+		return target == ErrTotalLimitExceeded
+	case RuleNoOverlap:
+		return target == ErrTimeConflict
+	}
+	return false
+}
+
+// Message is the student-facing (Japanese) explanation of the failed rule
+func (v *RuleViolation) Message() string {
+	who := ""
+	if v.Grade != "" {
+		who = fmt.Sprintf("中学%s年生が", v.Grade)
+	}
+	switch v.Rule {
+	case RuleMaxPerDay:
+		return fmt.Sprintf("申込数の上限を超えています。%s同じ日に申し込める授業は%dつまでです。", who, v.Limit)
+	case RuleMaxTotal:
+		return fmt.Sprintf("申込数の上限を超えています。%s申し込める授業は全体で%dつまでです。", who, v.Limit)
+	case RuleNoOverlap:
+		if v.ConflictClass != "" {
+			return fmt.Sprintf("「%s」(%s〜%s) と時間が重複しているため申し込めません。",
+				v.ConflictClass, v.ConflictStartAt.Format("01月02日 15:04"), v.ConflictEndAt.Format("15:04"))
+		}
+		return "同じ時間帯の授業に既に申し込んでいます。時間が重なる授業には申し込めません。"
+	}
+	return "申込条件を満たしていません。"
+}
+
+// GetEnrollmentRules loads the rules, or the defaults if none were saved
+func GetEnrollmentRules(q Querier) (EnrollmentRules, error) {
+	var raw string
+	err := q.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key='enrollment_rules'").Scan(&raw)
+	if err == sql.ErrNoRows {
+		return DefaultEnrollmentRules(), nil
+	}
+	if err != nil {
+		return DefaultEnrollmentRules(), err
+	}
+	var rules EnrollmentRules
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return DefaultEnrollmentRules(), fmt.Errorf("parse enrollment_rules: %w", err)
+	}
+	return rules, nil
+}
+
+// UpdateEnrollmentRules saves the rules, replacing the stored ones
+func UpdateEnrollmentRules(db Querier, rules EnrollmentRules) error {
+	raw, err := json.Marshal(rules)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+		INSERT INTO system_settings (setting_key, setting_value)
+		VALUES ('enrollment_rules', $1)
+		ON CONFLICT (setting_key)
+		DO UPDATE SET setting_value = EXCLUDED.setting_value
+	`, string(raw))
+	return err
+}
+
+// CheckEnrollmentLimits verifies that enrolling the user in newSessionID keeps
+// them within the configured EnrollmentRules. It returns a *RuleViolation
+// naming the failed rule. Only confirmed seats count; waitlist entries don't
+// use up the allowance.
+func CheckEnrollmentLimits(db Querier, userID, newSessionID int) error {
+	rules, err := GetEnrollmentRules(db)
+	if err != nil {
+		return err
+	}
+
+	// The session the user wants to enroll in
+	var newDayID int
+	var newStart, newEnd time.Time
+	err = db.QueryRow(`
+		SELECT day_id, start_at, end_at
+		FROM class_sessions
+		WHERE session_id = $1
+	`, newSessionID).Scan(&newDayID, &newStart, &newEnd)
+	if err != nil {
+		return err
+	}
+
+	var grade string
+	err = db.QueryRow("SELECT grade FROM user_profiles WHERE user_id = $1", userID).Scan(&grade)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+
+	// The user's current confirmed enrollments in the same edition
+	rows, err := db.Query(`
+		SELECT cs.day_id, cs.start_at, cs.end_at, c.class_name
+		FROM session_enrollments se
+		JOIN class_sessions cs ON se.session_id = cs.session_id
+		JOIN classes c ON cs.class_id = c.class_id
+		JOIN user_profiles up ON se.user_profile_id = up.id
+		WHERE up.user_id = $1 AND se.status = 'confirmed' AND se.session_id <> $2
+		  AND c.edition_id = (
+			SELECT c2.edition_id FROM class_sessions s2
+			JOIN classes c2 ON c2.class_id = s2.class_id
+			WHERE s2.session_id = $2
+		  )
+		ORDER BY cs.start_at
+	`, userID, newSessionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	dayCounts := make(map[int]int)
+	totalCount := 0
+	var conflict *RuleViolation
+
+	for rows.Next() {
+		var dayID int
+		var start, end time.Time
+		var className string
+		if err := rows.Scan(&dayID, &start, &end, &className); err != nil {
+			return err
+		}
+		dayCounts[dayID]++
+		totalCount++
+		if conflict == nil && Overlaps(start, end, newStart, newEnd) {
+			conflict = &RuleViolation{
+				Rule:            RuleNoOverlap,
+				ConflictClass:   className,
+				ConflictStartAt: start,
+				ConflictEndAt:   end,
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	perDay, total := rules.LimitsFor(grade)
+	gradeTag := ""
+	if _, ok := rules.GradeLimits[grade]; ok {
+		gradeTag = grade
+	}
+
+	if rules.ForbidOverlap && conflict != nil {
+		return conflict
+	}
+	if total > 0 && totalCount >= total {
+		return &RuleViolation{Rule: RuleMaxTotal, Limit: total, Grade: gradeTag}
+	}
+	if perDay > 0 && dayCounts[newDayID] >= perDay {
+		return &RuleViolation{Rule: RuleMaxPerDay, Limit: perDay, Grade: gradeTag}
+	}
+	return nil
+}
@@ -2,13 +2,19 @@ package models
 
 import (
 	"database/sql"
+	"errors"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+var ErrCapacityBelowEnrollment = errors.New("capacity cannot be lower than the current enrollment count")
+
 type Session struct {
 	ID                   int
 	ClassID              int
-	DaySequence          int       // 1 or 2
+	DayID                int
+	DayLabel             string // e.g. "1日目"; read-only, from event_days
 	StartAt              time.Time
 	EndAt                time.Time
 	Capacity             int
@@ -17,58 +23,159 @@ type Session struct {
 type SessionDetail struct {
 	SessionID            int
 	ClassName            string
+	ClassDescription     string // Markdown
+	ClassCategory        string
+	ClassPrerequisites   string
+	ClassImage           string
+	TargetGrades         []string
 	RoomNumber           string
 	RoomName             string
 	TeacherName          string // Simplified for display
 	SyllabusPDF          string
+	SyllabusThumb        string
+	SyllabusExcerpt      string
 	StartAt              time.Time
 	EndAt                time.Time
 	Capacity             int
 	CurrentEnrolledCount int
 	RemainingSeats       int 
+	RegistrationStartAt  time.Time
+	RegistrationEndAt    time.Time
 }
 
-// CreateSession inserts one specific time slot
-func CreateSession(db *sql.DB, s Session) error {
-	_, err := db.Exec(`
+// RegistrationStateAt reports whether the session's class is taking registrations at `now`
+func (s SessionDetail) RegistrationStateAt(now time.Time) RegistrationState {
+	return Class{RegistrationStartAt: s.RegistrationStartAt, RegistrationEndAt: s.RegistrationEndAt}.RegistrationStateAt(now)
+}
+
+// GradesLabel describes the grades the session's class is meant for
+func (s SessionDetail) GradesLabel() string {
+	return Class{TargetGrades: s.TargetGrades}.GradesLabel()
+}
+
+// ForGrade reports whether the session's class is meant for a student of grade
+func (s SessionDetail) ForGrade(grade string) bool {
+	return Class{TargetGrades: s.TargetGrades}.ForGrade(grade)
+}
+
+// CreateSession inserts one specific time slot and returns its ID
+func CreateSession(db *sql.DB, s Session) (int, error) {
+	var id int
+	err := db.QueryRow(`
 		INSERT INTO class_sessions (
-			class_id, day_sequence, start_at, end_at, capacity, current_enrolled_count
+			class_id, day_id, start_at, end_at, capacity, current_enrolled_count
 		)
 		VALUES ($1, $2, $3, $4, $5, 0)
+		RETURNING session_id
 	`, 
-		s.ClassID, s.DaySequence, s.StartAt, s.EndAt, s.Capacity,
-	)
-	return err
+		s.ClassID, s.DayID, s.StartAt, s.EndAt, s.Capacity,
+	).Scan(&id)
+	return id, err
+}
+
+// GetSessionByID fetches one session
+func GetSessionByID(db *sql.DB, id int) (*Session, error) {
+	s := &Session{}
+	err := db.QueryRow(`
+		SELECT s.session_id, s.class_id, s.day_id, d.label, s.start_at, s.end_at, s.capacity, s.current_enrolled_count
+		FROM class_sessions s
+		JOIN event_days d ON d.day_id = s.day_id
+		WHERE s.session_id = $1
+	`, id).Scan(&s.ID, &s.ClassID, &s.DayID, &s.DayLabel, &s.StartAt, &s.EndAt, &s.Capacity, &s.CurrentEnrolledCount)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// UpdateSession changes a session's day, times and capacity.
+// The capacity may not drop below the number of students already enrolled.
+func UpdateSession(db *sql.DB, s Session) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	// Lock the row so no enrollment sneaks in between the check and the update
+	var current int
+	err = tx.QueryRow("SELECT current_enrolled_count FROM class_sessions WHERE session_id = $1 FOR UPDATE", s.ID).Scan(&current)
+	if err != nil {
+		return err
+	}
+	if s.Capacity < current {
+		return ErrCapacityBelowEnrollment
+	}
+
+	_, err = tx.Exec(`
+		UPDATE class_sessions
+		SET day_id = $2, start_at = $3, end_at = $4, capacity = $5
+		WHERE session_id = $1
+	`, s.ID, s.DayID, s.StartAt, s.EndAt, s.Capacity)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteSession removes a session; its enrollments go with it (ON DELETE CASCADE)
+func DeleteSession(db *sql.DB, id int) error {
+	res, err := db.Exec("DELETE FROM class_sessions WHERE session_id = $1", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
 }
 
 func GetSessionsByClassID(db *sql.DB, classID int) ([]Session, error) {
+	return FindClassSessions(db, classID, ClassFilter{})
+}
+
+// FindClassSessions returns the sessions of a class that pass the session
+// conditions of f (day, time range, free seats), in start order
+func FindClassSessions(db *sql.DB, classID int, f ClassFilter) ([]Session, error) {
+	sessions, err := FindSessions(db, []int{classID}, f)
+	return sessions[classID], err
+}
+
+// FindSessions is FindClassSessions for many classes in one query. The
+// sessions are keyed by class ID; classes without a match are missing.
+func FindSessions(db *sql.DB, classIDs []int, f ClassFilter) (map[int][]Session, error) {
+	args := []any{pq.Array(classIDs)}
 	rows, err := db.Query(`
-		SELECT session_id, day_sequence, start_at, end_at, capacity, current_enrolled_count
-		FROM class_sessions 
-		WHERE class_id = $1 
-		ORDER BY start_at ASC
-	`, classID)
+		SELECT s.session_id, s.class_id, s.day_id, d.label, s.start_at, s.end_at, s.capacity, s.current_enrolled_count
+		FROM class_sessions s
+		JOIN event_days d ON d.day_id = s.day_id
+		WHERE s.class_id = ANY($1) AND `+f.sessionConds(&args)+`
+		ORDER BY s.start_at ASC, s.session_id ASC
+	`, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	var sessions []Session
+	sessions := make(map[int][]Session)
 	for rows.Next() {
 		var s Session
-		if err := rows.Scan(&s.ID, &s.DaySequence, &s.StartAt, &s.EndAt, &s.Capacity, &s.CurrentEnrolledCount); err != nil {
+		if err := rows.Scan(&s.ID, &s.ClassID, &s.DayID, &s.DayLabel, &s.StartAt, &s.EndAt, &s.Capacity, &s.CurrentEnrolledCount); err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, s)
+		sessions[s.ClassID] = append(sessions[s.ClassID], s)
 	}
-	return sessions, nil
+	return sessions, rows.Err()
 }
 func GetSessionDetail(db *sql.DB, sessionID int) (*SessionDetail, error) {
 	// Join Sessions with Classes to get the full picture
 	query := `
 		SELECT 
-			cs.session_id, c.class_name, c.room_number, c.room_name, c.syllabus_pdf_url,
+			cs.session_id, c.class_name, c.description, c.room_number, c.room_name, c.syllabus_pdf_url,
+			COALESCE(c.syllabus_thumb, ''), COALESCE(c.syllabus_excerpt, ''),
+			c.category, c.prerequisites, c.image_url, c.target_grades,
 			cs.start_at, cs.end_at, cs.capacity, cs.current_enrolled_count,
+			c.registration_start_at, c.registration_end_at,
             COALESCE(string_agg(i.name, ', '), '') as teachers
 		FROM class_sessions cs
 		JOIN classes c ON cs.class_id = c.class_id
@@ -79,8 +186,11 @@ func GetSessionDetail(db *sql.DB, sessionID int) (*SessionDetail, error) {
 	`
 	var s SessionDetail
 	err := db.QueryRow(query, sessionID).Scan(
-		&s.SessionID, &s.ClassName, &s.RoomNumber, &s.RoomName, &s.SyllabusPDF,
-		&s.StartAt, &s.EndAt, &s.Capacity, &s.CurrentEnrolledCount, &s.TeacherName,
+		&s.SessionID, &s.ClassName, &s.ClassDescription, &s.RoomNumber, &s.RoomName, &s.SyllabusPDF,
+		&s.SyllabusThumb, &s.SyllabusExcerpt,
+		&s.ClassCategory, &s.ClassPrerequisites, &s.ClassImage, pq.Array(&s.TargetGrades),
+		&s.StartAt, &s.EndAt, &s.Capacity, &s.CurrentEnrolledCount,
+		&s.RegistrationStartAt, &s.RegistrationEndAt, &s.TeacherName,
 	)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+func TestFindSessions(t *testing.T) {
+	db := dbtest.Open(t)
+	full := seedSession(t, db, 1)
+	open := seedSession(t, db, 5)
+	classOf := func(sessionID int) int {
+		t.Helper()
+		var id int
+		if err := db.QueryRow("SELECT class_id FROM class_sessions WHERE session_id = $1", sessionID).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	fullClass, openClass := classOf(full), classOf(open)
+
+	// A second, earlier session of the open class
+	var early int
+	err := db.QueryRow(`
+		INSERT INTO class_sessions (class_id, day_id, start_at, end_at, capacity)
+		SELECT class_id, day_id, start_at - interval '2 hours', end_at - interval '2 hours', 5
+		FROM class_sessions WHERE session_id = $1
+		RETURNING session_id
+	`, open).Scan(&early)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := EnrollUser(db, full, seedStudents(t, db, 1)[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := FindSessions(db, []int{fullClass, openClass}, ClassFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got[fullClass]) != 1 || got[fullClass][0].ID != full || got[fullClass][0].CurrentEnrolledCount != 1 {
+		t.Errorf("sessions of the full class = %+v", got[fullClass])
+	}
+	if o := got[openClass]; len(o) != 2 || o[0].ID != early || o[1].ID != open || o[0].ClassID != openClass {
+		t.Errorf("sessions of the open class = %+v, want %d then %d", o, early, open)
+	}
+
+	// Session conditions apply to every class
+	got, err = FindSessions(db, []int{fullClass, openClass}, ClassFilter{Available: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got[fullClass]; ok || len(got[openClass]) != 2 {
+		t.Errorf("available sessions = %+v", got)
+	}
+
+	// FindClassSessions agrees
+	one, err := FindClassSessions(db, openClass, ClassFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(one) != 2 || !one[0].StartAt.Equal(one[1].StartAt.Add(-2*time.Hour)) {
+		t.Errorf("FindClassSessions = %+v", one)
+	}
+	if none, err := FindSessions(db, nil, ClassFilter{}); err != nil || len(none) != 0 {
+		t.Errorf("FindSessions(nil) = %v, %v", none, err)
+	}
+}
+
+func TestUpdateSessionCapacity(t *testing.T) {
+	// Two of five seats are taken
+	tests := []struct {
+		capacity int
+		err      error
+	}{
+		{1, ErrCapacityBelowEnrollment},
+		{2, nil},
+		{3, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.capacity), func(t *testing.T) {
+			db := dbtest.Open(t)
+			sessionID := seedSession(t, db, 5)
+			for _, u := range seedStudents(t, db, 2) {
+				if err := EnrollUser(db, sessionID, u); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s, err := GetSessionByID(db, sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s.Capacity = tt.capacity
+			if err := UpdateSession(db, *s); err != tt.err {
+				t.Fatalf("UpdateSession = %v, want %v", err, tt.err)
+			}
+			want := tt.capacity
+			if tt.err != nil {
+				want = 5 // unchanged
+			}
+			got, err := GetSessionByID(db, sessionID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Capacity != want || got.CurrentEnrolledCount != 2 {
+				t.Errorf("capacity %d with %d enrolled, want %d with 2", got.Capacity, got.CurrentEnrolledCount, want)
+			}
+		})
+	}
+}
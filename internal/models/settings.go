@@ -2,33 +2,54 @@ package models
 
 import (
 	"database/sql"
+	"strconv"
+	"time"
 )
 
-type EventDates struct {
-	Day1 string // Format: "YYYY-MM-DD"
-	Day2 string
+// EventLocation is the time zone the event runs in. Dates and times typed
+// into admin forms (which carry no zone) are interpreted in this location.
+var EventLocation = loadEventLocation()
+
+func loadEventLocation() *time.Location {
+	loc, err := time.LoadLocation("Asia/Tokyo")
+	if err != nil {
+		// tzdata missing (e.g. minimal container image): Japan has no DST
+		return time.FixedZone("JST", 9*60*60)
+	}
+	return loc
 }
 
-func GetEventDates(db *sql.DB) (EventDates, error) {
-	dates := EventDates{}
-	
-	// We fetch both in one go, or individual queries. 
-	// Simple separate queries for clarity:
-	err := db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key='event_date_1'").Scan(&dates.Day1)
-	if err != nil { return dates, err }
+// DefaultCancelDeadlineHours is used when no deadline has been configured
+const DefaultCancelDeadlineHours = 24
+
+// GetCancelDeadline returns how long before a session starts cancellation closes
+func GetCancelDeadline(db *sql.DB) (time.Duration, error) {
+	hours, err := GetCancelDeadlineHours(db)
+	return time.Duration(hours) * time.Hour, err
+}
 
-	err = db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key='event_date_2'").Scan(&dates.Day2)
-	// Day 2 might be empty (optional), so we ignore error if needed, 
-    // but for now let's assume it exists.
-	return dates, nil
+func GetCancelDeadlineHours(db *sql.DB) (int, error) {
+	var v string
+	err := db.QueryRow("SELECT setting_value FROM system_settings WHERE setting_key='cancel_deadline_hours'").Scan(&v)
+	if err == sql.ErrNoRows {
+		return DefaultCancelDeadlineHours, nil
+	}
+	if err != nil {
+		return DefaultCancelDeadlineHours, err
+	}
+	hours, err := strconv.Atoi(v)
+	if err != nil || hours < 0 {
+		return DefaultCancelDeadlineHours, nil
+	}
+	return hours, nil
 }
 
-func UpdateEventDates(db *sql.DB, d1, d2 string) error {
+func UpdateCancelDeadlineHours(db Querier, hours int) error {
 	_, err := db.Exec(`
-		INSERT INTO system_settings (setting_key, setting_value) 
-		VALUES ('event_date_1', $1), ('event_date_2', $2)
-		ON CONFLICT (setting_key) 
+		INSERT INTO system_settings (setting_key, setting_value)
+		VALUES ('cancel_deadline_hours', $1)
+		ON CONFLICT (setting_key)
 		DO UPDATE SET setting_value = EXCLUDED.setting_value
-	`, d1, d2)
+	`, strconv.Itoa(hours))
 	return err
 }
@@ -3,6 +3,7 @@ package models
 import (
 	"database/sql"
 	"errors"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -15,19 +16,46 @@ type User struct {
 }
 
 type UserProfile struct {
-    ID           int
-    UserID       int
-    StudentName  sql.NullString
-    SchoolName   sql.NullString
-    Grade        sql.NullString
-    GuardianName sql.NullString
+    ID                 int
+    UserID             int
+    StudentName        sql.NullString
+    SchoolName         sql.NullString
+    Grade              sql.NullString
+    GuardianName       sql.NullString
+    StudentKana        string
+    Phone              string
+    GuardianCount      int
+    AccessibilityNeeds string
+}
+
+// MaxAccompanyingGuardians is how many guardians may come with one student
+const MaxAccompanyingGuardians = 2
+
+// StudentProfile is what a student enters at signup
+type StudentProfile struct {
+	StudentName        string
+	StudentKana        string // furigana of StudentName
+	SchoolName         string
+	Grade              string // one of Grades
+	GuardianName       string
+	Phone              string
+	GuardianCount      int    // guardians accompanying the student, 0..MaxAccompanyingGuardians
+	AccessibilityNeeds string // free text, empty if none
 }
 
 var ErrUserExists = errors.New("user already exists")
 
-func CreateUser(db *sql.DB, email, passwordHash string) (int, error) {
+// CreateStudent creates a student account and its profile in one
+// transaction, so a failure never leaves an account without a profile
+func CreateStudent(db *sql.DB, email, passwordHash string, p StudentProfile) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
 	var id int
-	err := db.QueryRow(
+	err = tx.QueryRow(
 		`INSERT INTO users (email, password_hash) VALUES ($1, $2) RETURNING id`,
 		email, passwordHash,
 	).Scan(&id)
@@ -38,15 +66,19 @@ func CreateUser(db *sql.DB, email, passwordHash string) (int, error) {
 		}
 		return 0, err
 	}
-	return id, nil
-}
 
-func CreateUserProfile(db *sql.DB, userID int, name, school, grade, guardian string) error {
-    _, err := db.Exec(`
-        INSERT INTO user_profiles (user_id, student_name, school_name, grade, guardian_name)
-        VALUES ($1, $2, $3, $4, $5)
-    `, userID, name, school, grade, guardian)
-    return err
+	_, err = tx.Exec(`
+		INSERT INTO user_profiles (
+			user_id, student_name, student_kana, school_name, grade, guardian_name,
+			phone, guardian_count, accessibility_needs
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+	`, id, p.StudentName, p.StudentKana, p.SchoolName, p.Grade, p.GuardianName,
+		p.Phone, p.GuardianCount, p.AccessibilityNeeds)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
 }
 
 func GetUserByEmail(db *sql.DB, email string) (*User, error) {
@@ -60,14 +92,29 @@ func GetUserByEmail(db *sql.DB, email string) (*User, error) {
 	}
 	return u, nil
 }
+
+func GetUserByID(db *sql.DB, id int) (*User, error) {
+	u := &User{}
+	err := db.QueryRow(
+		`SELECT id, email, password_hash, created_at FROM users WHERE id = $1`,
+		id,
+	).Scan(&u.ID, &u.Email, &u.PasswordHash, &u.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return u, nil
+}
+
 func GetUserProfile(db *sql.DB, userID int) (*UserProfile, error) {
     p := &UserProfile{}
     err := db.QueryRow(`
-        SELECT id, user_id, student_name, school_name, grade, guardian_name
+        SELECT id, user_id, student_name, school_name, grade, guardian_name,
+               student_kana, phone, guardian_count, accessibility_needs
         FROM user_profiles
         WHERE user_id = $1
         LIMIT 1
-    `, userID).Scan(&p.ID, &p.UserID, &p.StudentName, &p.SchoolName, &p.Grade, &p.GuardianName)
+    `, userID).Scan(&p.ID, &p.UserID, &p.StudentName, &p.SchoolName, &p.Grade, &p.GuardianName,
+        &p.StudentKana, &p.Phone, &p.GuardianCount, &p.AccessibilityNeeds)
     if err != nil {
         if err == sql.ErrNoRows {
             return nil, nil // no profile yet
@@ -76,3 +123,76 @@ func GetUserProfile(db *sql.DB, userID int) (*UserProfile, error) {
     }
     return p, nil
 }
+
+
+// UserSummary is one row of the admin user list
+type UserSummary struct {
+	ID            int
+	Email         string
+	StudentName   string
+	SchoolName    string
+	Grade         string
+	Role          string
+	InstructorID  int    // linked instructor for the instructor role, else 0
+	Instructor    string // that instructor's name
+	EmailVerified bool
+	CreatedAt     time.Time
+	Sessions      int // logins that haven't expired or been revoked
+}
+
+// ListUsers returns accounts, newest first.
+// unverifiedOnly restricts the list to accounts that haven't confirmed their email.
+func ListUsers(db *sql.DB, unverifiedOnly bool) ([]UserSummary, error) {
+	rows, err := db.Query(`
+		SELECT
+			u.id, u.email, COALESCE(up.student_name, ''), COALESCE(up.school_name, ''), COALESCE(up.grade, ''),
+			u.role, COALESCE(u.instructor_id, 0), COALESCE(i.name, ''),
+			u.email_verified_at IS NOT NULL, u.created_at,
+			(SELECT COUNT(*) FROM user_sessions s WHERE s.user_id = u.id AND s.expires_at > NOW())
+		FROM users u
+		LEFT JOIN user_profiles up ON up.user_id = u.id
+		LEFT JOIN instructors i ON i.instructor_id = u.instructor_id
+		WHERE NOT $1 OR u.email_verified_at IS NULL
+		ORDER BY u.created_at DESC, u.id DESC
+	`, unverifiedOnly)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []UserSummary
+	for rows.Next() {
+		var u UserSummary
+		if err := rows.Scan(&u.ID, &u.Email, &u.StudentName, &u.SchoolName, &u.Grade, &u.Role, &u.InstructorID, &u.Instructor, &u.EmailVerified, &u.CreatedAt, &u.Sessions); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// GetUserRole returns a user's role and, for instructors, their linked instructor (else 0)
+func GetUserRole(db *sql.DB, userID int) (string, int, error) {
+	var role string
+	var instructorID int
+	err := db.QueryRow(
+		"SELECT role, COALESCE(instructor_id, 0) FROM users WHERE id = $1", userID,
+	).Scan(&role, &instructorID)
+	return role, instructorID, err
+}
+
+// UpdateUserRole assigns a role. instructorID is only kept for the instructor role.
+func UpdateUserRole(db *sql.DB, userID int, role string, instructorID int) error {
+	var link any
+	if role == "instructor" && instructorID > 0 {
+		link = instructorID
+	}
+	res, err := db.Exec("UPDATE users SET role = $2, instructor_id = $3 WHERE id = $1", userID, role, link)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
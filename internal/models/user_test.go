@@ -0,0 +1,62 @@
+package models
+
+import (
+	"strings"
+	"testing"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+func TestCreateStudent(t *testing.T) {
+	valid := StudentProfile{StudentName: "高専 太郎", SchoolName: "第一中学校", Grade: "2", GuardianName: "高専 花子"}
+	tooManyGuardians := valid
+	tooManyGuardians.GuardianCount = MaxAccompanyingGuardians + 1
+	longPhone := valid
+	longPhone.Phone = strings.Repeat("0", 21)
+
+	// Each profile the database refuses must take the account with it
+	tests := []struct {
+		name    string
+		profile StudentProfile
+		ok      bool
+	}{
+		{"valid", valid, true},
+		{"guardian count out of range", tooManyGuardians, false},
+		{"phone too long", longPhone, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t)
+			const addr = "family@example.com"
+			id, err := CreateStudent(db, addr, "x", tt.profile)
+			if (err == nil) != tt.ok {
+				t.Fatalf("CreateStudent = %d, %v", id, err)
+			}
+
+			var users, profiles int
+			err = db.QueryRow(`
+				SELECT (SELECT COUNT(*) FROM users WHERE email = $1),
+				       (SELECT COUNT(*) FROM user_profiles p JOIN users u ON u.id = p.user_id WHERE u.email = $1)
+			`, addr).Scan(&users, &profiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := 0
+			if tt.ok {
+				want = 1
+			}
+			if users != want || profiles != want {
+				t.Fatalf("%d users and %d profiles left, want %d", users, profiles, want)
+			}
+
+			// The address is free again after a failure, and taken after a success
+			_, err = CreateStudent(db, addr, "x", valid)
+			if tt.ok && err != ErrUserExists {
+				t.Errorf("second signup = %v, want ErrUserExists", err)
+			}
+			if !tt.ok && err != nil {
+				t.Errorf("signup after a failed one = %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrInvalidVerificationToken = errors.New("email verification token is invalid, used or expired")
+
+// CreateEmailVerificationToken stores the hash of a newly issued verification token
+func CreateEmailVerificationToken(db *sql.DB, userID int, tokenHash string, expiresAt time.Time) error {
+	_, err := db.Exec(`
+		INSERT INTO email_verification_tokens (user_id, token_hash, expires_at)
+		VALUES ($1, $2, $3)
+	`, userID, tokenHash, expiresAt)
+	return err
+}
+
+// CountEmailVerificationsSince counts verification links sent to a user since a given time
+func CountEmailVerificationsSince(db *sql.DB, userID int, since time.Time) (int, error) {
+	var n int
+	err := db.QueryRow(`
+		SELECT COUNT(*) FROM email_verification_tokens
+		WHERE user_id = $1 AND created_at >= $2
+	`, userID, since).Scan(&n)
+	return n, err
+}
+
+// VerifyEmailWithToken marks the token's owner as verified and uses up their tokens
+func VerifyEmailWithToken(db *sql.DB, tokenHash string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	var userID int
+	err = tx.QueryRow(`
+		SELECT user_id FROM email_verification_tokens
+		WHERE token_hash = $1 AND used_at IS NULL AND expires_at > NOW()
+		FOR UPDATE
+	`, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1", userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE email_verification_tokens SET used_at = NOW() WHERE user_id = $1 AND used_at IS NULL", userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// MarkEmailVerified verifies an account without a token (admin action)
+func MarkEmailVerified(db *sql.DB, userID int) error {
+	_, err := db.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id = $1", userID)
+	return err
+}
+
+// IsEmailVerified reports whether the user has confirmed their address
+func IsEmailVerified(db *sql.DB, userID int) (bool, error) {
+	var verified bool
+	err := db.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id = $1", userID).Scan(&verified)
+	return verified, err
+}
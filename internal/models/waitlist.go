@@ -0,0 +1,310 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Enrollment statuses stored in session_enrollments.status
+const (
+	StatusConfirmed  = "confirmed"
+	StatusWaitlisted = "waitlisted"
+)
+
+var (
+	ErrAlreadyWaitlisted = errors.New("user is already on the waitlist for this session")
+	ErrSessionNotFull    = errors.New("class session still has free seats")
+)
+
+// Promotion is a waitlisted student who was moved into a freed seat
+type Promotion struct {
+	UserID    int
+	Email     string
+	SessionID int
+}
+
+// WaitlistReport is one row of the admin waitlist table
+type WaitlistReport struct {
+	Position    int
+	UserID      int
+	StudentName string
+	SchoolName  string
+	Email       string
+	ClassName   string
+	SessionTime string
+	RegDate     time.Time
+}
+
+// JoinWaitlist queues a student for a full session and returns their position
+func JoinWaitlist(db *sql.DB, sessionID, userID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	// 1. Only full sessions still taking registrations have a waitlist
+	var current, capacity int
+	var class Class
+	err = tx.QueryRow(`
+		SELECT cs.current_enrolled_count, cs.capacity, c.registration_start_at, c.registration_end_at,
+			c.edition_id <> `+activeEditionID+`, c.target_grades
+		FROM class_sessions cs
+		JOIN classes c ON cs.class_id = c.class_id
+		WHERE cs.session_id = $1
+		FOR UPDATE OF cs
+	`, sessionID).Scan(&current, &capacity, &class.RegistrationStartAt, &class.RegistrationEndAt, &class.Archived,
+		pq.Array(&class.TargetGrades))
+	if err != nil {
+		return 0, err
+	}
+	if err := checkRegistrationWindow(class, time.Now()); err != nil {
+		return 0, err
+	}
+	if current < capacity {
+		return 0, ErrSessionNotFull
+	}
+	var grade string
+	err = tx.QueryRow("SELECT grade FROM user_profiles WHERE user_id = $1", userID).Scan(&grade)
+	if err == sql.ErrNoRows {
+		return 0, ErrProfileNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+	if !class.ForGrade(grade) {
+		return 0, ErrWrongGrade
+	}
+
+	// 2. Insert the waitlist entry (the UNIQUE constraint covers both statuses)
+	var enrollmentID int
+	err = tx.QueryRow(`
+		INSERT INTO session_enrollments (session_id, user_profile_id, status)
+		SELECT $1, id, $3 FROM user_profiles WHERE user_id = $2
+		ON CONFLICT (session_id, user_profile_id) DO NOTHING
+		RETURNING enrollment_id
+	`, sessionID, userID, StatusWaitlisted).Scan(&enrollmentID)
+	if err == sql.ErrNoRows {
+		status, err := GetEnrollmentStatus(tx, sessionID, userID)
+		if err != nil {
+			return 0, err
+		}
+		if status == StatusWaitlisted {
+			return 0, ErrAlreadyWaitlisted
+		}
+		return 0, ErrAlreadyEnrolled
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	position, err := waitlistPosition(tx, enrollmentID)
+	if err != nil {
+		return 0, err
+	}
+	return position, tx.Commit()
+}
+
+// PromoteWaitlist fills free seats of a session from its waitlist, oldest first.
+// Students who could not enroll now (their grade isn't one the class is
+// for, or they would break the enrollment limits) are skipped and stay
+// queued. Nobody is promoted once registration has closed or the edition
+// is archived, as EnrollUser would refuse them.
+func PromoteWaitlist(db *sql.DB, sessionID int) ([]Promotion, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback() // no-op after Commit
+
+	var current, capacity int
+	var class Class
+	err = tx.QueryRow(`
+		SELECT cs.current_enrolled_count, cs.capacity, c.registration_start_at, c.registration_end_at,
+			c.edition_id <> `+activeEditionID+`, c.target_grades
+		FROM class_sessions cs
+		JOIN classes c ON cs.class_id = c.class_id
+		WHERE cs.session_id = $1
+		FOR UPDATE OF cs
+	`, sessionID).Scan(&current, &capacity, &class.RegistrationStartAt, &class.RegistrationEndAt, &class.Archived,
+		pq.Array(&class.TargetGrades))
+	if err != nil {
+		return nil, err
+	}
+	if current >= capacity || checkRegistrationWindow(class, time.Now()) != nil {
+		return nil, nil
+	}
+
+	type candidate struct {
+		enrollmentID int
+		userID       int
+		email        string
+	}
+	rows, err := tx.Query(`
+		SELECT se.enrollment_id, u.id, u.email
+		FROM session_enrollments se
+		JOIN user_profiles up ON se.user_profile_id = up.id
+		JOIN users u ON up.user_id = u.id
+		WHERE se.session_id = $1 AND se.status = $2
+		ORDER BY se.registered_at, se.enrollment_id
+		FOR UPDATE OF se
+	`, sessionID, StatusWaitlisted)
+	if err != nil {
+		return nil, err
+	}
+	var queue []candidate
+	for rows.Next() {
+		var c candidate
+		if err := rows.Scan(&c.enrollmentID, &c.userID, &c.email); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		queue = append(queue, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var promoted []Promotion
+	for _, c := range queue {
+		if current >= capacity {
+			break
+		}
+		// Lock the candidate's profile like EnrollUser does (session first, then profile)
+		var grade string
+		if err := tx.QueryRow("SELECT grade FROM user_profiles WHERE user_id = $1 FOR UPDATE", c.userID).Scan(&grade); err != nil {
+			return nil, err
+		}
+		if !class.ForGrade(grade) {
+			continue // their grade changed, or the class's target grades did
+		}
+		if err := CheckEnrollmentLimits(tx, c.userID, sessionID); err != nil {
+			var v *RuleViolation
+			if errors.As(err, &v) {
+				continue // not eligible any more, keep their place in the queue
+			}
+			return nil, err
+		}
+		if _, err := tx.Exec("UPDATE session_enrollments SET status = $1 WHERE enrollment_id = $2", StatusConfirmed, c.enrollmentID); err != nil {
+			return nil, err
+		}
+		current++
+		promoted = append(promoted, Promotion{UserID: c.userID, Email: c.email, SessionID: sessionID})
+	}
+
+	if len(promoted) > 0 {
+		_, err = tx.Exec("UPDATE class_sessions SET current_enrolled_count = $1 WHERE session_id = $2", current, sessionID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return promoted, tx.Commit()
+}
+
+// GetEnrollmentStatus returns the user's status for a session, or "" if they have none
+func GetEnrollmentStatus(q Querier, sessionID, userID int) (string, error) {
+	var status string
+	err := q.QueryRow(`
+		SELECT se.status FROM session_enrollments se
+		JOIN user_profiles up ON se.user_profile_id = up.id
+		WHERE se.session_id = $1 AND up.user_id = $2
+	`, sessionID, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return status, err
+}
+
+// waitlistPosition returns the 1-based queue position of a waitlist entry
+func waitlistPosition(q Querier, enrollmentID int) (int, error) {
+	var pos int
+	err := q.QueryRow(`
+		SELECT COUNT(*) FROM session_enrollments w
+		JOIN session_enrollments me ON me.enrollment_id = $1
+		WHERE w.session_id = me.session_id
+		  AND w.status = $2
+		  AND (w.registered_at, w.enrollment_id) <= (me.registered_at, me.enrollment_id)
+	`, enrollmentID, StatusWaitlisted).Scan(&pos)
+	return pos, err
+}
+
+// GetWaitlistReport lists waitlisted students with their queue positions.
+// editionID > 0 limits it to one edition, instructorID > 0 to that
+// instructor's classes.
+func GetWaitlistReport(db *sql.DB, editionID int, classID int, sessionID int, instructorID int) ([]WaitlistReport, error) {
+	query := `
+		SELECT
+			ROW_NUMBER() OVER (PARTITION BY s.session_id ORDER BY e.registered_at, e.enrollment_id),
+			u.id, u.email, e.registered_at,
+			up.student_name, up.school_name,
+			c.class_name, d.label, s.start_at, s.end_at
+		FROM session_enrollments e
+		JOIN user_profiles up ON e.user_profile_id = up.id
+		JOIN users u ON up.user_id = u.id
+		JOIN class_sessions s ON e.session_id = s.session_id
+		JOIN event_days d ON d.day_id = s.day_id
+		JOIN classes c ON s.class_id = c.class_id
+		WHERE e.status = $1
+	`
+
+	// Dynamic Filtering
+	args := []any{StatusWaitlisted}
+	argCounter := 2
+
+	if editionID > 0 {
+		query += fmt.Sprintf(" AND c.edition_id = $%d", argCounter)
+		args = append(args, editionID)
+		argCounter++
+	}
+
+	if classID > 0 {
+		query += fmt.Sprintf(" AND c.class_id = $%d", argCounter)
+		args = append(args, classID)
+		argCounter++
+	}
+
+	if sessionID > 0 {
+		query += fmt.Sprintf(" AND s.session_id = $%d", argCounter)
+		args = append(args, sessionID)
+		argCounter++
+	}
+
+	if instructorID > 0 {
+		query += fmt.Sprintf(" AND c.class_id IN (SELECT class_id FROM class_instructors WHERE instructor_id = $%d)", argCounter)
+		args = append(args, instructorID)
+		argCounter++
+	}
+
+	query += ` ORDER BY s.start_at, s.session_id, e.registered_at, e.enrollment_id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reports []WaitlistReport
+	for rows.Next() {
+		var r WaitlistReport
+		var day string
+		var start, end time.Time
+
+		err := rows.Scan(
+			&r.Position, &r.UserID, &r.Email, &r.RegDate,
+			&r.StudentName, &r.SchoolName,
+			&r.ClassName, &day, &start, &end,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		r.SessionTime = fmt.Sprintf("%s %s-%s", day, start.Format("15:04"), end.Format("15:04"))
+		reports = append(reports, r)
+	}
+	return reports, nil
+}
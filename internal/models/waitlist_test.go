@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"example.com/myapp/internal/database/dbtest"
+)
+
+// fullSessionWithQueue seeds a session of capacity 2 held by the first two
+// of n students, with the rest waitlisted in order
+func fullSessionWithQueue(t *testing.T, db *sql.DB, n int) (sessionID int, users []int) {
+	t.Helper()
+	sessionID = seedSession(t, db, 2)
+	users = seedStudents(t, db, n)
+	for i, u := range users {
+		if i < 2 {
+			if err := EnrollUser(db, sessionID, u); err != nil {
+				t.Fatal(err)
+			}
+			continue
+		}
+		pos, err := JoinWaitlist(db, sessionID, u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pos != i-1 {
+			t.Fatalf("student %d got waitlist position %d, want %d", i, pos, i-1)
+		}
+	}
+	return sessionID, users
+}
+
+func statusOf(t *testing.T, db *sql.DB, sessionID, userID int) string {
+	t.Helper()
+	status, err := GetEnrollmentStatus(db, sessionID, userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
+
+func TestJoinWaitlist(t *testing.T) {
+	db := dbtest.Open(t)
+	sessionID, users := fullSessionWithQueue(t, db, 4)
+
+	if _, err := JoinWaitlist(db, sessionID, users[2]); !errors.Is(err, ErrAlreadyWaitlisted) {
+		t.Errorf("joining twice = %v, want ErrAlreadyWaitlisted", err)
+	}
+	if _, err := JoinWaitlist(db, sessionID, users[0]); !errors.Is(err, ErrAlreadyEnrolled) {
+		t.Errorf("joining with a seat = %v, want ErrAlreadyEnrolled", err)
+	}
+	if counter, rows := seatCounts(t, db, sessionID); counter != 2 || rows != 2 {
+		t.Errorf("waitlist took seats: counter %d, rows %d", counter, rows)
+	}
+
+	// A session with free seats has no waitlist
+	open := seedSession(t, db, 5)
+	if _, err := JoinWaitlist(db, open, users[2]); !errors.Is(err, ErrSessionNotFull) {
+		t.Errorf("JoinWaitlist on a free session = %v, want ErrSessionNotFull", err)
+	}
+}
+
+func TestPromoteWaitlistInOrder(t *testing.T) {
+	db := dbtest.Open(t)
+	sessionID, users := fullSessionWithQueue(t, db, 5) // 2 seated, 3 queued
+
+	// Nothing to do while the session is full
+	if promoted, err := PromoteWaitlist(db, sessionID); err != nil || len(promoted) != 0 {
+		t.Fatalf("full session: promoted %v, %v", promoted, err)
+	}
+
+	// One seat frees up: only the first in the queue gets it
+	if err := CancelEnrollment(db, sessionID, users[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	promoted, err := PromoteWaitlist(db, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != 1 || promoted[0].UserID != users[2] || promoted[0].SessionID != sessionID {
+		t.Fatalf("promoted %+v, want student 2 only", promoted)
+	}
+	if counter, rows := seatCounts(t, db, sessionID); counter != 2 || rows != 2 {
+		t.Errorf("after promotion: counter %d, rows %d; want 2, 2", counter, rows)
+	}
+	if s := statusOf(t, db, sessionID, users[3]); s != StatusWaitlisted {
+		t.Errorf("student 3 is %q, want still waitlisted", s)
+	}
+
+	// Two more seats: the rest of the queue, in order, and the counter follows
+	if _, err := db.Exec("UPDATE class_sessions SET capacity = 4 WHERE session_id = $1", sessionID); err != nil {
+		t.Fatal(err)
+	}
+	promoted, err = PromoteWaitlist(db, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != 2 || promoted[0].UserID != users[3] || promoted[1].UserID != users[4] {
+		t.Fatalf("promoted %+v, want students 3 and 4", promoted)
+	}
+	if counter, rows := seatCounts(t, db, sessionID); counter != 4 || rows != 4 {
+		t.Errorf("after promotion: counter %d, rows %d; want 4, 4", counter, rows)
+	}
+}
+
+func TestPromoteWaitlistSkipsIneligible(t *testing.T) {
+	db := dbtest.Open(t)
+	sessionID, users := fullSessionWithQueue(t, db, 4) // students 2 and 3 queued
+
+	// Student 2 moved to grade 1; the class is for grade 2 only
+	if _, err := db.Exec("UPDATE user_profiles SET grade = '1' WHERE user_id = $1", users[2]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`
+		UPDATE classes SET target_grades = '{2}'
+		WHERE class_id = (SELECT class_id FROM class_sessions WHERE session_id = $1)
+	`, sessionID); err != nil {
+		t.Fatal(err)
+	}
+	if err := CancelEnrollment(db, sessionID, users[0], 0); err != nil {
+		t.Fatal(err)
+	}
+	promoted, err := PromoteWaitlist(db, sessionID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(promoted) != 1 || promoted[0].UserID != users[3] {
+		t.Fatalf("promoted %+v, want student 3 only", promoted)
+	}
+	if s := statusOf(t, db, sessionID, users[2]); s != StatusWaitlisted {
+		t.Errorf("skipped student is %q, want to keep their place", s)
+	}
+	if counter, rows := seatCounts(t, db, sessionID); counter != 2 || rows != 2 {
+		t.Errorf("counter %d, rows %d; want 2, 2", counter, rows)
+	}
+}
+
+func TestPromoteWaitlistAfterRegistrationCloses(t *testing.T) {
+	tests := []struct {
+		name  string
+		close func(db *sql.DB, sessionID int) error
+	}{
+		{"registration closed", func(db *sql.DB, sessionID int) error {
+			_, err := db.Exec(`
+				UPDATE classes SET registration_end_at = NOW() - interval '1 minute'
+				WHERE class_id = (SELECT class_id FROM class_sessions WHERE session_id = $1)
+			`, sessionID)
+			return err
+		}},
+		{"edition archived", func(db *sql.DB, sessionID int) error {
+			_, err := RolloverEdition(db, "次年度", "2099-08-01")
+			return err
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := dbtest.Open(t)
+			sessionID, users := fullSessionWithQueue(t, db, 3)
+			if err := CancelEnrollment(db, sessionID, users[0], 0); err != nil {
+				t.Fatal(err)
+			}
+			if err := tt.close(db, sessionID); err != nil {
+				t.Fatal(err)
+			}
+
+			promoted, err := PromoteWaitlist(db, sessionID)
+			if err != nil || len(promoted) != 0 {
+				t.Fatalf("promoted %v, %v; want nobody", promoted, err)
+			}
+			if s := statusOf(t, db, sessionID, users[2]); s != StatusWaitlisted {
+				t.Errorf("student 2 is %q, want still waitlisted", s)
+			}
+		})
+	}
+}
@@ -0,0 +1,217 @@
+package pdf
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"sort"
+)
+
+// matrix is an affine transform [a b c d e f], applied as PDF does:
+// x' = a*x + c*y + e, y' = b*x + d*y + f
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns the transform that applies m, then n
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2], m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2], m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4], m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+func (m matrix) apply(x, y float64) point {
+	return point{x*m[0] + y*m[2] + m[4], x*m[1] + y*m[3] + m[5]}
+}
+
+func (m matrix) invert() (matrix, bool) {
+	det := m[0]*m[3] - m[1]*m[2]
+	if math.Abs(det) < 1e-12 {
+		return matrix{}, false
+	}
+	return matrix{
+		m[3] / det, -m[1] / det, -m[2] / det, m[0] / det,
+		(m[2]*m[5] - m[3]*m[4]) / det, (m[1]*m[4] - m[0]*m[5]) / det,
+	}, true
+}
+
+// scale is how much m enlarges lengths, on average
+func (m matrix) scale() float64 {
+	return math.Sqrt(math.Abs(m[0]*m[3] - m[1]*m[2]))
+}
+
+type point struct{ x, y float64 }
+
+// canvas is the image a page is drawn on, in device pixels
+type canvas struct {
+	img *image.RGBA
+}
+
+func newCanvas(w, h int) *canvas {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = 0xff
+	}
+	return &canvas{img: img}
+}
+
+// blend paints one pixel with c over what is there
+func (c *canvas) blend(x, y int, col color.RGBA) {
+	i := c.img.PixOffset(x, y)
+	p := c.img.Pix[i : i+4 : i+4]
+	a := uint32(col.A)
+	if a == 0xff {
+		p[0], p[1], p[2] = col.R, col.G, col.B
+		return
+	}
+	p[0] = uint8((uint32(col.R)*a + uint32(p[0])*(255-a)) / 255)
+	p[1] = uint8((uint32(col.G)*a + uint32(p[1])*(255-a)) / 255)
+	p[2] = uint8((uint32(col.B)*a + uint32(p[2])*(255-a)) / 255)
+}
+
+// fill paints the inside of polygons with the nonzero or even-odd rule
+func (c *canvas) fill(polys [][]point, col color.RGBA, evenOdd bool) {
+	type edge struct {
+		x0, y0, x1, y1 float64
+		dir            int
+	}
+	var edges []edge
+	minY, maxY := math.Inf(1), math.Inf(-1)
+	for _, poly := range polys {
+		for i := range poly {
+			a, b := poly[i], poly[(i+1)%len(poly)]
+			if a.y == b.y {
+				continue
+			}
+			dir := 1
+			if a.y > b.y {
+				a, b, dir = b, a, -1
+			}
+			edges = append(edges, edge{a.x, a.y, b.x, b.y, dir})
+			minY, maxY = math.Min(minY, a.y), math.Max(maxY, b.y)
+		}
+	}
+	if len(edges) == 0 {
+		return
+	}
+	bounds := c.img.Bounds()
+	y0 := max(bounds.Min.Y, int(math.Floor(minY)))
+	y1 := min(bounds.Max.Y, int(math.Ceil(maxY)))
+
+	type crossing struct {
+		x   float64
+		dir int
+	}
+	var xs []crossing
+	for y := y0; y < y1; y++ {
+		sy := float64(y) + 0.5
+		xs = xs[:0]
+		for _, e := range edges {
+			if sy >= e.y0 && sy < e.y1 {
+				xs = append(xs, crossing{e.x0 + (sy-e.y0)*(e.x1-e.x0)/(e.y1-e.y0), e.dir})
+			}
+		}
+		sort.Slice(xs, func(i, j int) bool { return xs[i].x < xs[j].x })
+		winding := 0
+		for i := 0; i+1 < len(xs); i++ {
+			if evenOdd {
+				winding ^= 1
+			} else {
+				winding += xs[i].dir
+			}
+			if winding == 0 {
+				continue
+			}
+			x0 := max(bounds.Min.X, int(math.Round(xs[i].x)))
+			x1 := min(bounds.Max.X, int(math.Round(xs[i+1].x)))
+			for x := x0; x < x1; x++ {
+				c.blend(x, y, col)
+			}
+		}
+	}
+}
+
+// stroke draws a polyline as quads of the given width (at least a pixel)
+func (c *canvas) stroke(pts []point, closed bool, width float64, col color.RGBA) {
+	width = math.Max(width, 1)
+	n := len(pts)
+	if !closed {
+		n--
+	}
+	var quads [][]point
+	for i := 0; i < n; i++ {
+		a, b := pts[i], pts[(i+1)%len(pts)]
+		dx, dy := b.x-a.x, b.y-a.y
+		l := math.Hypot(dx, dy)
+		if l == 0 {
+			continue
+		}
+		nx, ny := -dy/l*width/2, dx/l*width/2
+		quads = append(quads, []point{{a.x + nx, a.y + ny}, {b.x + nx, b.y + ny}, {b.x - nx, b.y - ny}, {a.x - nx, a.y - ny}})
+	}
+	c.fill(quads, col, false)
+}
+
+// draw paints an image onto the parallelogram m makes of the unit square.
+// The image's top row goes at y = 1, as in PDF image space. A nil image
+// (one we can't decode) is shown as a grey box.
+func (c *canvas) draw(src image.Image, m matrix) {
+	corners := []point{m.apply(0, 0), m.apply(1, 0), m.apply(1, 1), m.apply(0, 1)}
+	if src == nil {
+		c.fill([][]point{corners}, color.RGBA{0xcc, 0xcc, 0xcc, 0xff}, false)
+		return
+	}
+	inv, ok := m.invert()
+	if !ok {
+		return
+	}
+	minX, minY, maxX, maxY := math.Inf(1), math.Inf(1), math.Inf(-1), math.Inf(-1)
+	for _, p := range corners {
+		minX, minY = math.Min(minX, p.x), math.Min(minY, p.y)
+		maxX, maxY = math.Max(maxX, p.x), math.Max(maxY, p.y)
+	}
+	b := c.img.Bounds()
+	sb := src.Bounds()
+	w, h := float64(sb.Dx()), float64(sb.Dy())
+	for y := max(b.Min.Y, int(minY)); y < min(b.Max.Y, int(math.Ceil(maxY))); y++ {
+		for x := max(b.Min.X, int(minX)); x < min(b.Max.X, int(math.Ceil(maxX))); x++ {
+			u := inv.apply(float64(x)+0.5, float64(y)+0.5)
+			if u.x < 0 || u.x >= 1 || u.y <= 0 || u.y > 1 {
+				continue
+			}
+			sx := sb.Min.X + min(int(u.x*w), sb.Dx()-1)
+			sy := sb.Min.Y + min(int((1-u.y)*h), sb.Dy()-1)
+			r, g, bl, a := src.At(sx, sy).RGBA()
+			if a == 0 {
+				continue
+			}
+			// Un-premultiply for blend
+			c.blend(x, y, color.RGBA{uint8(r * 0xff / a), uint8(g * 0xff / a), uint8(bl * 0xff / a), uint8(a >> 8)})
+		}
+	}
+}
+
+// downscale shrinks the supersampled canvas by factor, averaging pixels
+func (c *canvas) downscale(factor int) *image.RGBA {
+	b := c.img.Bounds()
+	w, h := b.Dx()/factor, b.Dy()/factor
+	out := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var sum [3]int
+			for dy := 0; dy < factor; dy++ {
+				for dx := 0; dx < factor; dx++ {
+					i := c.img.PixOffset(x*factor+dx, y*factor+dy)
+					sum[0] += int(c.img.Pix[i])
+					sum[1] += int(c.img.Pix[i+1])
+					sum[2] += int(c.img.Pix[i+2])
+				}
+			}
+			n := factor * factor
+			out.SetRGBA(x, y, color.RGBA{uint8(sum[0] / n), uint8(sum[1] / n), uint8(sum[2] / n), 0xff})
+		}
+	}
+	return out
+}
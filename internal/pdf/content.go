@@ -0,0 +1,455 @@
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"image/color"
+	"io"
+	"math"
+)
+
+// maxOps bounds the operators run for one page, forms included
+const maxOps = 2_000_000
+
+// ctxCheckOps is how often (in operators) run looks at its context
+const ctxCheckOps = 1024
+
+// maxFormDepth bounds nested form XObjects
+const maxFormDepth = 8
+
+type gstate struct {
+	ctm          matrix
+	fill, stroke color.RGBA
+	lineWidth    float64
+
+	font                        *font
+	fontSize                    float64
+	charSpace, wordSpace, scale float64 // scale is Tz/100
+	leading, rise               float64
+	render                      int // Tr; 3 is invisible (OCR text over a scan)
+}
+
+// interp runs content streams. With a canvas it draws the page; it always
+// collects the text.
+type interp struct {
+	ctx    context.Context
+	doc    *Document
+	canvas *canvas
+	base   matrix // user space to device pixels
+	text   *textBuilder
+
+	gs    gstate
+	stack []gstate
+	path  [][]point // subpaths in device space
+	cur   point
+
+	tm, tlm matrix
+	fonts   map[Ref]*font
+	ops     int
+	depth   int
+}
+
+func newInterp(ctx context.Context, doc *Document, c *canvas, base matrix) *interp {
+	return &interp{
+		ctx:    ctx,
+		doc:    doc,
+		canvas: c,
+		base:   base,
+		text:   &textBuilder{},
+		gs:     gstate{ctm: identity, fill: color.RGBA{0, 0, 0, 0xff}, stroke: color.RGBA{0, 0, 0, 0xff}, lineWidth: 1, scale: 1},
+		fonts:  map[Ref]*font{},
+	}
+}
+
+// device is the transform from the current user space to pixels
+func (in *interp) device() matrix {
+	return in.gs.ctm.mul(in.base)
+}
+
+func (in *interp) run(content []byte, resources Dict) {
+	l := &lexer{data: content}
+	var args []any
+	for in.ops < maxOps {
+		v, err := l.value()
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			args = args[:0]
+			continue
+		}
+		op, ok := v.(keyword)
+		if !ok {
+			if len(args) < 64 {
+				args = append(args, v)
+			}
+			continue
+		}
+		in.ops++
+		if in.ops%ctxCheckOps == 0 && in.ctx.Err() != nil {
+			return
+		}
+		if op == "BI" {
+			skipInlineImage(l)
+		} else {
+			in.do(string(op), args, resources)
+		}
+		args = args[:0]
+	}
+}
+
+// skipInlineImage moves past the data of an inline image (BI ... ID data EI)
+func skipInlineImage(l *lexer) {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 3
+	for {
+		j := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if j < 0 {
+			l.pos = len(l.data)
+			return
+		}
+		end := l.pos + j
+		l.pos = end + 2
+		if end > 0 && isSpace(l.data[end-1]) && (l.pos >= len(l.data) || isSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
+
+func (in *interp) nums(args []any, n int) ([]float64, bool) {
+	if len(args) < n {
+		return nil, false
+	}
+	out := make([]float64, n)
+	for i, a := range args[len(args)-n:] {
+		f, ok := in.doc.num(a)
+		if !ok {
+			return nil, false
+		}
+		out[i] = f
+	}
+	return out, true
+}
+
+func (in *interp) do(op string, args []any, res Dict) {
+	gs := &in.gs
+	switch op {
+	// Graphics state
+	case "q":
+		if len(in.stack) < 256 {
+			in.stack = append(in.stack, in.gs)
+		}
+	case "Q":
+		if n := len(in.stack); n > 0 {
+			in.gs = in.stack[n-1]
+			in.stack = in.stack[:n-1]
+		}
+	case "cm":
+		if a, ok := in.nums(args, 6); ok {
+			gs.ctm = matrix(a).mul(gs.ctm)
+		}
+	case "w":
+		if a, ok := in.nums(args, 1); ok {
+			gs.lineWidth = a[0]
+		}
+
+	// Colour
+	case "g", "rg", "k", "sc", "scn":
+		if c, ok := in.color(args); ok {
+			gs.fill = c
+		}
+	case "G", "RG", "K", "SC", "SCN":
+		if c, ok := in.color(args); ok {
+			gs.stroke = c
+		}
+	case "cs":
+		gs.fill = color.RGBA{0, 0, 0, 0xff}
+	case "CS":
+		gs.stroke = color.RGBA{0, 0, 0, 0xff}
+
+	// Paths
+	case "m":
+		if a, ok := in.nums(args, 2); ok {
+			in.cur = in.device().apply(a[0], a[1])
+			in.path = append(in.path, []point{in.cur})
+		}
+	case "l":
+		if a, ok := in.nums(args, 2); ok {
+			in.lineTo(in.device().apply(a[0], a[1]))
+		}
+	case "c", "v", "y":
+		in.curve(op, args)
+	case "re":
+		if a, ok := in.nums(args, 4); ok {
+			m := in.device()
+			in.path = append(in.path, []point{
+				m.apply(a[0], a[1]), m.apply(a[0]+a[2], a[1]),
+				m.apply(a[0]+a[2], a[1]+a[3]), m.apply(a[0], a[1]+a[3]),
+			})
+		}
+	case "h":
+		// Subpaths are closed when filled; strokes close via s and b
+	case "f", "F", "f*":
+		in.fillPath(op == "f*")
+		in.path = nil
+	case "S", "s":
+		in.strokePath(op == "s")
+	case "B", "B*", "b", "b*":
+		in.fillPath(op == "B*" || op == "b*")
+		in.strokePath(op == "b" || op == "b*")
+	case "n":
+		in.path = nil
+
+	// Text
+	case "BT":
+		in.tm, in.tlm = identity, identity
+	case "Tf":
+		if len(args) >= 2 {
+			gs.fontSize, _ = in.doc.num(args[len(args)-1])
+			gs.font = in.font(res, args[len(args)-2])
+		}
+	case "Tc", "Tw", "Tz", "TL", "Ts", "Tr":
+		if a, ok := in.nums(args, 1); ok {
+			switch op {
+			case "Tc":
+				gs.charSpace = a[0]
+			case "Tw":
+				gs.wordSpace = a[0]
+			case "Tz":
+				gs.scale = a[0] / 100
+			case "TL":
+				gs.leading = a[0]
+			case "Ts":
+				gs.rise = a[0]
+			case "Tr":
+				gs.render = int(a[0])
+			}
+		}
+	case "Td", "TD":
+		if a, ok := in.nums(args, 2); ok {
+			if op == "TD" {
+				gs.leading = -a[1]
+			}
+			in.tlm = matrix{1, 0, 0, 1, a[0], a[1]}.mul(in.tlm)
+			in.tm = in.tlm
+		}
+	case "Tm":
+		if a, ok := in.nums(args, 6); ok {
+			in.tlm = matrix(a)
+			in.tm = in.tlm
+		}
+	case "T*":
+		in.nextLine()
+	case "Tj":
+		if len(args) > 0 {
+			in.show(args[len(args)-1])
+		}
+	case "'", "\"":
+		if op == "\"" {
+			if a, ok := in.nums(args[:max(0, len(args)-1)], 2); ok {
+				gs.wordSpace, gs.charSpace = a[0], a[1]
+			}
+		}
+		in.nextLine()
+		if len(args) > 0 {
+			in.show(args[len(args)-1])
+		}
+	case "TJ":
+		if len(args) > 0 {
+			for _, x := range in.doc.array(args[len(args)-1]) {
+				if n, ok := in.doc.num(x); ok {
+					in.tm = matrix{1, 0, 0, 1, -n / 1000 * gs.fontSize * gs.scale, 0}.mul(in.tm)
+				} else {
+					in.show(x)
+				}
+			}
+		}
+
+	// XObjects
+	case "Do":
+		if len(args) > 0 {
+			in.xobject(res, in.doc.name(args[len(args)-1]))
+		}
+	}
+}
+
+// color reads the operands of a colour operator by their count: grey, RGB
+// or CMYK. A pattern (a name operand) comes out light grey.
+func (in *interp) color(args []any) (color.RGBA, bool) {
+	if len(args) > 0 {
+		if _, isName := args[len(args)-1].(Name); isName {
+			return color.RGBA{0xdd, 0xdd, 0xdd, 0xff}, true
+		}
+	}
+	switch len(args) {
+	case 1:
+		a, _ := in.nums(args, 1)
+		v := clamp8(a[0])
+		return color.RGBA{v, v, v, 0xff}, true
+	case 3:
+		a, _ := in.nums(args, 3)
+		return color.RGBA{clamp8(a[0]), clamp8(a[1]), clamp8(a[2]), 0xff}, true
+	case 4:
+		a, _ := in.nums(args, 4)
+		return cmyk(a[0], a[1], a[2], a[3]), true
+	}
+	return color.RGBA{}, false
+}
+
+func clamp8(v float64) uint8 {
+	return uint8(math.Round(math.Max(0, math.Min(1, v)) * 255))
+}
+
+func cmyk(c, m, y, k float64) color.RGBA {
+	return color.RGBA{clamp8((1 - c) * (1 - k)), clamp8((1 - m) * (1 - k)), clamp8((1 - y) * (1 - k)), 0xff}
+}
+
+func (in *interp) lineTo(p point) {
+	if len(in.path) == 0 {
+		in.path = append(in.path, []point{in.cur})
+	}
+	last := &in.path[len(in.path)-1]
+	*last = append(*last, p)
+	in.cur = p
+}
+
+// curve flattens a Bézier curve into line segments
+func (in *interp) curve(op string, args []any) {
+	n := 6
+	if op != "c" {
+		n = 4
+	}
+	a, ok := in.nums(args, n)
+	if !ok {
+		return
+	}
+	m := in.device()
+	p0 := in.cur
+	var p1, p2, p3 point
+	switch op {
+	case "c":
+		p1, p2, p3 = m.apply(a[0], a[1]), m.apply(a[2], a[3]), m.apply(a[4], a[5])
+	case "v":
+		p1, p2, p3 = p0, m.apply(a[0], a[1]), m.apply(a[2], a[3])
+	case "y":
+		p1, p2, p3 = m.apply(a[0], a[1]), m.apply(a[2], a[3]), m.apply(a[2], a[3])
+	}
+	const steps = 8
+	for i := 1; i <= steps; i++ {
+		t := float64(i) / steps
+		u := 1 - t
+		in.lineTo(point{
+			u*u*u*p0.x + 3*u*u*t*p1.x + 3*u*t*t*p2.x + t*t*t*p3.x,
+			u*u*u*p0.y + 3*u*u*t*p1.y + 3*u*t*t*p2.y + t*t*t*p3.y,
+		})
+	}
+}
+
+func (in *interp) fillPath(evenOdd bool) {
+	if in.canvas != nil {
+		in.canvas.fill(in.path, in.gs.fill, evenOdd)
+	}
+}
+
+func (in *interp) strokePath(closed bool) {
+	if in.canvas != nil {
+		width := in.gs.lineWidth * in.device().scale()
+		for _, sub := range in.path {
+			in.canvas.stroke(sub, closed, width, in.gs.stroke)
+		}
+	}
+	in.path = nil
+}
+
+func (in *interp) nextLine() {
+	in.tlm = matrix{1, 0, 0, 1, 0, -in.gs.leading}.mul(in.tlm)
+	in.tm = in.tlm
+}
+
+func (in *interp) font(res Dict, name any) *font {
+	fonts := in.doc.dict(res["Font"])
+	v := fonts[in.doc.name(name)]
+	if r, ok := v.(Ref); ok {
+		if f, ok := in.fonts[r]; ok {
+			return f
+		}
+		f := in.doc.loadFont(r)
+		in.fonts[r] = f
+		return f
+	}
+	return in.doc.loadFont(v)
+}
+
+// show draws a string operand glyph by glyph, as grey bars, and adds its text
+func (in *interp) show(v any) {
+	s, ok := in.doc.resolve(v).(string)
+	gs := &in.gs
+	if !ok || gs.font == nil {
+		return
+	}
+	size := gs.fontSize
+	params := matrix{size * gs.scale, 0, 0, size, 0, gs.rise}
+
+	start := params.mul(in.tm).mul(gs.ctm)
+	var str []rune
+	for _, code := range gs.font.codes(s) {
+		w := gs.font.width(code)
+		t := gs.font.text(code)
+		str = append(str, []rune(t)...)
+
+		if in.canvas != nil && gs.render != 3 && gs.render != 7 && t != " " && !gs.font.isSpace(code) && w > 0 {
+			// A bar over the glyph's advance, about x-height tall
+			m := params.mul(in.tm).mul(in.device())
+			glyph := []point{m.apply(0.05*w, 0), m.apply(0.95*w, 0), m.apply(0.95*w, 0.6), m.apply(0.05*w, 0.6)}
+			col := gs.fill
+			col.A = 0x99
+			in.canvas.fill([][]point{glyph}, col, false)
+		}
+
+		advance := w*size + gs.charSpace
+		if gs.font.isSpace(code) {
+			advance += gs.wordSpace
+		}
+		in.tm = matrix{1, 0, 0, 1, advance * gs.scale, 0}.mul(in.tm)
+	}
+	end := params.mul(in.tm).mul(gs.ctm)
+	in.text.add(string(str), point{start[4], start[5]}, point{end[4], end[5]}, math.Abs(size)*in.tm.mul(gs.ctm).scale())
+}
+
+func (in *interp) xobject(res Dict, name Name) {
+	s := in.doc.stream(in.doc.dict(res["XObject"])[name])
+	if s == nil {
+		return
+	}
+	switch in.doc.name(s.Dict["Subtype"]) {
+	case "Image":
+		if in.canvas != nil {
+			img := in.doc.image(s, in.gs.fill)
+			in.canvas.draw(img, in.device())
+		}
+	case "Form":
+		if in.depth >= maxFormDepth {
+			return
+		}
+		data, filter, err := in.doc.decode(s)
+		if err != nil || filter != "" {
+			return
+		}
+		formRes := in.doc.dict(s.Dict["Resources"])
+		if formRes == nil {
+			formRes = res
+		}
+		saved, savedStack := in.gs, len(in.stack)
+		if m := in.doc.nums(s.Dict["Matrix"]); len(m) == 6 {
+			in.gs.ctm = matrix(m).mul(in.gs.ctm)
+		}
+		in.depth++
+		in.run(data, formRes)
+		in.depth--
+		in.gs, in.stack = saved, in.stack[:min(savedStack, len(in.stack))]
+	}
+}
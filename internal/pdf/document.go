@@ -0,0 +1,233 @@
+// Package pdf reads just enough of a PDF to preview it: the text of the
+// first pages and a rough rendering of the first one. It copes with what
+// office software and scanners write (compressed object and cross-reference
+// streams, CID fonts with ToUnicode maps, JPEG images) but not encrypted
+// files, and it draws text as grey bars rather than glyphs.
+//
+// Parsing and rendering stop when their context is done, so a caller can
+// put a deadline on a file built to be slow.
+package pdf
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+var (
+	ErrEncrypted = errors.New("pdf: file is encrypted")
+	ErrNoPages   = errors.New("pdf: no pages found")
+)
+
+// Document is a parsed PDF
+type Document struct {
+	objects map[int]any
+	root    Dict
+}
+
+// objHeader finds "12 0 obj". Objects are located by scanning rather than
+// through the cross-reference table, which is often wrong in files that
+// were edited or repaired; a later definition replaces an earlier one, as
+// it does in an incremental update.
+var objHeader = regexp.MustCompile(`(\d+)[ \t\r\n\f\x00]+\d+[ \t\r\n\f\x00]+obj\b`)
+
+// Open parses a PDF held in memory. It returns ctx.Err() if ctx is done
+// before the file has been scanned.
+func Open(ctx context.Context, data []byte) (doc *Document, err error) {
+	defer recoverErr(&err)
+
+	if !bytes.Contains(data[:min(len(data), 1024)], []byte("%PDF-")) {
+		return nil, errors.New("pdf: not a PDF file")
+	}
+
+	d := &Document{objects: make(map[int]any)}
+	type trailer struct {
+		pos  int
+		dict Dict
+	}
+	var trailers []trailer
+
+	for pos := 0; pos < len(data); {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		m := objHeader.FindSubmatchIndex(data[pos:])
+		if m == nil {
+			break
+		}
+		num, _ := strconv.Atoi(string(data[pos+m[2] : pos+m[3]]))
+		l := &lexer{data: data, pos: pos + m[1]}
+		v, err := l.value()
+		if err != nil {
+			pos += m[1]
+			continue
+		}
+		d.objects[num] = v
+		if s, ok := v.(*Stream); ok && s.Dict["Type"] == Name("XRef") {
+			trailers = append(trailers, trailer{pos + m[0], s.Dict})
+		}
+		pos = l.pos
+	}
+
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+		l := &lexer{data: data, pos: pos + i + len("trailer")}
+		if v, err := l.value(); err == nil {
+			if t, ok := v.(Dict); ok {
+				trailers = append(trailers, trailer{pos + i, t})
+			}
+		}
+		pos += i + len("trailer")
+	}
+	sort.SliceStable(trailers, func(i, j int) bool { return trailers[i].pos < trailers[j].pos })
+
+	d.loadObjectStreams()
+
+	var rootRef any
+	for _, t := range trailers {
+		if t.dict["Encrypt"] != nil {
+			return nil, ErrEncrypted
+		}
+		if r, ok := t.dict["Root"]; ok {
+			rootRef = r
+		}
+	}
+	d.root = d.dict(rootRef)
+	if d.root == nil || d.root["Pages"] == nil {
+		// No usable trailer: take any catalog
+		d.root = nil
+		for _, num := range d.objectNumbers() {
+			if c, ok := d.objects[num].(Dict); ok && c["Type"] == Name("Catalog") && c["Pages"] != nil {
+				d.root = c
+			}
+		}
+	}
+	if d.root == nil {
+		return nil, ErrNoPages
+	}
+	return d, nil
+}
+
+// loadObjectStreams adds the objects packed in object streams (PDF 1.5).
+// Objects defined outside any stream take precedence.
+func (d *Document) loadObjectStreams() {
+	for _, num := range d.objectNumbers() {
+		s, ok := d.objects[num].(*Stream)
+		if !ok || s.Dict["Type"] != Name("ObjStm") {
+			continue
+		}
+		data, filter, err := d.decode(s)
+		if err != nil || filter != "" {
+			continue
+		}
+		n, _ := d.int(s.Dict["N"])
+		first, _ := d.int(s.Dict["First"])
+		if n <= 0 || first <= 0 || first > len(data) {
+			continue
+		}
+		header := &lexer{data: data[:first]}
+		for i := 0; i < n; i++ {
+			numV, err1 := header.value()
+			offV, err2 := header.value()
+			objNum, ok1 := numV.(int)
+			off, ok2 := offV.(int)
+			if err1 != nil || err2 != nil || !ok1 || !ok2 || first+off >= len(data) {
+				break
+			}
+			if _, defined := d.objects[objNum]; defined {
+				continue
+			}
+			l := &lexer{data: data, pos: first + off}
+			if v, err := l.value(); err == nil {
+				d.objects[objNum] = v
+			}
+		}
+	}
+}
+
+func (d *Document) objectNumbers() []int {
+	nums := make([]int, 0, len(d.objects))
+	for n := range d.objects {
+		nums = append(nums, n)
+	}
+	sort.Ints(nums)
+	return nums
+}
+
+// resolve follows references
+func (d *Document) resolve(v any) any {
+	for i := 0; i < maxDepth; i++ {
+		r, ok := v.(Ref)
+		if !ok {
+			return v
+		}
+		v = d.objects[r.Num]
+	}
+	return nil
+}
+
+// dict returns v as a dictionary (a stream's dictionary for a stream), or nil
+func (d *Document) dict(v any) Dict {
+	switch x := d.resolve(v).(type) {
+	case Dict:
+		return x
+	case *Stream:
+		return x.Dict
+	}
+	return nil
+}
+
+func (d *Document) array(v any) Array {
+	a, _ := d.resolve(v).(Array)
+	return a
+}
+
+func (d *Document) stream(v any) *Stream {
+	s, _ := d.resolve(v).(*Stream)
+	return s
+}
+
+func (d *Document) name(v any) Name {
+	n, _ := d.resolve(v).(Name)
+	return n
+}
+
+func (d *Document) num(v any) (float64, bool) {
+	switch x := d.resolve(v).(type) {
+	case int:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+func (d *Document) int(v any) (int, bool) {
+	f, ok := d.num(v)
+	return int(f), ok
+}
+
+// nums reads an array of numbers; missing or odd entries are 0
+func (d *Document) nums(v any) []float64 {
+	a := d.array(v)
+	out := make([]float64, len(a))
+	for i, x := range a {
+		out[i], _ = d.num(x)
+	}
+	return out
+}
+
+// recoverErr turns a panic on malformed input into an error, so a broken
+// upload can't take the server down
+func recoverErr(err *error) {
+	if r := recover(); r != nil {
+		*err = fmt.Errorf("pdf: malformed file: %v", r)
+	}
+}
@@ -0,0 +1,188 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"fmt"
+	"io"
+)
+
+// maxDecoded bounds the decoded size of one stream (against zip bombs)
+const maxDecoded = 64 << 20
+
+// decode undoes a stream's filters. It stops at an image codec (DCTDecode
+// and the like) and returns that filter's name with the data still encoded
+// by it.
+func (d *Document) decode(s *Stream) ([]byte, Name, error) {
+	var filters []Name
+	var params []Dict
+	switch f := d.resolve(s.Dict["Filter"]).(type) {
+	case Name:
+		filters = []Name{f}
+		params = []Dict{d.dict(s.Dict["DecodeParms"])}
+	case Array:
+		p := d.array(s.Dict["DecodeParms"])
+		for i, x := range f {
+			filters = append(filters, d.name(x))
+			if i < len(p) {
+				params = append(params, d.dict(p[i]))
+			} else {
+				params = append(params, nil)
+			}
+		}
+	}
+
+	data := s.Data
+	var err error
+	for i, f := range filters {
+		switch f {
+		case "FlateDecode", "Fl":
+			if data, err = inflate(data); err == nil {
+				data, err = d.unpredict(data, params[i])
+			}
+		case "ASCIIHexDecode", "AHx":
+			data = []byte((&lexer{data: append(append([]byte{'<'}, data...), '>')}).hex())
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		case "RunLengthDecode", "RL":
+			data = decodeRunLength(data)
+		case "DCTDecode", "DCT", "JPXDecode", "CCITTFaxDecode", "CCF", "JBIG2Decode":
+			return data, f, nil
+		default:
+			return nil, "", fmt.Errorf("pdf: unsupported filter %s", f)
+		}
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	return data, "", nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	var r io.Reader
+	if zr, err := zlib.NewReader(bytes.NewReader(data)); err == nil {
+		r = zr
+	} else {
+		r = flate.NewReader(bytes.NewReader(data)) // some writers omit the zlib header
+	}
+	out, err := io.ReadAll(io.LimitReader(r, maxDecoded+1))
+	if len(out) > maxDecoded {
+		return nil, fmt.Errorf("pdf: stream larger than %d bytes", maxDecoded)
+	}
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil // a truncated stream still gives what was read
+}
+
+// unpredict undoes the PNG and TIFF predictors of Flate streams
+func (d *Document) unpredict(data []byte, p Dict) ([]byte, error) {
+	predictor, _ := d.int(p["Predictor"])
+	if predictor < 2 {
+		return data, nil
+	}
+	colors, bpc, columns := 1, 8, 1
+	if v, ok := d.int(p["Colors"]); ok && v > 0 {
+		colors = v
+	}
+	if v, ok := d.int(p["BitsPerComponent"]); ok && v > 0 {
+		bpc = v
+	}
+	if v, ok := d.int(p["Columns"]); ok && v > 0 {
+		columns = v
+	}
+	bpp := max(1, colors*bpc/8)
+	rowLen := (colors*bpc*columns + 7) / 8
+
+	if predictor == 2 {
+		if bpc != 8 {
+			return nil, fmt.Errorf("pdf: unsupported TIFF predictor with %d bits", bpc)
+		}
+		for row := 0; row+rowLen <= len(data); row += rowLen {
+			for i := row + bpp; i < row+rowLen; i++ {
+				data[i] += data[i-bpp]
+			}
+		}
+		return data, nil
+	}
+
+	out := make([]byte, 0, len(data))
+	prev := make([]byte, rowLen)
+	for pos := 0; pos+1+rowLen <= len(data); pos += 1 + rowLen {
+		kind := data[pos]
+		row := append([]byte(nil), data[pos+1:pos+1+rowLen]...)
+		for i := range row {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = row[i-bpp], prev[i-bpp]
+			}
+			up := prev[i]
+			switch kind {
+			case 1:
+				row[i] += left
+			case 2:
+				row[i] += up
+			case 3:
+				row[i] += byte((int(left) + int(up)) / 2)
+			case 4:
+				row[i] += paeth(left, up, upLeft)
+			}
+		}
+		out = append(out, row...)
+		prev = row
+	}
+	return out, nil
+}
+
+func paeth(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := abs(p-int(a)), abs(p-int(b)), abs(p-int(c))
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	out, err := io.ReadAll(io.LimitReader(ascii85.NewDecoder(bytes.NewReader(data)), maxDecoded))
+	if err != nil && len(out) == 0 {
+		return nil, err
+	}
+	return out, nil
+}
+
+func decodeRunLength(data []byte) []byte {
+	var out []byte
+	for i := 0; i < len(data) && len(out) < maxDecoded; {
+		n := int(data[i])
+		i++
+		switch {
+		case n < 128:
+			end := min(i+n+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		case n > 128 && i < len(data):
+			out = append(out, bytes.Repeat(data[i:i+1], 257-n)...)
+			i++
+		default:
+			return out // 128 is end of data
+		}
+	}
+	return out
+}
@@ -0,0 +1,324 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font knows how a font splits strings into character codes, how wide each
+// one is and, where the file says, which text it stands for
+type font struct {
+	twoByte      bool // Type0 fonts: two-byte codes unless the CMap says otherwise
+	utf16        bool // a Unicode CMap such as UniJIS-UCS2-H: codes are UTF-16
+	codespace    []codespaceRange
+	toUnicode    map[uint32]string
+	widths       map[uint32]float64 // in em
+	defaultWidth float64
+	encoding     *[256]rune // simple fonts without a ToUnicode map
+}
+
+type codespaceRange struct {
+	n      int // bytes per code
+	lo, hi uint32
+}
+
+func (d *Document) loadFont(v any) *font {
+	fd := d.dict(v)
+	f := &font{widths: map[uint32]float64{}, defaultWidth: 0.5}
+	if fd == nil {
+		return f
+	}
+
+	if s := d.stream(fd["ToUnicode"]); s != nil {
+		if data, filter, err := d.decode(s); err == nil && filter == "" {
+			f.toUnicode, f.codespace = parseCMap(data)
+		}
+	}
+
+	if d.name(fd["Subtype"]) == "Type0" {
+		f.twoByte = true
+		enc := string(d.name(fd["Encoding"]))
+		f.utf16 = strings.Contains(enc, "UCS2") || strings.Contains(enc, "UTF16")
+		desc := fd
+		if kids := d.array(fd["DescendantFonts"]); len(kids) > 0 {
+			desc = d.dict(kids[0])
+		}
+		f.defaultWidth = 1
+		if dw, ok := d.num(desc["DW"]); ok {
+			f.defaultWidth = dw / 1000
+		}
+		f.loadCIDWidths(d, d.array(desc["W"]))
+		return f
+	}
+
+	// Simple fonts: one byte per code
+	scale := 0.001
+	if d.name(fd["Subtype"]) == "Type3" {
+		if m := d.nums(fd["FontMatrix"]); len(m) > 0 {
+			scale = m[0]
+		}
+	}
+	first, _ := d.int(fd["FirstChar"])
+	for i, w := range d.nums(fd["Widths"]) {
+		f.widths[uint32(first+i)] = w * scale
+	}
+	if mw, ok := d.num(d.dict(fd["FontDescriptor"])["MissingWidth"]); ok && mw > 0 {
+		f.defaultWidth = mw * scale
+	}
+	f.encoding = d.simpleEncoding(fd["Encoding"])
+	return f
+}
+
+// loadCIDWidths reads a W array: "c [w1 w2 ...]" or "cFirst cLast w"
+func (f *font) loadCIDWidths(d *Document, w Array) {
+	for i := 0; i+1 < len(w); {
+		first, _ := d.int(w[i])
+		if list := d.array(w[i+1]); list != nil {
+			for j, x := range list {
+				width, _ := d.num(x)
+				f.widths[uint32(first+j)] = width / 1000
+			}
+			i += 2
+			continue
+		}
+		if i+2 >= len(w) {
+			return
+		}
+		last, _ := d.int(w[i+1])
+		width, _ := d.num(w[i+2])
+		for c := first; c <= last && c-first < 0x10000; c++ {
+			f.widths[uint32(c)] = width / 1000
+		}
+		i += 3
+	}
+}
+
+// codes splits a string operand into character codes
+func (f *font) codes(s string) []uint32 {
+	var out []uint32
+	for i := 0; i < len(s); {
+		n := f.codeLength(s[i:])
+		var c uint32
+		for j := 0; j < n; j++ {
+			c = c<<8 | uint32(s[i+j])
+		}
+		out = append(out, c)
+		i += n
+	}
+	return out
+}
+
+func (f *font) codeLength(s string) int {
+	for _, r := range f.codespace {
+		if r.n > len(s) {
+			continue
+		}
+		var c uint32
+		for j := 0; j < r.n; j++ {
+			c = c<<8 | uint32(s[j])
+		}
+		if c >= r.lo && c <= r.hi {
+			return r.n
+		}
+	}
+	if f.twoByte && len(s) >= 2 {
+		return 2
+	}
+	return 1
+}
+
+func (f *font) width(code uint32) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	return f.defaultWidth
+}
+
+// text returns what a code stands for, or "" if the file doesn't say
+func (f *font) text(code uint32) string {
+	if s, ok := f.toUnicode[code]; ok {
+		return s
+	}
+	switch {
+	case f.utf16:
+		return string(rune(code))
+	case f.twoByte:
+		return ""
+	case f.encoding != nil && code < 256 && f.encoding[code] != 0:
+		return string(f.encoding[code])
+	}
+	return ""
+}
+
+// isSpace reports whether a code is the word space, which Tw widens
+func (f *font) isSpace(code uint32) bool {
+	return !f.twoByte && code == ' '
+}
+
+// simpleEncoding builds the code to rune table of a simple font: WinAnsi
+// (close enough to Standard and MacRoman for previews) plus Differences
+func (d *Document) simpleEncoding(v any) *[256]rune {
+	var enc [256]rune
+	for i := 32; i < 256; i++ {
+		enc[i] = rune(i)
+	}
+	for i, r := range winAnsiHigh {
+		if r != 0 {
+			enc[0x80+i] = r
+		}
+	}
+	code := 0
+	for _, x := range d.array(d.dict(v)["Differences"]) {
+		switch x := d.resolve(x).(type) {
+		case int:
+			code = x
+		case Name:
+			if code >= 0 && code < 256 {
+				enc[code] = glyphRune(string(x))
+			}
+			code++
+		}
+	}
+	return &enc
+}
+
+// winAnsiHigh is WinAnsiEncoding for 0x80-0x9F, where it differs from Latin-1
+var winAnsiHigh = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+var glyphNames = map[string]rune{
+	"space": ' ', "exclam": '!', "quotedbl": '"', "numbersign": '#', "dollar": '$',
+	"percent": '%', "ampersand": '&', "quotesingle": '\'', "parenleft": '(',
+	"parenright": ')', "asterisk": '*', "plus": '+', "comma": ',', "hyphen": '-',
+	"period": '.', "slash": '/', "zero": '0', "one": '1', "two": '2', "three": '3',
+	"four": '4', "five": '5', "six": '6', "seven": '7', "eight": '8', "nine": '9',
+	"colon": ':', "semicolon": ';', "less": '<', "equal": '=', "greater": '>',
+	"question": '?', "at": '@', "bracketleft": '[', "backslash": '\\',
+	"bracketright": ']', "asciicircum": '^', "underscore": '_', "grave": '`',
+	"braceleft": '{', "bar": '|', "braceright": '}', "asciitilde": '~',
+	"quoteleft": '‘', "quoteright": '’', "quotedblleft": '“', "quotedblright": '”',
+	"endash": '–', "emdash": '—', "bullet": '•', "ellipsis": '…', "minus": '−',
+	"fi": 'ﬁ', "fl": 'ﬂ', "degree": '°', "copyright": '©', "registered": '®',
+}
+
+func glyphRune(name string) rune {
+	if r, ok := glyphNames[name]; ok {
+		return r
+	}
+	if len(name) == 1 {
+		return rune(name[0])
+	}
+	hex, ok := strings.CutPrefix(name, "uni")
+	if ok && len(hex) >= 4 {
+		hex = hex[:4] // "uni30423044" is a ligature; keep the first
+	} else if hex, ok = strings.CutPrefix(name, "u"); !ok || len(hex) < 4 || len(hex) > 6 {
+		return 0
+	}
+	n, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return 0
+	}
+	return rune(n)
+}
+
+// parseCMap reads the bfchar and bfrange mappings and the code space of a
+// ToUnicode CMap
+func parseCMap(data []byte) (map[uint32]string, []codespaceRange) {
+	m := map[uint32]string{}
+	var space []codespaceRange
+	l := &lexer{data: data}
+
+	// operands collects the values of one begin...end block
+	block := func(end keyword) []any {
+		var ops []any
+		for {
+			v, err := l.value()
+			if err != nil || v == end {
+				return ops
+			}
+			ops = append(ops, v)
+		}
+	}
+	for {
+		v, err := l.value()
+		if err != nil {
+			break
+		}
+		switch v {
+		case keyword("begincodespacerange"):
+			ops := block("endcodespacerange")
+			for i := 0; i+1 < len(ops); i += 2 {
+				lo, _ := ops[i].(string)
+				hi, _ := ops[i+1].(string)
+				if len(lo) > 0 && len(lo) <= 4 && len(lo) == len(hi) {
+					space = append(space, codespaceRange{len(lo), code(lo), code(hi)})
+				}
+			}
+		case keyword("beginbfchar"):
+			ops := block("endbfchar")
+			for i := 0; i+1 < len(ops); i += 2 {
+				src, _ := ops[i].(string)
+				switch dst := ops[i+1].(type) {
+				case string:
+					m[code(src)] = utf16String(dst)
+				case Name:
+					if r := glyphRune(string(dst)); r != 0 {
+						m[code(src)] = string(r)
+					}
+				}
+			}
+		case keyword("beginbfrange"):
+			ops := block("endbfrange")
+			for i := 0; i+2 < len(ops); i += 3 {
+				lo, _ := ops[i].(string)
+				hi, _ := ops[i+1].(string)
+				first, last := code(lo), code(hi)
+				if last < first || last-first > 0xFFFF {
+					continue
+				}
+				switch dst := ops[i+2].(type) {
+				case string:
+					units := utf16.Encode([]rune(utf16String(dst)))
+					if len(units) == 0 {
+						continue
+					}
+					for c := first; c <= last; c++ {
+						u := append([]uint16(nil), units...)
+						u[len(u)-1] += uint16(c - first)
+						m[c] = string(utf16.Decode(u))
+					}
+				case Array:
+					for j, x := range dst {
+						if s, ok := x.(string); ok && first+uint32(j) <= last {
+							m[first+uint32(j)] = utf16String(s)
+						}
+					}
+				}
+			}
+		}
+	}
+	return m, space
+}
+
+// code reads a big-endian character code
+func code(s string) uint32 {
+	var c uint32
+	for i := 0; i < len(s) && i < 4; i++ {
+		c = c<<8 | uint32(s[i])
+	}
+	return c
+}
+
+func utf16String(s string) string {
+	units := make([]uint16, 0, len(s)/2)
+	for i := 0; i+1 < len(s); i += 2 {
+		units = append(units, uint16(s[i])<<8|uint16(s[i+1]))
+	}
+	if len(s)%2 == 1 {
+		units = append(units, uint16(s[len(s)-1]))
+	}
+	return string(utf16.Decode(units))
+}
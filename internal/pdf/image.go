@@ -0,0 +1,233 @@
+package pdf
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/jpeg"
+)
+
+// maxImagePixels bounds the size of an image we decode
+const maxImagePixels = 40_000_000
+
+// image decodes an image XObject. It returns nil for codecs we don't
+// read (JPEG 2000, CCITT, JBIG2) or broken data; the caller draws a grey
+// box instead. Stencil masks are painted in fill.
+func (d *Document) image(s *Stream, fill color.RGBA) image.Image {
+	w, _ := d.int(s.Dict["Width"])
+	h, _ := d.int(s.Dict["Height"])
+	if w <= 0 || h <= 0 || w*h > maxImagePixels {
+		return nil
+	}
+	data, filter, err := d.decode(s)
+	if err != nil {
+		return nil
+	}
+
+	var img image.Image
+	switch filter {
+	case "DCTDecode", "DCT":
+		if img, err = jpeg.Decode(bytes.NewReader(data)); err != nil {
+			return nil
+		}
+	case "":
+		if mask, _ := d.resolve(s.Dict["ImageMask"]).(bool); mask {
+			return d.stencil(s, data, w, h, fill)
+		}
+		if img = d.rawImage(s, data, w, h); img == nil {
+			return nil
+		}
+	default:
+		return nil
+	}
+
+	if sm := d.stream(s.Dict["SMask"]); sm != nil {
+		if alpha := d.image(sm, fill); alpha != nil {
+			return withAlpha(img, alpha)
+		}
+	}
+	return img
+}
+
+// sampler reads packed samples of 1 to 16 bits
+type sampler struct {
+	data     []byte
+	bpc      int
+	rowBytes int
+}
+
+func (s sampler) at(row, index int) int {
+	switch s.bpc {
+	case 8:
+		return int(s.data[row*s.rowBytes+index])
+	case 16:
+		return int(s.data[row*s.rowBytes+index*2])
+	}
+	bit := index * s.bpc
+	b := s.data[row*s.rowBytes+bit/8]
+	shift := 8 - s.bpc - bit%8
+	return int(b>>shift) & (1<<s.bpc - 1)
+}
+
+func (s sampler) max() int {
+	if s.bpc == 16 {
+		return 255
+	}
+	return 1<<s.bpc - 1
+}
+
+func (d *Document) rawImage(s *Stream, data []byte, w, h int) image.Image {
+	bpc, _ := d.int(s.Dict["BitsPerComponent"])
+	if bpc == 0 {
+		bpc = 8
+	}
+	if bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && bpc != 16 {
+		return nil
+	}
+	space, comps, palette := d.colorSpace(s.Dict["ColorSpace"])
+	if comps == 0 {
+		return nil
+	}
+	smp := sampler{data: data, bpc: bpc, rowBytes: (w*comps*bpc + 7) / 8}
+	h = min(h, len(data)/smp.rowBytes)
+	if h == 0 {
+		return nil
+	}
+	decode := d.nums(s.Dict["Decode"])
+	inverted := len(decode) >= 2 && decode[0] > decode[1]
+
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	top := float64(smp.max())
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var v [4]float64
+			for c := 0; c < comps; c++ {
+				v[c] = float64(smp.at(y, x*comps+c)) / top
+				if inverted {
+					v[c] = 1 - v[c]
+				}
+			}
+			var col color.RGBA
+			switch {
+			case palette != nil:
+				col = palette[min(smp.at(y, x), len(palette)-1)]
+			case space == "gray":
+				col = color.RGBA{clamp8(v[0]), clamp8(v[0]), clamp8(v[0]), 0xff}
+			case space == "separation":
+				col = color.RGBA{clamp8(1 - v[0]), clamp8(1 - v[0]), clamp8(1 - v[0]), 0xff}
+			case space == "cmyk":
+				col = cmyk(v[0], v[1], v[2], v[3])
+			default:
+				col = color.RGBA{clamp8(v[0]), clamp8(v[1]), clamp8(v[2]), 0xff}
+			}
+			img.SetRGBA(x, y, col)
+		}
+	}
+	return img
+}
+
+// stencil paints fill where an image mask's sample is 0 (1 with Decode [1 0])
+func (d *Document) stencil(s *Stream, data []byte, w, h int, fill color.RGBA) image.Image {
+	smp := sampler{data: data, bpc: 1, rowBytes: (w + 7) / 8}
+	h = min(h, len(data)/smp.rowBytes)
+	paint := 0
+	if decode := d.nums(s.Dict["Decode"]); len(decode) >= 1 && decode[0] == 1 {
+		paint = 1
+	}
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if smp.at(y, x) == paint {
+				img.SetNRGBA(x, y, color.NRGBA{fill.R, fill.G, fill.B, 0xff})
+			}
+		}
+	}
+	return img
+}
+
+// colorSpace returns "gray", "rgb" or "cmyk" and the number of components,
+// or a palette for an Indexed space. comps is 0 for spaces we can't show.
+func (d *Document) colorSpace(v any) (space string, comps int, palette []color.RGBA) {
+	switch cs := d.resolve(v).(type) {
+	case Name:
+		switch cs {
+		case "DeviceGray", "G", "CalGray":
+			return "gray", 1, nil
+		case "DeviceRGB", "RGB", "CalRGB":
+			return "rgb", 3, nil
+		case "DeviceCMYK", "CMYK":
+			return "cmyk", 4, nil
+		}
+	case Array:
+		if len(cs) == 0 {
+			return "", 0, nil
+		}
+		switch d.name(cs[0]) {
+		case "ICCBased":
+			n, _ := d.int(d.dict(cs[1%len(cs)])["N"])
+			switch n {
+			case 1:
+				return "gray", 1, nil
+			case 4:
+				return "cmyk", 4, nil
+			}
+			return "rgb", 3, nil
+		case "CalGray":
+			return "gray", 1, nil
+		case "CalRGB", "Lab":
+			return "rgb", 3, nil
+		case "Separation":
+			// One tint component; shown as grey (1 is full ink, so dark)
+			return "separation", 1, nil
+		case "Indexed", "I":
+			if len(cs) < 4 {
+				return "", 0, nil
+			}
+			base, baseComps, _ := d.colorSpace(cs[1])
+			var lookup []byte
+			switch l := d.resolve(cs[3]).(type) {
+			case string:
+				lookup = []byte(l)
+			case *Stream:
+				lookup, _, _ = d.decode(l)
+			}
+			if baseComps == 0 {
+				return "", 0, nil
+			}
+			for i := 0; (i+1)*baseComps <= len(lookup) && i < 256; i++ {
+				e := lookup[i*baseComps:]
+				var c color.RGBA
+				switch base {
+				case "gray":
+					c = color.RGBA{e[0], e[0], e[0], 0xff}
+				case "cmyk":
+					c = cmyk(float64(e[0])/255, float64(e[1])/255, float64(e[2])/255, float64(e[3])/255)
+				default:
+					c = color.RGBA{e[0], e[1], e[2], 0xff}
+				}
+				palette = append(palette, c)
+			}
+			if len(palette) == 0 {
+				return "", 0, nil
+			}
+			return "indexed", 1, palette
+		}
+	}
+	return "", 0, nil
+}
+
+// withAlpha combines an image with a soft mask (its grey level is alpha)
+func withAlpha(img, mask image.Image) image.Image {
+	b, mb := img.Bounds(), mask.Bounds()
+	out := image.NewNRGBA(b)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		my := mb.Min.Y + (y-b.Min.Y)*mb.Dy()/b.Dy()
+		for x := b.Min.X; x < b.Max.X; x++ {
+			mx := mb.Min.X + (x-b.Min.X)*mb.Dx()/b.Dx()
+			r, g, bl, _ := img.At(x, y).RGBA()
+			a, _, _, _ := mask.At(mx, my).RGBA()
+			out.SetNRGBA(x, y, color.NRGBA{uint8(r >> 8), uint8(g >> 8), uint8(bl >> 8), uint8(a >> 8)})
+		}
+	}
+	return out
+}
@@ -0,0 +1,349 @@
+package pdf
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+)
+
+// PDF objects are read into these types. Numbers are int or float64,
+// strings are Go strings holding the raw bytes, and null is nil.
+type (
+	Name  string
+	Dict  map[Name]any
+	Array []any
+	Ref   struct{ Num, Gen int }
+)
+
+// Stream is a dictionary with data. Data is still encoded; see decode.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// keyword is a bare word: an operator in a content stream or CMap
+type keyword string
+
+var errSyntax = errors.New("pdf: syntax error")
+
+// maxDepth bounds nesting of arrays and dictionaries, and of references
+const maxDepth = 64
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+func (l *lexer) peek(off int) byte {
+	if l.pos+off < len(l.data) {
+		return l.data[l.pos+off]
+	}
+	return 0
+}
+
+// skipSpace skips white space and comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isSpace(c) {
+			l.pos++
+			continue
+		}
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+		return
+	}
+}
+
+// value reads the next object. Bare words come back as keyword, so the
+// same lexer reads files, content streams and CMaps.
+func (l *lexer) value() (any, error) {
+	return l.valueAt(0)
+}
+
+func (l *lexer) valueAt(depth int) (any, error) {
+	if depth > maxDepth {
+		return nil, errSyntax
+	}
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return nil, io.EOF
+	}
+	switch c := l.data[l.pos]; {
+	case c == '/':
+		l.pos++
+		return Name(l.word()), nil
+	case c == '(':
+		return l.literal(), nil
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		return l.dict(depth)
+	case c == '<':
+		return l.hex(), nil
+	case c == '[':
+		l.pos++
+		a := Array{}
+		for {
+			l.skipSpace()
+			if l.pos >= len(l.data) {
+				return nil, errSyntax
+			}
+			if l.data[l.pos] == ']' {
+				l.pos++
+				return a, nil
+			}
+			v, err := l.valueAt(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			a = append(a, v)
+		}
+	case c == '+' || c == '-' || c == '.' || (c >= '0' && c <= '9'):
+		return l.number(), nil
+	case isDelim(c):
+		// Stray ] > ) and braces; a content stream may go on after them
+		l.pos++
+		return keyword(c), nil
+	}
+	switch w := l.word(); w {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "null":
+		return nil, nil
+	default:
+		return keyword(w), nil
+	}
+}
+
+// word reads regular characters; in a name, #xx stands for a byte
+func (l *lexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelim(l.data[l.pos]) {
+		l.pos++
+	}
+	w := l.data[start:l.pos]
+	if bytes.IndexByte(w, '#') < 0 {
+		return string(w)
+	}
+	var out []byte
+	for i := 0; i < len(w); i++ {
+		if w[i] == '#' && i+2 < len(w) {
+			if b, err := strconv.ParseUint(string(w[i+1:i+3]), 16, 8); err == nil {
+				out = append(out, byte(b))
+				i += 2
+				continue
+			}
+		}
+		out = append(out, w[i])
+	}
+	return string(out)
+}
+
+// number reads an int or a float64, or a reference if the int is
+// followed by another int and R
+func (l *lexer) number() any {
+	start := l.pos
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c != '+' && c != '-' && c != '.' && (c < '0' || c > '9') {
+			break
+		}
+		l.pos++
+	}
+	s := string(l.data[start:l.pos])
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		f, _ := strconv.ParseFloat(s, 64)
+		return f
+	}
+
+	save := l.pos
+	l.skipSpace()
+	genStart := l.pos
+	for l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '9' {
+		l.pos++
+	}
+	if l.pos > genStart {
+		gen, _ := strconv.Atoi(string(l.data[genStart:l.pos]))
+		l.skipSpace()
+		if l.peek(0) == 'R' && (l.pos+1 >= len(l.data) || isSpace(l.peek(1)) || isDelim(l.peek(1))) {
+			l.pos++
+			return Ref{n, gen}
+		}
+	}
+	l.pos = save
+	return n
+}
+
+func (l *lexer) literal() string {
+	l.pos++ // (
+	var buf []byte
+	depth := 1
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return string(buf)
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return string(buf)
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+				continue // line continuation
+			case '\n':
+				continue
+			default:
+				if e >= '0' && e <= '7' {
+					v := int(e - '0')
+					for i := 0; i < 2 && l.peek(0) >= '0' && l.peek(0) <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				} else {
+					c = e
+				}
+			}
+		}
+		buf = append(buf, c)
+	}
+	return string(buf)
+}
+
+func (l *lexer) hex() string {
+	l.pos++ // <
+	var buf []byte
+	var hi byte
+	half := false
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		if c == '>' {
+			break
+		}
+		var v byte
+		switch {
+		case c >= '0' && c <= '9':
+			v = c - '0'
+		case c >= 'a' && c <= 'f':
+			v = c - 'a' + 10
+		case c >= 'A' && c <= 'F':
+			v = c - 'A' + 10
+		default:
+			continue
+		}
+		if half {
+			buf = append(buf, hi<<4|v)
+		} else {
+			hi = v
+		}
+		half = !half
+	}
+	if half {
+		buf = append(buf, hi<<4)
+	}
+	return string(buf)
+}
+
+// dict reads a dictionary after its <<, and the stream data if one follows
+func (l *lexer) dict(depth int) (any, error) {
+	d := Dict{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.data) {
+			return nil, errSyntax
+		}
+		if l.data[l.pos] == '>' && l.peek(1) == '>' {
+			l.pos += 2
+			break
+		}
+		k, err := l.valueAt(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		key, ok := k.(Name)
+		if !ok {
+			return nil, errSyntax
+		}
+		v, err := l.valueAt(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		d[key] = v
+	}
+
+	save := l.pos
+	l.skipSpace()
+	if !bytes.HasPrefix(l.data[l.pos:], []byte("stream")) {
+		l.pos = save
+		return d, nil
+	}
+	l.pos += len("stream")
+	if l.peek(0) == '\r' {
+		l.pos++
+	}
+	if l.peek(0) == '\n' {
+		l.pos++
+	}
+	start := l.pos
+
+	// Trust /Length if "endstream" is where it says; otherwise (an indirect
+	// or wrong length) look for the keyword
+	if n, ok := d["Length"].(int); ok && n >= 0 && start+n <= len(l.data) {
+		end := &lexer{data: l.data, pos: start + n}
+		end.skipSpace()
+		if bytes.HasPrefix(l.data[end.pos:], []byte("endstream")) {
+			l.pos = end.pos + len("endstream")
+			return &Stream{Dict: d, Data: l.data[start : start+n]}, nil
+		}
+	}
+	i := bytes.Index(l.data[start:], []byte("endstream"))
+	if i < 0 {
+		return nil, errSyntax
+	}
+	data := l.data[start : start+i]
+	data = bytes.TrimSuffix(data, []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+	l.pos = start + i + len("endstream")
+	return &Stream{Dict: d, Data: data}, nil
+}
@@ -0,0 +1,145 @@
+package pdf
+
+import (
+	"context"
+	"image"
+	"math"
+	"strings"
+)
+
+// maxPages bounds the page tree walk
+const maxPages = 10000
+
+type page struct {
+	dict      Dict
+	resources Dict
+	box       [4]float64 // x0 y0 x1 y1 of the visible area
+	rotate    int
+}
+
+// pages returns the first n pages in order, with inherited attributes
+func (d *Document) pages(n int) []page {
+	var out []page
+	visited := 0
+	var walk func(v any, inherited page, depth int)
+	walk = func(v any, inherited page, depth int) {
+		node := d.dict(v)
+		if node == nil || len(out) >= n || depth > maxDepth || visited > maxPages {
+			return
+		}
+		visited++
+		p := inherited
+		p.dict = node
+		if r := d.dict(node["Resources"]); r != nil {
+			p.resources = r
+		}
+		if b := d.nums(node["MediaBox"]); len(b) == 4 {
+			p.box = [4]float64(b)
+		}
+		if b := d.nums(node["CropBox"]); len(b) == 4 {
+			p.box = [4]float64(b)
+		}
+		if r, ok := d.int(node["Rotate"]); ok {
+			p.rotate = ((r % 360) + 360) % 360
+		}
+		if kids, ok := d.resolve(node["Kids"]).(Array); ok {
+			for _, k := range kids {
+				walk(k, p, depth+1)
+			}
+			return
+		}
+		x0, x1 := math.Min(p.box[0], p.box[2]), math.Max(p.box[0], p.box[2])
+		y0, y1 := math.Min(p.box[1], p.box[3]), math.Max(p.box[1], p.box[3])
+		p.box = [4]float64{x0, y0, x1, y1}
+		if x1-x0 < 1 || y1-y0 < 1 {
+			p.box = [4]float64{0, 0, 595, 842} // A4
+		}
+		out = append(out, p)
+	}
+	walk(d.root["Pages"], page{}, 0)
+	return out
+}
+
+// content returns the page's content streams decoded and joined
+func (d *Document) content(p page) []byte {
+	var parts []any
+	switch c := d.resolve(p.dict["Contents"]).(type) {
+	case Array:
+		parts = c
+	case *Stream:
+		parts = []any{c}
+	}
+	var out []byte
+	for _, part := range parts {
+		s := d.stream(part)
+		if s == nil {
+			continue
+		}
+		if data, filter, err := d.decode(s); err == nil && filter == "" {
+			out = append(out, data...)
+			out = append(out, '\n')
+		}
+	}
+	return out
+}
+
+// supersample is how many device pixels make one thumbnail pixel each way
+const supersample = 2
+
+// Thumbnail renders the first page width pixels wide. Text shows as grey
+// bars; pictures, fills and lines are drawn as they are. It returns
+// ctx.Err() if ctx is done first.
+func (d *Document) Thumbnail(ctx context.Context, width int) (img *image.RGBA, err error) {
+	defer recoverErr(&err)
+
+	pages := d.pages(1)
+	if len(pages) == 0 {
+		return nil, ErrNoPages
+	}
+	p := pages[0]
+	pw, ph := p.box[2]-p.box[0], p.box[3]-p.box[1]
+	if p.rotate == 90 || p.rotate == 270 {
+		pw, ph = ph, pw
+	}
+	s := float64(width*supersample) / pw
+	height := min(int(math.Round(ph*s/supersample)), 4*width) // a very long page is cut off
+
+	x0, y0, x1, y1 := p.box[0], p.box[1], p.box[2], p.box[3]
+	var base matrix
+	switch p.rotate {
+	case 90:
+		base = matrix{0, s, s, 0, -y0 * s, -x0 * s}
+	case 180:
+		base = matrix{-s, 0, 0, s, x1 * s, -y0 * s}
+	case 270:
+		base = matrix{0, -s, -s, 0, y1 * s, x1 * s}
+	default:
+		base = matrix{s, 0, 0, -s, -x0 * s, y1 * s}
+	}
+
+	c := newCanvas(width*supersample, max(1, height)*supersample)
+	newInterp(ctx, d, c, base).run(d.content(p), p.resources)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return c.downscale(supersample), nil
+}
+
+// Text returns the text of the first pages, in reading order with blank
+// lines between paragraphs. It returns ctx.Err() if ctx is done first.
+func (d *Document) Text(ctx context.Context, pages int) (text string, err error) {
+	defer recoverErr(&err)
+
+	var parts []string
+	for _, p := range d.pages(pages) {
+		in := newInterp(ctx, d, nil, identity)
+		in.run(d.content(p), p.resources)
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		if t := in.text.String(); t != "" {
+			parts = append(parts, t)
+		}
+	}
+	return strings.Join(parts, "\n\n"), nil
+}
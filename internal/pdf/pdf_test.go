@@ -0,0 +1,321 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"context"
+	"errors"
+	"fmt"
+	"image/color"
+	"strings"
+	"testing"
+	"time"
+)
+
+// build writes a PDF from object bodies, numbered from 1, with a correct
+// cross-reference table and a trailer pointing at object 1
+func build(objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return b.Bytes()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+// onePage is a one-page document with the given content stream
+func onePage(content string) []byte {
+	return build(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 100] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >>",
+		stream("", content),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+}
+
+func deflate(data []byte) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write(data)
+	w.Close()
+	return b.String()
+}
+
+func openText(t *testing.T, data []byte) string {
+	t.Helper()
+	doc, err := Open(context.Background(), data)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	text, err := doc.Text(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+	return text
+}
+
+func TestText(t *testing.T) {
+	text := openText(t, onePage("BT /F1 12 Tf 10 70 Td (Summer school) Tj 0 -14 Td (for families) Tj 0 -40 Td (Bring a pen) Tj ET"))
+	want := []string{"Summer school for families", "Bring a pen"}
+	if got := Paragraphs(text); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Paragraphs = %q, want %q (text %q)", got, want, text)
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	// The left half filled black
+	doc, err := Open(context.Background(), onePage("0 0 0 rg 0 0 100 100 re f"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := doc.Thumbnail(context.Background(), 40)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b := img.Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+		t.Fatalf("size = %v, want 40x20", b)
+	}
+	dark := func(c color.RGBA) bool { return c.R < 64 && c.G < 64 && c.B < 64 }
+	if !dark(img.RGBAAt(5, 10)) || dark(img.RGBAAt(35, 10)) {
+		t.Errorf("left %v, right %v; want the left half dark", img.RGBAAt(5, 10), img.RGBAAt(35, 10))
+	}
+}
+
+func TestOpenErrors(t *testing.T) {
+	encrypted := strings.Replace(string(onePage("")), "/Root 1 0 R", "/Root 1 0 R /Encrypt << /Filter /Standard >>", 1)
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"not a pdf", []byte("<html></html>"), nil},
+		{"empty", nil, nil},
+		{"encrypted", []byte(encrypted), ErrEncrypted},
+		{"no catalog", build("<< /Type /Font >>"), ErrNoPages},
+		{"header only", []byte("%PDF-1.7\n"), ErrNoPages},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := Open(context.Background(), tt.data)
+			if err == nil || doc != nil {
+				t.Fatalf("Open = %v, %v; want an error", doc, err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestOpenCorruptXref(t *testing.T) {
+	good := onePage("BT /F1 12 Tf 10 70 Td (Hello) Tj ET")
+	xref := bytes.Index(good, []byte("xref"))
+	trailer := bytes.Index(good, []byte("trailer"))
+
+	tests := map[string][]byte{
+		// Every offset wrong
+		"garbage xref": append(append(append([]byte{}, good[:xref]...), "xref\n0 6\nnonsense 12 n\n"...), good[trailer:]...),
+		// Cut off after the objects: no xref, no trailer
+		"truncated": good[:xref],
+		// startxref beyond the end of the file
+		"bad startxref": bytes.Replace(good, []byte("startxref\n"), []byte("startxref\n999999999"), 1),
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			if text := openText(t, data); text != "Hello" {
+				t.Errorf("text = %q", text)
+			}
+		})
+	}
+}
+
+func TestNestingBomb(t *testing.T) {
+	deep := strings.Repeat("[", 100000) + strings.Repeat("]", 100000)
+	data := build(
+		"<< /Type /Catalog /Pages 2 0 R /Deep "+deep+" >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 4 0 R /Extra "+strings.Repeat("<< /A ", 100000)+" >>",
+		stream("", "q "+deep+" Q"),
+	)
+	doc, err := Open(context.Background(), data)
+	if err != nil {
+		// The catalog nests too deep to parse, so there is no usable root
+		if !errors.Is(err, ErrNoPages) {
+			t.Fatalf("Open: %v", err)
+		}
+		return
+	}
+	if _, err := doc.Text(context.Background(), 3); err != nil {
+		t.Fatalf("Text: %v", err)
+	}
+}
+
+func TestPageTreeLoop(t *testing.T) {
+	// The Pages node lists itself as a kid, and a reference chain loops
+	data := build(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [2 0 R 3 0 R 4 0 R] /Count 2 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents 5 0 R /Resources << /Font << /F1 6 0 R >> >> >>",
+		"7 0 R",
+		stream("", "BT /F1 12 Tf (Loop) Tj ET"),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+		"4 0 R",
+	)
+	if text := openText(t, data); !strings.Contains(text, "Loop") {
+		t.Errorf("text = %q", text)
+	}
+}
+
+func TestFormXObjectLoop(t *testing.T) {
+	// A form that draws itself
+	data := build(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 100 100] /Contents 4 0 R /Resources << /XObject << /X 5 0 R >> >> >>",
+		stream("", "/X Do"),
+		stream("/Type /XObject /Subtype /Form /BBox [0 0 100 100] /Resources << /XObject << /X 5 0 R >> >>", "/X Do /X Do"),
+	)
+	doc, err := Open(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Thumbnail(context.Background(), 20); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestHugeStream(t *testing.T) {
+	if testing.Short() {
+		t.Skip("inflates 64 MB")
+	}
+	// Compresses to about 64 KB, inflates past maxDecoded
+	bomb := deflate(make([]byte, maxDecoded+1))
+	data := build(
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Contents [4 0 R 5 0 R] /Resources << /Font << /F1 6 0 R >> >> >>",
+		stream("/Filter /FlateDecode", bomb),
+		stream("", "BT /F1 12 Tf (After) Tj ET"),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	)
+	doc, err := Open(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := doc.decode(doc.stream(Ref{Num: 4})); err == nil {
+		t.Error("oversized stream decoded")
+	}
+	// The oversized stream is skipped; the rest of the page still reads
+	if text, err := doc.Text(context.Background(), 1); err != nil || text != "After" {
+		t.Errorf("Text = %q, %v", text, err)
+	}
+}
+
+func TestCancelled(t *testing.T) {
+	data := onePage(strings.Repeat("0 0 1 1 re f\n", 100000))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := Open(ctx, data); !errors.Is(err, context.Canceled) {
+		t.Errorf("Open = %v, want context.Canceled", err)
+	}
+	doc, err := Open(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := doc.Text(ctx, 1); !errors.Is(err, context.Canceled) {
+		t.Errorf("Text = %v, want context.Canceled", err)
+	}
+	if _, err := doc.Thumbnail(ctx, 100); !errors.Is(err, context.Canceled) {
+		t.Errorf("Thumbnail = %v, want context.Canceled", err)
+	}
+
+	// The interpreter gives up soon after the context is done, not at maxOps
+	in := newInterp(ctx, doc, nil, identity)
+	in.run(doc.content(doc.pages(1)[0]), nil)
+	if in.ops > ctxCheckOps {
+		t.Errorf("ran %d operators after cancellation", in.ops)
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	data := onePage(strings.Repeat("0 0 1 1 re f\n", 200000))
+	doc, err := Open(context.Background(), data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	<-ctx.Done()
+	if _, err := doc.Thumbnail(ctx, 200); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Thumbnail = %v, want context.DeadlineExceeded", err)
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	text := "夏休み\n体験講座\n\nA short\nline\n\n" + strings.Repeat("あ", 30)
+	if got := Paragraphs(text); len(got) != 3 || got[0] != "夏休み体験講座" || got[1] != "A short line" {
+		t.Errorf("Paragraphs = %q", got)
+	}
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{7, "夏休み体験講座"},
+		{5, "夏休み体験…"},
+		{20, "夏休み体験講座\n\nA short line\n\n" + strings.Repeat("あ", 1) + "…"},
+		{0, ""},
+	}
+	for _, tt := range tests {
+		if got := Excerpt(text, tt.limit); got != tt.want {
+			t.Errorf("Excerpt(%d) = %q, want %q", tt.limit, got, tt.want)
+		}
+	}
+}
+
+func fuzzSeeds(f *testing.F) {
+	f.Add(onePage("BT /F1 12 Tf 10 70 Td (Hello) Tj ET"))
+	f.Add(onePage("0 0 0 rg 0 0 100 100 re f q 2 0 0 2 0 0 cm 1 0 0 RG 0 0 m 50 50 l S Q"))
+	f.Add(build("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [2 0 R] >>"))
+	f.Add(build("<< /Type /Catalog /Pages 2 0 R >>", "<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Contents 4 0 R >>", stream("/Filter /FlateDecode", deflate([]byte("BT (x) Tj ET")))))
+	f.Add([]byte("%PDF-1.5\n1 0 obj << /Type /ObjStm /N 2 /First 8 /Length 20 >> stream\n2 0 3 5 << >> [ ]\nendstream endobj"))
+	f.Add([]byte("%PDF-" + strings.Repeat("[", 200)))
+}
+
+func FuzzOpen(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := Open(context.Background(), data)
+		if (doc == nil) == (err == nil) {
+			t.Fatalf("Open = %v, %v", doc, err)
+		}
+	})
+}
+
+func FuzzText(f *testing.F) {
+	fuzzSeeds(f)
+	f.Fuzz(func(t *testing.T, data []byte) {
+		doc, err := Open(context.Background(), data)
+		if err != nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+		defer cancel()
+		doc.Text(ctx, 3)
+		doc.Thumbnail(ctx, 32)
+	})
+}
@@ -0,0 +1,89 @@
+package pdf
+
+import (
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// textBuilder puts shown strings together into lines and paragraphs by
+// where they are on the page. Strings are taken in content order, which
+// is reading order in almost every generated file.
+type textBuilder struct {
+	b       strings.Builder
+	last    point // where the previous string ended
+	lastY   float64
+	size    float64
+	started bool
+}
+
+func (t *textBuilder) add(s string, start, end point, size float64) {
+	if strings.TrimSpace(s) == "" && !t.started {
+		return
+	}
+	if t.started {
+		lineHeight := math.Max(math.Max(size, t.size), 1)
+		dy := math.Abs(start.y - t.lastY)
+		switch {
+		case dy > 1.8*lineHeight:
+			t.b.WriteString("\n\n")
+		case dy > 0.5*lineHeight, start.x < t.last.x-2*lineHeight:
+			t.b.WriteString("\n")
+		case start.x-t.last.x > 0.2*lineHeight && !strings.HasPrefix(s, " "):
+			t.b.WriteString(" ")
+		}
+	}
+	t.b.WriteString(s)
+	t.last, t.lastY, t.size, t.started = end, start.y, size, true
+}
+
+func (t *textBuilder) String() string {
+	return t.b.String()
+}
+
+// Paragraphs splits extracted text into paragraphs. The lines of a
+// paragraph are joined, without a space between Japanese characters.
+func Paragraphs(text string) []string {
+	var out []string
+	for _, para := range strings.Split(text, "\n\n") {
+		var b strings.Builder
+		for _, line := range strings.Split(para, "\n") {
+			line = strings.Join(strings.FieldsFunc(line, unicode.IsSpace), " ")
+			if line == "" {
+				continue
+			}
+			if b.Len() > 0 {
+				prev, _ := utf8.DecodeLastRuneInString(b.String())
+				next, _ := utf8.DecodeRuneInString(line)
+				if prev < utf8.RuneSelf || next < utf8.RuneSelf {
+					b.WriteByte(' ')
+				}
+			}
+			b.WriteString(line)
+		}
+		if b.Len() > 0 {
+			out = append(out, b.String())
+		}
+	}
+	return out
+}
+
+// Excerpt returns the first paragraphs of text, up to about limit
+// characters. A paragraph that doesn't fit is cut and ends with "…".
+func Excerpt(text string, limit int) string {
+	var out []string
+	left := limit
+	for _, p := range Paragraphs(text) {
+		if left <= 0 {
+			break
+		}
+		if r := []rune(p); len(r) > left {
+			out = append(out, strings.TrimSpace(string(r[:left]))+"…")
+			break
+		}
+		out = append(out, p)
+		left -= utf8.RuneCountInString(p)
+	}
+	return strings.Join(out, "\n\n")
+}
@@ -0,0 +1,104 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// Local keeps files in one directory on disk
+type Local struct {
+	dir string
+}
+
+// NewLocal uses dir, creating it if needed
+func NewLocal(dir string) (*Local, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &Local{dir: dir}, nil
+}
+
+func (s *Local) Put(name string, r io.Reader, contentType string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	// Written under a temporary name so a half-written file is never served
+	tmp, err := os.CreateTemp(s.dir, ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name()) // no-op after the rename
+
+	_, err = io.Copy(tmp, r)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0640)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filepath.Join(s.dir, name))
+}
+
+func (s *Local) Get(name string) (io.ReadCloser, Info, error) {
+	if err := checkName(name); err != nil {
+		return nil, Info{}, err
+	}
+	f, err := os.Open(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil, Info{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, Info{}, err
+	}
+	st, err := f.Stat()
+	if err != nil || !st.Mode().IsRegular() {
+		f.Close()
+		return nil, Info{}, ErrNotFound
+	}
+	// *os.File can seek, so callers may serve ranges
+	return f, Info{Name: name, Size: st.Size(), ModTime: st.ModTime()}, nil
+}
+
+func (s *Local) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	err := os.Remove(filepath.Join(s.dir, name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List returns the files of the directory; subdirectories and hidden
+// (temporary) files are skipped
+func (s *Local) List() ([]Info, error) {
+	entries, err := os.ReadDir(s.dir)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var list []Info
+	for _, e := range entries {
+		if !e.Type().IsRegular() || !ValidName(e.Name()) {
+			continue
+		}
+		st, err := e.Info()
+		if err != nil {
+			continue
+		}
+		list = append(list, Info{Name: e.Name(), Size: st.Size(), ModTime: st.ModTime()})
+	}
+	return list, nil
+}
+
+// URL is empty: local files are served by the application
+func (s *Local) URL(name string) string {
+	return ""
+}
@@ -0,0 +1,86 @@
+package storage
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Memory keeps files in process memory. They don't survive a restart, so
+// it's meant for tests and local experiments.
+type Memory struct {
+	mu    sync.Mutex
+	files map[string]memoryFile
+}
+
+type memoryFile struct {
+	data    []byte
+	modTime time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{files: make(map[string]memoryFile)}
+}
+
+func (s *Memory) Put(name string, r io.Reader, contentType string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[name] = memoryFile{data: data, modTime: time.Now()}
+	return nil
+}
+
+func (s *Memory) Get(name string) (io.ReadCloser, Info, error) {
+	if err := checkName(name); err != nil {
+		return nil, Info{}, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f, ok := s.files[name]
+	if !ok {
+		return nil, Info{}, ErrNotFound
+	}
+	// Put never changes a stored slice, so readers can share it
+	return memoryReader{bytes.NewReader(f.data)}, Info{Name: name, Size: int64(len(f.data)), ModTime: f.modTime}, nil
+}
+
+func (s *Memory) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.files, name)
+	return nil
+}
+
+func (s *Memory) List() ([]Info, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Info, 0, len(s.files))
+	for name, f := range s.files {
+		list = append(list, Info{Name: name, Size: int64(len(f.data)), ModTime: f.modTime})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+// URL is empty: files are served by the application
+func (s *Memory) URL(name string) string {
+	return ""
+}
+
+// memoryReader is a seekable ReadCloser over a stored file
+type memoryReader struct {
+	*bytes.Reader
+}
+
+func (memoryReader) Close() error { return nil }
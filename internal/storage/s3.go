@@ -0,0 +1,300 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures an S3-compatible bucket (AWS S3, MinIO, R2, ...)
+type S3Options struct {
+	Endpoint  string // e.g. "https://s3.ap-northeast-1.amazonaws.com" or "http://minio:9000"
+	Region    string // "us-east-1" if empty
+	Bucket    string
+	Prefix    string // prepended to every object key, e.g. "uploads/"
+	AccessKey string
+	SecretKey string
+	// PublicURL, if set, is where the objects can be read without signing
+	// (a public bucket or a CDN in front of it). Files are then redirected
+	// there instead of being streamed by the application.
+	PublicURL string
+	Client    *http.Client
+}
+
+// S3 keeps files as objects in a bucket. Requests use path-style URLs
+// (endpoint/bucket/key), which every S3-compatible server understands, and
+// are signed with AWS Signature Version 4.
+type S3 struct {
+	opt      S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+func NewS3(opt S3Options) (*S3, error) {
+	if opt.Endpoint == "" || opt.Bucket == "" || opt.AccessKey == "" || opt.SecretKey == "" {
+		return nil, errors.New("storage: S3_ENDPOINT, S3_BUCKET, S3_ACCESS_KEY_ID and S3_SECRET_ACCESS_KEY are required")
+	}
+	u, err := url.Parse(strings.TrimSuffix(opt.Endpoint, "/"))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("storage: invalid S3 endpoint %q", opt.Endpoint)
+	}
+	if opt.Region == "" {
+		opt.Region = "us-east-1"
+	}
+	client := opt.Client
+	if client == nil {
+		client = &http.Client{Timeout: 60 * time.Second}
+	}
+	return &S3{opt: opt, endpoint: u, client: client}, nil
+}
+
+func (s *S3) Put(name string, r io.Reader, contentType string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	// The signature covers the payload hash, so the body is read up front.
+	// Uploads are capped well below what that makes a problem.
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	resp, err := s.do(http.MethodPut, s.opt.Prefix+name, nil, header, body)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+func (s *S3) Get(name string) (io.ReadCloser, Info, error) {
+	if err := checkName(name); err != nil {
+		return nil, Info{}, err
+	}
+	resp, err := s.do(http.MethodGet, s.opt.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return nil, Info{}, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		resp.Body.Close()
+		return nil, Info{}, ErrNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, Info{}, s3Error(resp)
+	}
+	info := Info{Name: name, Size: resp.ContentLength}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return resp.Body, info, nil
+}
+
+func (s *S3) Delete(name string) error {
+	if err := checkName(name); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodDelete, s.opt.Prefix+name, nil, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	// S3 answers 204 whether or not the object existed; some servers say 404
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNotFound {
+		return s3Error(resp)
+	}
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response we use
+type listResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		Size         int64     `xml:"Size"`
+		LastModified time.Time `xml:"LastModified"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// List returns the objects under the prefix. Keys in "subdirectories" of
+// the prefix are skipped, as Local skips subdirectories.
+func (s *S3) List() ([]Info, error) {
+	var list []Info
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.opt.Prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return nil, err
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("storage: reading S3 object list: %w", err)
+		}
+		for _, c := range result.Contents {
+			name := strings.TrimPrefix(c.Key, s.opt.Prefix)
+			if ValidName(name) {
+				list = append(list, Info{Name: name, Size: c.Size, ModTime: c.LastModified})
+			}
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return list, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+func (s *S3) URL(name string) string {
+	if s.opt.PublicURL == "" || !ValidName(name) {
+		return ""
+	}
+	return strings.TrimSuffix(s.opt.PublicURL, "/") + "/" + url.PathEscape(name)
+}
+
+// do sends a signed request for key in the bucket (the bucket itself if
+// key is empty)
+func (s *S3) do(method, key string, query url.Values, header http.Header, body []byte) (*http.Response, error) {
+	u := *s.endpoint
+	segments := []string{s.opt.Bucket}
+	if key != "" {
+		segments = append(segments, strings.Split(key, "/")...)
+	}
+	base := strings.TrimSuffix(u.Path, "/")
+	u.Path = base + "/" + strings.Join(segments, "/")
+	// Every byte but A-Z a-z 0-9 - _ . ~ is escaped, as the signature expects
+	for i, seg := range segments {
+		segments[i] = awsEscape(seg)
+	}
+	u.RawPath = base + "/" + strings.Join(segments, "/")
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	s.sign(req, body, time.Now().UTC())
+	return s.client.Do(req)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	payloadHash := sha256Hex(body)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	// Host and the x-amz-* headers are signed; Content-Type too when sent
+	signed := []string{"host", "x-amz-content-sha256", "x-amz-date"}
+	if req.Header.Get("Content-Type") != "" {
+		signed = append(signed, "content-type")
+	}
+	sort.Strings(signed)
+	var canonicalHeaders strings.Builder
+	for _, h := range signed {
+		v := req.Header.Get(h)
+		if h == "host" {
+			v = req.URL.Host
+		}
+		canonicalHeaders.WriteString(h + ":" + strings.TrimSpace(v) + "\n")
+	}
+	signedHeaders := strings.Join(signed, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := day + "/" + s.opt.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + sha256Hex([]byte(canonicalRequest))
+
+	key := hmacSHA256([]byte("AWS4"+s.opt.SecretKey), day)
+	key = hmacSHA256(key, s.opt.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.opt.AccessKey, scope, signedHeaders, signature))
+}
+
+// canonicalQuery encodes query sorted by key with %20 for spaces, as
+// Signature Version 4 requires
+func canonicalQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			parts = append(parts, awsEscape(k)+"="+awsEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func awsEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3Error reads the error code S3 sends in the body of a failed request
+func s3Error(resp *http.Response) error {
+	var body struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(data, &body) == nil && body.Code != "" {
+		return fmt.Errorf("storage: S3 %s: %s: %s", resp.Status, body.Code, body.Message)
+	}
+	return fmt.Errorf("storage: S3 %s", resp.Status)
+}
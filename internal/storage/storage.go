@@ -0,0 +1,72 @@
+// Package storage keeps uploaded files (the syllabus PDFs) on local disk,
+// in S3-compatible object storage, or in memory for tests.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"example.com/myapp/internal/config"
+)
+
+var (
+	ErrNotFound    = errors.New("storage: file not found")
+	ErrInvalidName = errors.New("storage: invalid file name")
+)
+
+// Info describes a stored file
+type Info struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage keeps files under flat names such as "<sha256>.pdf"
+type Storage interface {
+	Put(name string, r io.Reader, contentType string) error
+	Get(name string) (io.ReadCloser, Info, error) // ErrNotFound if missing
+	Delete(name string) error                     // a missing file is not an error
+	List() ([]Info, error)
+	// URL is where a browser can fetch the file directly, or "" if the
+	// application has to serve it (see handlers.ServeUpload)
+	URL(name string) string
+}
+
+// ValidName reports whether name can only refer to a file at the top level
+// of a store: no directories, no hidden files
+func ValidName(name string) bool {
+	return name != "" && name == path.Base(name) && !strings.HasPrefix(name, ".") && !strings.Contains(name, `\`)
+}
+
+func checkName(name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	return nil
+}
+
+// Open returns the backend selected by cfg.Storage: "local" (the default),
+// "s3" or "memory"
+func Open(cfg config.Config) (Storage, error) {
+	switch cfg.Storage {
+	case "", "local":
+		return NewLocal(cfg.UploadDir)
+	case "s3":
+		return NewS3(S3Options{
+			Endpoint:  cfg.S3Endpoint,
+			Region:    cfg.S3Region,
+			Bucket:    cfg.S3Bucket,
+			Prefix:    cfg.S3Prefix,
+			AccessKey: cfg.S3AccessKey,
+			SecretKey: cfg.S3SecretKey,
+			PublicURL: cfg.S3PublicURL,
+		})
+	case "memory":
+		return NewMemory(), nil
+	}
+	return nil, fmt.Errorf("storage: unknown backend %q", cfg.Storage)
+}
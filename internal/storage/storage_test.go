@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testStorage checks the behaviour every backend must share. s starts empty.
+func testStorage(t *testing.T, s Storage) {
+	t.Helper()
+	put := func(name, data string) {
+		t.Helper()
+		if err := s.Put(name, strings.NewReader(data), "application/pdf"); err != nil {
+			t.Fatalf("Put(%q): %v", name, err)
+		}
+	}
+	get := func(name string) (string, Info, error) {
+		t.Helper()
+		rc, info, err := s.Get(name)
+		if err != nil {
+			return "", info, err
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(rc)
+		if err != nil {
+			t.Fatalf("reading %q: %v", name, err)
+		}
+		return string(data), info, nil
+	}
+	names := func() []string {
+		t.Helper()
+		list, err := s.List()
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		var out []string
+		for _, f := range list {
+			out = append(out, f.Name)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	if got := names(); len(got) != 0 {
+		t.Fatalf("new store lists %q", got)
+	}
+	if _, _, err := get("missing.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get of a missing file = %v, want ErrNotFound", err)
+	}
+
+	put("a.pdf", "%PDF-1.4 first")
+	put("b.png", "png")
+	put("a.pdf", "%PDF-1.4 second") // replaces
+	data, info, err := get("a.pdf")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if data != "%PDF-1.4 second" || info.Name != "a.pdf" || info.Size != int64(len(data)) || info.ModTime.IsZero() {
+		t.Errorf("Get = %q, %+v", data, info)
+	}
+	if got := names(); strings.Join(got, ",") != "a.pdf,b.png" {
+		t.Errorf("List = %q", got)
+	}
+	list, _ := s.List()
+	for _, f := range list {
+		if f.Name == "b.png" && f.Size != 3 {
+			t.Errorf("List size of b.png = %d", f.Size)
+		}
+	}
+
+	if err := s.Delete("a.pdf"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, _, err := get("a.pdf"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete("a.pdf"); err != nil {
+		t.Errorf("Delete of a missing file = %v", err)
+	}
+	if got := names(); strings.Join(got, ",") != "b.png" {
+		t.Errorf("List after Delete = %q", got)
+	}
+
+	for _, name := range []string{"", ".", "..", "../a.pdf", "sub/a.pdf", "/a.pdf", ".hidden", `..\a.pdf`, `a\b.pdf`} {
+		if err := s.Put(name, strings.NewReader("x"), ""); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Put(%q) = %v, want ErrInvalidName", name, err)
+		}
+		if _, _, err := s.Get(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Get(%q) = %v, want ErrInvalidName", name, err)
+		}
+		if err := s.Delete(name); !errors.Is(err, ErrInvalidName) {
+			t.Errorf("Delete(%q) = %v, want ErrInvalidName", name, err)
+		}
+		if u := s.URL(name); u != "" {
+			t.Errorf("URL(%q) = %q", name, u)
+		}
+	}
+	if got := names(); strings.Join(got, ",") != "b.png" {
+		t.Errorf("invalid names changed the store: %q", got)
+	}
+}
+
+func TestMemory(t *testing.T) {
+	testStorage(t, NewMemory())
+}
+
+func TestLocal(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "uploads")
+	s, err := NewLocal(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, s)
+
+	// Temporary files and subdirectories are not part of the store
+	os.WriteFile(filepath.Join(dir, ".upload-123"), []byte("partial"), 0640)
+	os.Mkdir(filepath.Join(dir, "sub"), 0750)
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].Name != "b.png" {
+		t.Errorf("List = %+v", list)
+	}
+	if _, _, err := s.Get("sub"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a directory = %v, want ErrNotFound", err)
+	}
+	if s.URL("b.png") != "" {
+		t.Error("local files have no direct URL")
+	}
+}
+
+func TestValidName(t *testing.T) {
+	for name, ok := range map[string]bool{
+		strings.Repeat("ab", 32) + ".pdf": true,
+		"syllabus_1735689201.pdf":         true,
+		"":                                false,
+		".":                               false,
+		"..":                              false,
+		".env":                            false,
+		"a/b":                             false,
+		`a\b`:                             false,
+	} {
+		if ValidName(name) != ok {
+			t.Errorf("ValidName(%q) = %v", name, !ok)
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
     "path/filepath"
     "os"
     "net/http"
+
+    "example.com/myapp/internal/markdown"
 )
 
 type Renderer struct {
@@ -15,7 +17,10 @@ type Renderer struct {
 
 func Load(dir string) *Renderer {
     // 1. Create a Base Template with functions (if needed)
-    tmpl := template.New("")
+    // csrfField is a placeholder here; Render swaps in the request's token
+    tmpl := template.New("").Funcs(csrfFuncs("")).Funcs(template.FuncMap{
+        "markdown": markdown.ToHTML, // class descriptions
+    })
     
     // 2. Walk the directory and parse ALL .html files (Recursive)
     // This finds web/templates/admin/admin_index.html AND web/templates/layout.html
@@ -36,20 +41,50 @@ func Load(dir string) *Renderer {
     return &Renderer{templates: tmpl}
 }
 
+// csrfTokener is implemented by the response writer handlers.CSRF passes down
+type csrfTokener interface {
+    CSRFToken() string
+}
+
+// csrfFuncs returns the template functions that embed the CSRF token in forms
+func csrfFuncs(token string) template.FuncMap {
+    return template.FuncMap{
+        "csrfField": func() template.HTML {
+            return template.HTML(`<input type="hidden" name="csrf_token" value="` + template.HTMLEscapeString(token) + `">`)
+        },
+        "csrfToken": func() string { return token },
+    }
+}
+
 func (t *Renderer) Render(w io.Writer, name string, data any) {
+    // 0. Bind this request's CSRF token. Functions can't be re-bound once a
+    // template set has executed, so the parsed set is never executed itself;
+    // each render works on a fresh clone.
+    token := ""
+    if tw, ok := w.(csrfTokener); ok {
+        token = tw.CSRFToken()
+    }
+    set, err := t.templates.Clone()
+    if err != nil {
+        log.Printf("Template Clone Error: %v", err)
+        http.Error(w.(http.ResponseWriter), "Template Error", http.StatusInternalServerError)
+        return
+    }
+    set.Funcs(csrfFuncs(token))
+
     // 1. SAFE LOOKUP
     // If the template is not found, Lookup returns nil.
-    tmpl := t.templates.Lookup(name)
+    tmpl := set.Lookup(name)
     if tmpl == nil {
         log.Printf("CRITICAL: Template '%s' not found!", name)
         // Log all available templates to help debug
-        log.Printf("Available templates: %s", t.templates.DefinedTemplates())
+        log.Printf("Available templates: %s", set.DefinedTemplates())
         http.Error(w.(http.ResponseWriter), "Template Missing: "+name, http.StatusInternalServerError)
         return
     }
 
     // 2. Execute
-    err := tmpl.Execute(w, data)
+    err = tmpl.Execute(w, data)
     if err != nil {
         log.Printf("Template Execution Error (%s): %v", name, err)
     }
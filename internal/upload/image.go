@@ -0,0 +1,117 @@
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"regexp"
+
+	"example.com/myapp/internal/storage"
+)
+
+// Limits of class images. Larger pictures are scaled down to MaxImageWidth.
+const (
+	MaxImageSize   = 5 << 20 // 5MB
+	MaxImageWidth  = 1200    // pixels
+	maxImagePixels = 40_000_000
+)
+
+var ErrNotImage = errors.New("file is not a JPEG or PNG image")
+
+var jpegMagic = []byte("\xff\xd8\xff")
+
+// imagePattern matches the names SaveImage and MakePreview produce
+var imagePattern = regexp.MustCompile(`^[0-9a-f]{64}\.(png|jpg)$`)
+
+// IsJPEG reports whether data starts like a JPEG file
+func IsJPEG(head []byte) bool {
+	return bytes.HasPrefix(head, jpegMagic)
+}
+
+// IsImageName reports whether name is a stored image: a class image or a
+// syllabus thumbnail
+func IsImageName(name string) bool {
+	return imagePattern.MatchString(name)
+}
+
+// SaveImage checks that r holds a JPEG or PNG of at most MaxImageSize
+// bytes and stores it as "<sha256>.jpg" or ".png". The picture is decoded
+// and encoded again, which drops metadata such as the GPS position of a
+// phone photo, and scaled down to MaxImageWidth.
+func SaveImage(store storage.Storage, r io.Reader) (string, error) {
+	data, err := io.ReadAll(io.LimitReader(r, MaxImageSize+1))
+	switch {
+	case err != nil:
+		return "", err
+	case len(data) == 0:
+		return "", ErrEmpty
+	case len(data) > MaxImageSize:
+		return "", ErrTooLarge
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png") {
+		return "", ErrNotImage
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+		return "", ErrNotImage
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrNotImage
+	}
+	if img.Bounds().Dx() > MaxImageWidth {
+		img = shrink(img, MaxImageWidth)
+	}
+
+	var buf bytes.Buffer
+	ext, contentType := ".png", "image/png"
+	if format == "jpeg" {
+		ext, contentType = ".jpg", "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 85})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(buf.Bytes())
+	name := hex.EncodeToString(sum[:]) + ext
+	return name, store.Put(name, &buf, contentType)
+}
+
+// shrink scales img down to width pixels, averaging the source pixels
+// that fall on each target pixel
+func shrink(img image.Image, width int) image.Image {
+	b := img.Bounds()
+	height := max(1, b.Dy()*width/b.Dx())
+	out := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/height, b.Min.Y+(y+1)*b.Dy()/height
+		for x := 0; x < width; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/width, b.Min.X+(x+1)*b.Dx()/width
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < max(y1, y0+1); sy++ {
+				for sx := x0; sx < max(x1, x0+1); sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a, n = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca), n+1
+				}
+			}
+			if a == 0 {
+				continue
+			}
+			// Averaged premultiplied values, back to straight alpha
+			out.SetNRGBA(x, y, color.NRGBA{
+				uint8(r * 0xff / a), uint8(g * 0xff / a), uint8(bl * 0xff / a), uint8(a / n >> 8),
+			})
+		}
+	}
+	return out
+}
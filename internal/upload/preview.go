@@ -0,0 +1,95 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"io"
+	"regexp"
+	"strings"
+
+	"example.com/myapp/internal/pdf"
+	"example.com/myapp/internal/storage"
+)
+
+// Size of syllabus previews
+const (
+	ThumbWidth    = 240 // pixels
+	ExcerptLength = 300 // characters
+	excerptPages  = 3   // the first page is often just a title
+)
+
+// pngMagic starts every PNG file
+var pngMagic = []byte("\x89PNG\r\n\x1a\n")
+
+// thumbPattern matches the names ThumbName produces
+var thumbPattern = regexp.MustCompile(`^[0-9a-f]{64}\.png$`)
+
+// IsPNG reports whether data starts like a PNG file
+func IsPNG(head []byte) bool {
+	return bytes.HasPrefix(head, pngMagic)
+}
+
+// IsThumbName reports whether name is a thumbnail MakePreview stores
+func IsThumbName(name string) bool {
+	return thumbPattern.MatchString(name)
+}
+
+// ThumbName is the name of a stored PDF's thumbnail: same hash, .png.
+// Files from before content hashing get none ("").
+func ThumbName(pdfName string) string {
+	if !IsStoredName(pdfName) {
+		return ""
+	}
+	return strings.TrimSuffix(pdfName, ".pdf") + ".png"
+}
+
+// Preview is what students see of a syllabus without opening it
+type Preview struct {
+	Thumb   string // stored PNG of the first page, or ""
+	Excerpt string // the first paragraphs, or ""
+}
+
+// MakePreview reads a stored PDF, stores a thumbnail of its first page and
+// extracts its opening text. Files we can't read (encrypted ones, say) give
+// an empty Preview and the reason. Parsing stops when ctx is done; the
+// excerpt found by then is kept, but no thumbnail is stored.
+func MakePreview(ctx context.Context, store storage.Storage, pdfName string) (Preview, error) {
+	var p Preview
+	rc, _, err := store.Get(pdfName)
+	if err != nil {
+		return p, err
+	}
+	data, err := io.ReadAll(io.LimitReader(rc, MaxPDFSize+1))
+	rc.Close()
+	if err != nil {
+		return p, err
+	}
+
+	doc, err := pdf.Open(ctx, data)
+	if err != nil {
+		return p, err
+	}
+	if text, err := doc.Text(ctx, excerptPages); err == nil {
+		p.Excerpt = pdf.Excerpt(text, ExcerptLength)
+	}
+
+	name := ThumbName(pdfName)
+	if name == "" {
+		return p, nil
+	}
+	img, err := doc.Thumbnail(ctx, ThumbWidth)
+	if err != nil {
+		return p, fmt.Errorf("thumbnail: %w", err)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return p, err
+	}
+	if err := store.Put(name, &buf, "image/png"); err != nil {
+		return p, err
+	}
+	p.Thumb = name
+	return p, nil
+}
@@ -0,0 +1,111 @@
+// Package upload stores syllabus PDFs. Files are checked by their content,
+// not by the name or type the browser sent, and stored under the SHA-256 of
+// their content, so names can't collide or be chosen by the uploader.
+package upload
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"io"
+	"regexp"
+	"strings"
+
+	"example.com/myapp/internal/storage"
+)
+
+// MaxPDFSize is the largest syllabus accepted
+const MaxPDFSize = 10 << 20 // 10MB
+
+var (
+	ErrNotPDF   = errors.New("file is not a PDF")
+	ErrTooLarge = errors.New("file is too large")
+	ErrEmpty    = errors.New("file is empty")
+)
+
+// pdfMagic starts every PDF file
+var pdfMagic = []byte("%PDF-")
+
+// namePattern matches the names SavePDF produces
+var namePattern = regexp.MustCompile(`^[0-9a-f]{64}\.pdf$`)
+
+// IsPDF reports whether data starts like a PDF file
+func IsPDF(head []byte) bool {
+	return bytes.HasPrefix(head, pdfMagic)
+}
+
+// IsStoredName reports whether name is a file name SavePDF produces
+func IsStoredName(name string) bool {
+	return namePattern.MatchString(name)
+}
+
+// IsSafeName reports whether name can only refer to a file at the top level
+// of the store. Files saved before content checks existed have other names
+// (e.g. "syllabus_1735689201.pdf") and are still accepted.
+func IsSafeName(name string) bool {
+	return storage.ValidName(name)
+}
+
+// SavePDF checks that r holds a PDF of at most MaxPDFSize bytes and puts it
+// in store as "<sha256>.pdf". Uploading the same file twice yields the same
+// name and one stored copy.
+func SavePDF(store storage.Storage, r io.Reader) (string, error) {
+	// One byte past the limit tells a too-large file from one of exactly MaxPDFSize
+	data, err := io.ReadAll(io.LimitReader(r, MaxPDFSize+1))
+	switch {
+	case err != nil:
+		return "", err
+	case len(data) == 0:
+		return "", ErrEmpty
+	case !IsPDF(data):
+		return "", ErrNotPDF
+	case len(data) > MaxPDFSize:
+		return "", ErrTooLarge
+	}
+
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:]) + ".pdf"
+	return name, store.Put(name, bytes.NewReader(data), "application/pdf")
+}
+
+// CheckStored applies the checks of SavePDF and SaveImage to a file that
+// is put back under its stored name, e.g. from a backup: a PDF must look
+// like one and a class image or thumbnail must decode as the format its
+// name says. Nothing else is ever stored.
+func CheckStored(name string, data []byte) error {
+	if len(data) == 0 {
+		return ErrEmpty
+	}
+	if IsImageName(name) {
+		if len(data) > MaxImageSize {
+			return ErrTooLarge
+		}
+		want := "png"
+		if strings.HasSuffix(name, ".jpg") {
+			want = "jpeg"
+		}
+		cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+		if err != nil || format != want || cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > maxImagePixels {
+			return ErrNotImage
+		}
+		return nil
+	}
+	switch {
+	case !IsSafeName(name) || !strings.HasSuffix(name, ".pdf") || !IsPDF(data):
+		return ErrNotPDF
+	case len(data) > MaxPDFSize:
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// Remove deletes a stored file. Unsafe names are ignored, as is a file that
+// is already gone.
+func Remove(store storage.Storage, name string) error {
+	if !IsSafeName(name) {
+		return nil
+	}
+	return store.Delete(name)
+}
@@ -0,0 +1,206 @@
+package upload
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"example.com/myapp/internal/storage"
+)
+
+const minimalPDF = "%PDF-1.4\n1 0 obj << /Type /Catalog >> endobj\ntrailer << /Root 1 0 R >>\n%%EOF\n"
+
+func TestSavePDF(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"pdf", []byte(minimalPDF), nil},
+		{"html named .pdf", []byte("<html><script>alert(1)</script></html>"), ErrNotPDF},
+		{"pdf magic not at the start", []byte(" %PDF-1.4"), ErrNotPDF},
+		{"png", pngBytes(t, 4, 4), ErrNotPDF},
+		{"empty", nil, ErrEmpty},
+		{"too large", append([]byte("%PDF-"), make([]byte, MaxPDFSize)...), ErrTooLarge},
+		{"exactly the limit", append([]byte("%PDF-"), make([]byte, MaxPDFSize-5)...), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemory()
+			name, err := SavePDF(store, bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			files, _ := store.List()
+			if tt.err != nil {
+				if name != "" || len(files) != 0 {
+					t.Fatalf("rejected file stored as %q (%d files)", name, len(files))
+				}
+				return
+			}
+			if !IsStoredName(name) || len(files) != 1 {
+				t.Fatalf("stored as %q (%d files)", name, len(files))
+			}
+		})
+	}
+}
+
+func TestSavePDFSameContentSameName(t *testing.T) {
+	store := storage.NewMemory()
+	a, _ := SavePDF(store, strings.NewReader(minimalPDF))
+	b, _ := SavePDF(store, strings.NewReader(minimalPDF))
+	c, _ := SavePDF(store, strings.NewReader(minimalPDF+" "))
+	if a != b || a == c {
+		t.Fatalf("names %q %q %q", a, b, c)
+	}
+}
+
+func TestSaveImage(t *testing.T) {
+	tests := []struct {
+		name  string
+		data  []byte
+		err   error
+		ext   string
+		width int
+	}{
+		{"png", pngBytes(t, 300, 200), nil, ".png", 300},
+		{"jpeg", jpegBytes(t, 300, 200), nil, ".jpg", 300},
+		{"wide png is shrunk", pngBytes(t, 2400, 100), nil, ".png", MaxImageWidth},
+		{"pdf named .png", []byte(minimalPDF), ErrNotImage, "", 0},
+		{"html named .jpg", []byte("<svg onload=alert(1)>"), ErrNotImage, "", 0},
+		{"png magic then garbage", append([]byte("\x89PNG\r\n\x1a\n"), 1, 2, 3), ErrNotImage, "", 0},
+		{"gif", []byte("GIF89a\x01\x00\x01\x00\x00\x00\x00;"), ErrNotImage, "", 0},
+		{"empty", nil, ErrEmpty, "", 0},
+		{"too large", make([]byte, MaxImageSize+1), ErrTooLarge, "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := storage.NewMemory()
+			name, err := SaveImage(store, bytes.NewReader(tt.data))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("err = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			if !IsImageName(name) || !strings.HasSuffix(name, tt.ext) {
+				t.Fatalf("stored as %q", name)
+			}
+			rc, _, err := store.Get(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer rc.Close()
+			data, _ := io.ReadAll(rc)
+			cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.width {
+				t.Fatalf("width = %d, want %d", cfg.Width, tt.width)
+			}
+		})
+	}
+}
+
+func TestNames(t *testing.T) {
+	hash := strings.Repeat("ab", 32)
+	tests := []struct {
+		name          string
+		stored, image bool
+	}{
+		{hash + ".pdf", true, false},
+		{hash + ".png", false, true},
+		{hash + ".jpg", false, true},
+		{hash + ".html", false, false},
+		{"../" + hash + ".pdf", false, false},
+		{"syllabus_1735689201.pdf", false, false},
+		{strings.ToUpper(hash) + ".pdf", false, false},
+	}
+	for _, tt := range tests {
+		if got := IsStoredName(tt.name); got != tt.stored {
+			t.Errorf("IsStoredName(%q) = %v", tt.name, got)
+		}
+		if got := IsImageName(tt.name); got != tt.image {
+			t.Errorf("IsImageName(%q) = %v", tt.name, got)
+		}
+	}
+	if got := ThumbName(hash + ".pdf"); got != hash+".png" {
+		t.Errorf("ThumbName = %q", got)
+	}
+	if got := ThumbName("syllabus_1735689201.pdf"); got != "" {
+		t.Errorf("ThumbName of a legacy name = %q", got)
+	}
+}
+
+func TestMakePreview(t *testing.T) {
+	const page = "%PDF-1.4\n" +
+		"1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj\n" +
+		"2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj\n" +
+		"3 0 obj << /Type /Page /MediaBox [0 0 200 100] /Contents 4 0 R /Resources << /Font << /F1 5 0 R >> >> >> endobj\n" +
+		"4 0 obj << /Length 38 >> stream\nBT /F1 12 Tf 10 70 Td (Syllabus) Tj ET\nendstream endobj\n" +
+		"5 0 obj << /Type /Font /Subtype /Type1 /BaseFont /Helvetica >> endobj\n" +
+		"trailer << /Root 1 0 R >>\n%%EOF\n"
+
+	store := storage.NewMemory()
+	name, err := SavePDF(store, strings.NewReader(page))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := MakePreview(context.Background(), store, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Excerpt != "Syllabus" || p.Thumb != ThumbName(name) {
+		t.Fatalf("preview = %+v", p)
+	}
+
+	// Out of time: no preview and nothing stored
+	store = storage.NewMemory()
+	name, _ = SavePDF(store, strings.NewReader(page))
+	ctx, cancel := context.WithTimeout(context.Background(), -time.Second)
+	defer cancel()
+	p, err = MakePreview(ctx, store, name)
+	if !errors.Is(err, context.DeadlineExceeded) || p != (Preview{}) {
+		t.Fatalf("MakePreview = %+v, %v; want an empty preview and DeadlineExceeded", p, err)
+	}
+	if files, _ := store.List(); len(files) != 1 {
+		t.Errorf("%d files stored, want only the PDF", len(files))
+	}
+}
+
+func testImage(w, h int) image.Image {
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, color.NRGBA{uint8(x), uint8(y), 128, 255})
+		}
+	}
+	return img
+}
+
+func pngBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := png.Encode(&b, testImage(w, h)); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func jpegBytes(t *testing.T, w, h int) []byte {
+	t.Helper()
+	var b bytes.Buffer
+	if err := jpeg.Encode(&b, testImage(w, h), nil); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
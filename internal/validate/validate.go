@@ -0,0 +1,188 @@
+// Package validate checks form input and collects one Japanese message per
+// field, so a form can be shown again with the message next to each input.
+package validate
+
+import (
+	"fmt"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Input layouts of the HTML inputs
+const (
+	DateLayout     = "2006-01-02"       // <input type="date">
+	TimeLayout     = "15:04"            // <input type="time">
+	DateTimeLayout = "2006-01-02T15:04" // <input type="datetime-local">
+)
+
+// Password policy shared by signup and password reset. bcrypt only looks
+// at the first 72 bytes, so longer passwords are refused rather than
+// silently cut.
+const (
+	MinPasswordLength = 8
+	MaxPasswordBytes  = 72
+)
+
+// Errors maps a form field name to the message shown next to it.
+// A nil Errors is valid and empty.
+type Errors map[string]string
+
+// Add records a message for a field. The first message of a field wins,
+// since it is usually the most basic problem (e.g. "required").
+func (e Errors) Add(field, msg string) {
+	if _, ok := e[field]; !ok {
+		e[field] = msg
+	}
+}
+
+// Has reports whether a field already has a message
+func (e Errors) Has(field string) bool {
+	_, ok := e[field]
+	return ok
+}
+
+// OK reports whether no messages were recorded
+func (e Errors) OK() bool {
+	return len(e) == 0
+}
+
+// Required returns the trimmed value and records a message if it is empty
+func (e Errors) Required(field, value, label string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		e.Add(field, label+"を入力してください")
+	}
+	return value
+}
+
+// MaxLength records a message if value is longer than max characters
+func (e Errors) MaxLength(field, value string, max int, label string) {
+	if utf8.RuneCountInString(value) > max {
+		e.Add(field, fmt.Sprintf("%sは%d文字以内で入力してください", label, max))
+	}
+}
+
+// PositiveInt parses a required whole number of at least 1
+func (e Errors) PositiveInt(field, value, label string) int {
+	value = e.Required(field, value, label)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		e.Add(field, label+"には1以上の数値を入力してください")
+		return 0
+	}
+	return n
+}
+
+// Time parses a required value with layout in loc. The zero time is
+// returned (with a message) if it is missing or malformed.
+func (e Errors) Time(field, value, layout string, loc *time.Location, label string) time.Time {
+	value = e.Required(field, value, label)
+	if value == "" {
+		return time.Time{}
+	}
+	t, err := time.ParseInLocation(layout, value, loc)
+	if err != nil {
+		e.Add(field, label+"の形式が正しくありません")
+		return time.Time{}
+	}
+	return t
+}
+
+// After records msg on field unless end is after start. It is skipped when
+// either time is zero, since that problem was already reported.
+func (e Errors) After(field string, start, end time.Time, msg string) {
+	if start.IsZero() || end.IsZero() {
+		return
+	}
+	if !end.After(start) {
+		e.Add(field, msg)
+	}
+}
+
+// IntRange parses a required whole number between min and max
+func (e Errors) IntRange(field, value string, min, max int, label string) int {
+	value = e.Required(field, value, label)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		e.Add(field, fmt.Sprintf("%sには%d〜%dの数値を入力してください", label, min, max))
+		return 0
+	}
+	return n
+}
+
+// OneOf records a message unless value is one of allowed
+func (e Errors) OneOf(field, value string, allowed []string, label string) {
+	for _, a := range allowed {
+		if value == a {
+			return
+		}
+	}
+	e.Add(field, label+"を選択してください")
+}
+
+// Email returns the trimmed address and records a message unless it is a
+// plain address such as "taro@example.com" (no display name)
+func (e Errors) Email(field, value, label string) string {
+	value = e.Required(field, value, label)
+	if value == "" {
+		return ""
+	}
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value || !strings.Contains(value[strings.LastIndex(value, "@"):], ".") {
+		e.Add(field, "有効な"+label+"を入力してください")
+	}
+	return value
+}
+
+// Kana records a message unless value is written in hiragana or katakana
+// (spaces and the long vowel mark allowed), as furigana should be
+func (e Errors) Kana(field, value, label string) {
+	for _, r := range value {
+		if !unicode.In(r, unicode.Hiragana, unicode.Katakana) && r != 'ー' && r != ' ' && r != '　' {
+			e.Add(field, label+"はひらがなまたはカタカナで入力してください")
+			return
+		}
+	}
+}
+
+// Phone records a message unless value is a Japanese phone number:
+// 10 or 11 digits starting with 0, hyphens allowed
+func (e Errors) Phone(field, value, label string) {
+	digits := 0
+	for _, r := range value {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case r == '-':
+		default:
+			e.Add(field, label+"は半角数字とハイフンで入力してください")
+			return
+		}
+	}
+	if digits < 10 || digits > 11 || !strings.HasPrefix(value, "0") {
+		e.Add(field, label+"は0から始まる10桁または11桁で入力してください")
+	}
+}
+
+// Password records a message unless value is MinPasswordLength to
+// MaxPasswordBytes bytes long and has both letters and digits
+func (e Errors) Password(field, value string) {
+	switch {
+	case len(value) < MinPasswordLength:
+		e.Add(field, fmt.Sprintf("パスワードは%d文字以上で入力してください", MinPasswordLength))
+	case len(value) > MaxPasswordBytes:
+		e.Add(field, "パスワードが長すぎます")
+	case !strings.ContainsAny(value, "0123456789") || !strings.ContainsFunc(value, unicode.IsLetter):
+		e.Add(field, "パスワードには英字と数字の両方を含めてください")
+	}
+}
@@ -0,0 +1,245 @@
+package validate
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestErrors(t *testing.T) {
+	var nilErrs Errors
+	if !nilErrs.OK() || nilErrs.Has("x") {
+		t.Error("nil Errors should be empty")
+	}
+
+	e := Errors{}
+	e.Add("name", "first")
+	e.Add("name", "second")
+	if e["name"] != "first" {
+		t.Errorf("the first message should win, got %q", e["name"])
+	}
+	if !e.Has("name") || e.Has("other") || e.OK() {
+		t.Errorf("Has/OK wrong for %v", e)
+	}
+}
+
+func TestRequired(t *testing.T) {
+	tests := []struct {
+		value, want, msg string
+	}{
+		{"", "", "氏名を入力してください"},
+		{"  \t ", "", "氏名を入力してください"},
+		{"　", "", "氏名を入力してください"}, // a full-width space is blank too
+		{" 高専 太郎 ", "高専 太郎", ""},
+	}
+	for _, tt := range tests {
+		e := Errors{}
+		got := e.Required("name", tt.value, "氏名")
+		if got != tt.want || e["name"] != tt.msg {
+			t.Errorf("Required(%q) = %q, %q; want %q, %q", tt.value, got, e["name"], tt.want, tt.msg)
+		}
+	}
+}
+
+func TestMaxLength(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"", true},
+		{strings.Repeat("あ", 10), true}, // counted in characters, not bytes
+		{strings.Repeat("あ", 11), false},
+		{strings.Repeat("a", 10), true},
+		{strings.Repeat("a", 11), false},
+	}
+	for _, tt := range tests {
+		e := Errors{}
+		e.MaxLength("school", tt.value, 10, "中学校名")
+		if e.OK() != tt.ok {
+			t.Errorf("MaxLength(%q) ok = %v, want %v", tt.value, e.OK(), tt.ok)
+		}
+		if !tt.ok && e["school"] != "中学校名は10文字以内で入力してください" {
+			t.Errorf("message = %q", e["school"])
+		}
+	}
+}
+
+func TestNumbers(t *testing.T) {
+	tests := []struct {
+		name  string
+		check func(Errors) int
+		want  int
+		msg   string
+	}{
+		{"positive", func(e Errors) int { return e.PositiveInt("f", "12", "定員") }, 12, ""},
+		{"positive zero", func(e Errors) int { return e.PositiveInt("f", "0", "定員") }, 0, "定員には1以上の数値を入力してください"},
+		{"positive text", func(e Errors) int { return e.PositiveInt("f", "十", "定員") }, 0, "定員には1以上の数値を入力してください"},
+		{"positive empty", func(e Errors) int { return e.PositiveInt("f", "", "定員") }, 0, "定員を入力してください"},
+		{"range low", func(e Errors) int { return e.IntRange("f", "0", 0, 2, "人数") }, 0, ""},
+		{"range high", func(e Errors) int { return e.IntRange("f", "2", 0, 2, "人数") }, 2, ""},
+		{"range over", func(e Errors) int { return e.IntRange("f", "3", 0, 2, "人数") }, 0, "人数には0〜2の数値を入力してください"},
+		{"range negative", func(e Errors) int { return e.IntRange("f", "-1", 0, 2, "人数") }, 0, "人数には0〜2の数値を入力してください"},
+		{"range full-width digit", func(e Errors) int { return e.IntRange("f", "１", 0, 2, "人数") }, 0, "人数には0〜2の数値を入力してください"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := Errors{}
+			if got := tt.check(e); got != tt.want || e["f"] != tt.msg {
+				t.Errorf("got %d, %q; want %d, %q", got, e["f"], tt.want, tt.msg)
+			}
+		})
+	}
+}
+
+func TestTimeAndAfter(t *testing.T) {
+	jst := time.FixedZone("JST", 9*60*60)
+	e := Errors{}
+	start := e.Time("start", "2025-08-01T10:00", DateTimeLayout, jst, "開始")
+	end := e.Time("end", "2025-08-01T09:00", DateTimeLayout, jst, "終了")
+	bad := e.Time("bad", "2025/08/01", DateLayout, jst, "日付")
+	missing := e.Time("missing", "", TimeLayout, jst, "時刻")
+	e.After("end", start, end, "終了は開始より後にしてください")
+	e.After("none", start, missing, "should be skipped")
+
+	if !start.Equal(time.Date(2025, 8, 1, 1, 0, 0, 0, time.UTC)) {
+		t.Errorf("start = %v, parsed in the wrong zone", start)
+	}
+	if !bad.IsZero() || !missing.IsZero() {
+		t.Error("invalid times should be zero")
+	}
+	want := map[string]string{
+		"end":     "終了は開始より後にしてください",
+		"bad":     "日付の形式が正しくありません",
+		"missing": "時刻を入力してください",
+	}
+	if len(e) != len(want) {
+		t.Errorf("errors = %v", e)
+	}
+	for f, msg := range want {
+		if e[f] != msg {
+			t.Errorf("%s = %q, want %q", f, e[f], msg)
+		}
+	}
+
+	// Equal times are not "after"
+	e = Errors{}
+	e.After("end", start, start, "x")
+	if e.OK() {
+		t.Error("equal start and end accepted")
+	}
+}
+
+func TestOneOf(t *testing.T) {
+	e := Errors{}
+	e.OneOf("grade", "2", []string{"1", "2", "3"}, "学年")
+	e.OneOf("other", "4", []string{"1", "2", "3"}, "学年")
+	e.OneOf("empty", "", []string{"1", "2", "3"}, "学年")
+	if e.Has("grade") || e["other"] != "学年を選択してください" || e["empty"] != "学年を選択してください" {
+		t.Errorf("errors = %v", e)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := []struct {
+		value, msg string
+	}{
+		{"taro@example.com", ""},
+		{" taro@example.com ", ""},
+		{"", "メールアドレスを入力してください"},
+		{"taro", "有効なメールアドレスを入力してください"},
+		{"taro@localhost", "有効なメールアドレスを入力してください"},
+		{"Taro <taro@example.com>", "有効なメールアドレスを入力してください"},
+		{"taro@example.com, jiro@example.com", "有効なメールアドレスを入力してください"},
+	}
+	for _, tt := range tests {
+		e := Errors{}
+		got := e.Email("email", tt.value, "メールアドレス")
+		if e["email"] != tt.msg {
+			t.Errorf("Email(%q) message = %q, want %q", tt.value, e["email"], tt.msg)
+		}
+		if got != strings.TrimSpace(tt.value) {
+			t.Errorf("Email(%q) = %q", tt.value, got)
+		}
+	}
+}
+
+func TestKana(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"", true},
+		{"こうせん たろう", true},
+		{"コウセン　タロウ", true},
+		{"らーめん", true},
+		{"高専 太郎", false},
+		{"kosen taro", false},
+		{"ｺｳｾﾝ", true}, // half-width katakana is still katakana
+		{"コウセン1", false},
+	}
+	for _, tt := range tests {
+		e := Errors{}
+		e.Kana("kana", tt.value, "ふりがな")
+		if e.OK() != tt.ok {
+			t.Errorf("Kana(%q) ok = %v, want %v", tt.value, e.OK(), tt.ok)
+		}
+		if !tt.ok && e["kana"] != "ふりがなはひらがなまたはカタカナで入力してください" {
+			t.Errorf("message = %q", e["kana"])
+		}
+	}
+}
+
+func TestPhone(t *testing.T) {
+	const (
+		chars  = "電話番号は半角数字とハイフンで入力してください"
+		digits = "電話番号は0から始まる10桁または11桁で入力してください"
+	)
+	tests := []struct {
+		value, msg string
+	}{
+		{"090-1234-5678", ""},
+		{"0312345678", ""},
+		{"03-1234-5678", ""},
+		{"０９０１２３４５６７８", chars}, // full-width digits
+		{"090 1234 5678", chars},
+		{"+81-90-1234-5678", chars},
+		{"123456789", digits},
+		{"1234567890", digits},
+		{"090-1234-56789", digits},
+	}
+	for _, tt := range tests {
+		e := Errors{}
+		e.Phone("phone", tt.value, "電話番号")
+		if e["phone"] != tt.msg {
+			t.Errorf("Phone(%q) = %q, want %q", tt.value, e["phone"], tt.msg)
+		}
+	}
+}
+
+func TestPassword(t *testing.T) {
+	const (
+		short = "パスワードは8文字以上で入力してください"
+		long  = "パスワードが長すぎます"
+		mixed = "パスワードには英字と数字の両方を含めてください"
+	)
+	tests := []struct {
+		value, msg string
+	}{
+		{"", short},
+		{"abc1234", short},
+		{"abcd1234", ""},
+		{strings.Repeat("a1", 36), ""}, // exactly 72 bytes
+		{strings.Repeat("a1", 36) + "b", long},
+		{"abcdefgh", mixed},
+		{"12345678", mixed},
+		{"パスワード12", ""},                       // Japanese letters count as letters; 17 bytes
+		{strings.Repeat("あ", 24) + "1", long}, // 25 characters but 73 bytes
+	}
+	for _, tt := range tests {
+		e := Errors{}
+		e.Password("password", tt.value)
+		if e["password"] != tt.msg {
+			t.Errorf("Password(%q) = %q, want %q", tt.value, e["password"], tt.msg)
+		}
+	}
+}